@@ -0,0 +1,281 @@
+package compressor
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+const archiveDirPerm = 0o750
+
+func (c *runState) validateArchiveFlags() error {
+	if !c.archive {
+		return nil
+	}
+
+	if c.action != ActionCompress && c.action != ActionDecompress {
+		return fmt.Errorf("archive can only be used with %q and %q actions", ActionCompress, ActionDecompress)
+	}
+
+	if c.recursive {
+		return fmt.Errorf("archive can't be used together with recursive flag, as directories are archived anyway")
+	}
+
+	return nil
+}
+
+// openArchiveInput returns reader producing tar archive of given files and directories. Archive is written
+// in the background, so it does not need to fit in memory.
+func (c *runState) openArchiveInput(paths []string) (io.ReadCloser, error) {
+	if err := checkArchiveInputs(paths); err != nil {
+		return nil, err
+	}
+
+	// Original name and modification time would describe only one of archived files.
+	c.inputInfo = nil
+
+	reader, writer := io.Pipe()
+
+	go func() {
+		//nolint:errcheck // Closing pipe always returns nil.
+		writer.CloseWithError(writeArchive(writer, paths))
+	}()
+
+	return reader, nil
+}
+
+// checkArchiveInputs ensures, that paths to archive are given and exist, so errors are reported before any
+// output is written.
+func checkArchiveInputs(paths []string) error {
+	if len(paths) == 0 {
+		return fmt.Errorf("input path must be given")
+	}
+
+	for _, path := range paths {
+		if _, err := os.Stat(path); err != nil {
+			return fmt.Errorf("reading input %q information: %w", path, err)
+		}
+	}
+
+	return nil
+}
+
+// writeArchive writes tar archive of given files and directories into given writer.
+func writeArchive(w io.Writer, paths []string) error {
+	archive := tar.NewWriter(w)
+
+	if err := walkArchiveInputs(paths, func(path, name string, info fs.FileInfo) error {
+		return writeArchiveEntry(archive, path, name, info)
+	}); err != nil {
+		return err
+	}
+
+	if err := archive.Close(); err != nil {
+		return fmt.Errorf("closing archive: %w", err)
+	}
+
+	return nil
+}
+
+// walkArchiveInputs calls given function for every file and directory found in given paths. Entries are named
+// relative to the parent directory of each given path, like tar does, using forward slashes. Directory names
+// end with a slash. Only regular files and directories are supported.
+func walkArchiveInputs(paths []string, fn func(path, name string, info fs.FileInfo) error) error {
+	for _, root := range paths {
+		root = filepath.Clean(root)
+
+		if err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+
+			info, err := entry.Info()
+			if err != nil {
+				return fmt.Errorf("reading %q information: %w", path, err)
+			}
+
+			if !info.Mode().IsRegular() && !info.IsDir() {
+				return fmt.Errorf("unsupported type of file %q", path)
+			}
+
+			name, err := filepath.Rel(filepath.Dir(root), path)
+			if err != nil {
+				return fmt.Errorf("getting archive name of %q: %w", path, err)
+			}
+
+			name = filepath.ToSlash(name)
+
+			if info.IsDir() {
+				name += "/"
+			}
+
+			return fn(path, name, info)
+		}); err != nil {
+			return fmt.Errorf("archiving %q: %w", root, err)
+		}
+	}
+
+	return nil
+}
+
+func writeArchiveEntry(archive *tar.Writer, path, name string, info fs.FileInfo) error {
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return fmt.Errorf("creating header for %q: %w", path, err)
+	}
+
+	header.Name = name
+
+	if err := archive.WriteHeader(header); err != nil {
+		return fmt.Errorf("writing header for %q: %w", path, err)
+	}
+
+	if info.IsDir() {
+		return nil
+	}
+
+	return copyFileInto(archive, path)
+}
+
+// copyFileInto writes content of file with given path into given writer.
+func copyFileInto(w io.Writer, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("opening %q: %w", path, err)
+	}
+
+	//nolint:errcheck // File is only read, so closing errors can be ignored.
+	defer file.Close()
+
+	if _, err := io.Copy(w, file); err != nil {
+		return fmt.Errorf("archiving content of %q: %w", path, err)
+	}
+
+	return nil
+}
+
+// openArchiveOutput returns writer extracting written tar archive into directory with given path.
+func openArchiveOutput(path string) (io.Writer, finishOutputFunc, error) {
+	if path == "" {
+		return nil, nil, fmt.Errorf("output directory must be given")
+	}
+
+	if err := os.MkdirAll(path, archiveDirPerm); err != nil {
+		return nil, nil, fmt.Errorf("creating output directory %q: %w", path, err)
+	}
+
+	reader, writer := io.Pipe()
+	extractErrCh := make(chan error, 1)
+
+	go func() {
+		err := extractArchive(reader, path)
+
+		// Unblock writer if extraction fails before all data is written.
+		//
+		//nolint:errcheck // Closing pipe always returns nil.
+		reader.CloseWithError(err)
+
+		extractErrCh <- err
+	}()
+
+	return writer, func(actionErr error) error {
+		//nolint:errcheck // Closing pipe always returns nil.
+		writer.CloseWithError(actionErr)
+
+		if err := <-extractErrCh; err != nil {
+			return fmt.Errorf("extracting archive: %w", err)
+		}
+
+		return nil
+	}, nil
+}
+
+// extractArchive extracts tar archive from given reader into given directory. Only regular files and
+// directories are supported.
+func extractArchive(r io.Reader, dir string) error {
+	archive := tar.NewReader(r)
+
+	for {
+		header, err := archive.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return fmt.Errorf("reading archive: %w", err)
+		}
+
+		if err := extractArchiveEntry(archive, header, dir); err != nil {
+			return err
+		}
+	}
+
+	// Consume padding after the end of the archive, so writer does not block.
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		return fmt.Errorf("reading archive padding: %w", err)
+	}
+
+	return nil
+}
+
+func extractArchiveEntry(archive io.Reader, header *tar.Header, dir string) error {
+	path, err := archiveEntryPath(dir, header.Name)
+	if err != nil {
+		return err
+	}
+
+	switch header.Typeflag {
+	case tar.TypeDir:
+		if err := os.MkdirAll(path, archiveDirPerm); err != nil {
+			return fmt.Errorf("creating directory %q: %w", path, err)
+		}
+
+		return nil
+	case tar.TypeReg:
+		return extractFile(archive, path, header.FileInfo().Mode().Perm())
+	default:
+		return fmt.Errorf("unsupported type of archive entry %q", header.Name)
+	}
+}
+
+// archiveEntryPath returns path where archive entry with given name should be extracted into given directory.
+func archiveEntryPath(dir, name string) (string, error) {
+	localName := filepath.FromSlash(name)
+
+	// Do not allow archive to write outside of the output directory.
+	if filepath.IsAbs(localName) || !filepath.IsLocal(localName) {
+		return "", fmt.Errorf("archive entry %q points outside of output directory", name)
+	}
+
+	return filepath.Join(dir, localName), nil
+}
+
+// extractFile writes data from given reader into file with given path and permissions, creating parent
+// directories if needed.
+func extractFile(r io.Reader, path string, perm fs.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), archiveDirPerm); err != nil {
+		return fmt.Errorf("creating directory for %q: %w", path, err)
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return fmt.Errorf("creating %q: %w", path, err)
+	}
+
+	if _, err := io.Copy(file, r); err != nil {
+		//nolint:errcheck // We already return an error.
+		file.Close()
+
+		return fmt.Errorf("extracting %q: %w", path, err)
+	}
+
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("closing %q: %w", path, err)
+	}
+
+	return nil
+}
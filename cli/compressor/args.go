@@ -0,0 +1,131 @@
+package compressor
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	argsFileFlag = "args-file"
+	// argsFilePrefix is a shorthand for --args-file flag, following curl convention, e.g. @/path/to/args.
+	argsFilePrefix = "@"
+)
+
+// expandArgs returns given arguments with arguments loaded from files given using --args-file flag or @ prefix
+// prepended, so arguments given directly take precedence over ones loaded from files. Arguments given after
+// end of flags separator in a file are added to positional arguments instead, so the separator does not turn
+// arguments given directly into positional ones. Flag values are never expanded, even if they start with @.
+func (c *runState) expandArgs(args []string) ([]string, error) {
+	flags := c.flagsByName()
+	fileArgs := []string{}
+	directArgs := []string{}
+	positionalArgs := []string{}
+	directPositionalArgs := []string{}
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+
+		if arg == endOfFlags {
+			directPositionalArgs = args[i+1:]
+
+			break
+		}
+
+		if takesSeparateValue(flags, arg) && i+1 < len(args) {
+			directArgs = append(directArgs, arg, args[i+1])
+			i++
+
+			continue
+		}
+
+		path, consumed, err := argsFilePath(args[i:])
+		if err != nil {
+			return nil, err
+		}
+
+		if consumed == 0 {
+			directArgs = append(directArgs, arg)
+
+			continue
+		}
+
+		i += consumed - 1
+
+		loadedArgs, err := c.readArgsFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		loadedArgs, loadedPositionalArgs := splitPositionalArgs(loadedArgs)
+
+		fileArgs = append(fileArgs, loadedArgs...)
+		positionalArgs = append(positionalArgs, loadedPositionalArgs...)
+	}
+
+	fileArgs = append(fileArgs, directArgs...)
+	positionalArgs = append(positionalArgs, directPositionalArgs...)
+
+	if len(positionalArgs) == 0 {
+		return fileArgs, nil
+	}
+
+	return append(append(fileArgs, endOfFlags), positionalArgs...), nil
+}
+
+// argsFilePath returns path to arguments file if first of given arguments refers to one, together with number
+// of arguments used to specify it, which is zero if arguments file is not specified.
+func argsFilePath(args []string) (string, int, error) {
+	arg := args[0]
+
+	if strings.HasPrefix(arg, argsFilePrefix) {
+		return strings.TrimPrefix(arg, argsFilePrefix), 1, nil
+	}
+
+	if !strings.HasPrefix(arg, "-") {
+		return "", 0, nil
+	}
+
+	name, path, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+	if name != argsFileFlag {
+		return "", 0, nil
+	}
+
+	if hasValue {
+		return path, 1, nil
+	}
+
+	if len(args) < 2 {
+		return "", 0, fmt.Errorf("flag needs an argument: --%s", argsFileFlag)
+	}
+
+	return args[1], 2, nil
+}
+
+// splitPositionalArgs splits given arguments at end of flags separator, dropping the separator.
+func splitPositionalArgs(args []string) ([]string, []string) {
+	for i, arg := range args {
+		if arg == endOfFlags {
+			return args[:i], args[i+1:]
+		}
+	}
+
+	return args, nil
+}
+
+// readArgsFile reads arguments from given file, one per line. Empty lines are ignored.
+func (c *runState) readArgsFile(path string) ([]string, error) {
+	content, err := c.fsReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading arguments file %q: %w", path, err)
+	}
+
+	args := []string{}
+
+	for _, line := range strings.Split(string(content), "\n") {
+		if line = strings.TrimSuffix(line, "\r"); line != "" {
+			args = append(args, line)
+		}
+	}
+
+	return args, nil
+}
@@ -0,0 +1,171 @@
+package compressor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/invidian/golang-cli-testing-example/pkg/compressor"
+)
+
+const (
+	// DefaultBenchmarkDuration is used by benchmark action when neither duration nor size is specified.
+	DefaultBenchmarkDuration = time.Second
+
+	bytesInMegabyte = 1000 * 1000
+)
+
+// BenchmarkResult ...
+type BenchmarkResult struct {
+	InputBytes       int64         `json:"inputBytes"`
+	OutputBytes      int64         `json:"outputBytes"`
+	Duration         time.Duration `json:"duration"`
+	Throughput       float64       `json:"throughputMBps"`
+	CompressionRatio float64       `json:"compressionRatio"`
+}
+
+// zeroReader produces zero bytes until deadline passes or until given number of bytes is produced.
+type zeroReader struct {
+	deadline  time.Time
+	remaining int64
+	limited   bool
+}
+
+func (z *zeroReader) Read(b []byte) (int, error) {
+	if !z.deadline.IsZero() && !time.Now().Before(z.deadline) {
+		return 0, io.EOF
+	}
+
+	if z.limited {
+		if z.remaining == 0 {
+			return 0, io.EOF
+		}
+
+		if int64(len(b)) > z.remaining {
+			b = b[:z.remaining]
+		}
+
+		z.remaining -= int64(len(b))
+	}
+
+	for i := range b {
+		b[i] = 0
+	}
+
+	return len(b), nil
+}
+
+func (c *runState) newZeroReader() (*zeroReader, error) {
+	reader := &zeroReader{}
+
+	if c.benchmarkSize != "" {
+		size, err := parseBytes(c.benchmarkSize)
+		if err != nil {
+			return nil, fmt.Errorf("parsing size: %w", err)
+		}
+
+		reader.remaining = size
+		reader.limited = true
+	}
+
+	duration := time.Duration(0)
+
+	if c.benchmarkDuration != "" {
+		var err error
+
+		if duration, err = time.ParseDuration(c.benchmarkDuration); err != nil {
+			return nil, fmt.Errorf("parsing duration: %w", err)
+		}
+
+		if duration <= 0 {
+			return nil, fmt.Errorf("duration must be positive, got %v", duration)
+		}
+	}
+
+	if duration == 0 && !reader.limited {
+		duration = DefaultBenchmarkDuration
+	}
+
+	if duration != 0 {
+		reader.deadline = time.Now().Add(duration)
+	}
+
+	return reader, nil
+}
+
+// runBenchmark compresses zero bytes and reports compression throughput and ratio, so formats can be compared
+// without external tools.
+func (c *runState) runBenchmark(ctx context.Context) error {
+	if err := c.readConfig(); err != nil {
+		return fmt.Errorf("reading configuration: %w", err)
+	}
+
+	ctx, cancel, err := c.withTimeout(ctx)
+	if err != nil {
+		return fmt.Errorf("applying timeout: %w", err)
+	}
+
+	defer cancel()
+
+	client, err := compressor.NewClient(compressor.Config{Format: compressor.Format(c.format)})
+	if err != nil {
+		return fmt.Errorf("creating compressor client: %w", err)
+	}
+
+	input, err := c.newZeroReader()
+	if err != nil {
+		return fmt.Errorf("preparing input: %w", err)
+	}
+
+	var inputBytes int64
+
+	start := time.Now()
+
+	output, errCh := client.Compress(ctx, io.NopCloser(&progressReader{reader: input, counter: &inputBytes}))
+
+	outputBytes, err := io.Copy(io.Discard, output)
+	if err != nil {
+		return fmt.Errorf("reading compressed data: %w", err)
+	}
+
+	if err := <-errCh; err != nil {
+		return fmt.Errorf("compressing data: %w", err)
+	}
+
+	return c.printBenchmarkResult(newBenchmarkResult(inputBytes, outputBytes, time.Since(start)))
+}
+
+func newBenchmarkResult(inputBytes, outputBytes int64, duration time.Duration) BenchmarkResult {
+	result := BenchmarkResult{
+		InputBytes:  inputBytes,
+		OutputBytes: outputBytes,
+		Duration:    duration,
+	}
+
+	if seconds := duration.Seconds(); seconds > 0 {
+		result.Throughput = float64(inputBytes) / bytesInMegabyte / seconds
+	}
+
+	if outputBytes > 0 {
+		result.CompressionRatio = float64(inputBytes) / float64(outputBytes)
+	}
+
+	return result
+}
+
+func (c *runState) printBenchmarkResult(result BenchmarkResult) error {
+	if c.outputFormat == OutputFormatJSON {
+		if err := json.NewEncoder(c.Output).Encode(result); err != nil {
+			return fmt.Errorf("encoding benchmark result: %w", err)
+		}
+
+		return nil
+	}
+
+	fmt.Fprintf(c.Output, "Compressed %d bytes into %d bytes in %v: %.2f MB/s, compression ratio %.2f\n",
+		result.InputBytes, result.OutputBytes, result.Duration, result.Throughput, result.CompressionRatio)
+
+	return nil
+}
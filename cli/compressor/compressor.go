@@ -11,13 +11,23 @@ package compressor
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
+	"io/fs"
+	"math"
 	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"sigs.k8s.io/yaml"
 
+	"github.com/invidian/golang-cli-testing-example/internal/ctxio"
 	"github.com/invidian/golang-cli-testing-example/pkg/compressor"
 )
 
@@ -26,16 +36,51 @@ const (
 	ActionCompress = "compress"
 	// ActionDecompress ...
 	ActionDecompress = "decompress"
+	// ActionVersion ...
+	ActionVersion = "version"
+	// ActionValidate ...
+	ActionValidate = "validate"
+	// ActionBenchmark ...
+	ActionBenchmark = "benchmark"
+	// ActionCopy ...
+	ActionCopy = "copy"
+	// ActionTranscode ...
+	ActionTranscode = "transcode"
+	// ActionDiff ...
+	ActionDiff = "diff"
+	// ActionPatch ...
+	ActionPatch = "patch"
+	// ActionManPage prints manual page in groff format.
+	ActionManPage = "man"
+	// ActionZip creates ZIP archive of input files and directories.
+	ActionZip = "zip"
+	// ActionUnzip extracts ZIP archive into output directory.
+	ActionUnzip = "unzip"
+	// ActionServe processes requests received over Unix domain socket given by --socket, so other processes can
+	// reuse single compressor instance. See ServeOperationCompress for description of the protocol.
+	ActionServe = "serve"
+	// EnvPrefix is a prefix of environment variables, which can be used to set value of any flag.
+	EnvPrefix = "COMPRESSOR_"
 	// FormatEnv ...
-	FormatEnv = "COMPRESSOR_FORMAT"
+	FormatEnv = EnvPrefix + "FORMAT"
 
 	// DefaultConfigPath ...
 	DefaultConfigPath = "config.yaml"
+
+	actionHelp        = "help"
+	actionListFormats = "list-formats"
 )
 
 // Config ...
 type Config struct {
-	Format string `json:"format"`
+	Format compressor.Format `json:"format"`
+}
+
+// BuildInfo describes the binary running the CLI.
+type BuildInfo struct {
+	Version   string `json:"version"`
+	GoVersion string `json:"goVersion"`
+	BuildTime string `json:"buildTime"`
 }
 
 // Cli ...
@@ -53,10 +98,91 @@ type Cli struct {
 	// Input is usually stdin for direct user input.
 	Input io.Reader
 
-	action     string
-	format     string
-	configPath string
-	inputPath  string
+	// WorkDir is a directory where default configuration file is looked up. When empty, current working
+	// directory of the process is used.
+	WorkDir string
+
+	// FS is used to read configuration, arguments and input files. Paths must then follow fs.ValidPath rules,
+	// e.g. be relative and use forward slashes. When nil, file system of the process is used.
+	FS fs.FS
+
+	// Environ is usually os.Environ() and contains environment variables in "key=value" form, which can be used
+	// to set flags. When nil, environment of the process is used.
+	Environ []string
+
+	// Progress is optional and when set, it will be updated with number of bytes processed by the action.
+	Progress *Progress
+
+	// BuildInfo is printed by version action.
+	BuildInfo BuildInfo
+
+	// reportFormat is a validated output format of the last run, which is guarded by reportMu, as messages
+	// may be reported concurrently with Run.
+	reportFormat string
+	reportMu     sync.Mutex
+
+	// configReloader reloads configuration of the running serve action. It is guarded by reloadMu, as
+	// configuration may be reloaded concurrently with Run.
+	configReloader func() error
+	reloadMu       sync.Mutex
+}
+
+// runState holds values parsed during single Run, so Cli can be run multiple times.
+type runState struct {
+	*Cli
+
+	action      string
+	format      string
+	from        string
+	to          string
+	configPath  string
+	inputPaths  []string
+	outputPath  string
+	httpRetries string
+	s3Region    string
+	s3Endpoint  string
+	inputLimit  string
+	outputLimit string
+	rateLimit   string
+
+	noAutoExtension bool
+
+	recursive bool
+	include   string
+	exclude   string
+	archive   bool
+	zipLevel  string
+	dryRun    bool
+	countOnly bool
+	watch     bool
+	socket    string
+
+	checksum       string
+	verifyChecksum string
+
+	blockSize   string
+	parallelism string
+
+	chunkSize string
+	// chunkSizeBytes is a chunk size parsed when validating arguments.
+	chunkSizeBytes int
+
+	timeout string
+
+	outputFormat string
+
+	// formatFromConfig is set when format is taken from configuration file, so it can be reloaded.
+	formatFromConfig bool
+
+	benchmarkDuration string
+	benchmarkSize     string
+
+	diffOld   string
+	diffNew   string
+	patchBase string
+	patchPath string
+
+	inputInfo os.FileInfo
 }
 
 // Run ...
@@ -65,20 +191,72 @@ func (c *Cli) Run(ctx context.Context) error {
 		return fmt.Errorf("validating CLI configuration: %w", err)
 	}
 
-	c.format = os.Getenv(FormatEnv)
-	c.configPath = DefaultConfigPath
+	state := &runState{
+		Cli:        c,
+		configPath: filepath.Join(c.WorkDir, DefaultConfigPath),
+	}
+
+	// Configuration can only be reloaded while serve action is running.
+	defer c.setConfigReloader(nil)
+
+	return state.run(ctx)
+}
+
+func (c *runState) run(ctx context.Context) error {
+	// Environment variables take precedence over defaults, but not over arguments.
+	for _, definition := range c.flags() {
+		if !definition.settableFromEnv() {
+			continue
+		}
+
+		name := envForFlag(definition.name)
+
+		if value, ok := c.lookupEnv(name); ok {
+			if err := definition.setValue(value); err != nil {
+				return fmt.Errorf("parsing environment variable %s: %w", name, err)
+			}
+		}
+	}
 
 	// Parse arguments.
 	if err := c.parseArgs(); err != nil {
 		return fmt.Errorf("parsing arguments: %w", err)
 	}
 
+	if err := c.setReportFormat(); err != nil {
+		return fmt.Errorf("validating arguments: %w", err)
+	}
+
+	if err := c.validateActionFlags(); err != nil {
+		return fmt.Errorf("validating arguments: %w", err)
+	}
+
 	switch c.action {
-	case "help":
+	case actionHelp:
 		fmt.Fprintln(c.Output, usage())
 
 		return nil
-	case ActionCompress, ActionDecompress:
+	case actionListFormats:
+		return c.listFormats()
+	case ActionVersion:
+		return c.printVersion()
+	case ActionManPage:
+		return c.printManPage()
+	case ActionValidate:
+		return c.validateConfig()
+	case ActionBenchmark:
+		return c.runBenchmark(ctx)
+	case ActionDiff, ActionPatch:
+		return c.runDelta(ctx)
+	case ActionZip, ActionUnzip:
+		return c.runZipAction(ctx)
+	case ActionServe:
+		return c.runServe(ctx)
+	case ActionCompress, ActionDecompress, ActionCopy, ActionTranscode:
+		if c.watch {
+			return c.runWatch(ctx)
+		}
+
 		return c.runAction(ctx)
 	}
 
@@ -87,37 +265,124 @@ func (c *Cli) Run(ctx context.Context) error {
 	return fmt.Errorf("no action specified")
 }
 
-func (c *Cli) runAction(ctx context.Context) error {
+func (c *runState) runAction(ctx context.Context) error {
 	if err := c.readConfig(); err != nil {
 		return fmt.Errorf("reading configuration: %w", err)
 	}
 
-	input, err := c.selectUserInput(c.Input)
+	// Format applies to both sides of transcoding, unless specified separately.
+	if c.action == ActionTranscode {
+		if c.from == "" {
+			c.from = c.format
+		}
+
+		if c.to == "" {
+			c.to = c.format
+		}
+	}
+
+	if c.recursive {
+		if err := c.prepareRecursive(); err != nil {
+			return fmt.Errorf("preparing recursive compression: %w", err)
+		}
+	}
+
+	ctx, cancel, err := c.withTimeout(ctx)
 	if err != nil {
-		return fmt.Errorf("selecting user input: %w", err)
+		return fmt.Errorf("applying timeout: %w", err)
 	}
 
-	config := compressor.Config{
-		Format: compressor.Format(c.format),
+	defer cancel()
+
+	userInput, err := c.openUserInput(ctx)
+	if err != nil {
+		return fmt.Errorf("opening input: %w", err)
 	}
 
-	client, err := compressor.NewClient(config)
+	//nolint:errcheck // Input is only read, so closing errors can be ignored.
+	defer userInput.Close()
+
+	userOutput, finishOutput, err := c.openUserOutput(ctx)
 	if err != nil {
-		return fmt.Errorf("creating compressor client: %w", err)
+		return fmt.Errorf("opening output: %w", err)
 	}
 
-	var output io.Reader
+	input := io.Reader(userInput)
 
-	var errCh chan error
+	var inputBytes, outputBytes int64
 
-	switch c.action {
-	case ActionCompress:
-		output, errCh = client.Compress(ctx, input)
-	case ActionDecompress:
-		output, errCh = client.Decompress(ctx, input)
+	if c.discardsOutput() {
+		input = &progressReader{reader: userInput, counter: &inputBytes}
+		userOutput = &progressWriter{writer: userOutput, counter: &outputBytes}
+	}
+
+	actionErr := c.process(ctx, input, userOutput)
+
+	if err := finishOutput(actionErr); err != nil {
+		return fmt.Errorf("finishing output: %w", err)
+	}
+
+	if actionErr == nil && c.discardsOutput() {
+		c.reportDiscarded(inputBytes, outputBytes)
+	}
+
+	return actionErr
+}
+
+// openUserInput opens input of the action, which is an archive of input paths when archive is requested.
+func (c *runState) openUserInput(ctx context.Context) (io.ReadCloser, error) {
+	if c.archive && c.action == ActionCompress {
+		return c.openArchiveInput(c.inputPaths)
+	}
+
+	return c.openInputs(ctx, c.inputPaths, c.Input)
+}
+
+// openUserOutput opens output of the action, which extracts the archive when archive is requested. In dry run
+// or when only counting bytes, all output is discarded.
+func (c *runState) openUserOutput(ctx context.Context) (io.Writer, finishOutputFunc, error) {
+	if c.discardsOutput() {
+		output, finish := openDiscardedOutput()
+
+		return output, finish, nil
+	}
+
+	if c.archive && c.action == ActionDecompress {
+		return openArchiveOutput(c.outputPath)
+	}
+
+	return c.openOutput(ctx, c.outputPath, c.Output)
+}
+
+// process runs requested action on given input, writing the result to given output.
+func (c *runState) process(ctx context.Context, input io.Reader, userOutput io.Writer) error {
+	input, userOutput, err := c.applyLimits(input, userOutput)
+	if err != nil {
+		return fmt.Errorf("applying limits: %w", err)
+	}
+
+	if input, err = c.detectInputFormat(input); err != nil {
+		return fmt.Errorf("selecting format: %w", err)
+	}
+
+	input, userOutput = c.trackProgress(input, userOutput)
+
+	// Copying data does not involve compression, which allows testing input and output handling separately.
+	if c.action == ActionCopy {
+		if _, err := io.Copy(userOutput, ctxio.NewReader(ctx, input)); err != nil {
+			return fmt.Errorf("copying data: %w", err)
+		}
+
+		return nil
+	}
+
+	// User input is closed by the caller of process, once processing finishes.
+	output, errCh, err := c.startAction(ctx, io.NopCloser(input))
+	if err != nil {
+		return fmt.Errorf("starting action: %w", err)
 	}
 
-	if _, err := io.Copy(c.Output, output); err != nil {
+	if _, err := io.Copy(userOutput, output); err != nil {
 		return fmt.Errorf("copying action output: %w", err)
 	}
 
@@ -128,94 +393,449 @@ func (c *Cli) runAction(ctx context.Context) error {
 	return nil
 }
 
-func (c *Cli) readConfig() error {
-	configRaw, err := os.ReadFile(c.configPath)
+// listFormats prints available formats sorted alphabetically, one per line or as JSON array, so scripts
+// can rely on the output.
+func (c *runState) listFormats() error {
+	formats := formatNames(compressor.AvailableFormats())
+
+	sort.Strings(formats)
+
+	if c.outputFormat == OutputFormatJSON {
+		if err := json.NewEncoder(c.Output).Encode(formats); err != nil {
+			return fmt.Errorf("encoding formats: %w", err)
+		}
+
+		return nil
+	}
+
+	for _, format := range formats {
+		fmt.Fprintln(c.Output, format)
+	}
+
+	return nil
+}
+
+func formatNames(formats []compressor.Format) []string {
+	names := make([]string, 0, len(formats))
+
+	for _, format := range formats {
+		names = append(names, string(format))
+	}
+
+	return names
+}
+
+func (c *runState) printVersion() error {
+	if c.outputFormat == OutputFormatJSON {
+		if err := json.NewEncoder(c.Output).Encode(c.BuildInfo); err != nil {
+			return fmt.Errorf("encoding build information: %w", err)
+		}
+
+		return nil
+	}
+
+	fmt.Fprintf(c.Output, "Version: %s\nGo version: %s\nBuild time: %s\n",
+		c.BuildInfo.Version, c.BuildInfo.GoVersion, c.BuildInfo.BuildTime)
+
+	return nil
+}
+
+func (c *runState) withTimeout(ctx context.Context) (context.Context, context.CancelFunc, error) {
+	if c.timeout == "" {
+		ctx, cancel := context.WithCancel(ctx)
+
+		return ctx, cancel, nil
+	}
+
+	timeout, err := time.ParseDuration(c.timeout)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parsing timeout: %w", err)
+	}
+
+	if timeout <= 0 {
+		return nil, nil, fmt.Errorf("timeout must be positive, got %v", timeout)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+
+	return ctx, cancel, nil
+}
+
+func (c *runState) startAction(ctx context.Context, input io.ReadCloser) (io.Reader, chan error, error) {
+	if c.action == ActionTranscode {
+		return c.startTranscode(ctx, input)
+	}
+
+	client, err := compressor.NewClient(c.clientConfig())
+	if err != nil {
+		return nil, nil, fmt.Errorf("creating compressor client: %w", err)
+	}
+
+	if client, err = c.withRateLimit(client); err != nil {
+		return nil, nil, fmt.Errorf("applying rate limit: %w", err)
+	}
+
+	if c.blockSize == "" {
+		if c.action == ActionDecompress {
+			output, errCh := client.Decompress(ctx, input)
+
+			return output, errCh, nil
+		}
+
+		output, errCh := client.Compress(ctx, input)
+
+		return output, errCh, nil
+	}
+
+	return c.startBlocks(ctx, client, input)
+}
+
+// startBlocks starts processing data in blocks, as requested by --block-size flag.
+func (c *runState) startBlocks(
+	ctx context.Context, client compressor.Client, input io.ReadCloser,
+) (io.Reader, chan error, error) {
+	blockClient, ok := client.(compressor.BlockClient)
+	if !ok {
+		return nil, nil, fmt.Errorf("client %T does not support processing data in blocks", client)
+	}
+
+	blockSize, err := parseBytes(c.blockSize)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parsing block size: %w", err)
+	}
+
+	parallelism := min(runtime.NumCPU(), compressor.MaxParallelism)
+
+	if c.parallelism != "" {
+		if parallelism, err = strconv.Atoi(c.parallelism); err != nil {
+			return nil, nil, fmt.Errorf("parsing parallelism: %w", err)
+		}
+	}
+
+	if c.action == ActionDecompress {
+		output, errCh := blockClient.DecompressBlocks(ctx, input, parallelism)
+
+		return output, errCh, nil
+	}
+
+	output, errCh := blockClient.CompressBlocks(ctx, input, int(blockSize), parallelism)
+
+	return output, errCh, nil
+}
+
+func (c *runState) clientConfig() compressor.Config {
+	config := compressor.Config{
+		Format:           compressor.Format(c.format),
+		Checksum:         compressor.ChecksumAlgorithm(c.checksum),
+		ExpectedChecksum: c.verifyChecksum,
+	}
+
+	if c.inputInfo != nil {
+		config.OriginalName = c.inputInfo.Name()
+		config.ModTime = c.inputInfo.ModTime()
+	}
+
+	config.ChunkSize = c.chunkSizeBytes
+
+	if c.checksum != "" {
+		config.ChecksumHandler = func(checksum string) {
+			text := fmt.Sprintf("%s: %s", c.checksum, checksum)
+
+			c.report(message{Level: levelInfo, Msg: text}, text)
+		}
+	}
+
+	return config
+}
+
+// parseChunkSize validates and parses chunk size, so it can be used when creating clients.
+func (c *runState) parseChunkSize() error {
+	if c.chunkSize == "" {
+		return nil
+	}
+
+	if c.action != ActionCompress && c.action != ActionDecompress && c.action != ActionTranscode {
+		return fmt.Errorf("chunk size can only be used with %q, %q and %q actions",
+			ActionCompress, ActionDecompress, ActionTranscode)
+	}
+
+	size, err := parseBytes(c.chunkSize)
+	if err != nil {
+		return fmt.Errorf("parsing chunk size: %w", err)
+	}
+
+	if size < 1 || size > math.MaxInt32 {
+		return fmt.Errorf("chunk size must be between 1 and %d bytes, got %d", math.MaxInt32, size)
+	}
+
+	c.chunkSizeBytes = int(size)
+
+	return nil
+}
+
+func (c *runState) applyLimits(input io.Reader, output io.Writer) (io.Reader, io.Writer, error) {
+	input, err := c.limitInput(input)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	output, err = c.limitOutput(output)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return input, output, nil
+}
+
+// limitInput wraps given input to fail when it exceeds input limit, if requested.
+func (c *runState) limitInput(input io.Reader) (io.Reader, error) {
+	if c.inputLimit == "" {
+		return input, nil
+	}
+
+	limit, err := parseBytes(c.inputLimit)
+	if err != nil {
+		return nil, fmt.Errorf("parsing input limit: %w", err)
+	}
+
+	return newLimitedReader(input, limit), nil
+}
+
+// limitOutput wraps given output to fail when more data than output limit is written, if requested.
+func (c *runState) limitOutput(output io.Writer) (io.Writer, error) {
+	if c.outputLimit == "" {
+		return output, nil
+	}
+
+	limit, err := parseBytes(c.outputLimit)
+	if err != nil {
+		return nil, fmt.Errorf("parsing output limit: %w", err)
+	}
+
+	return newLimitedWriter(output, limit), nil
+}
+
+func (c *runState) readConfig() error {
+	config, err := c.readConfigFile()
+	if err != nil {
+		return err
+	}
+
+	// Format taken from configuration file is read again every time, so watching picks up its changes.
+	if (c.format == "" || c.formatFromConfig) && config.Format != "" {
+		c.format = string(config.Format)
+		c.formatFromConfig = true
+	}
+
+	return nil
+}
+
+// readConfigFile reads configuration file, which is optional, so empty configuration is returned when it
+// does not exist.
+func (c *runState) readConfigFile() (*Config, error) {
+	configRaw, err := c.fsReadFile(c.configPath)
 	if err != nil && !os.IsNotExist(err) {
-		return fmt.Errorf("reading configuration file %q: %w", c.configPath, err)
+		return nil, fmt.Errorf("reading configuration file %q: %w", c.configPath, err)
 	}
 
 	config := &Config{}
 
 	if err := yaml.Unmarshal(configRaw, config); err != nil {
+		return nil, fmt.Errorf("decoding config from file %q: %w", c.configPath, err)
+	}
+
+	return config, nil
+}
+
+// validateConfig checks, that configuration file exists, has no unknown fields and specifies valid settings,
+// so malformed configuration can be caught before running actual actions.
+func (c *runState) validateConfig() error {
+	configRaw, err := c.fsReadFile(c.configPath)
+	if err != nil {
+		return fmt.Errorf("reading configuration file %q: %w", c.configPath, err)
+	}
+
+	config := &Config{}
+
+	if err := yaml.UnmarshalStrict(configRaw, config); err != nil {
 		return fmt.Errorf("decoding config from file %q: %w", c.configPath, err)
 	}
 
-	if c.format == "" {
-		c.format = config.Format
+	if _, err := compressor.NewClient(compressor.Config{Format: config.Format}); err != nil {
+		return fmt.Errorf("validating config from file %q: %w", c.configPath, err)
 	}
 
+	fmt.Fprintln(c.Output, "config OK")
+
 	return nil
 }
 
-func (c *Cli) selectUserInput(userInput io.Reader) (io.Reader, error) {
-	input := userInput
+func (c *runState) parseArgs() error {
+	args, err := c.expandArgs(c.Args[1:])
+	if err != nil {
+		return fmt.Errorf("expanding arguments: %w", err)
+	}
 
-	var err error
+	args, positionalArgs := c.splitShortFlags(args)
 
-	if c.inputPath == "" && input == nil {
-		return nil, fmt.Errorf("either input or input path must be defined")
-	}
+	flagSet := c.newFlagSet()
 
-	if c.inputPath != "" {
-		input, err = os.Open(c.inputPath)
-		if err != nil {
-			return nil, fmt.Errorf("opening input file %q: %w", c.inputPath, err)
+	// Flag set stops parsing at first positional argument, so parse remaining arguments after each action
+	// to allow flags to be specified both before and after the action.
+	for {
+		if err := flagSet.Parse(args); err != nil {
+			return fmt.Errorf("parsing flags: %w", err)
 		}
-	}
 
-	return input, nil
+		if c.action == actionHelp {
+			return nil
+		}
+
+		if flagSet.NArg() == 0 {
+			return c.parsePositionalArgs(positionalArgs)
+		}
+
+		if err := c.parseAction(flagSet.Arg(0)); err != nil {
+			return err
+		}
+
+		args = flagSet.Args()[1:]
+	}
 }
 
-func (c *Cli) parseArgs() error {
-	for _, arg := range c.Args[1:] {
-		switch arg {
-		case "--help":
-			c.action = "help"
+// parsePositionalArgs parses arguments given after end of flags separator. First of them is an action, unless
+// it has already been specified. Next argument is an input path, which takes precedence over --input flag, so
+// paths starting with a dash can be given as well.
+func (c *runState) parsePositionalArgs(args []string) error {
+	if len(args) > 0 && c.action == "" {
+		if err := c.parseAction(args[0]); err != nil {
+			return err
+		}
+
+		args = args[1:]
+	}
 
-			return nil
-		case ActionCompress, ActionDecompress:
-			if c.action != "" {
-				return fmt.Errorf("action already specified")
-			}
+	switch len(args) {
+	case 0:
+		return nil
+	case 1:
+		c.inputPaths = []string{args[0]}
 
-			c.action = arg
-		default:
-			if c.parseValueArgs(arg) {
-				continue
-			}
+		return nil
+	default:
+		fmt.Fprintln(c.ErrorOutput, usage())
 
-			fmt.Fprintln(c.ErrorOutput, usage())
+		return fmt.Errorf("unexpected arguments after input path: %v", args[1:])
+	}
+}
 
-			return fmt.Errorf("unknown argument %q: %v", arg, c.Args)
+func (c *runState) parseAction(arg string) error {
+	switch arg {
+	case ActionCompress, ActionDecompress, ActionVersion, ActionValidate, ActionBenchmark, ActionCopy,
+		ActionTranscode, ActionDiff, ActionPatch, ActionManPage, ActionZip, ActionUnzip,
+		ActionServe:
+		if c.action != "" {
+			return fmt.Errorf("action already specified")
 		}
+
+		c.action = arg
+
+		return nil
 	}
 
-	return nil
+	fmt.Fprintln(c.ErrorOutput, usage())
+
+	return fmt.Errorf("unknown argument %q: %v", arg, c.Args)
 }
 
-func (c *Cli) parseValueArgs(arg string) bool {
-	for flag, target := range map[string]*string{
-		"format": &c.format,
-		"config": &c.configPath,
-		"input":  &c.inputPath,
-	} {
-		if parseStringArg(arg, flag, target) {
-			return true
+// lookupEnv returns value of given environment variable from configured environment, falling back to
+// environment of the process when it is not configured.
+func (c *Cli) lookupEnv(key string) (string, bool) {
+	if c.Environ == nil {
+		return os.LookupEnv(key)
+	}
+
+	// Like in os/exec, the last value takes precedence when the variable is duplicated.
+	for i := len(c.Environ) - 1; i >= 0; i-- {
+		if name, value, ok := strings.Cut(c.Environ[i], "="); ok && name == key {
+			return value, true
 		}
 	}
 
-	return false
+	return "", false
 }
 
-func parseStringArg(argument, flag string, destination *string) bool {
-	flagFull := fmt.Sprintf("--%s", flag)
-	if !strings.HasPrefix(argument, flagFull+"=") {
-		return false
+// envForFlag returns name of environment variable which can be used to set given flag,
+// e.g. COMPRESSOR_INPUT_LIMIT for input-limit flag.
+func envForFlag(name string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+func (c *runState) validateActionFlags() error {
+	if c.action == actionHelp || c.action == actionListFormats || c.action == ActionVersion ||
+		c.action == ActionManPage {
+		return nil
 	}
 
-	*destination = strings.Split(argument, "=")[1]
+	if c.parallelism != "" && c.blockSize == "" {
+		return fmt.Errorf("parallelism can only be set together with block size")
+	}
 
-	return true
+	if c.blockSize != "" && c.action != ActionCompress && c.action != ActionDecompress {
+		return fmt.Errorf("block size can only be used with %q and %q actions", ActionCompress, ActionDecompress)
+	}
+
+	if c.rateLimit != "" && c.action != ActionCompress && c.action != ActionDecompress && c.action != ActionTranscode {
+		return fmt.Errorf("rate limit can only be used with %q, %q and %q actions",
+			ActionCompress, ActionDecompress, ActionTranscode)
+	}
+
+	// Algorithm can't be reliably told from the checksum itself, so it must be given explicitly.
+	if c.verifyChecksum != "" && c.checksum == "" {
+		return fmt.Errorf("verify checksum requires checksum algorithm to be set")
+	}
+
+	if err := c.validateRecursiveFlags(); err != nil {
+		return err
+	}
+
+	if err := c.validateArchiveFlags(); err != nil {
+		return err
+	}
+
+	if err := c.validateZipFlags(); err != nil {
+		return err
+	}
+
+	if err := c.parseChunkSize(); err != nil {
+		return err
+	}
+
+	if err := c.validateDryRunFlags(); err != nil {
+		return err
+	}
+
+	if err := c.validateWatchFlags(); err != nil {
+		return err
+	}
+
+	if err := c.validateServeFlags(); err != nil {
+		return err
+	}
+
+	if (c.from != "" || c.to != "") && c.action != ActionTranscode {
+		return fmt.Errorf("source and target formats can only be used with %q action", ActionTranscode)
+	}
+
+	if err := c.validateDeltaFlags(); err != nil {
+		return err
+	}
+
+	if (c.benchmarkDuration != "" || c.benchmarkSize != "") && c.action != ActionBenchmark {
+		return fmt.Errorf("duration and size can only be used with %q action", ActionBenchmark)
+	}
+
+	return nil
 }
 
 func (c *Cli) validate() error {
@@ -235,18 +855,21 @@ func (c *Cli) validate() error {
 }
 
 func usage() string {
+	flags := (&runState{}).flags()
+
 	return fmt.Sprintf(`Usage:
   %s [command]
 
 Available Commands:
-  compress   Compress data from standard input
-  decompress Decompress data from standard input
-
+%s
 Flags:
-  --help   Help for %s.
-  --format Specified compression format. Valid values are: %s. Default is %s.
-  --config Path to optional configuration file. Default is %s.
-  --input  Path to input file which should processed.`,
-		os.Args[0], os.Args[0], strings.Join(compressor.AvailableFormats(), ", "),
-		compressor.DefaultFormat, DefaultConfigPath)
+%s
+Flags with value can be given either as --flag=value or as --flag value. Short flags can be given as -f value
+or as -fvalue. Arguments after -- are not parsed as flags: first of them is the command, unless it is already
+given, and next one is the input path, e.g. %s compress -- -input-file.
+
+Each flag, except %s, can also be set using environment variable with
+%s prefix, e.g. %s. Flags without value are set using boolean value, e.g. %s=true.`,
+		os.Args[0], commandsUsage(commands()), flagsUsage(flags), os.Args[0], envExceptions(flags), EnvPrefix, FormatEnv,
+		envForFlag("dry-run"))
 }
@@ -0,0 +1,67 @@
+package compressor
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+// Fuzzing only supports primitive types, so arguments are passed as a single string separated with this separator.
+const fuzzArgsSeparator = "\n"
+
+func FuzzParseArgs(f *testing.F) {
+	for _, seed := range [][]string{
+		{},
+		{ActionCompress},
+		{ActionDecompress, "--format=noop"},
+		{"--help"},
+		{"--list-formats", "--output-format=json"},
+		{ActionCompress, ActionDecompress},
+		{"--unknown"},
+		{"--format"},
+		{"--input=", "--output=="},
+	} {
+		f.Add(strings.Join(seed, fuzzArgsSeparator))
+	}
+
+	f.Fuzz(func(t *testing.T, args string) {
+		state := &runState{
+			Cli: &Cli{
+				Args:        append([]string{"compressor"}, strings.Split(args, fuzzArgsSeparator)...),
+				Output:      io.Discard,
+				ErrorOutput: io.Discard,
+			},
+		}
+
+		// Only absence of panics is verified, as arbitrary arguments are expected to produce errors.
+		_ = state.parseArgs() //nolint:errcheck // See above.
+	})
+}
+
+func FuzzPatch(f *testing.F) {
+	block := strings.Repeat("0123456789abcdef", 4)
+
+	for _, seed := range [][2]string{
+		{"", ""},
+		{"", "new"},
+		{"old", ""},
+		{block + "old", "new" + block},
+		{"a" + block + "b" + block, block + "b" + block + "a"},
+		{block, block + block + block},
+	} {
+		f.Add(seed[0], seed[1])
+	}
+
+	f.Fuzz(func(t *testing.T, oldData, newData string) {
+		result := &strings.Builder{}
+
+		if err := applyPatch([]byte(oldData), strings.NewReader(string(newPatch([]byte(oldData), []byte(newData)))),
+			result); err != nil {
+			t.Fatalf("Unexpected error applying patch: %v", err)
+		}
+
+		if result.String() != newData {
+			t.Fatalf("Expected patched data %q, got %q", newData, result.String())
+		}
+	})
+}
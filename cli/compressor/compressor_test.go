@@ -2,12 +2,29 @@ package compressor_test
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"testing/fstest"
+	"time"
+
+	"sigs.k8s.io/yaml"
 
 	"github.com/invidian/golang-cli-testing-example/cli/compressor"
 	"github.com/invidian/golang-cli-testing-example/internal/testutil"
@@ -35,72 +52,117 @@ func Test_Running_CLI_writes_resulting_data_into_given_output(t *testing.T) {
 		t.Fatalf("Unexpected error message printed to error output:\n%s", errorMessage)
 	}
 
-	if output := output.String(); len(output) == 0 {
-		t.Fatalf("Expected some output to be printed")
-	}
+	testutil.GoldenFile(t, "compressed-gzip", output.Bytes(), *testutil.UpdateGolden)
 }
 
-func Test_Running_CLI_reads_input_from_requested_input_file(t *testing.T) {
+func Test_Running_CLI_copies_data_without_compression_when_copy_action_is_requested(t *testing.T) {
 	t.Parallel()
 
-	expectedOutput := testData
-
 	inputPath := filepath.Join(t.TempDir(), "input")
 
-	if err := os.WriteFile(inputPath, []byte(expectedOutput), 0o600); err != nil {
-		t.Fatalf("Failed input file: %v", err)
+	testutil.MustWriteFile(t, inputPath, []byte(testData), 0o600)
+
+	for name, cli := range map[string]*compressor.Cli{
+		"from_input": {
+			Args:  []string{testCommand, compressor.ActionCopy},
+			Input: bytes.NewBufferString(testData),
+		},
+		"from_input_file": {
+			Args: []string{testCommand, compressor.ActionCopy, "--input=" + inputPath},
+		},
+	} {
+		output := &bytes.Buffer{}
+
+		cli.Output = output
+		cli.ErrorOutput = &bytes.Buffer{}
+
+		if err := cli.Run(testutil.ContextWithDeadline(t)); err != nil {
+			t.Fatalf("Unexpected error running CLI %s: %v", name, err)
+		}
+
+		if gotOutput := output.String(); gotOutput != testData {
+			t.Fatalf("Expected to get output %q %s, got %q", testData, name, gotOutput)
+		}
 	}
+}
+
+func Test_Running_CLI_multiple_times_does_not_reuse_values_parsed_by_previous_runs(t *testing.T) {
+	t.Parallel()
 
 	output := &bytes.Buffer{}
 
-	cli := compressor.Cli{
-		Args:        []string{testCommand, compressor.ActionCompress, "--format=noop", "--input=" + inputPath},
+	cli := &compressor.Cli{
+		Args:        []string{testCommand, compressor.ActionCompress, "--format=noop"},
 		Output:      output,
 		ErrorOutput: &bytes.Buffer{},
+		Input:       bytes.NewBufferString(testData),
 	}
 
 	if err := cli.Run(testutil.ContextWithDeadline(t)); err != nil {
-		t.Fatalf("Unexpected error running CLI: %v", err)
+		t.Fatalf("Unexpected error running CLI for the first time: %v", err)
 	}
 
-	if gotOutput := output.String(); gotOutput != expectedOutput {
-		t.Fatalf("Expected to get output %q, got %q", expectedOutput, gotOutput)
+	output.Reset()
+
+	cli.Args = []string{testCommand, compressor.ActionCompress, "--config=" + testutil.NewTempConfigFile(t, "")}
+	cli.Input = bytes.NewBufferString(testData)
+
+	if err := cli.Run(testutil.ContextWithDeadline(t)); err != nil {
+		t.Fatalf("Unexpected error running CLI for the second time: %v", err)
+	}
+
+	if gotData := testGunzip(t, output.Bytes()); gotData != testData {
+		t.Fatalf("Expected data compressed using default format to decompress to %q, got %q", testData, gotData)
 	}
 }
 
-//nolint:paralleltest // No parallelization as we tinker with working directory here which is global.
-func Test_Running_CLI_tries_reading_settings_from_default_configuration_file(t *testing.T) {
-	dir := t.TempDir()
-	configPath := filepath.Join(dir, "config.yaml")
+func Test_Creating_CLI_applies_given_options(t *testing.T) {
+	t.Parallel()
 
-	if err := os.WriteFile(configPath, []byte("format: noop"), 0o600); err != nil {
-		t.Fatalf("Failed writing configuration file: %v", err)
-	}
+	output := &bytes.Buffer{}
 
-	oldWorkingDir, err := os.Getwd()
+	cli, err := compressor.NewCli(
+		compressor.WithArgs([]string{testCommand, compressor.ActionCompress, "--format=noop"}),
+		compressor.WithOutput(output),
+		compressor.WithErrorOutput(&bytes.Buffer{}),
+		compressor.WithInput(bytes.NewBufferString(testData)),
+	)
 	if err != nil {
-		t.Fatalf("Error getting working directory: %v", err)
+		t.Fatalf("Unexpected error creating CLI: %v", err)
+	}
+
+	if err := cli.Run(testutil.ContextWithDeadline(t)); err != nil {
+		t.Fatalf("Unexpected error running CLI: %v", err)
 	}
 
-	if err := os.Chdir(dir); err != nil {
-		t.Fatalf("Failed changing working directory to %q: %v", dir, err)
+	if gotOutput := output.String(); gotOutput != testData {
+		t.Fatalf("Expected to get output %q, got %q", testData, gotOutput)
 	}
+}
 
-	t.Cleanup(func() {
-		if err := os.Chdir(oldWorkingDir); err != nil {
-			t.Fatalf("Failed restoring working directory: %v", err)
-		}
-	})
+func Test_Creating_CLI_returns_error_when_options_produce_invalid_configuration(t *testing.T) {
+	t.Parallel()
+
+	if _, err := compressor.NewCli(compressor.WithOutput(nil)); err == nil {
+		t.Fatalf("Expected error creating CLI")
+	}
+}
+
+func Test_Running_CLI_reads_input_from_requested_input_file(t *testing.T) {
+	t.Parallel()
 
 	expectedOutput := testData
 
+	inputPath := filepath.Join(t.TempDir(), "input")
+
+	testutil.MustWriteFile(t, inputPath, []byte(expectedOutput), 0o600)
+
 	output := &bytes.Buffer{}
 
 	cli := compressor.Cli{
-		Args:        []string{testCommand, compressor.ActionCompress},
+		Args:        []string{testCommand, compressor.ActionCompress, "--format=noop", "--input=" + inputPath},
 		Output:      output,
 		ErrorOutput: &bytes.Buffer{},
-		Input:       bytes.NewBufferString(expectedOutput),
 	}
 
 	if err := cli.Run(testutil.ContextWithDeadline(t)); err != nil {
@@ -112,198 +174,3406 @@ func Test_Running_CLI_tries_reading_settings_from_default_configuration_file(t *
 	}
 }
 
-func Test_Running_CLI_reads_format_setting_from_specified_configuration_file_when_requested(t *testing.T) {
+func Test_Running_CLI_reads_input_from_requested_URL(t *testing.T) {
 	t.Parallel()
 
-	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("key") != "value" {
+			w.WriteHeader(http.StatusBadRequest)
 
-	if err := os.WriteFile(configPath, []byte("format: noop"), 0o600); err != nil {
-		t.Fatalf("Failed writing configuration file: %v", err)
-	}
+			return
+		}
 
-	expectedOutput := testData
+		fmt.Fprint(w, testData)
+	}))
+
+	t.Cleanup(server.Close)
 
 	output := &bytes.Buffer{}
 
 	cli := compressor.Cli{
-		Args:        []string{testCommand, compressor.ActionCompress, "--config=" + configPath},
+		Args:        []string{testCommand, compressor.ActionCopy, "--input=" + server.URL + "/data?key=value"},
 		Output:      output,
 		ErrorOutput: &bytes.Buffer{},
-		Input:       bytes.NewBufferString(expectedOutput),
 	}
 
 	if err := cli.Run(testutil.ContextWithDeadline(t)); err != nil {
 		t.Fatalf("Unexpected error running CLI: %v", err)
 	}
 
-	if gotOutput := output.String(); gotOutput != expectedOutput {
-		t.Fatalf("Expected to get output %q, got %q", expectedOutput, gotOutput)
+	if gotOutput := output.String(); gotOutput != testData {
+		t.Fatalf("Expected to get output %q, got %q", testData, gotOutput)
 	}
 }
 
-func Test_Running_CLI_use_specified_format_for_actions(t *testing.T) {
+func Test_Running_CLI_retries_requesting_input_URL(t *testing.T) {
 	t.Parallel()
 
-	expectedOutput := testData
+	for name, testCase := range map[string]struct {
+		failures         int32
+		status           int
+		args             []string
+		expectError      bool
+		expectedRequests int32
+	}{
+		"on_server_errors": {
+			failures:         2,
+			status:           http.StatusServiceUnavailable,
+			expectedRequests: 3,
+		},
+		"until_requested_number_of_retries_is_exceeded": {
+			failures:         2,
+			status:           http.StatusInternalServerError,
+			args:             []string{"--http-retries=1"},
+			expectError:      true,
+			expectedRequests: 2,
+		},
+		"except_on_client_errors": {
+			failures:         1,
+			status:           http.StatusNotFound,
+			expectError:      true,
+			expectedRequests: 1,
+		},
+	} {
+		testCase := testCase
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
 
-	output := &bytes.Buffer{}
+			var requests int32
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if atomic.AddInt32(&requests, 1) <= testCase.failures {
+					w.WriteHeader(testCase.status)
+
+					return
+				}
+
+				fmt.Fprint(w, testData)
+			}))
+
+			t.Cleanup(server.Close)
+
+			cli := compressor.Cli{
+				Args:        append([]string{testCommand, compressor.ActionCopy, "--input=" + server.URL}, testCase.args...),
+				Output:      &bytes.Buffer{},
+				ErrorOutput: &bytes.Buffer{},
+			}
+
+			err := cli.Run(testutil.ContextWithDeadline(t))
+			if testCase.expectError && err == nil {
+				t.Fatalf("Expected error running CLI")
+			}
+
+			if !testCase.expectError && err != nil {
+				t.Fatalf("Unexpected error running CLI: %v", err)
+			}
+
+			if got := atomic.LoadInt32(&requests); got != testCase.expectedRequests {
+				t.Fatalf("Expected %d requests, got %d", testCase.expectedRequests, got)
+			}
+		})
+	}
+}
+
+func Test_Running_CLI_detects_format_of_decompressed_user_input(t *testing.T) {
+	t.Parallel()
+
+	zstdData := "\x28\xb5\x2f\xfd" + testData
+
+	t.Run("when_no_format_is_specified", func(t *testing.T) {
+		t.Parallel()
+
+		cli := compressor.Cli{
+			Args:        []string{testCommand, compressor.ActionDecompress, "--config=" + testutil.NewTempConfigFile(t, "")},
+			Output:      &bytes.Buffer{},
+			ErrorOutput: &bytes.Buffer{},
+			Input:       bytes.NewBufferString(zstdData),
+		}
+
+		err := cli.Run(testutil.ContextWithDeadline(t))
+		if err == nil {
+			t.Fatalf("Expected error running CLI")
+		}
+
+		if expectedFormat := "zstd"; !strings.Contains(err.Error(), expectedFormat) {
+			t.Fatalf("Expected error to mention detected format %q, got: %v", expectedFormat, err)
+		}
+	})
+
+	t.Run("unless_format_is_specified", func(t *testing.T) {
+		t.Parallel()
+
+		output := &bytes.Buffer{}
+
+		cli := compressor.Cli{
+			Args:        []string{testCommand, compressor.ActionDecompress, "--format=noop"},
+			Output:      output,
+			ErrorOutput: &bytes.Buffer{},
+			Input:       bytes.NewBufferString(zstdData),
+		}
+
+		if err := cli.Run(testutil.ContextWithDeadline(t)); err != nil {
+			t.Fatalf("Unexpected error running CLI: %v", err)
+		}
+
+		if gotOutput := output.String(); gotOutput != zstdData {
+			t.Fatalf("Expected to get output %q, got %q", zstdData, gotOutput)
+		}
+	})
+}
+
+func Test_Running_CLI_infers_format_of_decompressed_input_file_from_its_extension(t *testing.T) {
+	t.Parallel()
+
+	inputPath := filepath.Join(t.TempDir(), "input.zst")
+
+	testutil.MustWriteFile(t, inputPath, []byte(testData), 0o600)
+
+	t.Run("when_no_format_is_specified", func(t *testing.T) {
+		t.Parallel()
+
+		cli := compressor.Cli{
+			Args: []string{
+				testCommand, compressor.ActionDecompress, "--input=" + inputPath, "--config=" + testutil.NewTempConfigFile(t, ""),
+			},
+			Output:      &bytes.Buffer{},
+			ErrorOutput: &bytes.Buffer{},
+		}
+
+		err := cli.Run(testutil.ContextWithDeadline(t))
+		if err == nil {
+			t.Fatalf("Expected error running CLI")
+		}
+
+		if expectedFormat := "zstd"; !strings.Contains(err.Error(), expectedFormat) {
+			t.Fatalf("Expected error to mention inferred format %q, got: %v", expectedFormat, err)
+		}
+	})
+
+	t.Run("unless_format_is_specified", func(t *testing.T) {
+		t.Parallel()
+
+		output := &bytes.Buffer{}
+
+		cli := compressor.Cli{
+			Args:        []string{testCommand, compressor.ActionDecompress, "--input=" + inputPath, "--format=noop"},
+			Output:      output,
+			ErrorOutput: &bytes.Buffer{},
+		}
+
+		if err := cli.Run(testutil.ContextWithDeadline(t)); err != nil {
+			t.Fatalf("Unexpected error running CLI: %v", err)
+		}
+
+		if gotOutput := output.String(); gotOutput != testData {
+			t.Fatalf("Expected to get output %q, got %q", testData, gotOutput)
+		}
+	})
+}
+
+func Test_Running_CLI_appends_format_extension_to_output_file_path(t *testing.T) {
+	t.Parallel()
+
+	for name, testCase := range map[string]struct {
+		output       string
+		args         []string
+		expectedPath string
+	}{
+		"when_it_is_missing": {
+			output:       "data",
+			expectedPath: "data.gz",
+		},
+		"unless_it_is_already_present": {
+			output:       "data.GZ",
+			expectedPath: "data.GZ",
+		},
+		"unless_format_has_no_standard_extension": {
+			output:       "data",
+			args:         []string{"--format=noop"},
+			expectedPath: "data",
+		},
+		"unless_disabled": {
+			output:       "data",
+			args:         []string{"--no-auto-extension"},
+			expectedPath: "data",
+		},
+	} {
+		testCase := testCase
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+
+			cli := compressor.Cli{
+				Args: append([]string{
+					testCommand, compressor.ActionCompress, "--output=" + filepath.Join(dir, testCase.output),
+				}, testCase.args...),
+				Output:      &bytes.Buffer{},
+				ErrorOutput: &bytes.Buffer{},
+				Input:       bytes.NewBufferString(testData),
+			}
+
+			if err := cli.Run(testutil.ContextWithDeadline(t)); err != nil {
+				t.Fatalf("Unexpected error running CLI: %v", err)
+			}
+
+			if _, err := os.Stat(filepath.Join(dir, testCase.expectedPath)); err != nil {
+				t.Fatalf("Expected output file to be created: %v", err)
+			}
+		})
+	}
+}
+
+func Test_Running_CLI_transcodes_data_between_requested_formats(t *testing.T) {
+	t.Parallel()
+
+	compressed := &bytes.Buffer{}
 
 	cli := compressor.Cli{
-		Args:        []string{testCommand, compressor.ActionCompress, "--format=noop"},
+		Args:        []string{testCommand, compressor.ActionTranscode, "--from=noop", "--to=gzip"},
+		Output:      compressed,
+		ErrorOutput: &bytes.Buffer{},
+		Input:       bytes.NewBufferString(testData),
+	}
+
+	if err := cli.Run(testutil.ContextWithDeadline(t)); err != nil {
+		t.Fatalf("Unexpected error transcoding to gzip: %v", err)
+	}
+
+	if gotData := testGunzip(t, compressed.Bytes()); gotData != testData {
+		t.Fatalf("Expected transcoded data to decompress to %q, got %q", testData, gotData)
+	}
+
+	output := &bytes.Buffer{}
+
+	cli = compressor.Cli{
+		Args:        []string{testCommand, compressor.ActionTranscode, "--format=gzip", "--to=noop"},
 		Output:      output,
 		ErrorOutput: &bytes.Buffer{},
-		Input:       bytes.NewBufferString(expectedOutput),
+		Input:       compressed,
 	}
 
 	if err := cli.Run(testutil.ContextWithDeadline(t)); err != nil {
-		t.Fatalf("Unexpected error running CLI: %v", err)
+		t.Fatalf("Unexpected error transcoding from gzip: %v", err)
 	}
 
-	if gotOutput := output.String(); gotOutput != expectedOutput {
-		t.Fatalf("Expected to get output %q, got %q", expectedOutput, gotOutput)
+	if gotOutput := output.String(); gotOutput != testData {
+		t.Fatalf("Expected to get output %q, got %q", testData, gotOutput)
 	}
 }
 
-//nolint:paralleltest // This test sets environment variables.
-func Test_Running_CLI_reads_default_format_from_environment_variable(t *testing.T) {
-	t.Setenv(compressor.FormatEnv, "noop")
+func Test_Running_CLI_patch_applies_patch_created_by_diff(t *testing.T) {
+	t.Parallel()
 
-	expectedOutput := testData
+	dir := t.TempDir()
 
-	output := &bytes.Buffer{}
+	files := map[string]string{
+		"old.gz": "prefix " + testData + " suffix",
+		"new.gz": "prefix " + strings.ToUpper(testData) + " more suffix",
+	}
+
+	for name, content := range files {
+		buf := &bytes.Buffer{}
+		gzipWriter := gzip.NewWriter(buf)
+
+		if _, err := gzipWriter.Write([]byte(content)); err != nil {
+			t.Fatalf("Failed compressing data: %v", err)
+		}
+
+		if err := gzipWriter.Close(); err != nil {
+			t.Fatalf("Failed closing gzip writer: %v", err)
+		}
+
+		testutil.MustWriteFile(t, filepath.Join(dir, name), buf.Bytes(), 0o600)
+	}
+
+	patchPath := filepath.Join(dir, "patch.bin")
 
 	cli := compressor.Cli{
-		Args:        []string{testCommand, compressor.ActionCompress},
+		Args: []string{
+			testCommand, compressor.ActionDiff, "--old=" + filepath.Join(dir, "old.gz"),
+			"--new=" + filepath.Join(dir, "new.gz"), "--output=" + patchPath,
+		},
+		Output:      &bytes.Buffer{},
+		ErrorOutput: &bytes.Buffer{},
+	}
+
+	if err := cli.Run(testutil.ContextWithDeadline(t)); err != nil {
+		t.Fatalf("Unexpected error creating patch: %v", err)
+	}
+
+	output := &bytes.Buffer{}
+
+	cli = compressor.Cli{
+		Args: []string{
+			testCommand, compressor.ActionPatch, "--base=" + filepath.Join(dir, "old.gz"), "--patch=" + patchPath,
+		},
 		Output:      output,
 		ErrorOutput: &bytes.Buffer{},
-		Input:       bytes.NewBufferString(expectedOutput),
 	}
 
 	if err := cli.Run(testutil.ContextWithDeadline(t)); err != nil {
-		t.Fatalf("Unexpected error running CLI: %v", err)
+		t.Fatalf("Unexpected error applying patch: %v", err)
 	}
 
-	if gotOutput := output.String(); gotOutput != expectedOutput {
-		t.Fatalf("Expected to get output %q, got %q", expectedOutput, gotOutput)
+	if gotData := testGunzip(t, output.Bytes()); gotData != files["new.gz"] {
+		t.Fatalf("Expected patched data %q, got %q", files["new.gz"], gotData)
 	}
 }
 
-//nolint:paralleltest // This test sets environment variables.
-func Test_Running_CLI_prefers_format_setting_from_arguments_over_environment_variable(t *testing.T) {
-	t.Setenv(compressor.FormatEnv, string(pkgCompressor.FormatGzip))
+func Test_Running_CLI_diff_creates_patch_copying_moved_regions_of_old_data(t *testing.T) {
+	t.Parallel()
 
-	expectedOutput := testData
+	dir := t.TempDir()
+
+	regions := make([][]byte, 2)
+	for i := range regions {
+		regions[i] = make([]byte, 4096)
+
+		//nolint:gosec // Random data does not need to be secure, it just should not compress.
+		if _, err := rand.New(rand.NewSource(int64(i))).Read(regions[i]); err != nil {
+			t.Fatalf("Failed generating data: %v", err)
+		}
+	}
+
+	oldPath := filepath.Join(dir, "old")
+	newPath := filepath.Join(dir, "new")
+
+	testutil.MustWriteFile(t, oldPath, append(append([]byte{}, regions[0]...), regions[1]...), 0o600)
+	testutil.MustWriteFile(t, newPath, append(append([]byte("inserted"), regions[1]...), regions[0]...), 0o600)
 
 	output := &bytes.Buffer{}
 
 	cli := compressor.Cli{
-		Args:        []string{testCommand, compressor.ActionCompress, "--format=" + string(pkgCompressor.FormatNoop)},
+		Args: []string{
+			testCommand, compressor.ActionDiff, "--format=noop", "--old=" + oldPath, "--new=" + newPath,
+		},
 		Output:      output,
 		ErrorOutput: &bytes.Buffer{},
-		Input:       bytes.NewBufferString(expectedOutput),
 	}
 
 	if err := cli.Run(testutil.ContextWithDeadline(t)); err != nil {
-		t.Fatalf("Unexpected error running CLI: %v", err)
+		t.Fatalf("Unexpected error creating patch: %v", err)
 	}
 
-	if gotOutput := output.String(); gotOutput != expectedOutput {
-		t.Fatalf("Expected to get output %q, got %q", expectedOutput, gotOutput)
+	if maxSize := 64; output.Len() > maxSize {
+		t.Fatalf("Expected patch to have at most %d bytes, got %d", maxSize, output.Len())
 	}
 }
 
-func Test_Running_CLI_when_requested_help_via_flag_returns_no_error(t *testing.T) {
+func Test_Running_CLI_with_diff_or_patch_action_returns_error_when(t *testing.T) {
 	t.Parallel()
 
-	output := &bytes.Buffer{}
-	errorOutput := &bytes.Buffer{}
+	dir := t.TempDir()
+	oldPath := filepath.Join(dir, "old")
+	newPath := filepath.Join(dir, "new")
+	patchPath := filepath.Join(dir, "patch")
+
+	testutil.MustWriteFile(t, oldPath, []byte(testData), 0o600)
+	testutil.MustWriteFile(t, newPath, []byte(strings.Repeat(testData, 10)), 0o600)
 
 	cli := compressor.Cli{
-		Args:        []string{testCommand, "--help"},
-		Output:      output,
-		ErrorOutput: errorOutput,
-		Input:       &bytes.Buffer{},
+		Args: []string{
+			testCommand, compressor.ActionDiff, "--format=noop", "--old=" + oldPath, "--new=" + newPath,
+			"--output=" + patchPath,
+		},
+		Output:      &bytes.Buffer{},
+		ErrorOutput: &bytes.Buffer{},
 	}
 
 	if err := cli.Run(testutil.ContextWithDeadline(t)); err != nil {
-		t.Fatalf("Unexpected error running CLI: %v", err)
+		t.Fatalf("Unexpected error creating patch: %v", err)
 	}
 
-	t.Run("and_prints_usage_message_with_binary_name_to_configured_output", func(t *testing.T) {
-		t.Parallel()
+	limit := fmt.Sprintf("%d", len(testData)+1)
+
+	for name, args := range map[string][]string{
+		"diff_input_exceeds_input_limit": {
+			compressor.ActionDiff, "--old=" + oldPath, "--new=" + newPath, "--input-limit=" + limit,
+		},
+		"diff_output_exceeds_output_limit": {
+			compressor.ActionDiff, "--old=" + newPath, "--new=" + oldPath, "--output-limit=1",
+		},
+		"patch_exceeds_input_limit": {
+			compressor.ActionPatch, "--base=" + oldPath, "--patch=" + patchPath, "--input-limit=1",
+		},
+		"patched_data_exceeds_output_limit": {
+			compressor.ActionPatch, "--base=" + oldPath, "--patch=" + patchPath, "--output-limit=" + limit,
+		},
+	} {
+		args := args
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
 
-		expectedOutput := "Usage:"
-		if output := output.String(); !strings.Contains(output, expectedOutput) {
-			t.Fatalf("Expected output to include %q, got:\n%s", expectedOutput, output)
+			cli := compressor.Cli{
+				Args:        append([]string{testCommand, "--format=noop"}, args...),
+				Output:      &bytes.Buffer{},
+				ErrorOutput: &bytes.Buffer{},
+			}
+
+			err := cli.Run(testutil.ContextWithDeadline(t))
+			if err == nil {
+				t.Fatalf("Expected error running CLI")
+			}
+
+			if !strings.Contains(err.Error(), "limit") {
+				t.Fatalf("Expected error about exceeded limit, got: %v", err)
+			}
+		})
+	}
+}
+
+func Test_Running_CLI_diff_returns_error_when_decompressed_input_exceeds_output_limit(t *testing.T) {
+	t.Parallel()
+
+	// Compressed data fits into the limit, only decompressed data exceeds it.
+	buf := &bytes.Buffer{}
+	gzipWriter := gzip.NewWriter(buf)
+
+	if _, err := gzipWriter.Write(make([]byte, 1000)); err != nil {
+		t.Fatalf("Failed compressing data: %v", err)
+	}
+
+	if err := gzipWriter.Close(); err != nil {
+		t.Fatalf("Failed closing gzip writer: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "data.gz")
+	testutil.MustWriteFile(t, path, buf.Bytes(), 0o600)
+
+	cli := compressor.Cli{
+		Args: []string{
+			testCommand, compressor.ActionDiff, "--old=" + path, "--new=" + path, "--output-limit=100",
+		},
+		Output:      &bytes.Buffer{},
+		ErrorOutput: &bytes.Buffer{},
+	}
+
+	err := cli.Run(testutil.ContextWithDeadline(t))
+	if err == nil {
+		t.Fatalf("Expected error running CLI")
+	}
+
+	if !strings.Contains(err.Error(), "decompressed data exceeds limit") {
+		t.Fatalf("Expected error about exceeded limit, got: %v", err)
+	}
+}
+
+func Test_Running_CLI_uploads_output_to_requested_URL_using_PUT_request(t *testing.T) {
+	t.Parallel()
+
+	type upload struct {
+		method      string
+		contentType string
+		body        []byte
+	}
+
+	uploads := make(chan upload, 1)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+
+			return
+		}
+
+		uploads <- upload{method: r.Method, contentType: r.Header.Get("Content-Type"), body: body}
+	}))
+
+	t.Cleanup(server.Close)
+
+	output := &bytes.Buffer{}
+
+	cli := compressor.Cli{
+		Args:        []string{testCommand, compressor.ActionCompress, "--output=" + server.URL},
+		Output:      output,
+		ErrorOutput: &bytes.Buffer{},
+		Input:       bytes.NewBufferString(testData),
+	}
+
+	if err := cli.Run(testutil.ContextWithDeadline(t)); err != nil {
+		t.Fatalf("Unexpected error running CLI: %v", err)
+	}
+
+	if output.Len() != 0 {
+		t.Fatalf("Expected no data written to output, got %q", output.String())
+	}
+
+	got := <-uploads
+
+	if got.method != http.MethodPut {
+		t.Fatalf("Expected %q request, got %q", http.MethodPut, got.method)
+	}
+
+	expectedContentType := "application/gzip"
+
+	if got.contentType != expectedContentType {
+		t.Fatalf("Expected content type %q, got %q", expectedContentType, got.contentType)
+	}
+
+	if gotData := testGunzip(t, got.body); gotData != testData {
+		t.Fatalf("Expected uploaded data to decompress to %q, got %q", testData, gotData)
+	}
+}
+
+func Test_Running_CLI_uploads_output_to_and_reads_input_from_S3_compatible_storage(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu      sync.Mutex
+		objects = map[string][]byte{}
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch r.Method {
+		case http.MethodPut:
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+
+				return
+			}
+
+			objects[r.URL.Path] = body
+		case http.MethodGet:
+			object, ok := objects[r.URL.Path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+
+				return
+			}
+
+			//nolint:errcheck // Client will notice incomplete response.
+			w.Write(object)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+
+	t.Cleanup(server.Close)
+
+	s3Args := []string{"--s3-endpoint=" + server.URL, "--s3-region=us-east-1"}
+	environ := []string{"AWS_ACCESS_KEY_ID=test", "AWS_SECRET_ACCESS_KEY=test"}
+
+	compress := compressor.Cli{
+		Args:        append([]string{testCommand, compressor.ActionCompress, "--output=s3://bucket/data.gz"}, s3Args...),
+		Environ:     environ,
+		Output:      &bytes.Buffer{},
+		ErrorOutput: &bytes.Buffer{},
+		Input:       bytes.NewBufferString(testData),
+	}
+
+	if err := compress.Run(testutil.ContextWithDeadline(t)); err != nil {
+		t.Fatalf("Unexpected error compressing to S3: %v", err)
+	}
+
+	mu.Lock()
+	uploaded, ok := objects["/bucket/data.gz"]
+	mu.Unlock()
+
+	if !ok {
+		t.Fatalf("Expected object to be uploaded using path-style request, got objects %v", objects)
+	}
+
+	if gotData := testGunzip(t, uploaded); gotData != testData {
+		t.Fatalf("Expected uploaded data to decompress to %q, got %q", testData, gotData)
+	}
+
+	output := &bytes.Buffer{}
+
+	decompress := compressor.Cli{
+		Args:        append([]string{testCommand, compressor.ActionDecompress, "--input=s3://bucket/data.gz"}, s3Args...),
+		Environ:     environ,
+		Output:      output,
+		ErrorOutput: &bytes.Buffer{},
+	}
+
+	if err := decompress.Run(testutil.ContextWithDeadline(t)); err != nil {
+		t.Fatalf("Unexpected error decompressing from S3: %v", err)
+	}
+
+	if output.String() != testData {
+		t.Fatalf("Expected to get output %q, got %q", testData, output.String())
+	}
+}
+
+func Test_Running_CLI_writes_output_to_requested_output_file(t *testing.T) {
+	t.Parallel()
+
+	outputPath := filepath.Join(t.TempDir(), "output")
+
+	cli := compressor.Cli{
+		Args:        []string{testCommand, compressor.ActionCopy, "--output=" + outputPath},
+		Output:      &bytes.Buffer{},
+		ErrorOutput: &bytes.Buffer{},
+		Input:       bytes.NewBufferString(testData),
+	}
+
+	if err := cli.Run(testutil.ContextWithDeadline(t)); err != nil {
+		t.Fatalf("Unexpected error running CLI: %v", err)
+	}
+
+	testutil.RequireFileContent(t, outputPath, []byte(testData))
+}
+
+func Test_Running_CLI_preserves_input_file_name_and_modification_time_in_compressed_data(t *testing.T) {
+	t.Parallel()
+
+	inputPath := filepath.Join(t.TempDir(), "input")
+
+	testutil.MustWriteFile(t, inputPath, []byte(testData), 0o600)
+
+	expectedModTime := time.Unix(1600000000, 0)
+
+	if err := os.Chtimes(inputPath, expectedModTime, expectedModTime); err != nil {
+		t.Fatalf("Failed setting input file modification time: %v", err)
+	}
+
+	output := &bytes.Buffer{}
+
+	cli := compressor.Cli{
+		Args:        []string{testCommand, compressor.ActionCompress, "--input=" + inputPath},
+		Output:      output,
+		ErrorOutput: &bytes.Buffer{},
+	}
+
+	if err := cli.Run(testutil.ContextWithDeadline(t)); err != nil {
+		t.Fatalf("Unexpected error running CLI: %v", err)
+	}
+
+	reader, err := gzip.NewReader(output)
+	if err != nil {
+		t.Fatalf("Failed creating gzip reader: %v", err)
+	}
+
+	if expectedName := filepath.Base(inputPath); reader.Name != expectedName {
+		t.Fatalf("Expected name %q, got %q", expectedName, reader.Name)
+	}
+
+	if !reader.ModTime.Equal(expectedModTime) {
+		t.Fatalf("Expected modification time %v, got %v", expectedModTime, reader.ModTime)
+	}
+}
+
+func Test_Running_CLI_accepts_input_within_requested_input_limit(t *testing.T) {
+	t.Parallel()
+
+	for name, limit := range map[string]string{
+		"in_bytes":               fmt.Sprintf("%d", len(testData)),
+		"with_bytes_suffix":      fmt.Sprintf("%dB", len(testData)),
+		"with_suffix":            "1K",
+		"with_lowercase_suffix":  "1kb",
+		"with_binary_suffix":     "1KiB",
+		"with_mixed_case_suffix": "1mIb",
+		"with_gigabytes_suffix":  "1GB",
+		"with_terabytes_suffix":  "1t",
+		"above_size":             fmt.Sprintf("%d", len(testData)+1),
+		"for_empty_set":          "0",
+		"being_maximum_size":     fmt.Sprintf("%d", math.MaxInt64),
+	} {
+		limit := limit
+		input := testData
+
+		if name == "for_empty_set" {
+			input = ""
+		}
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			output := &bytes.Buffer{}
+
+			cli := compressor.Cli{
+				Args:        []string{testCommand, compressor.ActionCompress, "--format=noop", "--input-limit=" + limit},
+				Output:      output,
+				ErrorOutput: &bytes.Buffer{},
+				Input:       bytes.NewBufferString(input),
+			}
+
+			if err := cli.Run(testutil.ContextWithDeadline(t)); err != nil {
+				t.Fatalf("Unexpected error running CLI: %v", err)
+			}
+
+			if gotOutput := output.String(); gotOutput != input {
+				t.Fatalf("Expected to get output %q, got %q", input, gotOutput)
+			}
+		})
+	}
+}
+
+func Test_Running_CLI_limits_rate_of_reading_input_when_requested(t *testing.T) {
+	t.Parallel()
+
+	// First second worth of data is read immediately, so this should take around half a second.
+	input := strings.Repeat("a", 1536)
+	output := &bytes.Buffer{}
+
+	cli := compressor.Cli{
+		Args:        []string{testCommand, compressor.ActionCompress, "--format=noop", "--rate-limit=1K"},
+		Output:      output,
+		ErrorOutput: &bytes.Buffer{},
+		Input:       bytes.NewBufferString(input),
+	}
+
+	start := time.Now()
+
+	if err := cli.Run(testutil.ContextWithDeadline(t)); err != nil {
+		t.Fatalf("Unexpected error running CLI: %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Fatalf("Expected reading input to be rate limited, took %v", elapsed)
+	}
+
+	if gotOutput := output.String(); gotOutput != input {
+		t.Fatalf("Expected to get output %q, got %q", input, gotOutput)
+	}
+}
+
+func Test_Running_CLI_writes_output_within_requested_output_limit(t *testing.T) {
+	t.Parallel()
+
+	output := &bytes.Buffer{}
+
+	cli := compressor.Cli{
+		Args: []string{
+			testCommand, compressor.ActionCompress, "--format=noop", fmt.Sprintf("--output-limit=%d", len(testData)),
+		},
+		Output:      output,
+		ErrorOutput: &bytes.Buffer{},
+		Input:       bytes.NewBufferString(testData),
+	}
+
+	if err := cli.Run(testutil.ContextWithDeadline(t)); err != nil {
+		t.Fatalf("Unexpected error running CLI: %v", err)
+	}
+
+	if gotOutput := output.String(); gotOutput != testData {
+		t.Fatalf("Expected to get output %q, got %q", testData, gotOutput)
+	}
+}
+
+func Test_Running_CLI_prints_checksum_of_input_to_error_output_when_requested(t *testing.T) {
+	t.Parallel()
+
+	errorOutput := &bytes.Buffer{}
+
+	cli := compressor.Cli{
+		Args:        []string{testCommand, compressor.ActionCompress, "--checksum=sha256"},
+		Output:      &bytes.Buffer{},
+		ErrorOutput: errorOutput,
+		Input:       bytes.NewBufferString(testData),
+	}
+
+	if err := cli.Run(testutil.ContextWithDeadline(t)); err != nil {
+		t.Fatalf("Unexpected error running CLI: %v", err)
+	}
+
+	if errorMessage := errorOutput.String(); !strings.Contains(errorMessage, testDataSHA256) {
+		t.Fatalf("Expected error output to include %q, got:\n%s", testDataSHA256, errorMessage)
+	}
+}
+
+func Test_Running_CLI_prints_messages_as_JSON_lines_when_JSON_output_format_is_requested(t *testing.T) {
+	t.Parallel()
+
+	errorOutput := &bytes.Buffer{}
+
+	cli := compressor.Cli{
+		Args: []string{
+			testCommand, compressor.ActionCompress, "--checksum=sha256", "--output-format=" + compressor.OutputFormatJSON,
+		},
+		Output:      &bytes.Buffer{},
+		ErrorOutput: errorOutput,
+		Input:       bytes.NewBufferString(testData),
+	}
+
+	if err := cli.Run(testutil.ContextWithDeadline(t)); err != nil {
+		t.Fatalf("Unexpected error running CLI: %v", err)
+	}
+
+	message := map[string]interface{}{}
+
+	if err := json.Unmarshal(errorOutput.Bytes(), &message); err != nil {
+		t.Fatalf("Decoding error output %q as JSON: %v", errorOutput.String(), err)
+	}
+
+	if level := message["level"]; level != "info" {
+		t.Fatalf("Expected message level %q, got %q", "info", level)
+	}
+
+	if msg, _ := message["msg"].(string); !strings.Contains(msg, testDataSHA256) {
+		t.Fatalf("Expected message to include %q, got %q", testDataSHA256, msg)
+	}
+}
+
+func Test_Reporting_CLI_error_in_JSON_output_format_includes_number_of_processed_bytes(t *testing.T) {
+	t.Parallel()
+
+	errorOutput := &bytes.Buffer{}
+
+	cli := compressor.Cli{
+		Args: []string{
+			testCommand, compressor.ActionCompress, "--input-limit=1", "--output-format=" + compressor.OutputFormatJSON,
+		},
+		Output:      &bytes.Buffer{},
+		ErrorOutput: errorOutput,
+		Input:       bytes.NewBufferString(testData),
+		Progress:    &compressor.Progress{},
+	}
+
+	err := cli.Run(testutil.ContextWithDeadline(t))
+	if err == nil {
+		t.Fatalf("Expected error running CLI")
+	}
+
+	cli.ReportError(err)
+
+	message := struct {
+		Level          string `json:"level"`
+		Msg            string `json:"msg"`
+		BytesProcessed *int64 `json:"bytes_processed"`
+	}{}
+
+	if err := json.Unmarshal(errorOutput.Bytes(), &message); err != nil {
+		t.Fatalf("Decoding error output %q as JSON: %v", errorOutput.String(), err)
+	}
+
+	if message.Level != "error" {
+		t.Fatalf("Expected message level %q, got %q", "error", message.Level)
+	}
+
+	if message.Msg != err.Error() {
+		t.Fatalf("Expected message %q, got %q", err.Error(), message.Msg)
+	}
+
+	if message.BytesProcessed == nil {
+		t.Fatalf("Expected message to include number of processed bytes, got %q", errorOutput.String())
+	}
+}
+
+func Test_Running_CLI_decompresses_input_matching_requested_checksum(t *testing.T) {
+	t.Parallel()
+
+	output := &bytes.Buffer{}
+
+	cli := compressor.Cli{
+		Args: []string{
+			testCommand, compressor.ActionDecompress, "--format=noop", "--checksum=sha256",
+			"--verify-checksum=" + testDataSHA256,
+		},
+		Output:      output,
+		ErrorOutput: &bytes.Buffer{},
+		Input:       bytes.NewBufferString(testData),
+	}
+
+	if err := cli.Run(testutil.ContextWithDeadline(t)); err != nil {
+		t.Fatalf("Unexpected error running CLI: %v", err)
+	}
+
+	if gotOutput := output.String(); gotOutput != testData {
+		t.Fatalf("Expected to get output %q, got %q", testData, gotOutput)
+	}
+}
+
+func Test_Running_CLI_decompresses_data_compressed_in_blocks_when_block_size_is_set(t *testing.T) {
+	t.Parallel()
+
+	compressedData := &bytes.Buffer{}
+
+	compressCli := compressor.Cli{
+		Args:        []string{testCommand, compressor.ActionCompress, "--block-size=2", "--parallelism=2"},
+		Output:      compressedData,
+		ErrorOutput: &bytes.Buffer{},
+		Input:       bytes.NewBufferString(testData),
+	}
+
+	if err := compressCli.Run(testutil.ContextWithDeadline(t)); err != nil {
+		t.Fatalf("Unexpected error running CLI: %v", err)
+	}
+
+	output := &bytes.Buffer{}
+
+	decompressCli := compressor.Cli{
+		Args:        []string{testCommand, compressor.ActionDecompress, "--block-size=2"},
+		Output:      output,
+		ErrorOutput: &bytes.Buffer{},
+		Input:       compressedData,
+	}
+
+	if err := decompressCli.Run(testutil.ContextWithDeadline(t)); err != nil {
+		t.Fatalf("Unexpected error running CLI: %v", err)
+	}
+
+	if gotOutput := output.String(); gotOutput != testData {
+		t.Fatalf("Expected to get output %q, got %q", testData, gotOutput)
+	}
+}
+
+func Test_Running_CLI_verifies_checksum_of_data_decompressed_in_blocks(t *testing.T) {
+	t.Parallel()
+
+	compressedData := &bytes.Buffer{}
+
+	compressCli := compressor.Cli{
+		Args:        []string{testCommand, compressor.ActionCompress, "--block-size=2"},
+		Output:      compressedData,
+		ErrorOutput: &bytes.Buffer{},
+		Input:       bytes.NewBufferString(testData),
+	}
+
+	if err := compressCli.Run(testutil.ContextWithDeadline(t)); err != nil {
+		t.Fatalf("Unexpected error running CLI: %v", err)
+	}
+
+	decompressCli := compressor.Cli{
+		Args: []string{
+			testCommand, compressor.ActionDecompress, "--block-size=2", "--checksum=sha256",
+			"--verify-checksum=" + strings.Repeat("0", len(testDataSHA256)),
+		},
+		Output:      &bytes.Buffer{},
+		ErrorOutput: &bytes.Buffer{},
+		Input:       compressedData,
+	}
+
+	err := decompressCli.Run(testutil.ContextWithDeadline(t))
+	if err == nil {
+		t.Fatalf("Expected error running CLI")
+	}
+
+	if !strings.Contains(err.Error(), "checksum") {
+		t.Fatalf("Expected error to mention checksum, got %v", err)
+	}
+}
+
+func Test_Running_CLI_reports_progress_of_the_action_when_requested(t *testing.T) {
+	t.Parallel()
+
+	progress := &compressor.Progress{}
+
+	cli := compressor.Cli{
+		Args:        []string{testCommand, compressor.ActionCompress, "--format=noop"},
+		Output:      &bytes.Buffer{},
+		ErrorOutput: &bytes.Buffer{},
+		Input:       bytes.NewBufferString(testData),
+		Progress:    progress,
+	}
+
+	if err := cli.Run(testutil.ContextWithDeadline(t)); err != nil {
+		t.Fatalf("Unexpected error running CLI: %v", err)
+	}
+
+	if inputBytes := progress.InputBytes(); inputBytes != int64(len(testData)) {
+		t.Fatalf("Expected %d input bytes to be reported, got %d", len(testData), inputBytes)
+	}
+
+	if outputBytes := progress.OutputBytes(); outputBytes != int64(len(testData)) {
+		t.Fatalf("Expected %d output bytes to be reported, got %d", len(testData), outputBytes)
+	}
+}
+
+func Test_Running_CLI_tries_reading_settings_from_default_configuration_file(t *testing.T) {
+	t.Parallel()
+
+	// Temporary configuration file has the default name, so it is used when its directory is the working one.
+	dir := filepath.Dir(testutil.NewTempConfigFile(t, "format: noop"))
+
+	expectedOutput := testData
+
+	output := &bytes.Buffer{}
+
+	cli := compressor.Cli{
+		Args:        []string{testCommand, compressor.ActionCompress},
+		Output:      output,
+		ErrorOutput: &bytes.Buffer{},
+		Input:       bytes.NewBufferString(expectedOutput),
+		WorkDir:     dir,
+	}
+
+	if err := cli.Run(testutil.ContextWithDeadline(t)); err != nil {
+		t.Fatalf("Unexpected error running CLI: %v", err)
+	}
+
+	if gotOutput := output.String(); gotOutput != expectedOutput {
+		t.Fatalf("Expected to get output %q, got %q", expectedOutput, gotOutput)
+	}
+}
+
+//nolint:funlen // Test covers reloading configuration of running server.
+func Test_Reloading_CLI_configuration_when_serving(t *testing.T) {
+	t.Parallel()
+
+	for name, expected := range map[string]struct {
+		config     string
+		output     string
+		compressed bool
+	}{
+		"reports_success_and_uses_new_format_when_configuration_is_valid": {
+			config:     "format: gzip",
+			output:     "Configuration reloaded",
+			compressed: true,
+		},
+		"reports_error_and_keeps_previous_format_when_configuration_is_invalid": {
+			config: "format: foo",
+			output: "Error reloading configuration",
+		},
+	} {
+		expected := expected
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			// Length of Unix socket path is limited, so temporary directory named after the test can't be used.
+			socketDir, err := os.MkdirTemp("", "compressor")
+			if err != nil {
+				t.Fatalf("Unexpected error creating temporary directory: %v", err)
+			}
+
+			t.Cleanup(func() {
+				if err := os.RemoveAll(socketDir); err != nil {
+					t.Logf("Removing temporary directory: %v", err)
+				}
+			})
+
+			socketPath := filepath.Join(socketDir, "socket")
+			configPath := testutil.NewTempConfigFile(t, "format: noop")
+
+			ctx, cancel := context.WithCancel(testutil.ContextWithDeadline(t))
+			defer cancel()
+
+			errorOutput := &bytes.Buffer{}
+
+			cli := &compressor.Cli{
+				Args:        []string{testCommand, compressor.ActionServe, "--socket=" + socketPath},
+				Output:      &bytes.Buffer{},
+				ErrorOutput: errorOutput,
+				WorkDir:     filepath.Dir(configPath),
+			}
+
+			errCh := make(chan error, 1)
+
+			go func() {
+				errCh <- cli.Run(ctx)
+			}()
+
+			conn := testDialSocket(ctx, t, socketPath)
+
+			status, response := testServeRequest(t, conn, compressor.ServeOperationCompress, "", testData)
+			if status != compressor.ServeStatusOK || string(response) != testData {
+				t.Fatalf("Expected data to be passed through before reloading, got status %d with %q", status, response)
+			}
+
+			if err := os.WriteFile(configPath, []byte(expected.config), 0o600); err != nil {
+				t.Fatalf("Unexpected error updating configuration file: %v", err)
+			}
+
+			cli.ReloadConfig()
+
+			status, response = testServeRequest(t, conn, compressor.ServeOperationCompress, "", testData)
+			if status != compressor.ServeStatusOK {
+				t.Fatalf("Expected compressing to succeed after reloading, got error: %s", response)
+			}
+
+			if expected.compressed {
+				response = []byte(testGunzip(t, response))
+			}
+
+			if string(response) != testData {
+				t.Fatalf("Expected data %q after reloading, got %q", testData, response)
+			}
+
+			cancel()
+
+			if err := <-errCh; err != nil {
+				t.Fatalf("Expected no error when serving is interrupted, got: %v", err)
+			}
+
+			if !strings.Contains(errorOutput.String(), expected.output) {
+				t.Fatalf("Expected error output to include %q, got %q", expected.output, errorOutput.String())
+			}
+		})
+	}
+}
+
+func Test_Reloading_CLI_configuration_does_nothing_when_action_other_than_serve_is_running(t *testing.T) {
+	t.Parallel()
+
+	configPath := testutil.NewTempConfigFile(t, "format: noop")
+
+	input, inputWriter := io.Pipe()
+	output := &bytes.Buffer{}
+	errorOutput := &bytes.Buffer{}
+
+	cli := &compressor.Cli{
+		Args:        []string{testCommand, compressor.ActionCompress},
+		Output:      output,
+		ErrorOutput: errorOutput,
+		Input:       input,
+		WorkDir:     filepath.Dir(configPath),
+	}
+
+	errCh := make(chan error, 1)
+
+	go func() {
+		errCh <- cli.Run(testutil.ContextWithDeadline(t))
+	}()
+
+	// Writing blocks until the action starts reading input, so configuration is reloaded while it is running.
+	if _, err := inputWriter.Write([]byte(testData)); err != nil {
+		t.Fatalf("Unexpected error writing input: %v", err)
+	}
+
+	cli.ReloadConfig()
+
+	if err := inputWriter.Close(); err != nil {
+		t.Fatalf("Unexpected error closing input: %v", err)
+	}
+
+	if err := <-errCh; err != nil {
+		t.Fatalf("Unexpected error running CLI: %v", err)
+	}
+
+	if errorOutput.Len() != 0 {
+		t.Fatalf("Expected no error output, got %q", errorOutput.String())
+	}
+
+	if output.String() != testData {
+		t.Fatalf("Expected output %q, got %q", testData, output.String())
+	}
+}
+
+func Test_Reloading_CLI_configuration_does_nothing_when_no_action_is_running(t *testing.T) {
+	t.Parallel()
+
+	errorOutput := &bytes.Buffer{}
+
+	cli := &compressor.Cli{
+		ErrorOutput: errorOutput,
+	}
+
+	cli.ReloadConfig()
+
+	if errorOutput.Len() != 0 {
+		t.Fatalf("Expected no error output, got %q", errorOutput.String())
+	}
+}
+
+func Test_Running_CLI_reads_configuration_and_input_from_given_file_system(t *testing.T) {
+	t.Parallel()
+
+	output := &bytes.Buffer{}
+
+	cli := compressor.Cli{
+		Args:        []string{testCommand, compressor.ActionCompress, "--input=data/input"},
+		Output:      output,
+		ErrorOutput: &bytes.Buffer{},
+		FS: fstest.MapFS{
+			compressor.DefaultConfigPath: &fstest.MapFile{Data: []byte("format: noop")},
+			"data/input":                 &fstest.MapFile{Data: []byte(testData)},
+		},
+	}
+
+	if err := cli.Run(testutil.ContextWithDeadline(t)); err != nil {
+		t.Fatalf("Unexpected error running CLI: %v", err)
+	}
+
+	if output.String() != testData {
+		t.Fatalf("Expected to get output %q, got %q", testData, output.String())
+	}
+}
+
+func Test_Running_CLI_returns_error_when_input_file_does_not_exist_in_given_file_system(t *testing.T) {
+	t.Parallel()
+
+	inputPath := filepath.Join(t.TempDir(), "input")
+
+	testutil.MustWriteFile(t, inputPath, []byte(testData), 0o600)
+
+	cli := compressor.Cli{
+		Args:        []string{testCommand, compressor.ActionCompress, "--input=" + inputPath},
+		Output:      &bytes.Buffer{},
+		ErrorOutput: &bytes.Buffer{},
+		FS:          fstest.MapFS{},
+	}
+
+	err := cli.Run(testutil.ContextWithDeadline(t))
+	if err == nil {
+		t.Fatalf("Expected error running CLI")
+	}
+
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("Expected not exist error, got %v", err)
+	}
+}
+
+func Test_Running_CLI_reads_format_setting_from_specified_configuration_file_when_requested(t *testing.T) {
+	t.Parallel()
+
+	configPath := testutil.NewTempConfigFile(t, "format: noop")
+
+	expectedOutput := testData
+
+	output := &bytes.Buffer{}
+
+	cli := compressor.Cli{
+		Args:        []string{testCommand, compressor.ActionCompress, "--config=" + configPath},
+		Output:      output,
+		ErrorOutput: &bytes.Buffer{},
+		Input:       bytes.NewBufferString(expectedOutput),
+	}
+
+	if err := cli.Run(testutil.ContextWithDeadline(t)); err != nil {
+		t.Fatalf("Unexpected error running CLI: %v", err)
+	}
+
+	if gotOutput := output.String(); gotOutput != expectedOutput {
+		t.Fatalf("Expected to get output %q, got %q", expectedOutput, gotOutput)
+	}
+}
+
+func Test_Running_CLI_use_specified_format_for_actions(t *testing.T) {
+	t.Parallel()
+
+	expectedOutput := testData
+
+	output := &bytes.Buffer{}
+
+	cli := compressor.Cli{
+		Args:        []string{testCommand, compressor.ActionCompress, "--format=noop"},
+		Output:      output,
+		ErrorOutput: &bytes.Buffer{},
+		Input:       bytes.NewBufferString(expectedOutput),
+	}
+
+	if err := cli.Run(testutil.ContextWithDeadline(t)); err != nil {
+		t.Fatalf("Unexpected error running CLI: %v", err)
+	}
+
+	if gotOutput := output.String(); gotOutput != expectedOutput {
+		t.Fatalf("Expected to get output %q, got %q", expectedOutput, gotOutput)
+	}
+}
+
+func Test_Running_CLI_reads_default_format_from_environment_variable(t *testing.T) {
+	t.Parallel()
+
+	expectedOutput := testData
+
+	output := &bytes.Buffer{}
+
+	cli := compressor.Cli{
+		Args:        []string{testCommand, compressor.ActionCompress},
+		Environ:     []string{compressor.FormatEnv + "=noop"},
+		Output:      output,
+		ErrorOutput: &bytes.Buffer{},
+		Input:       bytes.NewBufferString(expectedOutput),
+	}
+
+	if err := cli.Run(testutil.ContextWithDeadline(t)); err != nil {
+		t.Fatalf("Unexpected error running CLI: %v", err)
+	}
+
+	if gotOutput := output.String(); gotOutput != expectedOutput {
+		t.Fatalf("Expected to get output %q, got %q", expectedOutput, gotOutput)
+	}
+}
+
+func Test_Running_CLI_reads_flag_values_from_prefixed_environment_variables(t *testing.T) {
+	t.Parallel()
+
+	inputPath := filepath.Join(t.TempDir(), "input")
+
+	testutil.MustWriteFile(t, inputPath, []byte(testData), 0o600)
+
+	output := &bytes.Buffer{}
+
+	cli := compressor.Cli{
+		Args: []string{testCommand, compressor.ActionCompress},
+		Environ: []string{
+			compressor.EnvPrefix + "INPUT=" + inputPath,
+			compressor.EnvPrefix + "INPUT_LIMIT=1K",
+			compressor.FormatEnv + "=noop",
+		},
+		Output:      output,
+		ErrorOutput: &bytes.Buffer{},
+	}
+
+	if err := cli.Run(testutil.ContextWithDeadline(t)); err != nil {
+		t.Fatalf("Unexpected error running CLI: %v", err)
+	}
+
+	if gotOutput := output.String(); gotOutput != testData {
+		t.Fatalf("Expected to get output %q, got %q", testData, gotOutput)
+	}
+}
+
+func Test_Running_CLI_reads_flags_without_value_from_environment_variables(t *testing.T) {
+	t.Parallel()
+
+	output := &bytes.Buffer{}
+
+	cli := compressor.Cli{
+		Args:        []string{testCommand, compressor.ActionCompress},
+		Environ:     []string{compressor.EnvPrefix + "DRY_RUN=true", compressor.FormatEnv + "=noop"},
+		Output:      output,
+		ErrorOutput: &bytes.Buffer{},
+		Input:       strings.NewReader(testData),
+	}
+
+	if err := cli.Run(testutil.ContextWithDeadline(t)); err != nil {
+		t.Fatalf("Unexpected error running CLI: %v", err)
+	}
+
+	if output.Len() != 0 {
+		t.Fatalf("Expected output to be discarded in dry run, got %q", output.String())
+	}
+}
+
+func Test_Running_CLI_prefers_disabling_flag_without_value_in_arguments_over_environment_variable(t *testing.T) {
+	t.Parallel()
+
+	output := &bytes.Buffer{}
+
+	cli := compressor.Cli{
+		Args:        []string{testCommand, compressor.ActionCompress, "--dry-run=false"},
+		Environ:     []string{compressor.EnvPrefix + "DRY_RUN=1", compressor.FormatEnv + "=noop"},
+		Output:      output,
+		ErrorOutput: &bytes.Buffer{},
+		Input:       strings.NewReader(testData),
+	}
+
+	if err := cli.Run(testutil.ContextWithDeadline(t)); err != nil {
+		t.Fatalf("Unexpected error running CLI: %v", err)
+	}
+
+	if output.String() != testData {
+		t.Fatalf("Expected to get output %q, got %q", testData, output.String())
+	}
+}
+
+func Test_Running_CLI_returns_error_when_environment_variable_of_flag_without_value_is_not_boolean(t *testing.T) {
+	t.Parallel()
+
+	cli := compressor.Cli{
+		Args:        []string{testCommand, compressor.ActionCompress},
+		Environ:     []string{compressor.EnvPrefix + "DRY_RUN=maybe"},
+		Output:      &bytes.Buffer{},
+		ErrorOutput: &bytes.Buffer{},
+		Input:       strings.NewReader(testData),
+	}
+
+	err := cli.Run(testutil.ContextWithDeadline(t))
+	if err == nil {
+		t.Fatalf("Expected error running CLI")
+	}
+
+	if !strings.Contains(err.Error(), compressor.EnvPrefix+"DRY_RUN") {
+		t.Fatalf("Expected error to mention environment variable, got: %v", err)
+	}
+}
+
+//nolint:paralleltest // This test sets environment variables.
+func Test_Running_CLI_with_environment_defined_ignores_environment_variables_of_the_process(t *testing.T) {
+	t.Setenv(compressor.FormatEnv, "unknown")
+
+	cli := compressor.Cli{
+		Args:        []string{testCommand, compressor.ActionCompress},
+		Environ:     []string{},
+		Output:      &bytes.Buffer{},
+		ErrorOutput: &bytes.Buffer{},
+		Input:       strings.NewReader(testData),
+	}
+
+	if err := cli.Run(testutil.ContextWithDeadline(t)); err != nil {
+		t.Fatalf("Unexpected error running CLI: %v", err)
+	}
+}
+
+func Test_Running_CLI_uses_last_value_of_duplicated_environment_variable(t *testing.T) {
+	t.Parallel()
+
+	output := &bytes.Buffer{}
+
+	cli := compressor.Cli{
+		Args:        []string{testCommand, compressor.ActionCompress},
+		Environ:     []string{compressor.FormatEnv + "=gzip", compressor.FormatEnv + "=noop"},
+		Output:      output,
+		ErrorOutput: &bytes.Buffer{},
+		Input:       strings.NewReader(testData),
+	}
+
+	if err := cli.Run(testutil.ContextWithDeadline(t)); err != nil {
+		t.Fatalf("Unexpected error running CLI: %v", err)
+	}
+
+	if output.String() != testData {
+		t.Fatalf("Expected to get output %q, got %q", testData, output.String())
+	}
+}
+
+func Test_Running_CLI_prefers_format_setting_from_arguments_over_environment_variable(t *testing.T) {
+	t.Parallel()
+
+	expectedOutput := testData
+
+	output := &bytes.Buffer{}
+
+	cli := compressor.Cli{
+		Args:        []string{testCommand, compressor.ActionCompress, "--format=" + string(pkgCompressor.FormatNoop)},
+		Environ:     []string{compressor.FormatEnv + "=" + string(pkgCompressor.FormatGzip)},
+		Output:      output,
+		ErrorOutput: &bytes.Buffer{},
+		Input:       bytes.NewBufferString(expectedOutput),
+	}
+
+	if err := cli.Run(testutil.ContextWithDeadline(t)); err != nil {
+		t.Fatalf("Unexpected error running CLI: %v", err)
+	}
+
+	if gotOutput := output.String(); gotOutput != expectedOutput {
+		t.Fatalf("Expected to get output %q, got %q", expectedOutput, gotOutput)
+	}
+}
+
+func Test_Running_CLI_reads_additional_arguments_from_given_file(t *testing.T) {
+	t.Parallel()
+
+	argsPath := filepath.Join(t.TempDir(), "args")
+
+	testutil.MustWriteFile(t, argsPath, []byte(compressor.ActionCompress+"\n\n--format=gzip\r\n"), 0o600)
+
+	// Format from arguments file is overridden regardless of the position of --args-file flag.
+	for name, args := range map[string][]string{
+		"giving_precedence_to_arguments_given_after_the_file":  {"--args-file=" + argsPath, "--format=noop"},
+		"giving_precedence_to_arguments_given_before_the_file": {"--format=noop", "--args-file=" + argsPath},
+		"when_file_is_given_using_at_sign_prefix":              {"@" + argsPath, "--format=noop"},
+		"when_file_is_given_using_value_separated_by_space":    {"--args-file", argsPath, "--format=noop"},
+	} {
+		args := args
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			output := &bytes.Buffer{}
+
+			cli := compressor.Cli{
+				Args:        append([]string{testCommand}, args...),
+				Output:      output,
+				ErrorOutput: &bytes.Buffer{},
+				Input:       bytes.NewBufferString(testData),
+			}
+
+			if err := cli.Run(testutil.ContextWithDeadline(t)); err != nil {
+				t.Fatalf("Unexpected error running CLI: %v", err)
+			}
+
+			if gotOutput := output.String(); gotOutput != testData {
+				t.Fatalf("Expected to get output %q, got %q", testData, gotOutput)
+			}
+		})
+	}
+}
+
+func Test_Running_CLI_treats_only_arguments_after_end_of_flags_in_arguments_file_as_positional(t *testing.T) {
+	t.Parallel()
+
+	argsPath := filepath.Join(t.TempDir(), "args")
+
+	testutil.MustWriteFile(t, argsPath, []byte("--\n"+compressor.ActionCompress+"\n"), 0o600)
+
+	output := &bytes.Buffer{}
+
+	cli := compressor.Cli{
+		Args:        []string{testCommand, "@" + argsPath, "--format=noop"},
+		Output:      output,
+		ErrorOutput: &bytes.Buffer{},
+		Input:       bytes.NewBufferString(testData),
+	}
+
+	if err := cli.Run(testutil.ContextWithDeadline(t)); err != nil {
+		t.Fatalf("Unexpected error running CLI: %v", err)
+	}
+
+	if gotOutput := output.String(); gotOutput != testData {
+		t.Fatalf("Expected to get output %q, got %q", testData, gotOutput)
+	}
+}
+
+func Test_Running_CLI_reads_arguments_file_from_configured_file_system(t *testing.T) {
+	t.Parallel()
+
+	output := &bytes.Buffer{}
+
+	cli := compressor.Cli{
+		Args:        []string{testCommand, "@args"},
+		Output:      output,
+		ErrorOutput: &bytes.Buffer{},
+		Input:       bytes.NewBufferString(testData),
+		FS: fstest.MapFS{
+			"args": &fstest.MapFile{Data: []byte("--format=noop\n" + compressor.ActionCompress)},
+		},
+	}
+
+	if err := cli.Run(testutil.ContextWithDeadline(t)); err != nil {
+		t.Fatalf("Unexpected error running CLI: %v", err)
+	}
+
+	if gotOutput := output.String(); gotOutput != testData {
+		t.Fatalf("Expected to get output %q, got %q", testData, gotOutput)
+	}
+}
+
+func Test_Running_CLI_does_not_load_arguments_file_from_flag_value_starting_with_at_sign(t *testing.T) {
+	t.Parallel()
+
+	for name, flag := range map[string]string{
+		"given_using_long_flag":  "--input",
+		"given_using_short_flag": "-i",
+	} {
+		flag := flag
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			output := &bytes.Buffer{}
+
+			cli := compressor.Cli{
+				Args:        []string{testCommand, compressor.ActionCompress, "--format=noop", flag, "@input"},
+				Output:      output,
+				ErrorOutput: &bytes.Buffer{},
+				FS: fstest.MapFS{
+					"@input": &fstest.MapFile{Data: []byte(testData)},
+				},
+			}
+
+			if err := cli.Run(testutil.ContextWithDeadline(t)); err != nil {
+				t.Fatalf("Unexpected error running CLI: %v", err)
+			}
+
+			if gotOutput := output.String(); gotOutput != testData {
+				t.Fatalf("Expected to get output %q, got %q", testData, gotOutput)
+			}
+		})
+	}
+}
+
+func Test_Running_CLI_returns_error_when_given_arguments_file_can_not_be_read(t *testing.T) {
+	t.Parallel()
+
+	missingPath := filepath.Join(t.TempDir(), "missing")
+
+	for name, arg := range map[string]string{
+		"using_flag":              "--args-file=" + missingPath,
+		"using_at_sign_prefix":    "@" + missingPath,
+		"using_flag_without_path": "--args-file",
+	} {
+		arg := arg
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			cli := compressor.Cli{
+				Args:        []string{testCommand, arg},
+				Output:      &bytes.Buffer{},
+				ErrorOutput: &bytes.Buffer{},
+			}
+
+			if err := cli.Run(testutil.ContextWithDeadline(t)); err == nil {
+				t.Fatalf("Expected error running CLI")
+			}
+		})
+	}
+}
+
+func Test_Running_CLI_accepts_flags_in_standard_forms(t *testing.T) {
+	t.Parallel()
+
+	for name, args := range map[string][]string{
+		"with_double_dash":                              {"--format=noop", compressor.ActionCompress},
+		"with_single_dash":                              {"-format=noop", compressor.ActionCompress},
+		"after_action":                                  {compressor.ActionCompress, "--format=noop"},
+		"with_explicitly_disabled_boolean":              {compressor.ActionCompress, "--format=noop", "--version=false"},
+		"with_value_separated_by_space":                 {"--format", "noop", compressor.ActionCompress},
+		"with_value_separated_by_space_after_action":    {compressor.ActionCompress, "--format", "noop"},
+		"with_value_separated_by_space_and_single_dash": {"-format", "noop", compressor.ActionCompress},
+		"with_short_flag":                               {"-f", "noop", compressor.ActionCompress},
+		"with_short_flag_and_value_without_space":       {"-fnoop", compressor.ActionCompress},
+		"with_short_flag_and_separator":                 {"-f=noop", compressor.ActionCompress},
+	} {
+		args := args
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			output := &bytes.Buffer{}
+
+			cli := compressor.Cli{
+				Args:        append([]string{testCommand}, args...),
+				Output:      output,
+				ErrorOutput: &bytes.Buffer{},
+				Input:       bytes.NewBufferString(testData),
+			}
+
+			if err := cli.Run(testutil.ContextWithDeadline(t)); err != nil {
+				t.Fatalf("Unexpected error running CLI: %v", err)
+			}
+
+			if gotOutput := output.String(); gotOutput != testData {
+				t.Fatalf("Expected to get output %q, got %q", testData, gotOutput)
+			}
+		})
+	}
+}
+
+func Test_Running_CLI_accepts_short_flags_for_input_output_and_config(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	inputPath := filepath.Join(dir, "input")
+	outputPath := filepath.Join(dir, "output")
+	configPath := testutil.NewTempConfigFile(t, "format: noop")
+
+	testutil.MustWriteFile(t, inputPath, []byte(testData), 0o600)
+
+	cli := compressor.Cli{
+		Args: []string{
+			testCommand, compressor.ActionCompress, "-i", inputPath, "-o" + outputPath, "-c", configPath,
+			"--no-auto-extension",
+		},
+		Output:      &bytes.Buffer{},
+		ErrorOutput: &bytes.Buffer{},
+	}
+
+	if err := cli.Run(testutil.ContextWithDeadline(t)); err != nil {
+		t.Fatalf("Unexpected error running CLI: %v", err)
+	}
+
+	testutil.RequireFileContent(t, outputPath, []byte(testData))
+}
+
+func Test_Running_CLI_when_requested_help_via_short_flag_prints_usage(t *testing.T) {
+	t.Parallel()
+
+	output := &bytes.Buffer{}
+
+	cli := compressor.Cli{
+		Args:        []string{testCommand, "-h"},
+		Output:      output,
+		ErrorOutput: &bytes.Buffer{},
+	}
+
+	if err := cli.Run(testutil.ContextWithDeadline(t)); err != nil {
+		t.Fatalf("Unexpected error running CLI: %v", err)
+	}
+
+	if expectedOutput := "-f, --format"; !strings.Contains(output.String(), expectedOutput) {
+		t.Fatalf("Expected output to include %q, got:\n%s", expectedOutput, output.String())
+	}
+}
+
+func Test_Running_CLI_does_not_parse_arguments_after_end_of_flags_separator_as_flags(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	inputPath := filepath.Join(dir, "-input")
+
+	testutil.MustWriteFile(t, inputPath, []byte(testData), 0o600)
+
+	for name, args := range map[string][]string{
+		"using_first_one_as_input_path_when_action_is_given": {compressor.ActionCompress, "--format=noop", "--", inputPath},
+		"using_first_one_as_action_when_action_is_not_given": {"--format=noop", "--", compressor.ActionCompress, inputPath},
+		"using_input_path_given_after_separator_over_the_flag": {
+			"--input=missing", "-f", "noop", "--", compressor.ActionCopy, inputPath,
+		},
+	} {
+		args := args
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			output := &bytes.Buffer{}
+
+			cli := compressor.Cli{
+				Args:        append([]string{testCommand}, args...),
+				Output:      output,
+				ErrorOutput: &bytes.Buffer{},
+			}
+
+			if err := cli.Run(testutil.ContextWithDeadline(t)); err != nil {
+				t.Fatalf("Unexpected error running CLI: %v", err)
+			}
+
+			if gotOutput := output.String(); gotOutput != testData {
+				t.Fatalf("Expected to get output %q, got %q", testData, gotOutput)
+			}
+		})
+	}
+
+	for name, args := range map[string][]string{
+		"returns_error_when_more_than_one_input_path_is_given": {compressor.ActionCompress, "--", "-a", "-b"},
+		"returns_error_when_first_argument_is_not_an_action":   {"--", "-a"},
+	} {
+		args := args
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			cli := compressor.Cli{
+				Args:        append([]string{testCommand}, args...),
+				Output:      &bytes.Buffer{},
+				ErrorOutput: &bytes.Buffer{},
+			}
+
+			if err := cli.Run(testutil.ContextWithDeadline(t)); err == nil {
+				t.Fatalf("Expected error running CLI")
+			}
+		})
+	}
+}
+
+func Test_Running_CLI_with_multiple_inputs_compresses_their_concatenation(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	firstPath := filepath.Join(dir, "first")
+	secondPath := filepath.Join(dir, "second")
+
+	testutil.MustWriteFile(t, firstPath, []byte("foo"), 0o600)
+	testutil.MustWriteFile(t, secondPath, []byte("bar"), 0o600)
+
+	output := &bytes.Buffer{}
+
+	cli := compressor.Cli{
+		Args:        []string{testCommand, compressor.ActionCompress, "--input=" + firstPath, "-i", secondPath},
+		Output:      output,
+		ErrorOutput: &bytes.Buffer{},
+	}
+
+	if err := cli.Run(testutil.ContextWithDeadline(t)); err != nil {
+		t.Fatalf("Unexpected error running CLI: %v", err)
+	}
+
+	reader, err := gzip.NewReader(output)
+	if err != nil {
+		t.Fatalf("Unexpected error creating gzip reader: %v", err)
+	}
+
+	decompressed, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("Unexpected error decompressing output: %v", err)
+	}
+
+	if expected := "foobar"; string(decompressed) != expected {
+		t.Fatalf("Expected decompressed output %q, got %q", expected, decompressed)
+	}
+
+	if name := reader.Header.Name; name != "" {
+		t.Fatalf("Expected no original name to be preserved for multiple inputs, got %q", name)
+	}
+}
+
+func Test_Running_CLI_returns_error_when_one_of_multiple_inputs_can_not_be_opened(t *testing.T) {
+	t.Parallel()
+
+	inputPath := filepath.Join(t.TempDir(), "input")
+
+	testutil.MustWriteFile(t, inputPath, []byte(testData), 0o600)
+
+	cli := compressor.Cli{
+		Args:        []string{testCommand, compressor.ActionCompress, "-i", inputPath, "-i", inputPath + "-missing"},
+		Output:      &bytes.Buffer{},
+		ErrorOutput: &bytes.Buffer{},
+	}
+
+	if err := cli.Run(testutil.ContextWithDeadline(t)); err == nil {
+		t.Fatalf("Expected error running CLI")
+	}
+}
+
+func Test_Running_CLI_replaces_input_from_environment_variable_with_inputs_from_arguments(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	firstPath := filepath.Join(dir, "first")
+	secondPath := filepath.Join(dir, "second")
+
+	testutil.MustWriteFile(t, firstPath, []byte("foo"), 0o600)
+	testutil.MustWriteFile(t, secondPath, []byte("bar"), 0o600)
+
+	output := &bytes.Buffer{}
+
+	cli := compressor.Cli{
+		Args:        []string{testCommand, compressor.ActionCopy, "-i", firstPath, "-i", secondPath},
+		Environ:     []string{compressor.EnvPrefix + "INPUT=" + filepath.Join(dir, "missing")},
+		Output:      output,
+		ErrorOutput: &bytes.Buffer{},
+	}
+
+	if err := cli.Run(testutil.ContextWithDeadline(t)); err != nil {
+		t.Fatalf("Unexpected error running CLI: %v", err)
+	}
+
+	if expected := "foobar"; output.String() != expected {
+		t.Fatalf("Expected output %q, got %q", expected, output.String())
+	}
+}
+
+func Test_Running_CLI_compresses_files_found_recursively_using_block_compression(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0o700); err != nil {
+		t.Fatalf("Failed creating directory: %v", err)
+	}
+
+	testutil.MustWriteFile(t, filepath.Join(dir, "a.log"), []byte("foo"), 0o600)
+	testutil.MustWriteFile(t, filepath.Join(dir, "b.txt"), []byte("bar"), 0o600)
+	testutil.MustWriteFile(t, filepath.Join(dir, "sub", "c.log"), []byte("baz"), 0o600)
+	testutil.MustWriteFile(t, filepath.Join(dir, "sub", "d.log"), []byte("qux"), 0o600)
+
+	compressed := &bytes.Buffer{}
+
+	cli := compressor.Cli{
+		Args: []string{
+			testCommand, compressor.ActionCompress, "--recursive", "--input=" + dir, "--include=*.log", "--exclude=d.*",
+		},
+		Output:      compressed,
+		ErrorOutput: &bytes.Buffer{},
+	}
+
+	if err := cli.Run(testutil.ContextWithDeadline(t)); err != nil {
+		t.Fatalf("Unexpected error compressing: %v", err)
+	}
+
+	output := &bytes.Buffer{}
+
+	cli = compressor.Cli{
+		Args: []string{
+			testCommand, compressor.ActionDecompress, "--block-size=" + compressor.DefaultRecursiveBlockSize,
+		},
+		Output:      output,
+		ErrorOutput: &bytes.Buffer{},
+		Input:       compressed,
+	}
+
+	if err := cli.Run(testutil.ContextWithDeadline(t)); err != nil {
+		t.Fatalf("Unexpected error decompressing: %v", err)
+	}
+
+	if expected := "foobaz"; output.String() != expected {
+		t.Fatalf("Expected decompressed output %q, got %q", expected, output.String())
+	}
+}
+
+func Test_Running_CLI_with_recursive_flag_returns_error_when(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	for name, args := range map[string][]string{
+		"used_with_action_other_than_compress": {compressor.ActionDecompress, "--recursive", "--input=" + dir},
+		"include_is_used_without_it":           {compressor.ActionCompress, "--include=*", "--input=" + dir},
+		"input_path_is_not_given":              {compressor.ActionCompress, "--recursive"},
+		"no_files_are_found":                   {compressor.ActionCompress, "--recursive", "--input=" + dir},
+		"pattern_is_malformed":                 {compressor.ActionCompress, "--recursive", "--input=" + dir, "--exclude=["},
+		"input_directory_does_not_exist": {
+			compressor.ActionCompress, "--recursive", "--input=" + filepath.Join(dir, "missing"),
+		},
+	} {
+		args := args
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			cli := compressor.Cli{
+				Args:        append([]string{testCommand}, args...),
+				Output:      &bytes.Buffer{},
+				ErrorOutput: &bytes.Buffer{},
+				Input:       &bytes.Buffer{},
+			}
+
+			if err := cli.Run(testutil.ContextWithDeadline(t)); err == nil {
+				t.Fatalf("Expected error running CLI")
+			}
+		})
+	}
+}
+
+func Test_Running_CLI_with_archive_flag_restores_compressed_directory_when_decompressing(t *testing.T) {
+	t.Parallel()
+
+	dir := filepath.Join(t.TempDir(), "data")
+
+	if err := os.MkdirAll(filepath.Join(dir, "sub", "empty"), 0o700); err != nil {
+		t.Fatalf("Failed creating directory: %v", err)
+	}
+
+	testutil.MustWriteFile(t, filepath.Join(dir, "a.txt"), []byte("foo"), 0o600)
+	testutil.MustWriteFile(t, filepath.Join(dir, "sub", "b.txt"), []byte("bar"), 0o600)
+
+	compressed := &bytes.Buffer{}
+
+	cli := compressor.Cli{
+		Args:        []string{testCommand, compressor.ActionCompress, "--archive", "--input=" + dir},
+		Output:      compressed,
+		ErrorOutput: &bytes.Buffer{},
+	}
+
+	if err := cli.Run(testutil.ContextWithDeadline(t)); err != nil {
+		t.Fatalf("Unexpected error compressing: %v", err)
+	}
+
+	outputDir := t.TempDir()
+
+	cli = compressor.Cli{
+		Args:        []string{testCommand, compressor.ActionDecompress, "--archive", "--output=" + outputDir},
+		Output:      &bytes.Buffer{},
+		ErrorOutput: &bytes.Buffer{},
+		Input:       compressed,
+	}
+
+	if err := cli.Run(testutil.ContextWithDeadline(t)); err != nil {
+		t.Fatalf("Unexpected error decompressing: %v", err)
+	}
+
+	testutil.RequireFileContent(t, filepath.Join(outputDir, "data", "a.txt"), []byte("foo"))
+	testutil.RequireFileContent(t, filepath.Join(outputDir, "data", "sub", "b.txt"), []byte("bar"))
+
+	if info, err := os.Stat(filepath.Join(outputDir, "data", "sub", "empty")); err != nil || !info.IsDir() {
+		t.Fatalf("Expected empty directory to be restored, got error: %v", err)
+	}
+}
+
+func Test_Running_CLI_with_archive_flag_returns_error_when(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	for name, args := range map[string][]string{
+		"used_with_action_other_than_compress_or_decompress": {compressor.ActionCopy, "--archive", "--input=" + dir},
+		"used_together_with_recursive_flag":                  {compressor.ActionCompress, "--archive", "--recursive"},
+		"input_path_is_not_given":                            {compressor.ActionCompress, "--archive"},
+		"output_directory_is_not_given":                      {compressor.ActionDecompress, "--archive"},
+		"input_does_not_exist": {
+			compressor.ActionCompress, "--archive", "--input=" + filepath.Join(dir, "missing"),
+		},
+		"decompressed_data_is_not_an_archive": {
+			compressor.ActionDecompress, "--archive", "--output=" + dir, "--input=testdata/golden/compressed-gzip",
+		},
+	} {
+		args := args
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			cli := compressor.Cli{
+				Args:        append([]string{testCommand}, args...),
+				Output:      &bytes.Buffer{},
+				ErrorOutput: &bytes.Buffer{},
+				Input:       &bytes.Buffer{},
+			}
+
+			if err := cli.Run(testutil.ContextWithDeadline(t)); err == nil {
+				t.Fatalf("Expected error running CLI")
+			}
+		})
+	}
+}
+
+func Test_Running_CLI_unzip_extracts_archive_created_by_zip(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "a.txt")
+
+	if err := os.MkdirAll(filepath.Join(dir, "data", "sub"), 0o700); err != nil {
+		t.Fatalf("Failed creating directory: %v", err)
+	}
+
+	testutil.MustWriteFile(t, file, []byte("foo"), 0o600)
+	testutil.MustWriteFile(t, filepath.Join(dir, "data", "sub", "b.txt"), []byte("bar"), 0o600)
+
+	archive := &bytes.Buffer{}
+
+	cli := compressor.Cli{
+		Args: []string{
+			testCommand, compressor.ActionZip, "--input=" + file, "--input=" + filepath.Join(dir, "data"), "--zip-level=9",
+		},
+		Output:      archive,
+		ErrorOutput: &bytes.Buffer{},
+	}
+
+	if err := cli.Run(testutil.ContextWithDeadline(t)); err != nil {
+		t.Fatalf("Unexpected error creating archive: %v", err)
+	}
+
+	outputDir := t.TempDir()
+
+	cli = compressor.Cli{
+		Args:        []string{testCommand, compressor.ActionUnzip, "--output=" + outputDir},
+		Output:      &bytes.Buffer{},
+		ErrorOutput: &bytes.Buffer{},
+		Input:       archive,
+	}
+
+	if err := cli.Run(testutil.ContextWithDeadline(t)); err != nil {
+		t.Fatalf("Unexpected error extracting archive: %v", err)
+	}
+
+	testutil.RequireFileContent(t, filepath.Join(outputDir, "a.txt"), []byte("foo"))
+	testutil.RequireFileContent(t, filepath.Join(outputDir, "data", "sub", "b.txt"), []byte("bar"))
+}
+
+func Test_Running_CLI_zip_compresses_archive_entries_using_given_level(t *testing.T) {
+	t.Parallel()
+
+	file := filepath.Join(t.TempDir(), "data")
+
+	testutil.MustWriteFile(t, file, bytes.Repeat([]byte("foo"), 1000), 0o600)
+
+	sizes := map[string]int{}
+
+	for _, level := range []string{"0", "9"} {
+		archive := &bytes.Buffer{}
+
+		cli := compressor.Cli{
+			Args:        []string{testCommand, compressor.ActionZip, "--input=" + file, "--zip-level=" + level},
+			Output:      archive,
+			ErrorOutput: &bytes.Buffer{},
+		}
+
+		if err := cli.Run(testutil.ContextWithDeadline(t)); err != nil {
+			t.Fatalf("Unexpected error creating archive with level %s: %v", level, err)
+		}
+
+		sizes[level] = archive.Len()
+	}
+
+	if sizes["9"] >= sizes["0"] {
+		t.Fatalf("Expected archive with level 9 to be smaller than with level 0, got %d and %d bytes",
+			sizes["9"], sizes["0"])
+	}
+}
+
+func Test_Running_CLI_with_zip_action_returns_error_when(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	for name, args := range map[string][]string{
+		"zip_level_is_used_with_other_action": {compressor.ActionCompress, "--zip-level=1"},
+		"zip_level_is_not_a_number":           {compressor.ActionZip, "--input=" + dir, "--zip-level=foo"},
+		"zip_level_is_out_of_range":           {compressor.ActionZip, "--input=" + dir, "--zip-level=10"},
+		"input_path_is_not_given":             {compressor.ActionZip},
+		"input_does_not_exist":                {compressor.ActionZip, "--input=" + filepath.Join(dir, "missing")},
+		"output_directory_is_not_given":       {compressor.ActionUnzip},
+		"input_is_not_an_archive": {
+			compressor.ActionUnzip, "--output=" + dir, "--input=testdata/golden/compressed-gzip",
+		},
+	} {
+		args := args
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			cli := compressor.Cli{
+				Args:        append([]string{testCommand}, args...),
+				Output:      &bytes.Buffer{},
+				ErrorOutput: &bytes.Buffer{},
+				Input:       &bytes.Buffer{},
+			}
+
+			if err := cli.Run(testutil.ContextWithDeadline(t)); err == nil {
+				t.Fatalf("Expected error running CLI")
+			}
+		})
+	}
+}
+
+//nolint:funlen // Test covers whole watching lifecycle.
+func Test_Running_CLI_with_watch_flag_processes_input_again_every_time_it_changes(t *testing.T) {
+	t.Parallel()
+
+	inputPath := filepath.Join(t.TempDir(), "input")
+	outputDir := t.TempDir()
+
+	if err := os.WriteFile(inputPath, []byte("foo"), 0o600); err != nil {
+		t.Fatalf("Unexpected error writing input: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(testutil.ContextWithDeadline(t))
+	defer cancel()
+
+	cli := &compressor.Cli{
+		Args: []string{
+			testCommand, compressor.ActionCompress, "--watch",
+			"--input=" + inputPath, "--output=" + filepath.Join(outputDir, "out"),
+		},
+		Output:      &bytes.Buffer{},
+		ErrorOutput: &bytes.Buffer{},
+	}
+
+	errCh := make(chan error, 1)
+
+	go func() {
+		errCh <- cli.Run(ctx)
+	}()
+
+	// waitForOutputs waits until output files contain given data, as they are written in the background.
+	waitForOutputs := func(expected ...string) {
+		t.Helper()
+
+		var outputs []string
+
+		for {
+			paths, err := filepath.Glob(filepath.Join(outputDir, "out-*.gz"))
+			if err != nil {
+				t.Fatalf("Unexpected error listing outputs: %v", err)
+			}
+
+			outputs = nil
+
+			for _, path := range paths {
+				data, err := os.ReadFile(path)
+				if err != nil {
+					t.Fatalf("Unexpected error reading output: %v", err)
+				}
+
+				// Output may not be fully written yet.
+				reader, err := gzip.NewReader(bytes.NewReader(data))
+				if err != nil {
+					break
+				}
+
+				decompressed, err := io.ReadAll(reader)
+				if err != nil {
+					break
+				}
+
+				outputs = append(outputs, string(decompressed))
+			}
+
+			// Timestamps in file names sort chronologically.
+			if strings.Join(outputs, ",") == strings.Join(expected, ",") {
+				return
+			}
+
+			select {
+			case <-ctx.Done():
+				t.Fatalf("Expected outputs %q, got %q", expected, outputs)
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+	}
+
+	waitForOutputs("foo")
+
+	if err := os.WriteFile(inputPath, []byte("bar"), 0o600); err != nil {
+		t.Fatalf("Unexpected error updating input: %v", err)
+	}
+
+	waitForOutputs("foo", "bar")
+
+	cancel()
+
+	if err := <-errCh; err != nil {
+		t.Fatalf("Expected no error when watching is interrupted, got: %v", err)
+	}
+}
+
+func Test_Running_CLI_with_watch_flag_returns_error_when(t *testing.T) {
+	t.Parallel()
+
+	inputPath := filepath.Join(t.TempDir(), "input")
+
+	if err := os.WriteFile(inputPath, []byte(testData), 0o600); err != nil {
+		t.Fatalf("Unexpected error writing input: %v", err)
+	}
+
+	inputDir := filepath.Dir(inputPath)
+	outputPath := filepath.Join(t.TempDir(), "out")
+
+	for name, testCase := range map[string]struct {
+		args []string
+		fs   fs.FS
+	}{
+		"used_with_action_not_processing_data": {
+			args: []string{compressor.ActionBenchmark, "--input=" + inputPath, "--output=" + outputPath},
+		},
+		"input_path_is_not_given": {
+			args: []string{compressor.ActionCompress, "--output=" + outputPath},
+		},
+		"multiple_input_paths_are_given": {
+			args: []string{compressor.ActionCompress, "--input=" + inputPath, "--input=" + inputPath, "--output=" + outputPath},
+		},
+		"input_is_url": {
+			args: []string{compressor.ActionCompress, "--input=http://localhost/input", "--output=" + outputPath},
+		},
+		"output_path_is_not_given": {
+			args: []string{compressor.ActionCompress, "--input=" + inputPath},
+		},
+		"used_with_recursive_flag": {
+			args: []string{compressor.ActionCompress, "--recursive", "--input=" + inputDir, "--output=" + outputPath},
+		},
+		"custom_file_system_is_used": {
+			args: []string{compressor.ActionCompress, "--input=input", "--output=out"},
+			fs:   fstest.MapFS{"input": &fstest.MapFile{Data: []byte(testData)}},
+		},
+		"input_does_not_exist": {
+			args: []string{compressor.ActionCompress, "--input=" + inputPath + "-missing", "--output=" + outputPath},
+		},
+		"output_is_inside_watched_directory": {
+			args: []string{compressor.ActionCompress, "--archive", "--input=" + inputDir, "--output=" + inputPath},
+		},
+	} {
+		testCase := testCase
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			cli := compressor.Cli{
+				Args:        append([]string{testCommand, "--watch"}, testCase.args...),
+				Output:      &bytes.Buffer{},
+				ErrorOutput: &bytes.Buffer{},
+				FS:          testCase.fs,
+			}
+
+			if err := cli.Run(testutil.ContextWithDeadline(t)); err == nil {
+				t.Fatalf("Expected error running CLI")
+			}
+		})
+	}
+}
+
+func Test_Running_CLI_with_chunk_size_flag_produces_valid_data(t *testing.T) {
+	t.Parallel()
+
+	output := &bytes.Buffer{}
+
+	cli := compressor.Cli{
+		Args:        []string{testCommand, compressor.ActionCompress, "--chunk-size=1"},
+		Output:      output,
+		ErrorOutput: &bytes.Buffer{},
+		Input:       strings.NewReader(testData),
+	}
+
+	if err := cli.Run(testutil.ContextWithDeadline(t)); err != nil {
+		t.Fatalf("Unexpected error running CLI: %v", err)
+	}
+
+	if decompressed := testGunzip(t, output.Bytes()); decompressed != testData {
+		t.Fatalf("Expected decompressed output %q, got %q", testData, decompressed)
+	}
+}
+
+func Test_Running_CLI_with_chunk_size_flag_returns_error_when(t *testing.T) {
+	t.Parallel()
+
+	for name, args := range map[string][]string{
+		"used_with_action_not_processing_data": {compressor.ActionCopy, "--chunk-size=1K"},
+		"chunk_size_is_malformed":              {compressor.ActionCompress, "--chunk-size=foo"},
+		"chunk_size_is_zero":                   {compressor.ActionCompress, "--chunk-size=0"},
+		"chunk_size_is_too_big":                {compressor.ActionCompress, "--chunk-size=4G"},
+	} {
+		args := args
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			cli := compressor.Cli{
+				Args:        append([]string{testCommand}, args...),
+				Output:      &bytes.Buffer{},
+				ErrorOutput: &bytes.Buffer{},
+				Input:       strings.NewReader(testData),
+			}
+
+			if err := cli.Run(testutil.ContextWithDeadline(t)); err == nil {
+				t.Fatalf("Expected error running CLI")
+			}
+		})
+	}
+}
+
+func Test_Running_CLI_returns_error_when_value_of_last_flag_is_missing(t *testing.T) {
+	t.Parallel()
+
+	cli := compressor.Cli{
+		Args:        []string{testCommand, compressor.ActionCompress, "--format"},
+		Output:      &bytes.Buffer{},
+		ErrorOutput: &bytes.Buffer{},
+	}
+
+	if err := cli.Run(testutil.ContextWithDeadline(t)); err == nil {
+		t.Fatalf("Expected error running CLI")
+	}
+}
+
+func Test_Running_CLI_with_undefined_flag_prints_error_message_to_error_output(t *testing.T) {
+	t.Parallel()
+
+	errorOutput := &bytes.Buffer{}
+
+	cli := compressor.Cli{
+		Args:        []string{testCommand, compressor.ActionCompress, "--undefined"},
+		Output:      &bytes.Buffer{},
+		ErrorOutput: errorOutput,
+	}
+
+	if err := cli.Run(testutil.ContextWithDeadline(t)); err == nil {
+		t.Fatalf("Expected error running CLI")
+	}
+
+	expectedOutput := "flag provided but not defined: -undefined"
+	if errorMessage := errorOutput.String(); !strings.Contains(errorMessage, expectedOutput) {
+		t.Fatalf("Expected error output to include %q, got:\n%s", expectedOutput, errorMessage)
+	}
+}
+
+func Test_Running_CLI_when_requested_help_via_flag_returns_no_error(t *testing.T) {
+	t.Parallel()
+
+	output := &bytes.Buffer{}
+	errorOutput := &bytes.Buffer{}
+
+	cli := compressor.Cli{
+		Args:        []string{testCommand, "--help"},
+		Output:      output,
+		ErrorOutput: errorOutput,
+		Input:       &bytes.Buffer{},
+	}
+
+	if err := cli.Run(testutil.ContextWithDeadline(t)); err != nil {
+		t.Fatalf("Unexpected error running CLI: %v", err)
+	}
+
+	t.Run("and_prints_usage_message_with_binary_name_to_configured_output", func(t *testing.T) {
+		t.Parallel()
+
+		expectedOutput := "Usage:"
+		if output := output.String(); !strings.Contains(output, expectedOutput) {
+			t.Fatalf("Expected output to include %q, got:\n%s", expectedOutput, output)
+		}
+	})
+
+	t.Run("and_does_not_print_any_error_message", func(t *testing.T) {
+		t.Parallel()
+
+		if errorMessage := errorOutput.String(); len(errorMessage) != 0 {
+			t.Fatalf("Didn't expect error output, got:\n%s", errorMessage)
+		}
+	})
+}
+
+func Test_Running_CLI_when_requested_formats_list_prints_available_formats_sorted_one_per_line(t *testing.T) {
+	t.Parallel()
+
+	output := &bytes.Buffer{}
+
+	cli := compressor.Cli{
+		Args:        []string{testCommand, "--list-formats"},
+		Output:      output,
+		ErrorOutput: &bytes.Buffer{},
+	}
+
+	if err := cli.Run(testutil.ContextWithDeadline(t)); err != nil {
+		t.Fatalf("Unexpected error running CLI: %v", err)
+	}
+
+	expectedOutput := "gzip\nnoop\n"
+
+	if gotOutput := output.String(); gotOutput != expectedOutput {
+		t.Fatalf("Expected to get output %q, got %q", expectedOutput, gotOutput)
+	}
+}
+
+func Test_Running_CLI_when_requested_formats_list_in_JSON_output_format_prints_JSON_array(t *testing.T) {
+	t.Parallel()
+
+	output := &bytes.Buffer{}
+
+	cli := compressor.Cli{
+		Args:        []string{testCommand, "--list-formats", "--output-format=json"},
+		Output:      output,
+		ErrorOutput: &bytes.Buffer{},
+	}
+
+	if err := cli.Run(testutil.ContextWithDeadline(t)); err != nil {
+		t.Fatalf("Unexpected error running CLI: %v", err)
+	}
+
+	expectedOutput := `["gzip","noop"]` + "\n"
+
+	if gotOutput := output.String(); gotOutput != expectedOutput {
+		t.Fatalf("Expected to get output %q, got %q", expectedOutput, gotOutput)
+	}
+}
+
+func Test_Running_CLI_when_requested_version_prints_build_information(t *testing.T) {
+	t.Parallel()
+
+	buildInfo := compressor.BuildInfo{
+		Version:   "v1.2.3",
+		GoVersion: "go1.17",
+		BuildTime: "2021-01-01T00:00:00Z",
+	}
+
+	for _, args := range [][]string{{compressor.ActionVersion}, {"--version"}} {
+		output := &bytes.Buffer{}
+
+		cli := compressor.Cli{
+			Args:        append([]string{testCommand}, args...),
+			Output:      output,
+			ErrorOutput: &bytes.Buffer{},
+			BuildInfo:   buildInfo,
+		}
+
+		if err := cli.Run(testutil.ContextWithDeadline(t)); err != nil {
+			t.Fatalf("Unexpected error running CLI with arguments %v: %v", args, err)
+		}
+
+		for _, expectedOutput := range []string{buildInfo.Version, buildInfo.GoVersion, buildInfo.BuildTime} {
+			if gotOutput := output.String(); !strings.Contains(gotOutput, expectedOutput) {
+				t.Fatalf("Expected output to include %q, got:\n%s", expectedOutput, gotOutput)
+			}
+		}
+	}
+}
+
+func Test_Running_CLI_when_requested_man_page_prints_it_in_groff_format(t *testing.T) {
+	t.Parallel()
+
+	output := &bytes.Buffer{}
+
+	cli := compressor.Cli{
+		Args:        []string{testCommand, compressor.ActionManPage},
+		Output:      output,
+		ErrorOutput: &bytes.Buffer{},
+		BuildInfo:   compressor.BuildInfo{Version: "v1.2.3"},
+	}
+
+	if err := cli.Run(testutil.ContextWithDeadline(t)); err != nil {
+		t.Fatalf("Unexpected error running CLI: %v", err)
+	}
+
+	testutil.GoldenFile(t, "man.1", output.Bytes(), *testutil.UpdateGolden)
+}
+
+func Test_Running_CLI_validating_configuration_file(t *testing.T) {
+	t.Parallel()
+
+	t.Run("prints_confirmation_when_configuration_is_valid", func(t *testing.T) {
+		t.Parallel()
+
+		output := &bytes.Buffer{}
+
+		configPath := testutil.NewTempConfigFile(t, "format: noop")
+
+		cli := compressor.Cli{
+			Args:        []string{testCommand, compressor.ActionValidate, "--config=" + configPath},
+			Output:      output,
+			ErrorOutput: &bytes.Buffer{},
+		}
+
+		if err := cli.Run(testutil.ContextWithDeadline(t)); err != nil {
+			t.Fatalf("Unexpected error running CLI: %v", err)
+		}
+
+		expectedOutput := "config OK\n"
+
+		if gotOutput := output.String(); gotOutput != expectedOutput {
+			t.Fatalf("Expected to get output %q, got %q", expectedOutput, gotOutput)
+		}
+	})
+
+	for name, config := range map[string]string{
+		"returns_error_when_configuration_contains_unknown_fields":  "formt: noop",
+		"returns_error_when_configuration_specifies_unknown_format": "format: xz",
+		"returns_error_when_configuration_is_not_a_valid_YAML":      "format",
+	} {
+		config := config
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			output := &bytes.Buffer{}
+
+			cli := compressor.Cli{
+				Args:        []string{testCommand, compressor.ActionValidate, "--config=" + testutil.NewTempConfigFile(t, config)},
+				Output:      output,
+				ErrorOutput: &bytes.Buffer{},
+			}
+
+			if err := cli.Run(testutil.ContextWithDeadline(t)); err == nil {
+				t.Fatalf("Expected error running CLI")
+			}
+
+			if gotOutput := output.String(); gotOutput != "" {
+				t.Fatalf("Expected no output, got %q", gotOutput)
+			}
+		})
+	}
+
+	t.Run("returns_error_when_configuration_file_does_not_exist", func(t *testing.T) {
+		t.Parallel()
+
+		cli := compressor.Cli{
+			Args: []string{
+				testCommand, compressor.ActionValidate, "--config=" + filepath.Join(t.TempDir(), "config.yaml"),
+			},
+			Output:      &bytes.Buffer{},
+			ErrorOutput: &bytes.Buffer{},
+		}
+
+		if err := cli.Run(testutil.ContextWithDeadline(t)); err == nil {
+			t.Fatalf("Expected error running CLI")
+		}
+	})
+}
+
+func Test_Running_CLI_in_dry_run_processes_input_without_writing_output(t *testing.T) {
+	t.Parallel()
+
+	outputPath := filepath.Join(t.TempDir(), "output")
+	output := &bytes.Buffer{}
+	errorOutput := &bytes.Buffer{}
+
+	cli := compressor.Cli{
+		Args:        []string{testCommand, compressor.ActionCompress, "--dry-run", "--output=" + outputPath},
+		Output:      output,
+		ErrorOutput: errorOutput,
+		Input:       strings.NewReader("foobar"),
+	}
+
+	if err := cli.Run(testutil.ContextWithDeadline(t)); err != nil {
+		t.Fatalf("Unexpected error running CLI: %v", err)
+	}
+
+	if expected := "Dry run complete: 6 bytes processed\n"; errorOutput.String() != expected {
+		t.Fatalf("Expected error output %q, got %q", expected, errorOutput.String())
+	}
+
+	if output.Len() != 0 {
+		t.Fatalf("Expected no output, got %q", output.String())
+	}
+
+	for _, path := range []string{outputPath, outputPath + ".gz"} {
+		if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("Expected output file %q to not be created, got: %v", path, err)
+		}
+	}
+}
+
+func Test_Running_CLI_in_dry_run_returns_error_when_input_is_invalid(t *testing.T) {
+	t.Parallel()
+
+	errorOutput := &bytes.Buffer{}
+
+	cli := compressor.Cli{
+		Args:        []string{testCommand, compressor.ActionDecompress, "--dry-run"},
+		Output:      &bytes.Buffer{},
+		ErrorOutput: errorOutput,
+		Input:       strings.NewReader("not compressed"),
+	}
+
+	if err := cli.Run(testutil.ContextWithDeadline(t)); err == nil {
+		t.Fatalf("Expected error running CLI")
+	}
+
+	if strings.Contains(errorOutput.String(), "Dry run complete") {
+		t.Fatalf("Expected no dry run summary on failure, got %q", errorOutput.String())
+	}
+}
+
+func Test_Running_CLI_returns_error_when_dry_run_is_used_with_action_not_producing_data(t *testing.T) {
+	t.Parallel()
+
+	cli := compressor.Cli{
+		Args:        []string{testCommand, compressor.ActionBenchmark, "--dry-run"},
+		Output:      &bytes.Buffer{},
+		ErrorOutput: &bytes.Buffer{},
+	}
+
+	if err := cli.Run(testutil.ContextWithDeadline(t)); err == nil {
+		t.Fatalf("Expected error running CLI")
+	}
+}
+
+func Test_Running_CLI_with_count_only_flag_prints_input_and_output_sizes_instead_of_output(t *testing.T) {
+	t.Parallel()
+
+	input := bytes.Repeat([]byte("foo"), 100)
+	compressed := &bytes.Buffer{}
+
+	cli := compressor.Cli{
+		Args:        []string{testCommand, compressor.ActionCompress},
+		Output:      compressed,
+		ErrorOutput: &bytes.Buffer{},
+		Input:       bytes.NewReader(input),
+	}
+
+	if err := cli.Run(testutil.ContextWithDeadline(t)); err != nil {
+		t.Fatalf("Unexpected error compressing: %v", err)
+	}
+
+	output := &bytes.Buffer{}
+	errorOutput := &bytes.Buffer{}
+
+	cli = compressor.Cli{
+		Args:        []string{testCommand, compressor.ActionCompress, "--count-only"},
+		Output:      output,
+		ErrorOutput: errorOutput,
+		Input:       bytes.NewReader(input),
+	}
+
+	if err := cli.Run(testutil.ContextWithDeadline(t)); err != nil {
+		t.Fatalf("Unexpected error counting: %v", err)
+	}
+
+	expected := fmt.Sprintf("Input: %d bytes, Output: %d bytes, Ratio: %.2f\n",
+		len(input), compressed.Len(), float64(compressed.Len())/float64(len(input)))
+
+	if errorOutput.String() != expected {
+		t.Fatalf("Expected error output %q, got %q", expected, errorOutput.String())
+	}
+
+	if output.Len() != 0 {
+		t.Fatalf("Expected no output, got %q", output.String())
+	}
+}
+
+func Test_Running_CLI_with_count_only_flag_in_JSON_output_format_prints_counts_as_JSON(t *testing.T) {
+	t.Parallel()
+
+	errorOutput := &bytes.Buffer{}
+
+	cli := compressor.Cli{
+		Args: []string{
+			testCommand, compressor.ActionCopy, "--count-only", "--output-format=" + compressor.OutputFormatJSON,
+		},
+		Output:      &bytes.Buffer{},
+		ErrorOutput: errorOutput,
+		Input:       strings.NewReader("foobar"),
+	}
+
+	if err := cli.Run(testutil.ContextWithDeadline(t)); err != nil {
+		t.Fatalf("Unexpected error running CLI: %v", err)
+	}
+
+	expected := `{"level":"info","msg":"count complete","bytes_processed":6,"bytes_written":6,"ratio":1}` + "\n"
+
+	if errorOutput.String() != expected {
+		t.Fatalf("Expected error output %q, got %q", expected, errorOutput.String())
+	}
+}
+
+func Test_Running_CLI_returns_error_when_count_only_is_used_together_with_dry_run(t *testing.T) {
+	t.Parallel()
+
+	cli := compressor.Cli{
+		Args:        []string{testCommand, compressor.ActionCompress, "--count-only", "--dry-run"},
+		Output:      &bytes.Buffer{},
+		ErrorOutput: &bytes.Buffer{},
+		Input:       strings.NewReader("foobar"),
+	}
+
+	if err := cli.Run(testutil.ContextWithDeadline(t)); err == nil {
+		t.Fatalf("Expected error running CLI")
+	}
+}
+
+func Test_Running_CLI_benchmark_reports_throughput_and_compression_ratio(t *testing.T) {
+	t.Parallel()
+
+	t.Run("of_compressing_requested_number_of_bytes", func(t *testing.T) {
+		t.Parallel()
+
+		output := &bytes.Buffer{}
+
+		cli := compressor.Cli{
+			Args: []string{
+				testCommand, compressor.ActionBenchmark, "--size=1M", "--format=noop", "--output-format=json",
+			},
+			Output:      output,
+			ErrorOutput: &bytes.Buffer{},
+		}
+
+		if err := cli.Run(testutil.ContextWithDeadline(t)); err != nil {
+			t.Fatalf("Unexpected error running CLI: %v", err)
+		}
+
+		result := compressor.BenchmarkResult{}
+
+		if err := json.Unmarshal(output.Bytes(), &result); err != nil {
+			t.Fatalf("Decoding output %q: %v", output.String(), err)
+		}
+
+		expectedBytes := int64(1 << 20)
+
+		if result.InputBytes != expectedBytes {
+			t.Fatalf("Expected benchmark to compress %d bytes, got %d", expectedBytes, result.InputBytes)
+		}
+
+		if result.CompressionRatio != 1 {
+			t.Fatalf("Expected compression ratio 1 for noop format, got %f", result.CompressionRatio)
+		}
+
+		if result.Throughput <= 0 {
+			t.Fatalf("Expected positive throughput, got %f", result.Throughput)
+		}
+	})
+
+	t.Run("for_requested_duration", func(t *testing.T) {
+		t.Parallel()
+
+		output := &bytes.Buffer{}
+
+		duration := 100 * time.Millisecond
+
+		cli := compressor.Cli{
+			Args:        []string{testCommand, compressor.ActionBenchmark, "--duration=" + duration.String()},
+			Output:      output,
+			ErrorOutput: &bytes.Buffer{},
+		}
+
+		if err := cli.Run(testutil.ContextWithDeadline(t)); err != nil {
+			t.Fatalf("Unexpected error running CLI: %v", err)
+		}
+
+		expectedOutput := "MB/s, compression ratio"
+
+		if gotOutput := output.String(); !strings.Contains(gotOutput, expectedOutput) {
+			t.Fatalf("Expected output to include %q, got %q", expectedOutput, gotOutput)
+		}
+	})
+}
+
+//nolint:funlen // Test covers whole serving lifecycle.
+func Test_Running_CLI_with_serve_action_processes_requests_received_over_socket(t *testing.T) {
+	t.Parallel()
+
+	// Length of Unix socket path is limited, so temporary directory named after the test can't be used.
+	socketDir, err := os.MkdirTemp("", "compressor")
+	if err != nil {
+		t.Fatalf("Unexpected error creating temporary directory: %v", err)
+	}
+
+	t.Cleanup(func() {
+		if err := os.RemoveAll(socketDir); err != nil {
+			t.Logf("Removing temporary directory: %v", err)
+		}
+	})
+
+	socketPath := filepath.Join(socketDir, "socket")
+
+	ctx, cancel := context.WithCancel(testutil.ContextWithDeadline(t))
+	defer cancel()
+
+	cli := &compressor.Cli{
+		Args:        []string{testCommand, compressor.ActionServe, "--socket=" + socketPath},
+		Output:      &bytes.Buffer{},
+		ErrorOutput: &bytes.Buffer{},
+	}
+
+	errCh := make(chan error, 1)
+
+	go func() {
+		errCh <- cli.Run(ctx)
+	}()
+
+	conn := testDialSocket(ctx, t, socketPath)
+
+	status, compressed := testServeRequest(t, conn, compressor.ServeOperationCompress, "", testData)
+	if status != compressor.ServeStatusOK {
+		t.Fatalf("Expected compressing to succeed, got error: %s", compressed)
+	}
+
+	if decompressed := testGunzip(t, compressed); decompressed != testData {
+		t.Fatalf("Expected decompressed data %q, got %q", testData, decompressed)
+	}
+
+	// Failed requests must not break the connection for next requests.
+	for name, request := range map[string]struct {
+		operation byte
+		format    string
+		data      string
+	}{
+		"format_is_unknown":      {compressor.ServeOperationCompress, "unknown", testData},
+		"operation_is_unknown":   {2, "", testData},
+		"data_is_not_compressed": {compressor.ServeOperationDecompress, "gzip", testData},
+	} {
+		status, response := testServeRequest(t, conn, request.operation, request.format, request.data)
+		if status != compressor.ServeStatusError {
+			t.Fatalf("%s: expected error status, got %d with %q", name, status, response)
+		}
+
+		if len(response) == 0 {
+			t.Fatalf("%s: expected error message", name)
+		}
+	}
+
+	status, decompressed := testServeRequest(t, conn, compressor.ServeOperationDecompress, "gzip", string(compressed))
+	if status != compressor.ServeStatusOK {
+		t.Fatalf("Expected decompressing to succeed, got error: %s", decompressed)
+	}
+
+	if string(decompressed) != testData {
+		t.Fatalf("Expected decompressed data %q, got %q", testData, decompressed)
+	}
+
+	cancel()
+
+	if err := <-errCh; err != nil {
+		t.Fatalf("Expected no error when serving is interrupted, got: %v", err)
+	}
+
+	if _, err := os.Stat(socketPath); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("Expected socket to be removed after serving, got: %v", err)
+	}
+}
+
+//nolint:funlen // Test covers whole serving lifecycle.
+func Test_Running_CLI_with_serve_action_limits_size_of_request_data_and_response_payload(t *testing.T) {
+	t.Parallel()
+
+	socketDir, err := os.MkdirTemp("", "compressor")
+	if err != nil {
+		t.Fatalf("Unexpected error creating temporary directory: %v", err)
+	}
+
+	t.Cleanup(func() {
+		if err := os.RemoveAll(socketDir); err != nil {
+			t.Logf("Removing temporary directory: %v", err)
+		}
+	})
+
+	socketPath := filepath.Join(socketDir, "socket")
+
+	ctx, cancel := context.WithCancel(testutil.ContextWithDeadline(t))
+	defer cancel()
+
+	cli := &compressor.Cli{
+		Args: []string{
+			testCommand, compressor.ActionServe, "--socket=" + socketPath, "--format=noop",
+			"--input-limit=32", "--output-limit=8",
+		},
+		Output:      &bytes.Buffer{},
+		ErrorOutput: &bytes.Buffer{},
+	}
+
+	errCh := make(chan error, 1)
+
+	go func() {
+		errCh <- cli.Run(ctx)
+	}()
+
+	conn := testDialSocket(ctx, t, socketPath)
+
+	status, response := testServeRequest(t, conn, compressor.ServeOperationCompress, "", "too long!")
+	if status != compressor.ServeStatusError || !strings.Contains(string(response), "limit") {
+		t.Fatalf("Expected error about exceeded output limit, got status %d with %q", status, response)
+	}
+
+	// Exceeding output limit does not break the connection, as the request data is read.
+	status, response = testServeRequest(t, conn, compressor.ServeOperationCompress, "", "fits")
+	if status != compressor.ServeStatusOK || string(response) != "fits" {
+		t.Fatalf("Expected request within limits to succeed, got status %d with %q", status, response)
+	}
+
+	status, response = testServeRequest(t, conn, compressor.ServeOperationCompress, "", strings.Repeat("x", 33))
+	if status != compressor.ServeStatusError || !strings.Contains(string(response), "limit") {
+		t.Fatalf("Expected error about exceeded input limit, got status %d with %q", status, response)
+	}
+
+	// Data exceeding input limit is not read, so the connection is closed.
+	if _, err := conn.Read(make([]byte, 1)); err == nil {
+		t.Fatalf("Expected connection to be closed after request exceeding input limit")
+	}
+
+	cancel()
+
+	if err := <-errCh; err != nil {
+		t.Fatalf("Expected no error when serving is interrupted, got: %v", err)
+	}
+}
+
+func Test_Running_CLI_with_serve_action_returns_error_when(t *testing.T) {
+	t.Parallel()
+
+	for name, args := range map[string][]string{
+		"socket_path_is_not_given":         {compressor.ActionServe},
+		"socket_is_used_with_other_action": {compressor.ActionCompress, "--socket=socket"},
+		"input_path_is_given":              {compressor.ActionServe, "--socket=socket", "--input=input"},
+		"output_path_is_given":             {compressor.ActionServe, "--socket=socket", "--output=output"},
+		"socket_directory_does_not_exist":  {compressor.ActionServe, "--socket=" + filepath.Join(t.TempDir(), "x", "s")},
+		"checksum_is_given":                {compressor.ActionServe, "--socket=socket", "--checksum=sha256"},
+		"HTTP_retries_are_given":           {compressor.ActionServe, "--socket=socket", "--http-retries=1"},
+		"S3_region_is_given":               {compressor.ActionServe, "--socket=socket", "--s3-region=region"},
+		"S3_endpoint_is_given":             {compressor.ActionServe, "--socket=socket", "--s3-endpoint=endpoint"},
+		"no_auto_extension_is_given":       {compressor.ActionServe, "--socket=socket", "--no-auto-extension"},
+		"input_limit_is_invalid":           {compressor.ActionServe, "--socket=socket", "--input-limit=foo"},
+		"output_limit_is_invalid":          {compressor.ActionServe, "--socket=socket", "--output-limit=foo"},
+	} {
+		args := args
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			cli := compressor.Cli{
+				Args:        append([]string{testCommand}, args...),
+				Output:      &bytes.Buffer{},
+				ErrorOutput: &bytes.Buffer{},
+			}
+
+			if err := cli.Run(testutil.ContextWithDeadline(t)); err == nil {
+				t.Fatalf("Expected error running CLI")
+			}
+		})
+	}
+}
+
+// testDialSocket connects to given Unix socket, retrying until it is created by the server running in the
+// background.
+func testDialSocket(ctx context.Context, t *testing.T, path string) net.Conn {
+	t.Helper()
+
+	for {
+		conn, err := (&net.Dialer{}).DialContext(ctx, "unix", path)
+		if err == nil {
+			t.Cleanup(func() {
+				//nolint:errcheck // Connection may already be closed by the server.
+				conn.Close()
+			})
+
+			return conn
+		}
+
+		select {
+		case <-ctx.Done():
+			t.Fatalf("Connecting to socket: %v", err)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+// testServeRequest sends single request using serve action protocol and returns received status and payload.
+func testServeRequest(t *testing.T, conn net.Conn, operation byte, format, data string) (byte, []byte) {
+	t.Helper()
+
+	request := []byte{operation}
+	request = binary.BigEndian.AppendUint16(request, uint16(len(format)))
+	request = append(request, format...)
+	request = binary.BigEndian.AppendUint64(request, uint64(len(data)))
+	request = append(request, data...)
+
+	if _, err := conn.Write(request); err != nil {
+		t.Fatalf("Writing request: %v", err)
+	}
+
+	// Status byte followed by uint64 payload length.
+	header := make([]byte, 9)
+
+	if _, err := io.ReadFull(conn, header); err != nil {
+		t.Fatalf("Reading response header: %v", err)
+	}
+
+	payload := make([]byte, binary.BigEndian.Uint64(header[1:]))
+
+	if _, err := io.ReadFull(conn, payload); err != nil {
+		t.Fatalf("Reading response payload: %v", err)
+	}
+
+	return header[0], payload
+}
+
+func testGunzip(t *testing.T, data []byte) string {
+	t.Helper()
+
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Failed creating gzip reader: %v", err)
+	}
+
+	decompressed, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("Failed decompressing data: %v", err)
+	}
+
+	return string(decompressed)
+}
+
+//nolint:funlen,gocognit,cyclop // Just many isolated test-cases.
+func Test_Running_CLI_returns_error_when(t *testing.T) {
+	t.Parallel()
+
+	t.Run("output_is_not_set", func(t *testing.T) {
+		t.Parallel()
+
+		cli := compressor.Cli{
+			Args:        []string{testCommand, "--help"},
+			Output:      nil,
+			ErrorOutput: &bytes.Buffer{},
+			Input:       &bytes.Buffer{},
+		}
+
+		if err := cli.Run(testutil.ContextWithDeadline(t)); err == nil {
+			t.Fatalf("Expected CLI run error")
+		}
+	})
+
+	t.Run("error_output_is_not_set", func(t *testing.T) {
+		t.Parallel()
+
+		cli := compressor.Cli{
+			Args:        []string{testCommand, "--help"},
+			Output:      &bytes.Buffer{},
+			ErrorOutput: nil,
+			Input:       &bytes.Buffer{},
+		}
+
+		if err := cli.Run(testutil.ContextWithDeadline(t)); err == nil {
+			t.Fatalf("Expected CLI run error")
+		}
+	})
+
+	t.Run("neither_input_and_input_flag_are_not_set", func(t *testing.T) {
+		t.Parallel()
+
+		cli := compressor.Cli{
+			Args:        []string{testCommand, "compress"},
+			Output:      &bytes.Buffer{},
+			ErrorOutput: &bytes.Buffer{},
+			Input:       nil,
+		}
+
+		if err := cli.Run(testutil.ContextWithDeadline(t)); err == nil {
+			t.Fatalf("Expected CLI run error")
+		}
+	})
+
+	t.Run("no_arguments_are_given", func(t *testing.T) {
+		t.Parallel()
+
+		cli := compressor.Cli{
+			Args:        []string{},
+			Output:      &bytes.Buffer{},
+			ErrorOutput: &bytes.Buffer{},
+			Input:       &bytes.Buffer{},
+		}
+
+		if err := cli.Run(testutil.ContextWithDeadline(t)); err == nil {
+			t.Fatalf("Expected error running CLI")
+		}
+	})
+
+	t.Run("no_action_argument_is_specified", func(t *testing.T) {
+		t.Parallel()
+
+		errorOutput := &bytes.Buffer{}
+
+		cli := compressor.Cli{
+			Args:        []string{testCommand},
+			Output:      &bytes.Buffer{},
+			ErrorOutput: errorOutput,
+			Input:       &bytes.Buffer{},
+		}
+
+		if err := cli.Run(testutil.ContextWithDeadline(t)); err == nil {
+			t.Fatalf("Expected error running CLI")
+		}
+
+		if len(errorOutput.String()) == 0 {
+			t.Fatalf("Expected error message to be printed to error output")
+		}
+	})
+
+	t.Run("trying_to_run_unknown_action", func(t *testing.T) {
+		t.Parallel()
+
+		errorOutput := &bytes.Buffer{}
+
+		cli := compressor.Cli{
+			Args:        []string{testCommand, "unknown-action"},
+			Output:      &bytes.Buffer{},
+			ErrorOutput: errorOutput,
+			Input:       &bytes.Buffer{},
+		}
+
+		if err := cli.Run(testutil.ContextWithDeadline(t)); err == nil {
+			t.Fatalf("Expected error running CLI")
+		}
+
+		if len(errorOutput.String()) == 0 {
+			t.Fatalf("Expected error message to be printed to error output")
+		}
+
+		t.Run("and_prints_usage_message_only_once", func(t *testing.T) {
+			t.Parallel()
+
+			if strings.Count(errorOutput.String(), "Usage:") > 1 {
+				t.Fatalf("Expected usage message to be printed only once, got:\n%s", errorOutput.String())
+			}
+		})
+	})
+
+	t.Run("multiple_valid_actions_are_specified", func(t *testing.T) {
+		t.Parallel()
+
+		cli := compressor.Cli{
+			Args:        []string{testCommand, compressor.ActionDecompress, compressor.ActionCompress},
+			Output:      &bytes.Buffer{},
+			ErrorOutput: &bytes.Buffer{},
+			Input:       bytes.NewBufferString(testData),
+		}
+
+		if err := cli.Run(testutil.ContextWithDeadline(t)); err == nil {
+			t.Fatalf("Expected error running CLI")
+		}
+	})
+	t.Run("creating_compression_client_fails", func(t *testing.T) {
+		t.Parallel()
+
+		cli := compressor.Cli{
+			Args:        []string{testCommand, compressor.ActionCompress, "--format=foo"},
+			Output:      &bytes.Buffer{},
+			ErrorOutput: &bytes.Buffer{},
+			Input:       bytes.NewBufferString(testData),
+		}
+
+		if err := cli.Run(testutil.ContextWithDeadline(t)); err == nil {
+			t.Fatalf("Expected error running CLI")
+		}
+	})
+
+	t.Run("requested_input_file_does_not_exit", func(t *testing.T) {
+		t.Parallel()
+
+		inputPath := filepath.Join(t.TempDir(), "nonexisting")
+
+		output := &bytes.Buffer{}
+
+		cli := compressor.Cli{
+			Args:        []string{testCommand, compressor.ActionCompress, "--input=" + inputPath},
+			Output:      output,
+			ErrorOutput: &bytes.Buffer{},
+		}
+
+		if err := cli.Run(testutil.ContextWithDeadline(t)); err == nil {
+			t.Fatalf("Expected error running CLI")
+		}
+	})
+
+	t.Run("requested_input_file_is_not_readable", func(t *testing.T) {
+		t.Parallel()
+
+		expectedOutput := testData
+
+		inputPath := filepath.Join(t.TempDir(), "input")
+
+		testutil.MustWriteFile(t, inputPath, []byte(expectedOutput), 0o000)
+
+		output := &bytes.Buffer{}
+
+		cli := compressor.Cli{
+			Args:        []string{testCommand, compressor.ActionCompress, "--input=" + inputPath},
+			Output:      output,
+			ErrorOutput: &bytes.Buffer{},
+		}
+
+		err := cli.Run(testutil.ContextWithDeadline(t))
+		if err == nil {
+			t.Fatalf("Expected error running CLI")
+		}
+
+		if !errors.Is(err, os.ErrPermission) {
+			t.Fatalf("Unexpected error %q, expected %q", err, os.ErrPermission)
+		}
+	})
+
+	t.Run("configuration_file_exists_but_it_is_not_readable", func(t *testing.T) {
+		t.Parallel()
+
+		configPath := filepath.Join(t.TempDir(), "config.yaml")
+
+		testutil.MustWriteFile(t, configPath, []byte("format: noop"), 0o000)
+
+		expectedOutput := testData
+
+		output := &bytes.Buffer{}
+
+		cli := compressor.Cli{
+			Args:        []string{testCommand, compressor.ActionCompress, "--config=" + configPath},
+			Output:      output,
+			ErrorOutput: &bytes.Buffer{},
+			Input:       bytes.NewBufferString(expectedOutput),
+		}
+
+		if err := cli.Run(testutil.ContextWithDeadline(t)); err == nil {
+			t.Fatalf("Expected error running CLI")
+		}
+	})
+
+	t.Run("configuration_file_is_not_a_valid_YAML", func(t *testing.T) {
+		t.Parallel()
+
+		configPath := testutil.NewTempConfigFile(t, "format")
+
+		expectedOutput := testData
+
+		output := &bytes.Buffer{}
+
+		cli := compressor.Cli{
+			Args:        []string{testCommand, compressor.ActionCompress, "--config=" + configPath},
+			Output:      output,
+			ErrorOutput: &bytes.Buffer{},
+			Input:       bytes.NewBufferString(expectedOutput),
+		}
+
+		if err := cli.Run(testutil.ContextWithDeadline(t)); err == nil {
+			t.Fatalf("Expected error running CLI")
 		}
 	})
 
-	t.Run("and_does_not_print_any_error_message", func(t *testing.T) {
+	t.Run("action_fails", func(t *testing.T) {
 		t.Parallel()
 
-		if errorMessage := errorOutput.String(); len(errorMessage) != 0 {
-			t.Fatalf("Didn't expect error output, got:\n%s", errorMessage)
+		cli := compressor.Cli{
+			Args:        []string{testCommand, compressor.ActionDecompress},
+			Output:      &bytes.Buffer{},
+			ErrorOutput: &bytes.Buffer{},
+			Input:       bytes.NewBufferString(testData),
 		}
-	})
-}
 
-//nolint:funlen,gocognit,cyclop // Just many isolated test-cases.
-func Test_Running_CLI_returns_error_when(t *testing.T) {
-	t.Parallel()
+		if err := cli.Run(testutil.ContextWithDeadline(t)); err == nil {
+			t.Fatalf("Expected error running CLI")
+		}
+	})
 
-	t.Run("output_is_not_set", func(t *testing.T) {
+	t.Run("input_exceeds_requested_input_limit", func(t *testing.T) {
 		t.Parallel()
 
+		output := &bytes.Buffer{}
+
 		cli := compressor.Cli{
-			Args:        []string{testCommand, "--help"},
-			Output:      nil,
+			Args: []string{
+				testCommand, compressor.ActionCompress, "--format=noop", fmt.Sprintf("--input-limit=%d", len(testData)-1),
+			},
+			Output:      output,
 			ErrorOutput: &bytes.Buffer{},
-			Input:       &bytes.Buffer{},
+			Input:       bytes.NewBufferString(testData),
 		}
 
-		if err := cli.Run(testutil.ContextWithDeadline(t)); err == nil {
-			t.Fatalf("Expected CLI run error")
+		err := cli.Run(testutil.ContextWithDeadline(t))
+		if err == nil {
+			t.Fatalf("Expected error running CLI")
+		}
+
+		if !strings.Contains(err.Error(), "limit") {
+			t.Fatalf("Expected error to mention limit, got %v", err)
+		}
+
+		if output.Len() >= len(testData) {
+			t.Fatalf("Expected no more than %d bytes to be written, got %q", len(testData)-1, output.String())
 		}
 	})
 
-	t.Run("error_output_is_not_set", func(t *testing.T) {
+	t.Run("decompressed_output_exceeds_requested_output_limit", func(t *testing.T) {
 		t.Parallel()
 
+		compressedData := &bytes.Buffer{}
+
+		gzipWriter := gzip.NewWriter(compressedData)
+
+		if _, err := gzipWriter.Write(make([]byte, 1<<20)); err != nil {
+			t.Fatalf("Failed compressing test data: %v", err)
+		}
+
+		if err := gzipWriter.Close(); err != nil {
+			t.Fatalf("Failed closing compressor: %v", err)
+		}
+
+		outputLimit := 1 << 10
+		output := &bytes.Buffer{}
+
 		cli := compressor.Cli{
-			Args:        []string{testCommand, "--help"},
-			Output:      &bytes.Buffer{},
-			ErrorOutput: nil,
-			Input:       &bytes.Buffer{},
+			Args: []string{
+				testCommand, compressor.ActionDecompress, fmt.Sprintf("--output-limit=%d", outputLimit),
+			},
+			Output:      output,
+			ErrorOutput: &bytes.Buffer{},
+			Input:       compressedData,
 		}
 
-		if err := cli.Run(testutil.ContextWithDeadline(t)); err == nil {
-			t.Fatalf("Expected CLI run error")
+		err := cli.Run(testutil.ContextWithDeadline(t))
+		if err == nil {
+			t.Fatalf("Expected error running CLI")
+		}
+
+		if !strings.Contains(err.Error(), "limit") {
+			t.Fatalf("Expected error to mention limit, got %v", err)
+		}
+
+		if output.Len() > outputLimit {
+			t.Fatalf("Expected no more than %d bytes to be written, got %d", outputLimit, output.Len())
 		}
 	})
 
-	t.Run("neither_input_and_input_flag_are_not_set", func(t *testing.T) {
+	for name, limitFlag := range map[string]string{
+		"input_limit_has_unknown_suffix":  "--input-limit=10X",
+		"input_limit_has_repeated_suffix": "--input-limit=10KIBB",
+		"input_limit_is_fractional":       "--input-limit=1.5K",
+		"input_limit_is_not_a_number":     "--input-limit=M",
+		"input_limit_is_negative":         "--input-limit=-1",
+		"input_limit_overflows":           "--input-limit=9000000000T",
+		"output_limit_is_not_a_number":    "--output-limit=M",
+	} {
+		limitFlag := limitFlag
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			cli := compressor.Cli{
+				Args:        []string{testCommand, compressor.ActionCompress, limitFlag},
+				Output:      &bytes.Buffer{},
+				ErrorOutput: &bytes.Buffer{},
+				Input:       bytes.NewBufferString(testData),
+			}
+
+			if err := cli.Run(testutil.ContextWithDeadline(t)); err == nil {
+				t.Fatalf("Expected error running CLI")
+			}
+		})
+	}
+
+	t.Run("benchmark_size_is_requested_for_other_action", func(t *testing.T) {
 		t.Parallel()
 
 		cli := compressor.Cli{
-			Args:        []string{testCommand, "compress"},
+			Args:        []string{testCommand, compressor.ActionCompress, "--size=1M"},
 			Output:      &bytes.Buffer{},
 			ErrorOutput: &bytes.Buffer{},
-			Input:       nil,
+			Input:       bytes.NewBufferString(testData),
 		}
 
 		if err := cli.Run(testutil.ContextWithDeadline(t)); err == nil {
-			t.Fatalf("Expected CLI run error")
+			t.Fatalf("Expected error running CLI")
 		}
 	})
 
-	t.Run("no_arguments_are_given", func(t *testing.T) {
+	t.Run("benchmark_duration_is_not_positive", func(t *testing.T) {
 		t.Parallel()
 
 		cli := compressor.Cli{
-			Args:        []string{},
+			Args:        []string{testCommand, compressor.ActionBenchmark, "--duration=-1s"},
 			Output:      &bytes.Buffer{},
 			ErrorOutput: &bytes.Buffer{},
-			Input:       &bytes.Buffer{},
 		}
 
 		if err := cli.Run(testutil.ContextWithDeadline(t)); err == nil {
@@ -311,61 +3581,72 @@ func Test_Running_CLI_returns_error_when(t *testing.T) {
 		}
 	})
 
-	t.Run("no_action_argument_is_specified", func(t *testing.T) {
+	t.Run("requested_input_URL_responds_with_error", func(t *testing.T) {
 		t.Parallel()
 
-		errorOutput := &bytes.Buffer{}
+		server := httptest.NewServer(http.NotFoundHandler())
+
+		t.Cleanup(server.Close)
 
 		cli := compressor.Cli{
-			Args:        []string{testCommand},
+			Args:        []string{testCommand, compressor.ActionCompress, "--input=" + server.URL},
 			Output:      &bytes.Buffer{},
-			ErrorOutput: errorOutput,
-			Input:       &bytes.Buffer{},
+			ErrorOutput: &bytes.Buffer{},
 		}
 
 		if err := cli.Run(testutil.ContextWithDeadline(t)); err == nil {
 			t.Fatalf("Expected error running CLI")
 		}
-
-		if len(errorOutput.String()) == 0 {
-			t.Fatalf("Expected error message to be printed to error output")
-		}
 	})
 
-	t.Run("trying_to_run_unknown_action", func(t *testing.T) {
+	t.Run("requested_output_URL_responds_with_error", func(t *testing.T) {
 		t.Parallel()
 
-		errorOutput := &bytes.Buffer{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+		}))
+
+		t.Cleanup(server.Close)
 
 		cli := compressor.Cli{
-			Args:        []string{testCommand, "unknown-action"},
+			Args:        []string{testCommand, compressor.ActionCompress, "--output=" + server.URL},
 			Output:      &bytes.Buffer{},
-			ErrorOutput: errorOutput,
-			Input:       &bytes.Buffer{},
+			ErrorOutput: &bytes.Buffer{},
+			Input:       bytes.NewBufferString(testData),
 		}
 
 		if err := cli.Run(testutil.ContextWithDeadline(t)); err == nil {
 			t.Fatalf("Expected error running CLI")
 		}
+	})
 
-		if len(errorOutput.String()) == 0 {
-			t.Fatalf("Expected error message to be printed to error output")
-		}
+	for name, arg := range map[string]string{
+		"S3_input_path_has_no_key":  "--input=s3://bucket",
+		"S3_output_path_has_no_key": "--output=s3://bucket/",
+	} {
+		arg := arg
 
-		t.Run("and_prints_usage_message_only_once", func(t *testing.T) {
+		t.Run(name, func(t *testing.T) {
 			t.Parallel()
 
-			if strings.Count(errorOutput.String(), "Usage:") > 1 {
-				t.Fatalf("Expected usage message to be printed only once, got:\n%s", errorOutput.String())
+			cli := compressor.Cli{
+				Args:        []string{testCommand, compressor.ActionCopy, arg},
+				Output:      &bytes.Buffer{},
+				ErrorOutput: &bytes.Buffer{},
+				Input:       bytes.NewBufferString(testData),
+			}
+
+			if err := cli.Run(testutil.ContextWithDeadline(t)); err == nil {
+				t.Fatalf("Expected error running CLI")
 			}
 		})
-	})
+	}
 
-	t.Run("multiple_valid_actions_are_specified", func(t *testing.T) {
+	t.Run("transcoded_data_is_not_in_source_format", func(t *testing.T) {
 		t.Parallel()
 
 		cli := compressor.Cli{
-			Args:        []string{testCommand, compressor.ActionDecompress, compressor.ActionCompress},
+			Args:        []string{testCommand, compressor.ActionTranscode, "--from=gzip", "--to=noop"},
 			Output:      &bytes.Buffer{},
 			ErrorOutput: &bytes.Buffer{},
 			Input:       bytes.NewBufferString(testData),
@@ -375,11 +3656,12 @@ func Test_Running_CLI_returns_error_when(t *testing.T) {
 			t.Fatalf("Expected error running CLI")
 		}
 	})
-	t.Run("creating_compression_client_fails", func(t *testing.T) {
+
+	t.Run("rate_limit_is_not_positive", func(t *testing.T) {
 		t.Parallel()
 
 		cli := compressor.Cli{
-			Args:        []string{testCommand, compressor.ActionCompress, "--format=foo"},
+			Args:        []string{testCommand, compressor.ActionCompress, "--rate-limit=0"},
 			Output:      &bytes.Buffer{},
 			ErrorOutput: &bytes.Buffer{},
 			Input:       bytes.NewBufferString(testData),
@@ -390,17 +3672,29 @@ func Test_Running_CLI_returns_error_when(t *testing.T) {
 		}
 	})
 
-	t.Run("requested_input_file_does_not_exit", func(t *testing.T) {
+	t.Run("rate_limit_is_requested_for_other_action", func(t *testing.T) {
 		t.Parallel()
 
-		inputPath := filepath.Join(t.TempDir(), "nonexisting")
+		cli := compressor.Cli{
+			Args:        []string{testCommand, compressor.ActionCopy, "--rate-limit=1K"},
+			Output:      &bytes.Buffer{},
+			ErrorOutput: &bytes.Buffer{},
+			Input:       bytes.NewBufferString(testData),
+		}
 
-		output := &bytes.Buffer{}
+		if err := cli.Run(testutil.ContextWithDeadline(t)); err == nil {
+			t.Fatalf("Expected error running CLI")
+		}
+	})
+
+	t.Run("target_format_is_requested_for_other_action", func(t *testing.T) {
+		t.Parallel()
 
 		cli := compressor.Cli{
-			Args:        []string{testCommand, compressor.ActionCompress, "--input=" + inputPath},
-			Output:      output,
+			Args:        []string{testCommand, compressor.ActionCompress, "--to=noop"},
+			Output:      &bytes.Buffer{},
 			ErrorOutput: &bytes.Buffer{},
+			Input:       bytes.NewBufferString(testData),
 		}
 
 		if err := cli.Run(testutil.ContextWithDeadline(t)); err == nil {
@@ -408,53 +3702,53 @@ func Test_Running_CLI_returns_error_when(t *testing.T) {
 		}
 	})
 
-	t.Run("requested_input_file_is_not_readable", func(t *testing.T) {
+	t.Run("patch_is_applied_to_different_base", func(t *testing.T) {
 		t.Parallel()
 
-		expectedOutput := testData
-
-		inputPath := filepath.Join(t.TempDir(), "input")
+		dir := t.TempDir()
+		basePath := filepath.Join(dir, "base")
+		patchPath := filepath.Join(dir, "patch")
 
-		if err := os.WriteFile(inputPath, []byte(expectedOutput), 0o000); err != nil {
-			t.Fatalf("Failed input file: %v", err)
-		}
+		testutil.MustWriteFile(t, basePath, []byte(testData), 0o600)
 
-		output := &bytes.Buffer{}
+		// Patch created for empty base.
+		testutil.MustWriteFile(t, patchPath, []byte("CPAT\x02"+strings.Repeat("\x00", 16)), 0o600)
 
 		cli := compressor.Cli{
-			Args:        []string{testCommand, compressor.ActionCompress, "--input=" + inputPath},
-			Output:      output,
+			Args: []string{
+				testCommand, compressor.ActionPatch, "--format=noop", "--base=" + basePath, "--patch=" + patchPath,
+			},
+			Output:      &bytes.Buffer{},
 			ErrorOutput: &bytes.Buffer{},
 		}
 
-		err := cli.Run(testutil.ContextWithDeadline(t))
-		if err == nil {
+		if err := cli.Run(testutil.ContextWithDeadline(t)); err == nil {
 			t.Fatalf("Expected error running CLI")
 		}
-
-		if !errors.Is(err, os.ErrPermission) {
-			t.Fatalf("Unexpected error %q, expected %q", err, os.ErrPermission)
-		}
 	})
 
-	t.Run("configuration_file_exists_but_it_is_not_readable", func(t *testing.T) {
+	t.Run("patch_action_is_requested_without_patch_path", func(t *testing.T) {
 		t.Parallel()
 
-		configPath := filepath.Join(t.TempDir(), "config.yaml")
-
-		if err := os.WriteFile(configPath, []byte("format: noop"), 0o000); err != nil {
-			t.Fatalf("Failed writing configuration file: %v", err)
+		cli := compressor.Cli{
+			Args:        []string{testCommand, compressor.ActionPatch, "--base=base.gz"},
+			Output:      &bytes.Buffer{},
+			ErrorOutput: &bytes.Buffer{},
 		}
 
-		expectedOutput := testData
+		if err := cli.Run(testutil.ContextWithDeadline(t)); err == nil {
+			t.Fatalf("Expected error running CLI")
+		}
+	})
 
-		output := &bytes.Buffer{}
+	t.Run("unknown_output_format_is_requested", func(t *testing.T) {
+		t.Parallel()
 
 		cli := compressor.Cli{
-			Args:        []string{testCommand, compressor.ActionCompress, "--config=" + configPath},
-			Output:      output,
+			Args:        []string{testCommand, compressor.ActionCompress, "--output-format=xml"},
+			Output:      &bytes.Buffer{},
 			ErrorOutput: &bytes.Buffer{},
-			Input:       bytes.NewBufferString(expectedOutput),
+			Input:       bytes.NewBufferString(testData),
 		}
 
 		if err := cli.Run(testutil.ContextWithDeadline(t)); err == nil {
@@ -462,36 +3756,50 @@ func Test_Running_CLI_returns_error_when(t *testing.T) {
 		}
 	})
 
-	t.Run("configuration_file_is_not_a_valid_YAML", func(t *testing.T) {
+	t.Run("unknown_checksum_algorithm_is_requested", func(t *testing.T) {
 		t.Parallel()
 
-		configPath := filepath.Join(t.TempDir(), "config.yaml")
-
-		if err := os.WriteFile(configPath, []byte("format"), 0o600); err != nil {
-			t.Fatalf("Failed writing configuration file: %v", err)
+		cli := compressor.Cli{
+			Args:        []string{testCommand, compressor.ActionCompress, "--checksum=crc"},
+			Output:      &bytes.Buffer{},
+			ErrorOutput: &bytes.Buffer{},
+			Input:       bytes.NewBufferString(testData),
 		}
 
-		expectedOutput := testData
+		if err := cli.Run(testutil.ContextWithDeadline(t)); err == nil {
+			t.Fatalf("Expected error running CLI")
+		}
+	})
 
-		output := &bytes.Buffer{}
+	t.Run("input_does_not_match_requested_checksum", func(t *testing.T) {
+		t.Parallel()
 
 		cli := compressor.Cli{
-			Args:        []string{testCommand, compressor.ActionCompress, "--config=" + configPath},
-			Output:      output,
+			Args: []string{
+				testCommand, compressor.ActionDecompress, "--format=noop", "--checksum=md5", "--verify-checksum=" + testDataSHA256,
+			},
+			Output:      &bytes.Buffer{},
 			ErrorOutput: &bytes.Buffer{},
-			Input:       bytes.NewBufferString(expectedOutput),
+			Input:       bytes.NewBufferString(testData),
 		}
 
-		if err := cli.Run(testutil.ContextWithDeadline(t)); err == nil {
+		err := cli.Run(testutil.ContextWithDeadline(t))
+		if err == nil {
 			t.Fatalf("Expected error running CLI")
 		}
+
+		if !strings.Contains(err.Error(), "checksum") {
+			t.Fatalf("Expected error to mention checksum, got %v", err)
+		}
 	})
 
-	t.Run("action_fails", func(t *testing.T) {
+	t.Run("checksum_is_verified_without_checksum_algorithm", func(t *testing.T) {
 		t.Parallel()
 
 		cli := compressor.Cli{
-			Args:        []string{testCommand, compressor.ActionDecompress},
+			Args: []string{
+				testCommand, compressor.ActionDecompress, "--format=noop", "--verify-checksum=" + testDataSHA256,
+			},
 			Output:      &bytes.Buffer{},
 			ErrorOutput: &bytes.Buffer{},
 			Input:       bytes.NewBufferString(testData),
@@ -502,6 +3810,70 @@ func Test_Running_CLI_returns_error_when(t *testing.T) {
 		}
 	})
 
+	for name, args := range map[string][]string{
+		"block_size_is_not_a_number":            {compressor.ActionCompress, "--block-size=M"},
+		"block_size_is_zero":                    {compressor.ActionCompress, "--block-size=0"},
+		"block_size_is_set_without_action":      {"--block-size=1M"},
+		"parallelism_is_not_a_number":           {compressor.ActionCompress, "--block-size=1M", "--parallelism=foo"},
+		"parallelism_is_zero":                   {compressor.ActionCompress, "--block-size=1M", "--parallelism=0"},
+		"parallelism_is_set_without_block_size": {compressor.ActionCompress, "--parallelism=1"},
+	} {
+		args := args
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			cli := compressor.Cli{
+				Args:        append([]string{testCommand}, args...),
+				Output:      &bytes.Buffer{},
+				ErrorOutput: &bytes.Buffer{},
+				Input:       bytes.NewBufferString(testData),
+			}
+
+			if err := cli.Run(testutil.ContextWithDeadline(t)); err == nil {
+				t.Fatalf("Expected error running CLI")
+			}
+		})
+	}
+
+	t.Run("action_does_not_finish_within_requested_timeout", func(t *testing.T) {
+		t.Parallel()
+
+		cli := compressor.Cli{
+			Args:        []string{testCommand, compressor.ActionCompress, "--timeout=100ms"},
+			Output:      io.Discard,
+			ErrorOutput: &bytes.Buffer{},
+			Input:       rand.New(rand.NewSource(time.Now().UnixNano())),
+		}
+
+		err := cli.Run(testutil.ContextWithDeadline(t))
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("Expected error %v, got %v", context.DeadlineExceeded, err)
+		}
+	})
+
+	for name, timeout := range map[string]string{
+		"timeout_is_not_a_duration": "foo",
+		"timeout_is_not_positive":   "0s",
+	} {
+		timeout := timeout
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			cli := compressor.Cli{
+				Args:        []string{testCommand, compressor.ActionCompress, "--timeout=" + timeout},
+				Output:      &bytes.Buffer{},
+				ErrorOutput: &bytes.Buffer{},
+				Input:       bytes.NewBufferString(testData),
+			}
+
+			if err := cli.Run(testutil.ContextWithDeadline(t)); err == nil {
+				t.Fatalf("Expected error running CLI")
+			}
+		})
+	}
+
 	t.Run("writing_to_given_output_fails", func(t *testing.T) {
 		t.Parallel()
 
@@ -528,11 +3900,19 @@ func Test_Running_CLI_returns_error_when(t *testing.T) {
 }
 
 func TestMain(m *testing.M) {
-	// Ensure user has no format environment variable set when running tests, to make sure
+	// Ensure user has no CLI environment variables set when running tests, to make sure
 	// test results are not affected by user environment.
-	if err := os.Unsetenv(compressor.FormatEnv); err != nil {
-		fmt.Fprintf(os.Stderr, "Failed unsetting environment variable %q: %v", compressor.FormatEnv, err)
-		os.Exit(1)
+	for _, env := range os.Environ() {
+		name := strings.SplitN(env, "=", 2)[0]
+
+		if !strings.HasPrefix(name, compressor.EnvPrefix) {
+			continue
+		}
+
+		if err := os.Unsetenv(name); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed unsetting environment variable %q: %v", name, err)
+			os.Exit(1)
+		}
 	}
 
 	os.Exit(m.Run())
@@ -546,7 +3926,88 @@ func (f *testFailingWriter) Write([]byte) (int, error) {
 	return 0, f.err
 }
 
+// BenchmarkCLI compares compressing data using CLI, which includes parsing flags, loading configuration and
+// setting up input and output, with calling compressor client directly. If CLI overhead exceeds 10%,
+// it should be investigated.
+func BenchmarkCLI(b *testing.B) {
+	data := bytes.Repeat([]byte(testData), 1024)
+
+	configPath := filepath.Join(b.TempDir(), "config.yaml")
+
+	if err := os.WriteFile(configPath, []byte("format: gzip"), 0o600); err != nil {
+		b.Fatalf("Failed writing config file: %v", err)
+	}
+
+	b.Run("cli", func(b *testing.B) {
+		b.SetBytes(int64(len(data)))
+
+		for i := 0; i < b.N; i++ {
+			cli := compressor.Cli{
+				Args:        []string{testCommand, compressor.ActionCompress, "--config=" + configPath},
+				Output:      io.Discard,
+				ErrorOutput: io.Discard,
+				Input:       bytes.NewReader(data),
+			}
+
+			if err := cli.Run(context.Background()); err != nil {
+				b.Fatalf("Unexpected error running CLI: %v", err)
+			}
+		}
+	})
+
+	b.Run("direct", func(b *testing.B) {
+		b.SetBytes(int64(len(data)))
+
+		client, err := pkgCompressor.NewClient()
+		if err != nil {
+			b.Fatalf("Unexpected error creating client: %v", err)
+		}
+
+		for i := 0; i < b.N; i++ {
+			output, errCh := client.Compress(context.Background(), io.NopCloser(bytes.NewReader(data)))
+
+			if _, err := io.Copy(io.Discard, output); err != nil {
+				b.Fatalf("Unexpected error reading compressed data: %v", err)
+			}
+
+			if err := <-errCh; err != nil {
+				b.Fatalf("Unexpected compression error: %v", err)
+			}
+		}
+	})
+}
+
+func FuzzReadConfig(f *testing.F) {
+	for _, seed := range []struct {
+		config string
+		format string
+	}{
+		{},
+		{config: "format: gzip", format: "gzip"},
+		{config: "format: noop\nunknown: field", format: "noop"},
+		{config: "format: [", format: "foo"},
+		{config: "format:\n  nested: value", format: "\x00"},
+	} {
+		f.Add([]byte(seed.config), seed.format)
+	}
+
+	f.Fuzz(func(t *testing.T, configRaw []byte, format string) {
+		config := &compressor.Config{}
+
+		// Only absence of panics is verified, as arbitrary content is expected to produce errors.
+		_ = yaml.Unmarshal(configRaw, config) //nolint:errcheck // See above.
+
+		_, err := pkgCompressor.NewClient(pkgCompressor.Config{Format: pkgCompressor.Format(format)})
+		if format != "" && !pkgCompressor.Format(format).IsValid() && err == nil {
+			t.Fatalf("Expected error creating client with invalid format %q", format)
+		}
+	})
+}
+
 const (
 	testCommand = "testCommand"
 	testData    = "testData"
+
+	// Generated using: echo -n testData | sha256sum.
+	testDataSHA256 = "ba477a0ac57e10dd90bb5bf0289c5990fe839c619b26fde7c2aac62f526d4113"
 )
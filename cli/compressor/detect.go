@@ -0,0 +1,105 @@
+package compressor
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/invidian/golang-cli-testing-example/pkg/compressor"
+)
+
+const (
+	// Formats which are not supported, but are detected to produce meaningful errors.
+	formatZstd  compressor.Format = "zstd"
+	formatLZ4   compressor.Format = "lz4"
+	formatBzip2 compressor.Format = "bzip2"
+
+	magicBytesLength = 4
+)
+
+//nolint:gochecknoglobals // Effectively constant lookup table.
+var formatMagicBytes = map[compressor.Format][]byte{
+	compressor.FormatGzip: {0x1f, 0x8b},
+	formatZstd:            {0x28, 0xb5, 0x2f, 0xfd},
+	formatLZ4:             {0x04, 0x22, 0x4d, 0x18},
+}
+
+//nolint:gochecknoglobals // Effectively constant lookup table.
+var formatExtensions = map[string]compressor.Format{
+	".gz":  compressor.FormatGzip,
+	".zst": formatZstd,
+	".lz4": formatLZ4,
+	".bz2": formatBzip2,
+}
+
+// formatFromExtension returns compression format inferred from the extension of given path. If extension is
+// not known, empty format is returned.
+func formatFromExtension(path string) compressor.Format {
+	return formatExtensions[strings.ToLower(filepath.Ext(path))]
+}
+
+// extensionForFormat returns standard file extension for given format. If format has no standard extension,
+// empty string is returned.
+func extensionForFormat(format compressor.Format) string {
+	for extension, extensionFormat := range formatExtensions {
+		if extensionFormat == format {
+			return extension
+		}
+	}
+
+	return ""
+}
+
+// detectFormat detects compression format of the data based on magic bytes. Returned reader must be used
+// instead of given one, as it still includes inspected bytes. If format cannot be detected, empty format
+// is returned.
+func detectFormat(r io.Reader) (compressor.Format, io.Reader, error) {
+	reader := bufio.NewReader(r)
+
+	header, err := reader.Peek(magicBytesLength)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", nil, fmt.Errorf("reading header: %w", err)
+	}
+
+	for format, magicBytes := range formatMagicBytes {
+		if bytes.HasPrefix(header, magicBytes) {
+			return format, reader, nil
+		}
+	}
+
+	return "", reader, nil
+}
+
+// detectInputFormat selects format for decompressing the input, when format is not specified. Format of input
+// files is inferred from their extension and format of user input is detected from its content.
+func (c *runState) detectInputFormat(input io.Reader) (io.Reader, error) {
+	inputFormat := &c.format
+
+	if c.action == ActionTranscode {
+		inputFormat = &c.from
+	}
+
+	if (c.action != ActionDecompress && c.action != ActionTranscode) || *inputFormat != "" {
+		return input, nil
+	}
+
+	// Concatenated inputs are expected to use the same format.
+	if len(c.inputPaths) > 0 {
+		*inputFormat = string(formatFromExtension(c.inputPaths[0]))
+
+		return input, nil
+	}
+
+	format, input, err := detectFormat(input)
+	if err != nil {
+		return nil, fmt.Errorf("detecting format: %w", err)
+	}
+
+	*inputFormat = string(format)
+
+	return input, nil
+}
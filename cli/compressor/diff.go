@@ -0,0 +1,429 @@
+package compressor
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/invidian/golang-cli-testing-example/pkg/compressor"
+)
+
+// Patch consists of a header with magic number, version, base data size and result size, followed by
+// operations creating the result. Each operation is a single byte with its type followed by unsigned varints:
+// offset and length of base data to copy for patchOpCopy or length of data to insert for patchOpInsert,
+// followed by inserted data. Header integers are encoded in big-endian byte order.
+const (
+	patchVersion    byte = 2
+	patchHeaderSize      = 4 + 1 + 8 + 8
+
+	patchOpCopy   byte = 0
+	patchOpInsert byte = 1
+
+	// patchBlockSize is a size of base data blocks, which are searched for in new data. Smaller blocks find
+	// more matches, but make the index bigger.
+	patchBlockSize = 32
+	// patchHashBase is a multiplier of the rolling hash.
+	patchHashBase uint32 = 16777619
+)
+
+//nolint:gochecknoglobals // Arrays can't be constants.
+var patchMagic = [4]byte{'C', 'P', 'A', 'T'}
+
+// newPatch creates patch, which transforms old data into new data. Old data is indexed in blocks, which are
+// searched for in new data using rolling hash, so moved and repeated regions are copied instead of inserted.
+func newPatch(oldData, newData []byte) []byte {
+	index := map[uint32]int{}
+
+	for offset := 0; offset+patchBlockSize <= len(oldData); offset += patchBlockSize {
+		hash := patchHash(oldData[offset : offset+patchBlockSize])
+
+		// Keep the first block, so repeated data is copied from the same place.
+		if _, ok := index[hash]; !ok {
+			index[hash] = offset
+		}
+	}
+
+	patch := make([]byte, patchHeaderSize)
+
+	copy(patch, patchMagic[:])
+	patch[len(patchMagic)] = patchVersion
+
+	binary.BigEndian.PutUint64(patch[5:], uint64(len(oldData)))
+	binary.BigEndian.PutUint64(patch[13:], uint64(len(newData)))
+
+	// Data since insertStart did not match any block yet and will be inserted.
+	insertStart := 0
+
+	weight := patchHashWeight()
+
+	var hash uint32
+	if len(newData) >= patchBlockSize {
+		hash = patchHash(newData[:patchBlockSize])
+	}
+
+	for i := 0; i+patchBlockSize <= len(newData); {
+		offset, ok := index[hash]
+		if !ok || !bytes.Equal(oldData[offset:offset+patchBlockSize], newData[i:i+patchBlockSize]) {
+			if i+patchBlockSize < len(newData) {
+				hash = rollPatchHash(hash, weight, newData[i], newData[i+patchBlockSize])
+			}
+
+			i++
+
+			continue
+		}
+
+		// Extend the match in both directions, as blocks of old data are aligned.
+		for offset > 0 && i > insertStart && oldData[offset-1] == newData[i-1] {
+			offset--
+			i--
+		}
+
+		length := 0
+		for offset+length < len(oldData) && i+length < len(newData) && oldData[offset+length] == newData[i+length] {
+			length++
+		}
+
+		patch = appendPatchInsert(patch, newData[insertStart:i])
+		patch = append(patch, patchOpCopy)
+		patch = binary.AppendUvarint(patch, uint64(offset))
+		patch = binary.AppendUvarint(patch, uint64(length))
+
+		i += length
+		insertStart = i
+
+		if i+patchBlockSize <= len(newData) {
+			hash = patchHash(newData[i : i+patchBlockSize])
+		}
+	}
+
+	return appendPatchInsert(patch, newData[insertStart:])
+}
+
+// appendPatchInsert appends operation inserting given data to the patch, unless data is empty.
+func appendPatchInsert(patch, data []byte) []byte {
+	if len(data) == 0 {
+		return patch
+	}
+
+	patch = append(patch, patchOpInsert)
+	patch = binary.AppendUvarint(patch, uint64(len(data)))
+
+	return append(patch, data...)
+}
+
+// patchHash calculates polynomial hash of given block, which can be updated using rollPatchHash.
+func patchHash(block []byte) uint32 {
+	var hash uint32
+
+	for _, b := range block {
+		hash = hash*patchHashBase + uint32(b)
+	}
+
+	return hash
+}
+
+// patchHashWeight returns weight of the first byte of the block in its hash.
+func patchHashWeight() uint32 {
+	weight := uint32(1)
+	for i := 1; i < patchBlockSize; i++ {
+		weight *= patchHashBase
+	}
+
+	return weight
+}
+
+// rollPatchHash moves block with given hash by one byte, removing old byte with given weight and adding new one.
+func rollPatchHash(hash, weight uint32, oldByte, newByte byte) uint32 {
+	return (hash-uint32(oldByte)*weight)*patchHashBase + uint32(newByte)
+}
+
+// applyPatch transforms base data using patch created by newPatch and writes the result to given writer.
+// Patch is read as it is applied, so neither patch nor result has to fit in memory.
+func applyPatch(base []byte, patch io.Reader, output io.Writer) error {
+	reader := bufio.NewReader(patch)
+
+	header := make([]byte, patchHeaderSize)
+
+	if _, err := io.ReadFull(reader, header); err != nil || !bytes.Equal(header[:len(patchMagic)], patchMagic[:]) {
+		return fmt.Errorf("patch has invalid header")
+	}
+
+	if version := header[len(patchMagic)]; version != patchVersion {
+		return fmt.Errorf("unsupported patch version %d", version)
+	}
+
+	if baseSize := binary.BigEndian.Uint64(header[5:]); baseSize != uint64(len(base)) {
+		return fmt.Errorf("patch expects base of %d bytes, got %d", baseSize, len(base))
+	}
+
+	// Remaining size of the result, so operations producing more data are rejected before writing it.
+	remaining := binary.BigEndian.Uint64(header[13:])
+	if remaining > math.MaxInt64 {
+		return fmt.Errorf("patch result size %d is too big", remaining)
+	}
+
+	for {
+		op, err := reader.ReadByte()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return fmt.Errorf("reading operation: %w", err)
+		}
+
+		length, err := applyPatchOp(op, base, reader, output, remaining)
+		if err != nil {
+			return err
+		}
+
+		remaining -= length
+	}
+
+	if remaining != 0 {
+		return fmt.Errorf("patch is truncated, %d bytes of result are missing", remaining)
+	}
+
+	return nil
+}
+
+// applyPatchOp applies single operation of given type and returns length of written data.
+func applyPatchOp(op byte, base []byte, reader *bufio.Reader, output io.Writer, remaining uint64) (uint64, error) {
+	var offset uint64
+
+	if op == patchOpCopy {
+		var err error
+
+		if offset, err = binary.ReadUvarint(reader); err != nil {
+			return 0, fmt.Errorf("reading copy offset: %w", err)
+		}
+	}
+
+	length, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return 0, fmt.Errorf("reading operation length: %w", err)
+	}
+
+	if length > remaining {
+		return 0, fmt.Errorf("operation exceeds result size by %d bytes", length-remaining)
+	}
+
+	switch op {
+	case patchOpCopy:
+		if offset > uint64(len(base)) || length > uint64(len(base))-offset {
+			return 0, fmt.Errorf("copied range exceeds base data")
+		}
+
+		if _, err := output.Write(base[offset : offset+length]); err != nil {
+			return 0, fmt.Errorf("writing copied data: %w", err)
+		}
+	case patchOpInsert:
+		// Length is lower than result size, which fits in int64.
+		if _, err := io.CopyN(output, reader, int64(length)); err != nil {
+			return 0, fmt.Errorf("writing inserted data: %w", err)
+		}
+	default:
+		return 0, fmt.Errorf("unknown operation %d", op)
+	}
+
+	return length, nil
+}
+
+// runDelta runs action creating or applying patches.
+func (c *runState) runDelta(ctx context.Context) error {
+	if err := c.readConfig(); err != nil {
+		return fmt.Errorf("reading configuration: %w", err)
+	}
+
+	ctx, cancel, err := c.withTimeout(ctx)
+	if err != nil {
+		return fmt.Errorf("applying timeout: %w", err)
+	}
+
+	defer cancel()
+
+	if c.action == ActionDiff {
+		return c.runDiff(ctx)
+	}
+
+	return c.runPatch(ctx)
+}
+
+// validateDeltaFlags ensures, that paths required by diff and patch actions are specified only for them.
+func (c *runState) validateDeltaFlags() error {
+	diffFlags := c.diffOld != "" || c.diffNew != ""
+	patchFlags := c.patchBase != "" || c.patchPath != ""
+
+	switch {
+	case c.action == ActionDiff && (c.diffOld == "" || c.diffNew == ""):
+		return fmt.Errorf("both old and new paths must be specified for %q action", ActionDiff)
+	case c.action == ActionPatch && (c.patchBase == "" || c.patchPath == ""):
+		return fmt.Errorf("both base and patch paths must be specified for %q action", ActionPatch)
+	case diffFlags && c.action != ActionDiff:
+		return fmt.Errorf("old and new paths can only be used with %q action", ActionDiff)
+	case patchFlags && c.action != ActionPatch:
+		return fmt.Errorf("base and patch paths can only be used with %q action", ActionPatch)
+	}
+
+	return nil
+}
+
+// runDiff writes patch between decompressed old and new data into the output.
+func (c *runState) runDiff(ctx context.Context) error {
+	oldData, err := c.readDecompressed(ctx, c.diffOld)
+	if err != nil {
+		return fmt.Errorf("reading old data: %w", err)
+	}
+
+	newData, err := c.readDecompressed(ctx, c.diffNew)
+	if err != nil {
+		return fmt.Errorf("reading new data: %w", err)
+	}
+
+	return c.writeOutput(ctx, bytes.NewReader(newPatch(oldData, newData)))
+}
+
+// runPatch applies patch to decompressed base data and writes compressed result into the output.
+func (c *runState) runPatch(ctx context.Context) error {
+	base, err := c.readDecompressed(ctx, c.patchBase)
+	if err != nil {
+		return fmt.Errorf("reading base data: %w", err)
+	}
+
+	patch, err := c.openLimitedInput(ctx, c.patchPath)
+	if err != nil {
+		return fmt.Errorf("opening patch: %w", err)
+	}
+
+	//nolint:errcheck // Input is only read, so closing errors can be ignored.
+	defer patch.Close()
+
+	client, err := compressor.NewClient(compressor.Config{Format: compressor.Format(c.format)})
+	if err != nil {
+		return fmt.Errorf("creating compressor client: %w", err)
+	}
+
+	// Result is compressed as it is produced, so it does not have to fit in memory.
+	resultReader, resultWriter := io.Pipe()
+
+	// Unblock applying patch when compressing stops early.
+	//
+	//nolint:errcheck // Closing pipe always returns nil.
+	defer resultReader.Close()
+
+	go func() {
+		if err := applyPatch(base, patch, resultWriter); err != nil {
+			//nolint:errcheck // Closing pipe always returns nil.
+			resultWriter.CloseWithError(fmt.Errorf("applying patch: %w", err))
+
+			return
+		}
+
+		//nolint:errcheck // Closing pipe always returns nil.
+		resultWriter.Close()
+	}()
+
+	output, errCh := client.Compress(ctx, resultReader)
+
+	if err := c.writeOutput(ctx, output); err != nil {
+		return err
+	}
+
+	if err := <-errCh; err != nil {
+		return fmt.Errorf("compressing data: %w", err)
+	}
+
+	return nil
+}
+
+// openLimitedInput opens input from given path, which fails when it exceeds input limit.
+func (c *runState) openLimitedInput(ctx context.Context, path string) (io.ReadCloser, error) {
+	input, err := c.openInput(ctx, path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := c.limitInput(input)
+	if err != nil {
+		//nolint:errcheck // We already return an error.
+		input.Close()
+
+		return nil, err
+	}
+
+	return struct {
+		io.Reader
+		io.Closer
+	}{reader, input}, nil
+}
+
+// readDecompressed reads and decompresses whole input from given path. Input limit applies to the
+// compressed input and output limit to the decompressed data, as it is held in memory.
+func (c *runState) readDecompressed(ctx context.Context, path string) ([]byte, error) {
+	input, err := c.openLimitedInput(ctx, path)
+	if err != nil {
+		return nil, fmt.Errorf("opening input: %w", err)
+	}
+
+	//nolint:errcheck // Input is only read, so closing errors can be ignored.
+	defer input.Close()
+
+	config := compressor.Config{Format: compressor.Format(c.format)}
+
+	if c.outputLimit != "" {
+		if config.MaxOutputBytes, err = parseBytes(c.outputLimit); err != nil {
+			return nil, fmt.Errorf("parsing output limit: %w", err)
+		}
+	}
+
+	client, err := compressor.NewClient(config)
+	if err != nil {
+		return nil, fmt.Errorf("creating compressor client: %w", err)
+	}
+
+	output, errCh := client.Decompress(ctx, input)
+
+	data, err := io.ReadAll(output)
+	if err != nil {
+		return nil, fmt.Errorf("reading decompressed data: %w", err)
+	}
+
+	if err := <-errCh; err != nil {
+		return nil, fmt.Errorf("decompressing data: %w", err)
+	}
+
+	return data, nil
+}
+
+// writeOutput copies given data into requested output.
+func (c *runState) writeOutput(ctx context.Context, data io.Reader) error {
+	output, finishOutput, err := c.openOutput(ctx, c.outputPath, c.Output)
+	if err != nil {
+		return fmt.Errorf("opening output: %w", err)
+	}
+
+	limitedOutput, err := c.limitOutput(output)
+	if err != nil {
+		//nolint:errcheck // We already return an error.
+		finishOutput(err)
+
+		return err
+	}
+
+	_, copyErr := io.Copy(limitedOutput, data)
+	if copyErr != nil {
+		copyErr = fmt.Errorf("writing output: %w", copyErr)
+	}
+
+	if err := finishOutput(copyErr); err != nil {
+		return fmt.Errorf("finishing output: %w", err)
+	}
+
+	return copyErr
+}
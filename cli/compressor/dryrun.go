@@ -0,0 +1,62 @@
+package compressor
+
+import (
+	"fmt"
+	"io"
+)
+
+// validateDryRunFlags ensures, that dry run and counting is only requested for actions producing output data.
+func (c *runState) validateDryRunFlags() error {
+	if !c.discardsOutput() {
+		return nil
+	}
+
+	if c.dryRun && c.countOnly {
+		return fmt.Errorf("dry run and count only can't be used together")
+	}
+
+	switch c.action {
+	case ActionCompress, ActionDecompress, ActionCopy, ActionTranscode:
+		return nil
+	}
+
+	return fmt.Errorf("dry run and count only can only be used with %q, %q, %q and %q actions",
+		ActionCompress, ActionDecompress, ActionCopy, ActionTranscode)
+}
+
+// discardsOutput returns true, when result of the action should be discarded instead of written to the output.
+func (c *runState) discardsOutput() bool {
+	return c.dryRun || c.countOnly
+}
+
+// openDiscardedOutput returns output discarding all data, so configured output is not created or modified.
+func openDiscardedOutput() (io.Writer, finishOutputFunc) {
+	return io.Discard, func(error) error { return nil }
+}
+
+// reportDiscarded prints summary of the action, which output has been discarded, using requested output format.
+func (c *runState) reportDiscarded(inputBytes, outputBytes int64) {
+	if !c.countOnly {
+		c.report(message{
+			Level:          levelInfo,
+			Msg:            "dry run complete",
+			BytesProcessed: &inputBytes,
+		}, fmt.Sprintf("Dry run complete: %d bytes processed", inputBytes))
+
+		return
+	}
+
+	ratio := 0.0
+
+	if inputBytes > 0 {
+		ratio = float64(outputBytes) / float64(inputBytes)
+	}
+
+	c.report(message{
+		Level:          levelInfo,
+		Msg:            "count complete",
+		BytesProcessed: &inputBytes,
+		BytesWritten:   &outputBytes,
+		Ratio:          &ratio,
+	}, fmt.Sprintf("Input: %d bytes, Output: %d bytes, Ratio: %.2f", inputBytes, outputBytes, ratio))
+}
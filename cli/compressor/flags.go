@@ -0,0 +1,534 @@
+package compressor
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/invidian/golang-cli-testing-example/pkg/compressor"
+)
+
+// flagNameWidth is a width of the column with flag names in usage message. Longer names are printed in separate
+// line.
+const flagNameWidth = 17
+
+// endOfFlags separates flags from positional arguments, which should not be parsed as flags even if they
+// start with a dash.
+const endOfFlags = "--"
+
+// cliFlag describes single flag, so parsing, usage message and manual page are always in sync.
+type cliFlag struct {
+	name string
+	// short is an optional single character alias of the flag, e.g. f for format.
+	short string
+	// placeholder describes expected value in the manual page. It is empty for flags without value.
+	placeholder string
+	// usage may contain multiple lines, which are indented in usage message.
+	usage string
+	// value is set for flags with value, which can also be set using environment variables.
+	value *string
+	// values is set instead of value for flags, which can be given multiple times.
+	values *[]string
+	// enabled is set for flags without value, which enable an option. They can also be set using environment
+	// variables with boolean value, e.g. true or 1.
+	enabled *bool
+	// set is called for flags without value, which select an action.
+	set func()
+}
+
+// takesValue returns true for flags, which require a value.
+func (f cliFlag) takesValue() bool {
+	return f.value != nil || f.values != nil
+}
+
+// settableFromEnv returns true for flags, which can be set using environment variables. Flags selecting an
+// action and flags without destination, like --args-file, can't.
+func (f cliFlag) settableFromEnv() bool {
+	return f.takesValue() || f.enabled != nil
+}
+
+// setValue sets flag value from environment variable.
+func (f cliFlag) setValue(value string) error {
+	switch {
+	case f.value != nil:
+		*f.value = value
+	case f.values != nil:
+		*f.values = []string{value}
+	case f.enabled != nil:
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("parsing boolean value: %w", err)
+		}
+
+		*f.enabled = enabled
+	}
+
+	return nil
+}
+
+// stringsValue collects values of flag given multiple times. Values set before parsing, e.g. from environment
+// variables, are replaced when flag is given for the first time.
+type stringsValue struct {
+	values *[]string
+	parsed bool
+}
+
+func (s *stringsValue) String() string {
+	if s.values == nil {
+		return ""
+	}
+
+	return strings.Join(*s.values, ",")
+}
+
+func (s *stringsValue) Set(value string) error {
+	if !s.parsed {
+		*s.values = nil
+		s.parsed = true
+	}
+
+	*s.values = append(*s.values, value)
+
+	return nil
+}
+
+// cliCommand describes single action, which can be requested.
+type cliCommand struct {
+	name  string
+	usage string
+}
+
+func commands() []cliCommand {
+	return []cliCommand{
+		{ActionCompress, "Compress data from standard input"},
+		{ActionDecompress, "Decompress data from standard input"},
+		{ActionVersion, "Print version information"},
+		{ActionValidate, "Validate configuration file"},
+		{ActionBenchmark, "Measure compression throughput and ratio using zero bytes as input"},
+		{ActionCopy, "Copy data from standard input without any compression"},
+		{ActionTranscode, "Decompress data from standard input and compress it again using different format"},
+		{ActionDiff, "Create patch between decompressed --old and --new data"},
+		{ActionPatch, "Apply --patch to decompressed --base data and compress the result"},
+		{ActionManPage, "Print manual page in groff format"},
+		{ActionZip, "Create ZIP archive of input files and directories, compressing each file independently"},
+		{ActionUnzip, "Extract ZIP archive into directory given by --output"},
+		{ActionServe, "Compress and decompress data sent over Unix domain socket given by --socket"},
+	}
+}
+
+//nolint:funlen // Flags are just listed here.
+func (c *runState) flags() []cliFlag {
+	return []cliFlag{
+		{name: "help", short: "h", usage: "Print this help message.", set: func() { c.action = actionHelp }},
+		{
+			name:  "list-formats",
+			usage: "Print available compression formats, one per line.",
+			// Keep parsing, as output format may be specified after this flag.
+			set: func() { c.action = actionListFormats },
+		},
+		{name: "version", usage: "Print version information.", set: func() { c.action = ActionVersion }},
+		{
+			name:        "format",
+			short:       "f",
+			placeholder: "FORMAT",
+			usage: fmt.Sprintf("Specified compression format. Valid values are: %s. Default is %s.",
+				strings.Join(formatNames(compressor.AvailableFormats()), ", "), compressor.DefaultFormat),
+			value: &c.format,
+		},
+		{
+			name:        "from",
+			placeholder: "FORMAT",
+			usage:       "Compression format of data to transcode. Default is value of --format.",
+			value:       &c.from,
+		},
+		{
+			name:        "to",
+			placeholder: "FORMAT",
+			usage:       "Compression format to transcode data to. Default is value of --format.",
+			value:       &c.to,
+		},
+		{
+			name:        "config",
+			short:       "c",
+			placeholder: "PATH",
+			usage:       fmt.Sprintf("Path to optional configuration file. Default is %s.", DefaultConfigPath),
+			value:       &c.configPath,
+		},
+		{
+			name:        "input",
+			short:       "i",
+			placeholder: "PATH",
+			usage: "Path to input file, HTTP(S) URL or S3 path in form s3://<bucket>/<key> which should be\n" +
+				"processed. Can be given multiple times to process concatenated inputs.",
+			values: &c.inputPaths,
+		},
+		{
+			name:        "http-retries",
+			placeholder: "N",
+			usage: fmt.Sprintf("Number of times HTTP input request is retried on server errors and timeouts. Default is %d.",
+				DefaultHTTPRetries),
+			value: &c.httpRetries,
+		},
+		{
+			name:        "output",
+			short:       "o",
+			placeholder: "PATH",
+			usage: "Path to output file, HTTP(S) URL where result should be uploaded using PUT request or S3\n" +
+				"path in form s3://<bucket>/<key>. Extension matching compression format is appended to output\n" +
+				"file path if missing.",
+			value: &c.outputPath,
+		},
+		{
+			name:        "s3-region",
+			placeholder: "REGION",
+			usage:       "Region of S3 input and output. Defaults to AWS_REGION environment variable.",
+			value:       &c.s3Region,
+		},
+		{
+			name:        "s3-endpoint",
+			placeholder: "URL",
+			usage: "Endpoint of S3-compatible storage like MinIO or Ceph used for S3 input and output.\n" +
+				"Credentials are read from AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY environment variables.",
+			value: &c.s3Endpoint,
+		},
+		{
+			name: "recursive",
+			usage: "Compress all files found in input directories into single output using block compression.\n" +
+				fmt.Sprintf("Block size is %s unless --block-size is set.", DefaultRecursiveBlockSize),
+			enabled: &c.recursive,
+		},
+		{
+			name:        "include",
+			placeholder: "GLOB",
+			usage:       "Only compress files with names matching given pattern, e.g. *.log, when --recursive is set.",
+			value:       &c.include,
+		},
+		{
+			name:        "exclude",
+			placeholder: "GLOB",
+			usage:       "Skip files with names matching given pattern when --recursive is set.",
+			value:       &c.exclude,
+		},
+		{
+			name: "archive",
+			usage: "Compress tar archive of input files and directories. When decompressing, extract the archive\n" +
+				"into directory given by --output.",
+			enabled: &c.archive,
+		},
+		{
+			name:        "zip-level",
+			placeholder: "N",
+			usage:       "Compression level of ZIP archive entries from 0 to 9. Default is 6.",
+			value:       &c.zipLevel,
+		},
+		{
+			name: "dry-run",
+			usage: "Read and process all input, but discard the result instead of writing it to the output.\n" +
+				"Number of processed bytes is printed to error output.",
+			enabled: &c.dryRun,
+		},
+		{
+			name: "count-only",
+			usage: "Discard the result and print number of input and output bytes and ratio of output to input\n" +
+				"size to error output, like wc -c for compressed data.",
+			enabled: &c.countOnly,
+		},
+		{
+			name: "watch",
+			usage: "Process input file or directory given by --input again every time it changes, until\n" +
+				"interrupted. Each result is written to a new file named after --output with timestamp added.",
+			enabled: &c.watch,
+		},
+		{
+			name:        "socket",
+			placeholder: "PATH",
+			usage: "Path of Unix domain socket, on which serve action listens for requests. Data of each request\n" +
+				fmt.Sprintf("and response is limited by --input-limit and --output-limit, %s by default.",
+					DefaultServeDataLimit),
+			value: &c.socket,
+		},
+		{
+			name:    "no-auto-extension",
+			usage:   "Do not append extension matching compression format to output file path.",
+			enabled: &c.noAutoExtension,
+		},
+		{
+			name:        "input-limit",
+			placeholder: "SIZE",
+			usage:       "Maximum number of bytes to read from input, e.g. 10M or 1G. Unlimited by default.",
+			value:       &c.inputLimit,
+		},
+		{
+			name:        "output-limit",
+			placeholder: "SIZE",
+			usage:       "Maximum number of bytes to write to output, e.g. 10M or 1G. Unlimited by default.",
+			value:       &c.outputLimit,
+		},
+		{
+			name:        "rate-limit",
+			placeholder: "SIZE",
+			usage:       "Maximum number of input bytes read per second, e.g. 10M. Unlimited by default.",
+			value:       &c.rateLimit,
+		},
+		{
+			name:        "checksum",
+			placeholder: "ALGORITHM",
+			usage: fmt.Sprintf("Print checksum of uncompressed data to error output. Valid values are: %s.",
+				strings.Join(compressor.AvailableChecksumAlgorithms(), ", ")),
+			value: &c.checksum,
+		},
+		{
+			name:        "verify-checksum",
+			placeholder: "HEX",
+			usage:       "Hex-encoded checksum which uncompressed data must match. Requires --checksum.",
+			value:       &c.verifyChecksum,
+		},
+		{
+			name:        "block-size",
+			placeholder: "SIZE",
+			usage: "Compress data in independent blocks of given size, e.g. 1M. Must be set for decompression\n" +
+				"of data compressed in blocks as well. Maximum is 64M.",
+			value: &c.blockSize,
+		},
+		{
+			name:        "parallelism",
+			placeholder: "N",
+			usage: fmt.Sprintf("Number of blocks processed concurrently when --block-size is set. Default is number\n"+
+				"of CPUs. Maximum is %d.", compressor.MaxParallelism),
+			value: &c.parallelism,
+		},
+		{
+			name:        "chunk-size",
+			placeholder: "SIZE",
+			usage: fmt.Sprintf("Number of bytes processed between checks for cancellation, e.g. 4K. Smaller chunks\n"+
+				"make cancellation more responsive at the cost of more overhead. Default is %dK.",
+				compressor.DefaultChunkSize/1024),
+			value: &c.chunkSize,
+		},
+		{
+			name:        "timeout",
+			placeholder: "DURATION",
+			usage:       "Maximum duration of the action, e.g. 30s or 5m. Unlimited by default.",
+			value:       &c.timeout,
+		},
+		{
+			name:        "output-format",
+			placeholder: "FORMAT",
+			usage: fmt.Sprintf("Format of messages printed to error output. Valid values are: %s, %s. Default is %s.",
+				OutputFormatText, OutputFormatJSON, OutputFormatText),
+			value: &c.outputFormat,
+		},
+		{
+			name:        "duration",
+			placeholder: "DURATION",
+			usage: fmt.Sprintf("How long benchmark should run, e.g. 10s. Default is %v unless --size is set.",
+				DefaultBenchmarkDuration),
+			value: &c.benchmarkDuration,
+		},
+		{
+			name:        "size",
+			placeholder: "SIZE",
+			usage:       "Number of zero bytes to compress by benchmark, e.g. 100M.",
+			value:       &c.benchmarkSize,
+		},
+		{name: "old", placeholder: "PATH", usage: "Path to compressed old data to create patch from.", value: &c.diffOld},
+		{name: "new", placeholder: "PATH", usage: "Path to compressed new data to create patch from.", value: &c.diffNew},
+		{name: "base", placeholder: "PATH", usage: "Path to compressed base data to apply patch to.", value: &c.patchBase},
+		{name: "patch", placeholder: "PATH", usage: "Path to patch to apply to base data.", value: &c.patchPath},
+		{
+			// Arguments files are loaded before parsing, see expandArgs.
+			name:        "args-file",
+			placeholder: "PATH",
+			usage: "Path to file with additional arguments, one per line, e.g. --args-file=args or @args.\n" +
+				"Arguments given directly take precedence. Can't be set using environment variable.",
+		},
+	}
+}
+
+// newFlagSet returns flag set parsing defined flags, which reports errors to error output.
+func (c *runState) newFlagSet() *flag.FlagSet {
+	flagSet := flag.NewFlagSet(c.Args[0], flag.ContinueOnError)
+	flagSet.SetOutput(c.ErrorOutput)
+	flagSet.Usage = func() {
+		fmt.Fprintln(c.ErrorOutput, usage())
+	}
+
+	for _, definition := range c.flags() {
+		// Values are shared between all names of the flag, e.g. --input and -i.
+		values := &stringsValue{values: definition.values}
+
+		for _, name := range definition.names() {
+			switch {
+			case definition.values != nil:
+				flagSet.Var(values, name, definition.usage)
+			case definition.value != nil:
+				// Use current value as default, so values from environment variables are preserved.
+				flagSet.StringVar(definition.value, name, *definition.value, definition.usage)
+			case definition.enabled != nil:
+				// Use current value as default, so values from environment variables can also be disabled.
+				flagSet.BoolVar(definition.enabled, name, *definition.enabled, definition.usage)
+			case definition.set != nil:
+				flagSet.BoolFunc(name, definition.usage, boolFlag(definition.set))
+			}
+		}
+	}
+
+	return flagSet
+}
+
+// names returns all names flag can be given with.
+func (f cliFlag) names() []string {
+	if f.short == "" {
+		return []string{f.name}
+	}
+
+	return []string{f.name, f.short}
+}
+
+// flagsByName returns defined flags indexed by all their names.
+func (c *runState) flagsByName() map[string]cliFlag {
+	flags := map[string]cliFlag{}
+
+	for _, definition := range c.flags() {
+		for _, name := range definition.names() {
+			flags[name] = definition
+		}
+	}
+
+	return flags
+}
+
+// takesSeparateValue returns true if given argument is a flag, which takes its value from the next argument.
+func takesSeparateValue(flags map[string]cliFlag, arg string) bool {
+	if !strings.HasPrefix(arg, "-") || strings.Contains(arg, "=") {
+		return false
+	}
+
+	definition, ok := flags[strings.TrimLeft(arg, "-")]
+
+	return ok && definition.takesValue()
+}
+
+// splitShortFlags splits short flags with value given without separator, e.g. -fgzip into -f and gzip, as
+// flag set does not support this form. Arguments matching regular flags and flag values are kept as they are.
+// Arguments after end of flags separator -- are returned separately, without the separator.
+func (c *runState) splitShortFlags(args []string) ([]string, []string) {
+	flags := c.flagsByName()
+
+	splitArgs := []string{}
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+
+		if arg == endOfFlags {
+			return splitArgs, args[i+1:]
+		}
+
+		if !strings.HasPrefix(arg, "-") {
+			splitArgs = append(splitArgs, arg)
+
+			continue
+		}
+
+		name := strings.SplitN(strings.TrimLeft(arg, "-"), "=", 2)[0]
+
+		if _, ok := flags[name]; ok {
+			splitArgs = append(splitArgs, arg)
+
+			// Keep value given after a space as it is, even if it looks like a flag.
+			if takesSeparateValue(flags, arg) && i+1 < len(args) {
+				i++
+				splitArgs = append(splitArgs, args[i])
+			}
+
+			continue
+		}
+
+		if len(arg) > 2 && arg[1] != '-' {
+			if short, ok := flags[arg[1:2]]; ok && short.takesValue() {
+				splitArgs = append(splitArgs, arg[:2], arg[2:])
+
+				continue
+			}
+		}
+
+		splitArgs = append(splitArgs, arg)
+	}
+
+	return splitArgs, nil
+}
+
+// boolFlag returns function calling given function when flag value is true, e.g. --help or --help=true.
+func boolFlag(set func()) func(string) error {
+	return func(value string) error {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("parsing boolean value: %w", err)
+		}
+
+		if enabled {
+			set()
+		}
+
+		return nil
+	}
+}
+
+// flagsUsage formats given flags for usage message.
+func flagsUsage(flags []cliFlag) string {
+	var usage strings.Builder
+
+	for _, definition := range flags {
+		name := "--" + definition.name
+		if definition.short != "" {
+			name = "-" + definition.short + ", " + name
+		}
+
+		lines := strings.Split(definition.usage, "\n")
+
+		if len(name) > flagNameWidth {
+			fmt.Fprintf(&usage, "  %s\n", name)
+
+			name = ""
+		}
+
+		for i, line := range lines {
+			if i > 0 {
+				name = ""
+			}
+
+			fmt.Fprintf(&usage, "  %-*s %s\n", flagNameWidth, name, line)
+		}
+	}
+
+	return usage.String()
+}
+
+// envExceptions lists flags, which can't be set using environment variables, for usage message and manual page.
+func envExceptions(flags []cliFlag) string {
+	names := []string{}
+
+	for _, definition := range flags {
+		if !definition.settableFromEnv() {
+			names = append(names, "--"+definition.name)
+		}
+	}
+
+	if len(names) < 2 {
+		return strings.Join(names, "")
+	}
+
+	return strings.Join(names[:len(names)-1], ", ") + " and " + names[len(names)-1]
+}
+
+// commandsUsage formats given commands for usage message.
+func commandsUsage(commands []cliCommand) string {
+	var usage strings.Builder
+
+	for _, command := range commands {
+		fmt.Fprintf(&usage, "  %-10s %s\n", command.name, command.usage)
+	}
+
+	return usage.String()
+}
@@ -0,0 +1,30 @@
+package compressor
+
+import (
+	"io/fs"
+	"os"
+)
+
+// fsOpen opens file with given path from configured file system, falling back to file system of the process
+// when it is not configured.
+func (c *Cli) fsOpen(path string) (fs.File, error) {
+	if c.FS == nil {
+		//nolint:wrapcheck // Callers add context to the error.
+		return os.Open(path)
+	}
+
+	//nolint:wrapcheck // Callers add context to the error.
+	return c.FS.Open(path)
+}
+
+// fsReadFile reads content of file with given path from configured file system, falling back to file system
+// of the process when it is not configured.
+func (c *Cli) fsReadFile(path string) ([]byte, error) {
+	if c.FS == nil {
+		//nolint:wrapcheck // Callers add context to the error.
+		return os.ReadFile(path)
+	}
+
+	//nolint:wrapcheck // Callers add context to the error.
+	return fs.ReadFile(c.FS, path)
+}
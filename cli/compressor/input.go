@@ -0,0 +1,196 @@
+package compressor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultHTTPRetries is a number of times request for HTTP input is retried on transient errors.
+	DefaultHTTPRetries = 3
+
+	httpRetryInitialDelay = 100 * time.Millisecond
+)
+
+// isURL returns true when given path should be accessed using HTTP instead of local file system.
+func isURL(path string) bool {
+	return strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://")
+}
+
+// openInputs opens inputs from given paths and concatenates them. When no paths are given, fallback is used.
+// Returned reader closes all opened inputs.
+func (c *runState) openInputs(ctx context.Context, paths []string, fallback io.Reader) (io.ReadCloser, error) {
+	if len(paths) <= 1 {
+		path := ""
+		if len(paths) == 1 {
+			path = paths[0]
+		}
+
+		return c.openInput(ctx, path, fallback)
+	}
+
+	readers := make([]io.Reader, 0, len(paths))
+	inputs := &multiReadCloser{}
+
+	for _, path := range paths {
+		input, err := c.openInput(ctx, path, fallback)
+		if err != nil {
+			//nolint:errcheck // We already return an error.
+			inputs.Close()
+
+			return nil, err
+		}
+
+		readers = append(readers, input)
+		inputs.closers = append(inputs.closers, input)
+	}
+
+	// Original name and modification time can't be preserved for multiple files.
+	c.inputInfo = nil
+
+	inputs.Reader = io.MultiReader(readers...)
+
+	return inputs, nil
+}
+
+// multiReadCloser reads concatenated inputs and closes all of them when closed.
+type multiReadCloser struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (m *multiReadCloser) Close() error {
+	errs := []error{}
+
+	for _, closer := range m.closers {
+		if err := closer.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// openInput opens input from given path, which can be either local file, HTTP URL or S3 path. When path is empty,
+// fallback is used. Returned reader must be closed by the caller to release the underlying resources.
+func (c *runState) openInput(ctx context.Context, path string, fallback io.Reader) (io.ReadCloser, error) {
+	if path == "" && fallback == nil {
+		return nil, fmt.Errorf("either input or input path must be defined")
+	}
+
+	if path == "" {
+		// User input is owned by the caller, so it must not be closed.
+		return io.NopCloser(fallback), nil
+	}
+
+	if isS3URL(path) {
+		return c.openS3Input(ctx, path)
+	}
+
+	if isURL(path) {
+		retries := DefaultHTTPRetries
+
+		if c.httpRetries != "" {
+			var err error
+
+			if retries, err = strconv.Atoi(c.httpRetries); err != nil {
+				return nil, fmt.Errorf("parsing HTTP retries: %w", err)
+			}
+
+			if retries < 0 {
+				return nil, fmt.Errorf("HTTP retries must not be negative, got %d", retries)
+			}
+		}
+
+		return httpInputWithRetry(ctx, path, retries)
+	}
+
+	return c.openFileInput(path)
+}
+
+func (c *runState) openFileInput(path string) (io.ReadCloser, error) {
+	input, err := c.fsOpen(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening input file %q: %w", path, err)
+	}
+
+	// File information is used to preserve original file name and modification time in compressed data.
+	c.inputInfo, err = input.Stat()
+	if err != nil {
+		//nolint:errcheck // We already return an error.
+		input.Close()
+
+		return nil, fmt.Errorf("reading input file %q information: %w", path, err)
+	}
+
+	return input, nil
+}
+
+// httpInputWithRetry opens HTTP input, retrying given number of times with exponential backoff when
+// request fails with transient error.
+func httpInputWithRetry(ctx context.Context, url string, retries int) (io.ReadCloser, error) {
+	delay := httpRetryInitialDelay
+
+	for attempt := 0; ; attempt++ {
+		input, err := openHTTPInput(ctx, url)
+		if err == nil || attempt >= retries || !isTransientHTTPError(err) {
+			return input, err
+		}
+
+		time.Sleep(delay)
+
+		delay *= 2
+	}
+}
+
+// httpStatusError is returned when server responds with unexpected status code.
+type httpStatusError struct {
+	url    string
+	status string
+	code   int
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("requesting %q: unexpected status %q", e.url, e.status)
+}
+
+// isTransientHTTPError returns true for errors, which may not occur when request is retried, like
+// server errors or network timeouts.
+func isTransientHTTPError(err error) bool {
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.code >= http.StatusInternalServerError
+	}
+
+	var netErr net.Error
+
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+func openHTTPInput(ctx context.Context, url string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("requesting %q: %w", url, err)
+	}
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		//nolint:errcheck // We already return an error.
+		resp.Body.Close()
+
+		return nil, &httpStatusError{url: url, status: resp.Status, code: resp.StatusCode}
+	}
+
+	return resp.Body, nil
+}
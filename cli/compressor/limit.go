@@ -0,0 +1,138 @@
+package compressor
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/invidian/golang-cli-testing-example/pkg/compressor"
+)
+
+// limitedReader returns an error when underlying reader provides more data than the configured limit,
+// instead of silently truncating it like io.LimitReader does.
+type limitedReader struct {
+	reader io.Reader
+	limit  int64
+	read   int64
+}
+
+func newLimitedReader(reader io.Reader, limit int64) io.Reader {
+	// No reader can provide more data than that and reading one byte more would overflow.
+	if limit == math.MaxInt64 {
+		return reader
+	}
+
+	return &limitedReader{
+		// Read one byte more than the limit to be able to tell if the limit has been exceeded.
+		reader: io.LimitReader(reader, limit+1),
+		limit:  limit,
+	}
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	n, err := l.reader.Read(p)
+	l.read += int64(n)
+
+	if l.read > l.limit {
+		return n - int(l.read-l.limit), fmt.Errorf("input exceeds limit of %d bytes", l.limit)
+	}
+
+	//nolint:wrapcheck // Errors like io.EOF must be returned unwrapped.
+	return n, err
+}
+
+// limitedWriter returns an error once more data than the configured limit is written into it, which protects
+// from e.g. decompression bombs filling up the disk.
+type limitedWriter struct {
+	writer  io.Writer
+	limit   int64
+	written int64
+}
+
+func newLimitedWriter(writer io.Writer, limit int64) io.Writer {
+	return &limitedWriter{
+		writer: writer,
+		limit:  limit,
+	}
+}
+
+func (l *limitedWriter) Write(p []byte) (int, error) {
+	exceeded := false
+
+	if remaining := l.limit - l.written; int64(len(p)) > remaining {
+		p = p[:remaining]
+		exceeded = true
+	}
+
+	n, err := l.writer.Write(p)
+	l.written += int64(n)
+
+	if err != nil {
+		//nolint:wrapcheck // Do not hide the error from the underlying writer.
+		return n, err
+	}
+
+	if exceeded {
+		return n, fmt.Errorf("output exceeds limit of %d bytes", l.limit)
+	}
+
+	return n, nil
+}
+
+// withRateLimit wraps given client to limit rate of reading input if requested.
+func (c *runState) withRateLimit(client compressor.Client) (compressor.Client, error) {
+	if c.rateLimit == "" {
+		return client, nil
+	}
+
+	limit, err := parseBytes(c.rateLimit)
+	if err != nil {
+		return nil, fmt.Errorf("parsing rate limit: %w", err)
+	}
+
+	if limit < 1 {
+		return nil, fmt.Errorf("rate limit must be positive, got %d", limit)
+	}
+
+	return compressor.Chain(client, compressor.RateLimitMiddleware(limit)), nil
+}
+
+// parseBytes parses human-readable size like 10M, 512KiB or 1gb into number of bytes. Suffixes are
+// case-insensitive and all of them use binary multipliers, so 1K, 1KB and 1KiB all mean 1024 bytes.
+func parseBytes(size string) (int64, error) {
+	multipliers := map[string]int64{
+		"":  1,
+		"B": 1,
+	}
+
+	for i, unit := range "KMGT" {
+		for _, suffix := range []string{"", "B", "IB"} {
+			multipliers[string(unit)+suffix] = 1 << (10 * (i + 1))
+		}
+	}
+
+	number := strings.TrimRightFunc(size, unicode.IsLetter)
+
+	multiplier, ok := multipliers[strings.ToUpper(size[len(number):])]
+	if !ok {
+		return 0, fmt.Errorf("unsupported size suffix in %q", size)
+	}
+
+	value, err := strconv.ParseInt(number, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parsing size %q: %w", size, err)
+	}
+
+	if value < 0 {
+		return 0, fmt.Errorf("size %q must not be negative", size)
+	}
+
+	if value > math.MaxInt64/multiplier {
+		return 0, fmt.Errorf("size %q is too big", size)
+	}
+
+	return value * multiplier, nil
+}
@@ -0,0 +1,154 @@
+package compressor
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/invidian/golang-cli-testing-example/pkg/compressor"
+)
+
+// manPageTemplate is a groff template of the manual page printed by man action. Values are escaped using groff
+// function, so they can't be interpreted as groff requests.
+const manPageTemplate = `.TH {{ groff (upper .Name) }} 1 "" "{{ groff .Name }} {{ groff .Version }}" "User Commands"
+.SH NAME
+{{ groff .Name }} \- compress and decompress data
+.SH SYNOPSIS
+.B {{ groff .Name }}
+.I command
+[\fIflags\fR]
+.SH DESCRIPTION
+{{ groff .Name }} compresses and decompresses data from standard input or given input file and writes the result
+to standard output or given output file.
+.SH COMMANDS
+{{- range .Commands }}
+.TP
+.B {{ groff .Name }}
+{{ groff .Description }}
+{{- end }}
+.SH OPTIONS
+{{- range .Flags }}
+.TP
+.B {{ groff .Name }}
+{{ groff .Description }}
+{{- end }}
+.SH ENVIRONMENT
+Each flag, except {{ groff .EnvExceptions }}, can also be set using environment variable with
+.B {{ groff .EnvPrefix }}
+prefix, e.g.
+.BR {{ groff .FormatEnv }} .
+Flags without value are set using boolean value, e.g.
+.BR {{ groff .BoolEnv }}=true .
+Arguments take precedence over environment variables.
+.SH FILES
+.TP
+.I {{ groff .ConfigPath }}
+Optional configuration file in YAML format. Path can be changed using \-\-config flag. Supported fields:
+.RS
+.TP
+.B format
+Compression format to use when \-\-format flag is not set. Valid values are: {{ groff .Formats }}.
+.RE
+.SH EXAMPLES
+.TP
+Compress file into file with extension matching compression format:
+.B {{ groff .Name }} compress \-\-input=data \-\-output=data
+.TP
+Decompress data from standard input using configuration file:
+.B {{ groff .Name }} decompress \-\-config=config.yaml < data.gz > data
+.TP
+Convert gzip data into uncompressed data:
+.B {{ groff .Name }} transcode \-\-from=gzip \-\-to=noop < data.gz > data
+.SH SEE ALSO
+.BR gzip (1),
+.BR curl (1)
+`
+
+type manPageEntry struct {
+	Name        string
+	Description string
+}
+
+type manPage struct {
+	Name          string
+	Version       string
+	Commands      []manPageEntry
+	Flags         []manPageEntry
+	EnvPrefix     string
+	FormatEnv     string
+	BoolEnv       string
+	EnvExceptions string
+	ConfigPath    string
+	Formats       string
+}
+
+// groffEscape escapes characters, which have special meaning in groff. Leading dot and apostrophe are escaped
+// as well, as they would start a request when at the beginning of the line.
+func groffEscape(s string) string {
+	s = strings.NewReplacer(`\`, `\e`, `-`, `\-`).Replace(s)
+
+	if strings.HasPrefix(s, ".") || strings.HasPrefix(s, "'") {
+		s = `\&` + s
+	}
+
+	return s
+}
+
+func (c *runState) printManPage() error {
+	tmpl, err := template.New("man").Funcs(template.FuncMap{
+		"groff": groffEscape,
+		"upper": strings.ToUpper,
+	}).Parse(manPageTemplate)
+	if err != nil {
+		return fmt.Errorf("parsing man page template: %w", err)
+	}
+
+	page := manPage{
+		Name:          filepath.Base(c.Args[0]),
+		Version:       c.BuildInfo.Version,
+		Commands:      manPageCommands(),
+		Flags:         c.manPageFlags(),
+		EnvPrefix:     EnvPrefix,
+		FormatEnv:     FormatEnv,
+		BoolEnv:       envForFlag("dry-run"),
+		EnvExceptions: envExceptions(c.flags()),
+		ConfigPath:    DefaultConfigPath,
+		Formats:       strings.Join(formatNames(compressor.AvailableFormats()), ", "),
+	}
+
+	if err := tmpl.Execute(c.Output, page); err != nil {
+		return fmt.Errorf("executing man page template: %w", err)
+	}
+
+	return nil
+}
+
+func manPageCommands() []manPageEntry {
+	entries := []manPageEntry{}
+
+	for _, command := range commands() {
+		entries = append(entries, manPageEntry{Name: command.name, Description: command.usage + "."})
+	}
+
+	return entries
+}
+
+func (c *runState) manPageFlags() []manPageEntry {
+	entries := []manPageEntry{}
+
+	for _, flag := range c.flags() {
+		name := "--" + flag.name
+		if flag.placeholder != "" {
+			name += "=" + flag.placeholder
+		}
+
+		if flag.short != "" {
+			name = "-" + flag.short + ", " + name
+		}
+
+		entries = append(entries, manPageEntry{Name: name, Description: strings.ReplaceAll(flag.usage, "\n", " ")})
+	}
+
+	return entries
+}
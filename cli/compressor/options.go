@@ -0,0 +1,72 @@
+package compressor
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// CliOption configures Cli created using NewCli.
+type CliOption func(*Cli)
+
+// WithArgs sets arguments of the CLI, including the binary name. Default is os.Args.
+func WithArgs(args []string) CliOption {
+	return func(c *Cli) {
+		c.Args = args
+	}
+}
+
+// WithOutput sets output of the CLI. Default is os.Stdout.
+func WithOutput(w io.Writer) CliOption {
+	return func(c *Cli) {
+		c.Output = w
+	}
+}
+
+// WithErrorOutput sets error output of the CLI. Default is os.Stderr.
+func WithErrorOutput(w io.Writer) CliOption {
+	return func(c *Cli) {
+		c.ErrorOutput = w
+	}
+}
+
+// WithInput sets input of the CLI. Default is os.Stdin.
+func WithInput(r io.Reader) CliOption {
+	return func(c *Cli) {
+		c.Input = r
+	}
+}
+
+// WithProgress sets progress, which will be updated by the running action.
+func WithProgress(p *Progress) CliOption {
+	return func(c *Cli) {
+		c.Progress = p
+	}
+}
+
+// WithBuildInfo sets build information printed by version action.
+func WithBuildInfo(info BuildInfo) CliOption {
+	return func(c *Cli) {
+		c.BuildInfo = info
+	}
+}
+
+// NewCli creates Cli using process standard streams and arguments, unless overridden by given options.
+func NewCli(opts ...CliOption) (*Cli, error) {
+	c := &Cli{
+		Args:        os.Args,
+		Output:      os.Stdout,
+		ErrorOutput: os.Stderr,
+		Input:       os.Stdin,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	if err := c.validate(); err != nil {
+		return nil, fmt.Errorf("validating CLI configuration: %w", err)
+	}
+
+	return c, nil
+}
@@ -0,0 +1,167 @@
+package compressor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/invidian/golang-cli-testing-example/pkg/compressor"
+)
+
+const (
+	contentTypeGzip   = "application/gzip"
+	contentTypeBinary = "application/octet-stream"
+)
+
+// finishOutputFunc closes the output. When action failed, the error should be passed to it, so partial data
+// is not considered complete, e.g. HTTP upload is aborted.
+type finishOutputFunc func(actionErr error) error
+
+// openOutput opens output at given path, which can be either local file, HTTP URL or S3 path. When path is empty,
+// fallback is used. Returned function must always be called once writing is finished.
+func (c *runState) openOutput(
+	ctx context.Context, path string, fallback io.Writer,
+) (io.Writer, finishOutputFunc, error) {
+	if path == "" {
+		// User output is owned by the caller, so it must not be closed.
+		return fallback, func(error) error { return nil }, nil
+	}
+
+	if isS3URL(path) {
+		return c.openS3Output(ctx, path)
+	}
+
+	if isURL(path) {
+		output, finish := openHTTPOutput(ctx, path, c.contentType())
+
+		return output, finish, nil
+	}
+
+	path = c.withFormatExtension(path)
+
+	output, err := os.Create(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("creating output file %q: %w", path, err)
+	}
+
+	return output, func(error) error {
+		if err := output.Close(); err != nil {
+			return fmt.Errorf("closing output file %q: %w", path, err)
+		}
+
+		return nil
+	}, nil
+}
+
+// withFormatExtension appends extension matching compression format to given path, if it is missing, so
+// original file is not accidentally overwritten and the output is self-describing.
+func (c *runState) withFormatExtension(path string) string {
+	format, ok := c.resultFormat()
+	if c.noAutoExtension || !ok {
+		return path
+	}
+
+	extension := extensionForFormat(format)
+	if extension == "" || strings.HasSuffix(strings.ToLower(path), extension) {
+		return path
+	}
+
+	return path + extension
+}
+
+// resultFormat returns compression format of data produced by the requested action. If action does not
+// produce data in a standard compression format, false is returned.
+func (c *runState) resultFormat() (compressor.Format, bool) {
+	format := compressor.Format(c.format)
+
+	switch {
+	case c.action == ActionTranscode:
+		format = compressor.Format(c.to)
+	case (c.action != ActionCompress && c.action != ActionPatch) || c.blockSize != "":
+		return "", false
+	}
+
+	if format == "" {
+		format = compressor.DefaultFormat
+	}
+
+	return format, true
+}
+
+// contentType returns MIME type of data produced by the requested action.
+func (c *runState) contentType() string {
+	format, ok := c.resultFormat()
+	if !ok {
+		return contentTypeBinary
+	}
+
+	switch format {
+	case compressor.FormatGzip:
+		return contentTypeGzip
+	default:
+		return contentTypeBinary
+	}
+}
+
+// openHTTPOutput streams data written to returned writer as HTTP PUT request body, without buffering
+// entire data in memory.
+func openHTTPOutput(ctx context.Context, url, contentType string) (io.Writer, finishOutputFunc) {
+	bodyReader, bodyWriter := io.Pipe()
+
+	errCh := make(chan error, 1)
+
+	go func() {
+		err := putHTTP(ctx, url, contentType, bodyReader)
+
+		// Unblock writer in case server stopped reading the body.
+		//
+		//nolint:errcheck // Closing pipe always returns nil.
+		bodyReader.CloseWithError(err)
+
+		errCh <- err
+	}()
+
+	return bodyWriter, func(actionErr error) error {
+		if actionErr != nil {
+			// Abort the request, so server does not receive partial data as complete.
+			//
+			//nolint:errcheck // Closing pipe always returns nil.
+			bodyWriter.CloseWithError(actionErr)
+
+			<-errCh
+
+			return nil
+		}
+
+		//nolint:errcheck // Closing pipe always returns nil.
+		bodyWriter.Close()
+
+		return <-errCh
+	}
+}
+
+func putHTTP(ctx context.Context, url, contentType string, body io.Reader) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, url, body)
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("uploading to %q: %w", url, err)
+	}
+
+	//nolint:errcheck // Response body is not used.
+	defer resp.Body.Close()
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("uploading to %q: unexpected status %q", url, resp.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,58 @@
+package compressor
+
+import (
+	"io"
+	"sync/atomic"
+)
+
+// Progress tracks number of bytes processed by the running action. It is safe to read it concurrently,
+// e.g. from a signal handler.
+type Progress struct {
+	inputBytes  int64
+	outputBytes int64
+}
+
+// InputBytes returns number of bytes read from the input so far.
+func (p *Progress) InputBytes() int64 {
+	return atomic.LoadInt64(&p.inputBytes)
+}
+
+// OutputBytes returns number of bytes written to the output so far.
+func (p *Progress) OutputBytes() int64 {
+	return atomic.LoadInt64(&p.outputBytes)
+}
+
+type progressReader struct {
+	reader  io.Reader
+	counter *int64
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.reader.Read(b)
+	atomic.AddInt64(p.counter, int64(n))
+
+	//nolint:wrapcheck // Errors like io.EOF must be returned unwrapped.
+	return n, err
+}
+
+type progressWriter struct {
+	writer  io.Writer
+	counter *int64
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	n, err := p.writer.Write(b)
+	atomic.AddInt64(p.counter, int64(n))
+
+	//nolint:wrapcheck // Do not hide the error from the underlying writer.
+	return n, err
+}
+
+func (c *runState) trackProgress(input io.Reader, output io.Writer) (io.Reader, io.Writer) {
+	if c.Progress == nil {
+		return input, output
+	}
+
+	return &progressReader{reader: input, counter: &c.Progress.inputBytes},
+		&progressWriter{writer: output, counter: &c.Progress.outputBytes}
+}
@@ -0,0 +1,96 @@
+package compressor
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+)
+
+// DefaultRecursiveBlockSize is a block size used when compressing directories recursively without --block-size
+// flag, so output always uses the framing format of block compression.
+const DefaultRecursiveBlockSize = "1M"
+
+func (c *runState) validateRecursiveFlags() error {
+	if c.recursive && c.action != ActionCompress {
+		return fmt.Errorf("recursive compression can only be used with %q action", ActionCompress)
+	}
+
+	if (c.include != "" || c.exclude != "") && !c.recursive {
+		return fmt.Errorf("include and exclude patterns can only be used together with recursive flag")
+	}
+
+	return nil
+}
+
+// prepareRecursive replaces input directories with files found in them and enables block compression.
+func (c *runState) prepareRecursive() error {
+	if len(c.inputPaths) == 0 {
+		return fmt.Errorf("input path must be given")
+	}
+
+	files, err := c.expandDirectories(c.inputPaths)
+	if err != nil {
+		return err
+	}
+
+	c.inputPaths = files
+
+	if c.blockSize == "" {
+		c.blockSize = DefaultRecursiveBlockSize
+	}
+
+	return nil
+}
+
+// expandDirectories replaces directories in given paths with paths of all files found in them, sorted
+// lexically. Found files are filtered using include and exclude patterns matched against file names.
+func (c *runState) expandDirectories(paths []string) ([]string, error) {
+	for _, pattern := range []string{c.include, c.exclude} {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("parsing pattern %q: %w", pattern, err)
+		}
+	}
+
+	files := []string{}
+
+	for _, root := range paths {
+		err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if !entry.IsDir() && c.matchesFilters(entry.Name()) {
+				files = append(files, path)
+			}
+
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("walking %q: %w", root, err)
+		}
+	}
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no files found in %v", paths)
+	}
+
+	return files, nil
+}
+
+// matchesFilters returns true if given file name matches include pattern and does not match exclude pattern.
+// Patterns are validated before, so matching errors can be ignored.
+func (c *runState) matchesFilters(name string) bool {
+	if c.include != "" {
+		if included, _ := filepath.Match(c.include, name); !included {
+			return false
+		}
+	}
+
+	if c.exclude != "" {
+		if excluded, _ := filepath.Match(c.exclude, name); excluded {
+			return false
+		}
+	}
+
+	return true
+}
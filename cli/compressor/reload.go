@@ -0,0 +1,64 @@
+package compressor
+
+import (
+	"fmt"
+
+	"github.com/invidian/golang-cli-testing-example/pkg/compressor"
+)
+
+// ReloadConfig reads configuration file again and applies it to the running serve action, so requests
+// received afterwards use the new configuration. Requests already in progress complete using the previous
+// one. Other actions process single input, so they are not affected. Only settings taken from configuration
+// file are changed, as arguments and environment variables take precedence. Result is reported to error
+// output using requested output format. It is safe to call it concurrently with Run, e.g. from a signal
+// handler.
+func (c *Cli) ReloadConfig() {
+	c.reloadMu.Lock()
+	defer c.reloadMu.Unlock()
+
+	if c.configReloader == nil {
+		return
+	}
+
+	if err := c.configReloader(); err != nil {
+		c.report(message{
+			Level: levelError,
+			Msg:   fmt.Sprintf("reloading configuration: %v", err),
+		}, fmt.Sprintf("Error reloading configuration: %v", err))
+
+		return
+	}
+
+	c.report(message{Level: levelInfo, Msg: "configuration reloaded"}, "Configuration reloaded")
+}
+
+func (c *Cli) setConfigReloader(reloader func() error) {
+	c.reloadMu.Lock()
+	defer c.reloadMu.Unlock()
+
+	c.configReloader = reloader
+}
+
+// reloadClientConfig returns function, which applies configuration read from configuration file to given client.
+// Configuration is prepared upfront, as reloading happens concurrently with serving requests.
+func (c *runState) reloadClientConfig(client compressor.Reloader) func() error {
+	config := c.clientConfig()
+	formatFromConfig := c.formatFromConfig
+
+	return func() error {
+		fileConfig, err := c.readConfigFile()
+		if err != nil {
+			return err
+		}
+
+		if formatFromConfig {
+			config.Format = fileConfig.Format
+		}
+
+		if err := client.Reload(config); err != nil {
+			return fmt.Errorf("reloading client: %w", err)
+		}
+
+		return nil
+	}
+}
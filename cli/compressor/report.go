@@ -0,0 +1,95 @@
+package compressor
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	// OutputFormatText prints operational messages as human-readable text.
+	OutputFormatText = "text"
+	// OutputFormatJSON prints operational messages as JSON lines, e.g. for pipeline orchestrators.
+	OutputFormatJSON = "json"
+
+	levelInfo  = "info"
+	levelError = "error"
+)
+
+// message is a single operational message printed to error output in JSON output format.
+type message struct {
+	Level          string   `json:"level"`
+	Msg            string   `json:"msg"`
+	BytesProcessed *int64   `json:"bytes_processed,omitempty"`
+	BytesWritten   *int64   `json:"bytes_written,omitempty"`
+	Ratio          *float64 `json:"ratio,omitempty"`
+}
+
+// ReportError prints error returned by Run to error output using requested output format.
+func (c *Cli) ReportError(err error) {
+	msg := message{
+		Level: levelError,
+		Msg:   err.Error(),
+	}
+
+	if c.Progress != nil {
+		bytesProcessed := c.Progress.InputBytes()
+		msg.BytesProcessed = &bytesProcessed
+	}
+
+	c.report(msg, fmt.Sprintf("Error running CLI: %v", err))
+}
+
+// ReportProgress prints current progress to error output using requested output format. It is safe to call it
+// concurrently with Run, e.g. from a signal handler.
+func (c *Cli) ReportProgress() {
+	if c.Progress == nil {
+		return
+	}
+
+	bytesProcessed := c.Progress.InputBytes()
+	bytesWritten := c.Progress.OutputBytes()
+
+	c.report(message{
+		Level:          levelInfo,
+		Msg:            "progress",
+		BytesProcessed: &bytesProcessed,
+		BytesWritten:   &bytesWritten,
+	}, fmt.Sprintf("Progress: read %d bytes, written %d bytes", bytesProcessed, bytesWritten))
+}
+
+// report prints given message to error output either as JSON line or as given text.
+func (c *Cli) report(msg message, text string) {
+	c.reportMu.Lock()
+	defer c.reportMu.Unlock()
+
+	if c.reportFormat != OutputFormatJSON {
+		fmt.Fprintln(c.ErrorOutput, text)
+
+		return
+	}
+
+	// Encoding struct with only strings and finite numbers never fails.
+	//
+	//nolint:errchkjson // See above.
+	line, _ := json.Marshal(msg)
+
+	fmt.Fprintln(c.ErrorOutput, string(line))
+}
+
+// setReportFormat validates and applies requested output format. It is separate from parsing arguments, as
+// messages may be reported concurrently with Run.
+func (c *runState) setReportFormat() error {
+	switch c.outputFormat {
+	case "", OutputFormatText, OutputFormatJSON:
+	default:
+		return fmt.Errorf("unknown output format %q, expected %q or %q",
+			c.outputFormat, OutputFormatText, OutputFormatJSON)
+	}
+
+	c.reportMu.Lock()
+	defer c.reportMu.Unlock()
+
+	c.reportFormat = c.outputFormat
+
+	return nil
+}
@@ -0,0 +1,158 @@
+package compressor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+const (
+	s3Scheme = "s3://"
+
+	// Standard AWS environment variables. They are read using the environment of the CLI, so they can be
+	// given like any other environment variable.
+	awsAccessKeyIDEnv     = "AWS_ACCESS_KEY_ID"
+	awsSecretAccessKeyEnv = "AWS_SECRET_ACCESS_KEY"
+	awsSessionTokenEnv    = "AWS_SESSION_TOKEN"
+	awsRegionEnv          = "AWS_REGION"
+)
+
+// isS3URL returns true when given path points to object in S3-compatible storage.
+func isS3URL(path string) bool {
+	return strings.HasPrefix(path, s3Scheme)
+}
+
+// parseS3URL returns bucket and key of object from given s3://<bucket>/<key> path.
+func parseS3URL(path string) (string, string, error) {
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(path, s3Scheme), "/")
+	if bucket == "" || key == "" {
+		return "", "", fmt.Errorf("S3 path %q must be in form %s<bucket>/<key>", path, s3Scheme)
+	}
+
+	return bucket, key, nil
+}
+
+// s3Client creates S3 client using standard AWS configuration. Region and endpoint given by flags take
+// precedence, so S3-compatible storage like MinIO can be used.
+func (c *runState) s3Client(ctx context.Context) (*s3.Client, error) {
+	options := []func(*config.LoadOptions) error{}
+
+	region := c.s3Region
+	if region == "" {
+		region, _ = c.lookupEnv(awsRegionEnv)
+	}
+
+	if region != "" {
+		options = append(options, config.WithRegion(region))
+	}
+
+	// Otherwise credentials are looked up in shared configuration files and other standard sources.
+	if accessKeyID, ok := c.lookupEnv(awsAccessKeyIDEnv); ok {
+		secretAccessKey, _ := c.lookupEnv(awsSecretAccessKeyEnv)
+		sessionToken, _ := c.lookupEnv(awsSessionTokenEnv)
+
+		options = append(options, config.WithCredentialsProvider(
+			credentials.NewStaticCredentialsProvider(accessKeyID, secretAccessKey, sessionToken),
+		))
+	}
+
+	awsConfig, err := config.LoadDefaultConfig(ctx, options...)
+	if err != nil {
+		return nil, fmt.Errorf("loading AWS configuration: %w", err)
+	}
+
+	return s3.NewFromConfig(awsConfig, func(o *s3.Options) {
+		if c.s3Endpoint == "" {
+			return
+		}
+
+		o.BaseEndpoint = aws.String(c.s3Endpoint)
+		// S3-compatible storage usually does not support bucket names in host names.
+		o.UsePathStyle = true
+	}), nil
+}
+
+// openS3Input opens object at given S3 path for streaming.
+func (c *runState) openS3Input(ctx context.Context, path string) (io.ReadCloser, error) {
+	bucket, key, err := parseS3URL(path)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := c.s3Client(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("creating S3 client: %w", err)
+	}
+
+	object, err := client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("getting object %q: %w", path, err)
+	}
+
+	return object.Body, nil
+}
+
+// openS3Output streams written data to object at given S3 path. Data is uploaded in parts, so it does not
+// have to fit in memory.
+func (c *runState) openS3Output(ctx context.Context, path string) (io.Writer, finishOutputFunc, error) {
+	bucket, key, err := parseS3URL(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	client, err := c.s3Client(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("creating S3 client: %w", err)
+	}
+
+	bodyReader, bodyWriter := io.Pipe()
+
+	errCh := make(chan error, 1)
+
+	go func() {
+		_, err := manager.NewUploader(client).Upload(ctx, &s3.PutObjectInput{
+			Bucket:      aws.String(bucket),
+			Key:         aws.String(key),
+			Body:        bodyReader,
+			ContentType: aws.String(c.contentType()),
+		})
+		if err != nil {
+			err = fmt.Errorf("uploading object %q: %w", path, err)
+		}
+
+		// Unblock writer in case upload failed before reading all data.
+		//
+		//nolint:errcheck // Closing pipe always returns nil.
+		bodyReader.CloseWithError(err)
+
+		errCh <- err
+	}()
+
+	return bodyWriter, func(actionErr error) error {
+		if actionErr != nil {
+			// Abort the upload, so partial data is not stored as complete object.
+			//
+			//nolint:errcheck // Closing pipe always returns nil.
+			bodyWriter.CloseWithError(actionErr)
+
+			<-errCh
+
+			return nil
+		}
+
+		//nolint:errcheck // Closing pipe always returns nil.
+		bodyWriter.Close()
+
+		return <-errCh
+	}, nil
+}
@@ -0,0 +1,396 @@
+package compressor
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"sync"
+
+	"github.com/invidian/golang-cli-testing-example/pkg/compressor"
+)
+
+// Protocol used by serve action. Each connection may send any number of requests, one after another. Each
+// request consists of:
+//
+//   - single byte with operation, either ServeOperationCompress or ServeOperationDecompress,
+//   - big-endian uint16 length of format name followed by format name; when it is empty, format given by
+//     --format or configuration file is used,
+//   - big-endian uint64 length of data followed by data to process.
+//
+// Each request is answered with a response consisting of:
+//
+//   - single byte with status, either ServeStatusOK or ServeStatusError,
+//   - big-endian uint64 length of payload followed by payload, which is processed data or error message.
+const (
+	// ServeOperationCompress requests compressing sent data.
+	ServeOperationCompress byte = 0
+	// ServeOperationDecompress requests decompressing sent data.
+	ServeOperationDecompress byte = 1
+
+	// ServeStatusOK is sent when request was processed and payload contains processed data.
+	ServeStatusOK byte = 0
+	// ServeStatusError is sent when request could not be processed and payload contains error message.
+	ServeStatusError byte = 1
+
+	// serveResponseHeaderSize is a size of status byte and payload length.
+	serveResponseHeaderSize = 1 + 8
+
+	// DefaultServeDataLimit is a maximum size of request data and response payload, unless it is changed
+	// using --input-limit and --output-limit respectively. Whole response is buffered, as its size is sent
+	// before the payload.
+	DefaultServeDataLimit = "64M"
+)
+
+// serveRequest is a single request received by the server. Data must be read until the end before reading
+// the next request from the same connection.
+type serveRequest struct {
+	operation byte
+	format    compressor.Format
+	length    int64
+	data      io.Reader
+}
+
+// server processes requests received by serve action, creating single client for each requested format.
+// Requests not specifying format share a separate client, which is reloaded with the format from
+// configuration file when configuration is reloaded.
+type server struct {
+	*runState
+
+	// inputLimit and outputLimit are maximum sizes of data of each request and response.
+	inputLimit  int64
+	outputLimit int64
+
+	mu      sync.Mutex
+	clients map[compressor.Format]compressor.Client
+}
+
+// validateServeFlags ensures, that socket is given exactly when serving and that flags, which don't apply to
+// processing requests, are not given.
+func (c *runState) validateServeFlags() error {
+	if c.socket != "" && c.action != ActionServe {
+		return fmt.Errorf("socket can only be used with %q action", ActionServe)
+	}
+
+	if c.action != ActionServe {
+		return nil
+	}
+
+	if c.socket == "" {
+		return fmt.Errorf("%q action requires socket path", ActionServe)
+	}
+
+	if len(c.inputPaths) != 0 || c.outputPath != "" {
+		return fmt.Errorf("%q action receives data over socket, so input and output can't be given", ActionServe)
+	}
+
+	for _, flag := range []struct {
+		name string
+		set  bool
+	}{
+		{"checksum", c.checksum != ""},
+		{"http-retries", c.httpRetries != ""},
+		{"s3-region", c.s3Region != ""},
+		{"s3-endpoint", c.s3Endpoint != ""},
+		{"no-auto-extension", c.noAutoExtension},
+	} {
+		if flag.set {
+			return fmt.Errorf("--%s flag can't be used with %q action", flag.name, ActionServe)
+		}
+	}
+
+	return nil
+}
+
+// serveLimit parses given limit of request data or response payload, using default limit if it is empty.
+func serveLimit(limit string) (int64, error) {
+	if limit == "" {
+		limit = DefaultServeDataLimit
+	}
+
+	return parseBytes(limit)
+}
+
+// runServe processes requests received over Unix domain socket until given context is done. Errors of
+// individual connections are reported, but serving continues.
+func (c *runState) runServe(ctx context.Context) error {
+	if err := c.readConfig(); err != nil {
+		return fmt.Errorf("reading configuration: %w", err)
+	}
+
+	inputLimit, err := serveLimit(c.inputLimit)
+	if err != nil {
+		return fmt.Errorf("parsing input limit: %w", err)
+	}
+
+	outputLimit, err := serveLimit(c.outputLimit)
+	if err != nil {
+		return fmt.Errorf("parsing output limit: %w", err)
+	}
+
+	s := &server{
+		runState:    c,
+		inputLimit:  inputLimit,
+		outputLimit: outputLimit,
+		clients:     map[compressor.Format]compressor.Client{},
+	}
+
+	listener, err := (&net.ListenConfig{}).Listen(ctx, "unix", c.socket)
+	if err != nil {
+		return fmt.Errorf("listening on socket: %w", err)
+	}
+
+	c.setConfigReloader(s.reloadConfig)
+
+	// Closing listener also removes the socket file.
+	stopListening := context.AfterFunc(ctx, func() {
+		//nolint:errcheck // Error is returned from Accept instead.
+		listener.Close()
+	})
+
+	defer stopListening()
+
+	c.report(message{
+		Level: levelInfo,
+		Msg:   "serving on " + c.socket,
+	}, "Serving on "+c.socket)
+
+	var wg sync.WaitGroup
+
+	// Connections are closed once context is done, so waiting for them does not block.
+	defer wg.Wait()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			// Interrupting is the expected way of stopping serving.
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			return fmt.Errorf("accepting connection: %w", err)
+		}
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			s.serveConnection(ctx, conn)
+		}()
+	}
+}
+
+// serveConnection processes requests from given connection until it is closed and reports errors.
+func (s *server) serveConnection(ctx context.Context, conn net.Conn) {
+	//nolint:errcheck // Connection is closed on purpose, so errors are not relevant.
+	defer conn.Close()
+
+	stop := context.AfterFunc(ctx, func() {
+		//nolint:errcheck // Error is returned from pending read or write instead.
+		conn.Close()
+	})
+
+	defer stop()
+
+	if err := s.handleRequests(ctx, conn); err != nil && ctx.Err() == nil {
+		s.report(message{
+			Level: levelError,
+			Msg:   fmt.Sprintf("serving connection: %v", err),
+		}, fmt.Sprintf("Error serving connection: %v", err))
+	}
+}
+
+// handleRequests processes requests from given connection one after another and writes responses to it.
+func (s *server) handleRequests(ctx context.Context, conn io.ReadWriter) error {
+	reader := bufio.NewReader(conn)
+
+	for {
+		request, err := readServeRequest(reader)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		if err != nil {
+			return fmt.Errorf("reading request: %w", err)
+		}
+
+		if request.length > s.inputLimit {
+			err := fmt.Errorf("request data of %d bytes exceeds limit of %d bytes", request.length, s.inputLimit)
+
+			// Data is not read, so the connection can't be used for the next requests.
+			if writeErr := writeServeResponse(conn, nil, err); writeErr != nil {
+				return fmt.Errorf("writing response: %w", writeErr)
+			}
+
+			return fmt.Errorf("reading request: %w", err)
+		}
+
+		result, processErr := s.process(ctx, request)
+
+		// Unread data would be taken as the next request.
+		if _, err := io.Copy(io.Discard, request.data); err != nil {
+			return fmt.Errorf("reading request data: %w", err)
+		}
+
+		if err := writeServeResponse(conn, result, processErr); err != nil {
+			return fmt.Errorf("writing response: %w", err)
+		}
+	}
+}
+
+// process compresses or decompresses data of given request and returns the result.
+func (s *server) process(ctx context.Context, request *serveRequest) ([]byte, error) {
+	ctx, cancel, err := s.withTimeout(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("applying timeout: %w", err)
+	}
+
+	defer cancel()
+
+	client, err := s.client(request.format)
+	if err != nil {
+		return nil, fmt.Errorf("creating compressor client: %w", err)
+	}
+
+	var (
+		output io.ReadCloser
+		errCh  chan error
+	)
+
+	// Request data is drained by the caller, so it must not be closed here.
+	switch request.operation {
+	case ServeOperationCompress:
+		output, errCh = client.Compress(ctx, io.NopCloser(request.data))
+	case ServeOperationDecompress:
+		output, errCh = client.Decompress(ctx, io.NopCloser(request.data))
+	default:
+		return nil, fmt.Errorf("unknown operation %d", request.operation)
+	}
+
+	result := &bytes.Buffer{}
+
+	if _, err := io.Copy(newLimitedWriter(result, s.outputLimit), output); err != nil {
+		// Stop processing, as the rest of processed data won't be read.
+		//
+		//nolint:errcheck // We already return an error.
+		output.Close()
+
+		<-errCh
+
+		return nil, fmt.Errorf("reading processed data: %w", err)
+	}
+
+	if err := <-errCh; err != nil {
+		return nil, fmt.Errorf("processing data: %w", err)
+	}
+
+	return result.Bytes(), nil
+}
+
+// client returns client for given format, creating it on first use, so it is reused by all requests.
+func (s *server) client(format compressor.Format) (compressor.Client, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if client, ok := s.clients[format]; ok {
+		return client, nil
+	}
+
+	// Empty format keeps format given by --format or configuration file.
+	config := s.clientConfig()
+	if format != "" {
+		config.Format = format
+	}
+
+	client, err := compressor.NewClient(config)
+	if err != nil {
+		//nolint:wrapcheck // Caller adds context to the error.
+		return nil, err
+	}
+
+	s.clients[format] = client
+
+	return client, nil
+}
+
+// reloadConfig applies configuration file to client used by requests not specifying format, so requests
+// received afterwards use the new configuration.
+func (s *server) reloadConfig() error {
+	client, err := s.client("")
+	if err != nil {
+		return fmt.Errorf("creating compressor client: %w", err)
+	}
+
+	reloader, ok := client.(compressor.Reloader)
+	if !ok {
+		return nil
+	}
+
+	return s.reloadClientConfig(reloader)()
+}
+
+// readServeRequest reads header of the next request from given reader. It returns io.EOF when there are no
+// more requests.
+func readServeRequest(reader io.Reader) (*serveRequest, error) {
+	var header struct {
+		Operation    byte
+		FormatLength uint16
+	}
+
+	if err := binary.Read(reader, binary.BigEndian, &header); err != nil {
+		//nolint:wrapcheck // Errors like io.EOF must be returned unwrapped.
+		return nil, err
+	}
+
+	format := make([]byte, header.FormatLength)
+
+	if _, err := io.ReadFull(reader, format); err != nil {
+		return nil, fmt.Errorf("reading format: %w", err)
+	}
+
+	var dataLength uint64
+
+	if err := binary.Read(reader, binary.BigEndian, &dataLength); err != nil {
+		return nil, fmt.Errorf("reading data length: %w", err)
+	}
+
+	if dataLength > math.MaxInt64 {
+		return nil, fmt.Errorf("data length %d is too big", dataLength)
+	}
+
+	return &serveRequest{
+		operation: header.Operation,
+		format:    compressor.Format(format),
+		length:    int64(dataLength),
+		data:      io.LimitReader(reader, int64(dataLength)),
+	}, nil
+}
+
+// writeServeResponse writes given result or error message, when given error is not nil, to given writer.
+func writeServeResponse(writer io.Writer, result []byte, processErr error) error {
+	status := ServeStatusOK
+
+	if processErr != nil {
+		status = ServeStatusError
+		result = []byte(processErr.Error())
+	}
+
+	header := make([]byte, serveResponseHeaderSize)
+	header[0] = status
+	binary.BigEndian.PutUint64(header[1:], uint64(len(result)))
+
+	// Header and result are written together, so small responses are sent using single write.
+	buffers := net.Buffers{header, result}
+
+	if _, err := buffers.WriteTo(writer); err != nil {
+		return fmt.Errorf("writing: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,59 @@
+package compressor
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/invidian/golang-cli-testing-example/pkg/compressor"
+)
+
+// startTranscode decompresses input using source format and compresses the result again using target format.
+// Returned error channel receives first error from either of the stages.
+func (c *runState) startTranscode(ctx context.Context, input io.ReadCloser) (io.Reader, chan error, error) {
+	decompressorConfig := c.clientConfig()
+	decompressorConfig.Format = compressor.Format(c.from)
+
+	source, err := compressor.NewClient(decompressorConfig)
+	if err != nil {
+		return nil, nil, fmt.Errorf("creating client for source format: %w", err)
+	}
+
+	// Only reading input is rate limited, so limit applies to source client.
+	if source, err = c.withRateLimit(source); err != nil {
+		return nil, nil, fmt.Errorf("applying rate limit: %w", err)
+	}
+
+	compressorConfig := compressor.Config{
+		Format:       compressor.Format(c.to),
+		OriginalName: decompressorConfig.OriginalName,
+		ModTime:      decompressorConfig.ModTime,
+		ChunkSize:    decompressorConfig.ChunkSize,
+	}
+
+	target, err := compressor.NewClient(compressorConfig)
+	if err != nil {
+		return nil, nil, fmt.Errorf("creating client for target format: %w", err)
+	}
+
+	decompressed, decompressErrCh := source.Decompress(ctx, input)
+	output, compressErrCh := target.Compress(ctx, decompressed)
+
+	errCh := make(chan error, 1)
+
+	go func() {
+		decompressErr := <-decompressErrCh
+		compressErr := <-compressErrCh
+
+		switch {
+		case decompressErr != nil:
+			errCh <- fmt.Errorf("decompressing: %w", decompressErr)
+		case compressErr != nil:
+			errCh <- fmt.Errorf("compressing: %w", compressErr)
+		default:
+			errCh <- nil
+		}
+	}()
+
+	return output, errCh, nil
+}
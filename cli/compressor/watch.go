@@ -0,0 +1,189 @@
+package compressor
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+const (
+	// watchDebounce is a time without further changes of watched input, after which input is processed, so
+	// single write producing multiple events does not trigger processing multiple times.
+	watchDebounce = 100 * time.Millisecond
+
+	// watchTimestampLayout is used to name output files created when watching, so they sort chronologically.
+	watchTimestampLayout = "20060102T150405.000000000Z"
+)
+
+// validateWatchFlags ensures, that watching is only requested for a single local input, which results can be
+// written to separate files.
+func (c *runState) validateWatchFlags() error {
+	if !c.watch {
+		return nil
+	}
+
+	switch c.action {
+	case ActionCompress, ActionDecompress, ActionCopy, ActionTranscode:
+	default:
+		return fmt.Errorf("watch can only be used with %q, %q, %q and %q actions",
+			ActionCompress, ActionDecompress, ActionCopy, ActionTranscode)
+	}
+
+	if len(c.inputPaths) != 1 || isURL(c.inputPaths[0]) {
+		return fmt.Errorf("watch requires exactly one local input path")
+	}
+
+	if c.outputPath == "" || isURL(c.outputPath) {
+		return fmt.Errorf("watch requires local output path")
+	}
+
+	if c.recursive {
+		return fmt.Errorf("watch can't be used together with recursive flag")
+	}
+
+	if c.FS != nil {
+		return fmt.Errorf("watch can only be used with file system of the process")
+	}
+
+	return nil
+}
+
+// runWatch processes input once and then again every time it changes, until given context is done. Each
+// result is written to a new file, so previous results are preserved. Processing errors are reported, but
+// watching continues, as input may be fixed with the next change.
+func (c *runState) runWatch(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("creating watcher: %w", err)
+	}
+
+	//nolint:errcheck // Watcher is only used for reading events.
+	defer watcher.Close()
+
+	watchedPath, isWatched, err := c.watchedInput()
+	if err != nil {
+		return err
+	}
+
+	if err := watcher.Add(watchedPath); err != nil {
+		return fmt.Errorf("watching %q: %w", watchedPath, err)
+	}
+
+	outputPath := c.outputPath
+
+	c.processWatched(ctx, outputPath)
+
+	var changed <-chan time.Time
+
+	for {
+		select {
+		case <-ctx.Done():
+			// Interrupting is the expected way of stopping watching.
+			return nil
+		case event := <-watcher.Events:
+			if isWatched(event.Name) {
+				changed = time.After(watchDebounce)
+			}
+		case err := <-watcher.Errors:
+			return fmt.Errorf("watching %q: %w", watchedPath, err)
+		case <-changed:
+			changed = nil
+
+			c.processWatched(ctx, outputPath)
+		}
+	}
+}
+
+// watchedInput returns path, which should be watched for changes of the input and a function, which checks if
+// changed path belongs to the input.
+func (c *runState) watchedInput() (string, func(string) bool, error) {
+	inputPath := filepath.Clean(c.inputPaths[0])
+
+	info, err := os.Stat(inputPath)
+	if err != nil {
+		return "", nil, fmt.Errorf("checking input: %w", err)
+	}
+
+	if !info.IsDir() {
+		// Editors often replace files instead of writing into them, which removes the watch of the file itself,
+		// so parent directory is watched instead.
+		return filepath.Dir(inputPath), func(path string) bool { return filepath.Clean(path) == inputPath }, nil
+	}
+
+	// Writing output into watched directory would trigger processing again.
+	inside, err := isInside(inputPath, filepath.Dir(c.outputPath))
+	if err != nil {
+		return "", nil, fmt.Errorf("checking output path: %w", err)
+	}
+
+	if inside {
+		return "", nil, fmt.Errorf("output %q must be outside of watched directory %q", c.outputPath, inputPath)
+	}
+
+	return inputPath, func(string) bool { return true }, nil
+}
+
+// isInside returns true when given path is given directory or any of its subdirectories.
+func isInside(dir, path string) (bool, error) {
+	absoluteDir, err := filepath.Abs(dir)
+	if err != nil {
+		return false, fmt.Errorf("resolving absolute path of %q: %w", dir, err)
+	}
+
+	absolutePath, err := filepath.Abs(path)
+	if err != nil {
+		return false, fmt.Errorf("resolving absolute path of %q: %w", path, err)
+	}
+
+	relativePath, err := filepath.Rel(absoluteDir, absolutePath)
+	if err != nil {
+		return false, fmt.Errorf("resolving %q relative to %q: %w", path, dir, err)
+	}
+
+	return filepath.IsLocal(relativePath), nil
+}
+
+// processWatched runs the action once, writing the result into a new file named after given output path and
+// current time, and reports the result.
+func (c *runState) processWatched(ctx context.Context, outputPath string) {
+	c.outputPath = timestampedPath(outputPath, time.Now())
+
+	if err := c.runAction(ctx); err != nil {
+		// Stopping watching is not an error.
+		if ctx.Err() != nil {
+			return
+		}
+
+		c.report(message{
+			Level: levelError,
+			Msg:   fmt.Sprintf("processing input: %v", err),
+		}, fmt.Sprintf("Error processing input: %v", err))
+
+		return
+	}
+
+	// Summary of processing is already reported instead.
+	if c.discardsOutput() {
+		return
+	}
+
+	// Format is only known once configuration is read by the action.
+	writtenPath := c.withFormatExtension(c.outputPath)
+
+	c.report(message{
+		Level: levelInfo,
+		Msg:   fmt.Sprintf("output written to %s", writtenPath),
+	}, fmt.Sprintf("Output written to %s", writtenPath))
+}
+
+// timestampedPath adds given time to given path before its extension, e.g. out-20060102T150405.000000000Z.gz.
+func timestampedPath(path string, t time.Time) string {
+	extension := filepath.Ext(path)
+
+	return strings.TrimSuffix(path, extension) + "-" + t.UTC().Format(watchTimestampLayout) + extension
+}
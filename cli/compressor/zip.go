@@ -0,0 +1,209 @@
+package compressor
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strconv"
+
+	"github.com/invidian/golang-cli-testing-example/internal/ctxio"
+)
+
+// validateZipFlags ensures, that compression level of ZIP entries is valid and used only when creating ZIP
+// archives.
+func (c *runState) validateZipFlags() error {
+	if c.zipLevel == "" {
+		return nil
+	}
+
+	if c.action != ActionZip {
+		return fmt.Errorf("zip level can only be used with %q action", ActionZip)
+	}
+
+	if _, err := c.parseZipLevel(); err != nil {
+		return fmt.Errorf("parsing zip level: %w", err)
+	}
+
+	return nil
+}
+
+func (c *runState) parseZipLevel() (int, error) {
+	if c.zipLevel == "" {
+		return flate.DefaultCompression, nil
+	}
+
+	level, err := strconv.Atoi(c.zipLevel)
+	if err != nil {
+		return 0, fmt.Errorf("parsing number: %w", err)
+	}
+
+	if level < flate.NoCompression || level > flate.BestCompression {
+		return 0, fmt.Errorf("level must be between %d and %d, got %d",
+			flate.NoCompression, flate.BestCompression, level)
+	}
+
+	return level, nil
+}
+
+// runZipAction runs action creating or extracting ZIP archives.
+func (c *runState) runZipAction(ctx context.Context) error {
+	ctx, cancel, err := c.withTimeout(ctx)
+	if err != nil {
+		return fmt.Errorf("applying timeout: %w", err)
+	}
+
+	defer cancel()
+
+	if c.action == ActionZip {
+		return c.runZip(ctx)
+	}
+
+	return c.runUnzip(ctx)
+}
+
+// runZip writes ZIP archive of input files and directories into the output. Unlike tar archives, each file
+// is compressed independently, so files can be extracted without decompressing the whole archive.
+func (c *runState) runZip(ctx context.Context) error {
+	level, err := c.parseZipLevel()
+	if err != nil {
+		return fmt.Errorf("parsing zip level: %w", err)
+	}
+
+	if err := checkArchiveInputs(c.inputPaths); err != nil {
+		return err
+	}
+
+	output, finishOutput, err := c.openOutput(ctx, c.outputPath, c.Output)
+	if err != nil {
+		return fmt.Errorf("opening output: %w", err)
+	}
+
+	zipErr := writeZip(ctx, output, c.inputPaths, level)
+
+	if err := finishOutput(zipErr); err != nil {
+		return fmt.Errorf("finishing output: %w", err)
+	}
+
+	return zipErr
+}
+
+func writeZip(ctx context.Context, w io.Writer, paths []string, level int) error {
+	archive := zip.NewWriter(w)
+
+	archive.RegisterCompressor(zip.Deflate, func(out io.Writer) (io.WriteCloser, error) {
+		return flate.NewWriter(out, level)
+	})
+
+	if err := walkArchiveInputs(paths, func(path, name string, info fs.FileInfo) error {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("archiving %q: %w", path, err)
+		}
+
+		return writeZipEntry(archive, path, name, info)
+	}); err != nil {
+		return err
+	}
+
+	if err := archive.Close(); err != nil {
+		return fmt.Errorf("closing archive: %w", err)
+	}
+
+	return nil
+}
+
+func writeZipEntry(archive *zip.Writer, path, name string, info fs.FileInfo) error {
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return fmt.Errorf("creating header for %q: %w", path, err)
+	}
+
+	header.Name = name
+
+	if !info.IsDir() {
+		header.Method = zip.Deflate
+	}
+
+	entry, err := archive.CreateHeader(header)
+	if err != nil {
+		return fmt.Errorf("writing header for %q: %w", path, err)
+	}
+
+	if info.IsDir() {
+		return nil
+	}
+
+	return copyFileInto(entry, path)
+}
+
+// runUnzip extracts ZIP archive from the input into directory given as output. As ZIP index is stored at the
+// end of the archive, the input is read into memory first.
+func (c *runState) runUnzip(ctx context.Context) error {
+	if c.outputPath == "" {
+		return fmt.Errorf("output directory must be given")
+	}
+
+	input, err := c.openInputs(ctx, c.inputPaths, c.Input)
+	if err != nil {
+		return fmt.Errorf("opening input: %w", err)
+	}
+
+	//nolint:errcheck // Input is only read, so closing errors can be ignored.
+	defer input.Close()
+
+	data, err := io.ReadAll(ctxio.NewReader(ctx, input))
+	if err != nil {
+		return fmt.Errorf("reading input: %w", err)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return fmt.Errorf("reading archive: %w", err)
+	}
+
+	if err := os.MkdirAll(c.outputPath, archiveDirPerm); err != nil {
+		return fmt.Errorf("creating output directory %q: %w", c.outputPath, err)
+	}
+
+	for _, file := range archive.File {
+		if err := extractZipEntry(ctx, file, c.outputPath); err != nil {
+			return fmt.Errorf("extracting archive: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func extractZipEntry(ctx context.Context, file *zip.File, dir string) error {
+	path, err := archiveEntryPath(dir, file.Name)
+	if err != nil {
+		return err
+	}
+
+	mode := file.Mode()
+
+	switch {
+	case mode.IsDir():
+		if err := os.MkdirAll(path, archiveDirPerm); err != nil {
+			return fmt.Errorf("creating directory %q: %w", path, err)
+		}
+
+		return nil
+	case !mode.IsRegular():
+		return fmt.Errorf("unsupported type of archive entry %q", file.Name)
+	}
+
+	entry, err := file.Open()
+	if err != nil {
+		return fmt.Errorf("opening archive entry %q: %w", file.Name, err)
+	}
+
+	//nolint:errcheck // Entry is only read, so closing errors can be ignored.
+	defer entry.Close()
+
+	return extractFile(ctxio.NewReader(ctx, entry), path, mode.Perm())
+}
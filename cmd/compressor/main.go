@@ -16,51 +16,146 @@
 // This package responsibilities:
 // - Converting CLI errors into appropriate exit codes.
 // - Handling OS signals to context/control channel conversion.
+// - Reporting progress when SIGUSR1 signal is received.
+// - Reloading configuration of serve action when SIGHUP signal is received.
 //
 package main
 
 import (
 	"context"
-	"fmt"
 	"os"
 	"os/signal"
+	"runtime"
 	"syscall"
 
 	"github.com/invidian/golang-cli-testing-example/cli/compressor"
 )
 
+const (
+	// ExitCodeError is returned when CLI returns an error.
+	ExitCodeError = 1
+	// ExitCodeInterrupted is returned when CLI stops because of received termination signal.
+	ExitCodeInterrupted = 2
+)
+
+// Build information printed by version action. Version and BuildTime are expected to be set at build time using
+// e.g. go build -ldflags "-X main.Version=v1.0.0 -X main.BuildTime=2021-01-01T00:00:00Z".
+//
+//nolint:gochecknoglobals // Variables must be global to be set using linker flags.
+var (
+	Version   = "dev"
+	GoVersion = runtime.Version()
+	BuildTime = "unknown"
+)
+
 func main() {
 	os.Exit(run())
 }
 
 func run() int {
-	cli := compressor.Cli{
+	cli := &compressor.Cli{
 		Output:      os.Stdout,
 		Input:       os.Stdin,
 		ErrorOutput: os.Stderr,
 		Args:        os.Args,
+		Environ:     os.Environ(),
+		Progress:    &compressor.Progress{},
+		BuildInfo: compressor.BuildInfo{
+			Version:   Version,
+			GoVersion: GoVersion,
+			BuildTime: BuildTime,
+		},
 	}
 
-	if err := cli.Run(signalContext()); err != nil {
-		fmt.Fprintf(os.Stderr, "Error running CLI: %v\n", err)
+	reportProgressOnSignal(cli)
+	reloadConfigOnSignal(cli)
+
+	return runWithContext(signalContext(context.Background(), syscall.SIGINT, syscall.SIGTERM), cli)
+}
+
+// runWithContext runs given CLI and converts returned error into exit code. Given context should only be
+// cancelled when termination signal is received.
+func runWithContext(ctx context.Context, cli *compressor.Cli) int {
+	if err := cli.Run(ctx); err != nil {
+		cli.ReportError(err)
+
+		// Signal context is only cancelled when signal is received. Error itself is not checked, as it may
+		// wrap context.Canceled coming from elsewhere, e.g. from reading the input.
+		if ctx.Err() != nil {
+			return ExitCodeInterrupted
+		}
 
-		return 1
+		return ExitCodeError
 	}
 
 	return 0
 }
 
-func signalContext() context.Context {
-	ctx, cancel := context.WithCancel(context.Background())
+// signalContext returns context derived from given context, which is cancelled once one of given signals
+// is received.
+func signalContext(ctx context.Context, sigs ...os.Signal) context.Context {
+	signals := make(chan os.Signal, 1)
 
-	sigs := make(chan os.Signal, 1)
+	signal.Notify(signals, sigs...)
+
+	ctx = cancelOnSignal(ctx, signals)
+
+	// Restore default handling of signals, so e.g. next interrupt terminates the process even if it is still
+	// shutting down.
+	context.AfterFunc(ctx, func() {
+		signal.Stop(signals)
+	})
+
+	return ctx
+}
 
-	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+// cancelOnSignal returns context derived from given context, which is cancelled once signal is received
+// from given channel.
+func cancelOnSignal(ctx context.Context, signals <-chan os.Signal) context.Context {
+	ctx, cancel := context.WithCancel(ctx)
 
 	go func() {
-		<-sigs
-		cancel()
+		defer cancel()
+
+		select {
+		case <-signals:
+		case <-ctx.Done():
+		}
 	}()
 
 	return ctx
 }
+
+// reportProgressOnSignal prints current progress to stderr every time progress signal is received.
+func reportProgressOnSignal(cli *compressor.Cli) {
+	if len(progressSignals) == 0 {
+		return
+	}
+
+	sigs := make(chan os.Signal, 1)
+
+	signal.Notify(sigs, progressSignals...)
+
+	go func() {
+		for range sigs {
+			cli.ReportProgress()
+		}
+	}()
+}
+
+// reloadConfigOnSignal reloads configuration of the running serve action every time reload signal is received.
+func reloadConfigOnSignal(cli *compressor.Cli) {
+	if len(reloadSignals) == 0 {
+		return
+	}
+
+	sigs := make(chan os.Signal, 1)
+
+	signal.Notify(sigs, reloadSignals...)
+
+	go func() {
+		for range sigs {
+			cli.ReloadConfig()
+		}
+	}()
+}
@@ -2,13 +2,21 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"errors"
+	"io"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
+	"sync"
 	"syscall"
 	"testing"
+	"testing/iotest"
 	"time"
+
+	"github.com/invidian/golang-cli-testing-example/cli/compressor"
+	"github.com/invidian/golang-cli-testing-example/internal/testutil"
 )
 
 func Test_Main_exits_with_exit_code(t *testing.T) {
@@ -43,10 +51,8 @@ func Test_Main_exits_with_exit_code(t *testing.T) {
 			t.Fatalf("Expected to get ExitError, got %t", err)
 		}
 
-		expectedExitCode := 1
-
-		if exitCode := exitErr.ExitCode(); exitCode != expectedExitCode {
-			t.Fatalf("Expected exit code %d, got %d", expectedExitCode, exitCode)
+		if exitCode := exitErr.ExitCode(); exitCode != ExitCodeError {
+			t.Fatalf("Expected exit code %d, got %d", ExitCodeError, exitCode)
 		}
 	})
 }
@@ -64,6 +70,21 @@ func Test_Main_prints_regular_output_to_stdout(t *testing.T) {
 	}
 }
 
+func Test_Main_prints_version_information_to_stdout(t *testing.T) {
+	t.Parallel()
+
+	output, err := testCmd("--version").Output()
+	if err != nil {
+		t.Fatalf("Unexpected error running command: %v", err)
+	}
+
+	for _, expectedOutput := range []string{Version, GoVersion, BuildTime} {
+		if !strings.Contains(string(output), expectedOutput) {
+			t.Fatalf("Expected output to include %q, got:\n%s", expectedOutput, output)
+		}
+	}
+}
+
 func Test_Main_prints_error_messages_to_stderr(t *testing.T) {
 	t.Parallel()
 
@@ -148,10 +169,8 @@ func Test_Main_handles_gracefully(t *testing.T) {
 					t.Fatalf("Expected to get ExitError, got %t", err)
 				}
 
-				expectedExitCode := 1
-
-				if exitCode := exitErr.ExitCode(); exitCode != expectedExitCode {
-					t.Fatalf("Expected exit code %d, got %d", expectedExitCode, exitCode)
+				if exitCode := exitErr.ExitCode(); exitCode != ExitCodeInterrupted {
+					t.Fatalf("Expected exit code %d, got %d", ExitCodeInterrupted, exitCode)
 				}
 
 				if !strings.HasSuffix(strings.TrimSpace(stderr.String()), expectedError) {
@@ -164,6 +183,221 @@ func Test_Main_handles_gracefully(t *testing.T) {
 	}
 }
 
+func Test_Signal_context(t *testing.T) {
+	t.Parallel()
+
+	t.Run("is_cancelled_once_signal_is_received", func(t *testing.T) {
+		t.Parallel()
+
+		signals := testutil.NewFakeSignal(t)
+
+		ctx := cancelOnSignal(testutil.ContextWithDeadline(t), signals)
+
+		select {
+		case <-ctx.Done():
+			t.Fatalf("Context should not be cancelled before signal is received")
+		default:
+		}
+
+		signals <- syscall.SIGTERM
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Second):
+			t.Fatalf("Context should be cancelled after signal is received")
+		}
+	})
+
+	t.Run("is_cancelled_when_parent_context_is_cancelled", func(t *testing.T) {
+		t.Parallel()
+
+		parent, cancel := context.WithCancel(testutil.ContextWithDeadline(t))
+
+		ctx := signalContext(parent, syscall.SIGTERM)
+
+		cancel()
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Second):
+			t.Fatalf("Context should be cancelled after parent context is cancelled")
+		}
+	})
+}
+
+func Test_Running_CLI_returns_interrupted_exit_code_when_signal_is_received(t *testing.T) {
+	t.Parallel()
+
+	sigs := testutil.NewFakeSignal(t)
+	ctx := cancelOnSignal(testutil.ContextWithDeadline(t), sigs)
+
+	// Reading from pipe blocks until signal is received, so CLI can't finish on its own.
+	input, inputWriter := io.Pipe()
+	t.Cleanup(func() { inputWriter.Close() })
+
+	stderr := &bytes.Buffer{}
+
+	cli := &compressor.Cli{
+		Args:        []string{"compressor", compressor.ActionCompress},
+		Output:      io.Discard,
+		ErrorOutput: stderr,
+		Input:       input,
+	}
+
+	sigs <- os.Interrupt
+
+	if exitCode := runWithContext(ctx, cli); exitCode != ExitCodeInterrupted {
+		t.Fatalf("Expected exit code %d, got %d, error output:\n%s", ExitCodeInterrupted, exitCode, stderr.String())
+	}
+}
+
+func Test_Running_CLI_returns_error_exit_code_when_processing_is_canceled_without_signal(t *testing.T) {
+	t.Parallel()
+
+	ctx := cancelOnSignal(testutil.ContextWithDeadline(t), testutil.NewFakeSignal(t))
+
+	stderr := &bytes.Buffer{}
+
+	cli := &compressor.Cli{
+		Args:        []string{"compressor", compressor.ActionCompress},
+		Output:      io.Discard,
+		ErrorOutput: stderr,
+		Input:       iotest.ErrReader(context.Canceled),
+	}
+
+	if exitCode := runWithContext(ctx, cli); exitCode != ExitCodeError {
+		t.Fatalf("Expected exit code %d, got %d, error output:\n%s", ExitCodeError, exitCode, stderr.String())
+	}
+}
+
+func Test_Main_prints_progress_to_stderr_when_progress_signal_is_received(t *testing.T) {
+	t.Parallel()
+
+	if len(progressSignals) == 0 {
+		t.Skip("Progress signals are not supported on this platform")
+	}
+
+	cmd := testCmd("--input=/dev/zero", "compress")
+	stderr := &syncBuffer{}
+	cmd.Stderr = stderr
+
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Failed starting process: %v", err)
+	}
+
+	t.Cleanup(func() {
+		if err := cmd.Process.Kill(); err != nil {
+			t.Logf("Failed killing process: %v", err)
+		}
+
+		// Release resources associated with the process.
+		//
+		//nolint:errcheck // Process is killed, so error is expected here.
+		cmd.Wait()
+	})
+
+	expectedOutput := "Progress:"
+
+	// Signal handler may not be registered yet when process just started, so keep sending the signal.
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	timeout := time.NewTimer(5 * time.Second)
+
+	for !strings.Contains(stderr.String(), expectedOutput) {
+		select {
+		case <-ticker.C:
+			if err := cmd.Process.Signal(progressSignals[0]); err != nil {
+				t.Fatalf("Sending signal to process failed: %v", err)
+			}
+		case <-timeout.C:
+			t.Fatalf("Expected error output to include %q, got:\n%s", expectedOutput, stderr.String())
+		}
+	}
+}
+
+func Test_Main_reloads_configuration_when_reload_signal_is_received(t *testing.T) {
+	t.Parallel()
+
+	if len(reloadSignals) == 0 {
+		t.Skip("Reload signals are not supported on this platform")
+	}
+
+	// Length of Unix socket path is limited, so temporary directory named after the test can't be used.
+	socketDir, err := os.MkdirTemp("", "compressor")
+	if err != nil {
+		t.Fatalf("Unexpected error creating temporary directory: %v", err)
+	}
+
+	t.Cleanup(func() {
+		if err := os.RemoveAll(socketDir); err != nil {
+			t.Logf("Removing temporary directory: %v", err)
+		}
+	})
+
+	// Only serve action reloads configuration, as other actions process single input.
+	cmd := testCmd("serve", "--socket="+filepath.Join(socketDir, "socket"))
+	cmd.Dir = socketDir
+	stderr := &syncBuffer{}
+	cmd.Stderr = stderr
+
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Failed starting process: %v", err)
+	}
+
+	// Registered after removing temporary directory, so process is killed first.
+	t.Cleanup(func() {
+		if err := cmd.Process.Kill(); err != nil {
+			t.Logf("Failed killing process: %v", err)
+		}
+
+		// Release resources associated with the process.
+		//
+		//nolint:errcheck // Process is killed, so error is expected here.
+		cmd.Wait()
+	})
+
+	expectedOutput := "Configuration reloaded"
+
+	// Signal handler may not be registered yet when process just started, so keep sending the signal.
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	timeout := time.NewTimer(5 * time.Second)
+
+	for !strings.Contains(stderr.String(), expectedOutput) {
+		select {
+		case <-ticker.C:
+			if err := cmd.Process.Signal(reloadSignals[0]); err != nil {
+				t.Fatalf("Sending signal to process failed: %v", err)
+			}
+		case <-timeout.C:
+			t.Fatalf("Expected error output to include %q, got:\n%s", expectedOutput, stderr.String())
+		}
+	}
+}
+
+// syncBuffer allows reading process output while the process is still writing to it.
+type syncBuffer struct {
+	buf bytes.Buffer
+	mu  sync.Mutex
+}
+
+func (s *syncBuffer) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	//nolint:wrapcheck // We don't care about error wrapping in test code.
+	return s.buf.Write(p)
+}
+
+func (s *syncBuffer) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.buf.String()
+}
+
 const (
 	testFlagMain = "-test.main"
 	helpFlag     = "--help"
@@ -0,0 +1,15 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// Signals which trigger printing progress of the running action.
+var progressSignals = []os.Signal{syscall.SIGUSR1} //nolint:gochecknoglobals // Differs per platform.
+
+// Signals which trigger reloading configuration of the running serve action.
+var reloadSignals = []os.Signal{syscall.SIGHUP} //nolint:gochecknoglobals // Differs per platform.
@@ -0,0 +1,11 @@
+package main
+
+import (
+	"os"
+)
+
+// Windows has no equivalent of SIGUSR1, so progress reporting via signals is not available.
+var progressSignals []os.Signal //nolint:gochecknoglobals // Differs per platform.
+
+// Windows has no equivalent of SIGHUP, so configuration can't be reloaded via signals.
+var reloadSignals []os.Signal //nolint:gochecknoglobals // Differs per platform.
@@ -0,0 +1,99 @@
+// Package ctxio provides readers and writers respecting context cancellation, which are not intended to be
+// consumed outside of this module.
+package ctxio
+
+import (
+	"context"
+	"io"
+)
+
+// result is a result of single read or write.
+type result struct {
+	n   int
+	err error
+}
+
+type reader struct {
+	//nolint:containedctx // Reader is bound to a single operation using this context.
+	ctx    context.Context
+	reader io.Reader
+}
+
+// NewReader wraps given reader to make it respect given context. If the read blocks, it returns once context is
+// done with n=0 and err=ctx.Err(). Blocked read of the underlying reader is then left running in the background,
+// so it should be unblocked e.g. by closing the underlying reader.
+func NewReader(ctx context.Context, r io.Reader) io.Reader {
+	return &reader{ctx: ctx, reader: r}
+}
+
+func (r *reader) Read(b []byte) (int, error) {
+	// Separate buffer is used, as the read may finish after this function returns.
+	buf := make([]byte, len(b))
+	resultCh := make(chan result, 1)
+
+	go func() {
+		n, err := r.reader.Read(buf)
+		resultCh <- result{n: n, err: err}
+	}()
+
+	select {
+	case res := <-resultCh:
+		copy(b, buf[:res.n])
+
+		return res.n, res.err
+	case <-r.ctx.Done():
+		//nolint:wrapcheck // Context errors must be returned unwrapped, like by readers from standard library.
+		return 0, r.ctx.Err()
+	}
+}
+
+type writeCloser struct {
+	//nolint:containedctx // Writer is bound to a single operation using this context.
+	ctx    context.Context
+	writer io.WriteCloser
+}
+
+// NewWriteCloser wraps given writer to make its writes respect given context. If the write blocks, it returns
+// once context is done with n=0 and err=ctx.Err(). Closing is passed directly to the underlying writer.
+func NewWriteCloser(ctx context.Context, w io.WriteCloser) io.WriteCloser {
+	return &writeCloser{ctx: ctx, writer: w}
+}
+
+func (w *writeCloser) Write(b []byte) (int, error) {
+	// Data is copied, as the write may finish after this function returns and caller may then reuse the buffer.
+	buf := make([]byte, len(b))
+	copy(buf, b)
+
+	resultCh := make(chan result, 1)
+
+	go func() {
+		n, err := w.writer.Write(buf)
+		resultCh <- result{n: n, err: err}
+	}()
+
+	select {
+	case res := <-resultCh:
+		return res.n, res.err
+	case <-w.ctx.Done():
+		//nolint:wrapcheck // Context errors must be returned unwrapped, like by writers from standard library.
+		return 0, w.ctx.Err()
+	}
+}
+
+func (w *writeCloser) Close() error {
+	//nolint:wrapcheck // Do not hide the error from the underlying writer.
+	return w.writer.Close()
+}
+
+// WriteNopCloser returns writer with no-op Close method wrapping given writer, like io.NopCloser does for readers.
+func WriteNopCloser(w io.Writer) io.WriteCloser {
+	return nopWriteCloser{Writer: w}
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,106 @@
+package ctxio_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/invidian/golang-cli-testing-example/internal/ctxio"
+	"github.com/invidian/golang-cli-testing-example/internal/testutil"
+)
+
+func Test_Reader(t *testing.T) {
+	t.Parallel()
+
+	t.Run("reads_data_from_underlying_reader", func(t *testing.T) {
+		t.Parallel()
+
+		data, err := io.ReadAll(ctxio.NewReader(testutil.ContextWithDeadline(t), strings.NewReader("foo")))
+		if err != nil {
+			t.Fatalf("Unexpected error reading data: %v", err)
+		}
+
+		if string(data) != "foo" {
+			t.Fatalf("Expected data %q, got %q", "foo", string(data))
+		}
+	})
+
+	t.Run("returns_context_error_when_context_is_cancelled_during_blocked_read", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithCancel(testutil.ContextWithDeadline(t))
+
+		pipeReader, pipeWriter := io.Pipe()
+
+		t.Cleanup(func() {
+			//nolint:errcheck // Closing pipe always returns nil.
+			pipeWriter.Close()
+		})
+
+		cancel()
+
+		if _, err := ctxio.NewReader(ctx, pipeReader).Read(make([]byte, 1)); !errors.Is(err, context.Canceled) {
+			t.Fatalf("Expected error %v, got %v", context.Canceled, err)
+		}
+	})
+}
+
+func Test_WriteCloser(t *testing.T) {
+	t.Parallel()
+
+	t.Run("writes_data_to_underlying_writer", func(t *testing.T) {
+		t.Parallel()
+
+		output := &bytes.Buffer{}
+
+		writer := ctxio.NewWriteCloser(testutil.ContextWithDeadline(t), ctxio.WriteNopCloser(output))
+
+		if _, err := writer.Write([]byte("foo")); err != nil {
+			t.Fatalf("Unexpected error writing data: %v", err)
+		}
+
+		if err := writer.Close(); err != nil {
+			t.Fatalf("Unexpected error closing writer: %v", err)
+		}
+
+		if output.String() != "foo" {
+			t.Fatalf("Expected data %q, got %q", "foo", output.String())
+		}
+	})
+
+	t.Run("returns_context_error_when_context_is_cancelled_during_blocked_write", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithCancel(testutil.ContextWithDeadline(t))
+
+		pipeReader, pipeWriter := io.Pipe()
+
+		t.Cleanup(func() {
+			//nolint:errcheck // Closing pipe always returns nil.
+			pipeReader.Close()
+		})
+
+		cancel()
+
+		if _, err := ctxio.NewWriteCloser(ctx, pipeWriter).Write([]byte("foo")); !errors.Is(err, context.Canceled) {
+			t.Fatalf("Expected error %v, got %v", context.Canceled, err)
+		}
+	})
+
+	t.Run("closes_underlying_writer", func(t *testing.T) {
+		t.Parallel()
+
+		pipeReader, pipeWriter := io.Pipe()
+
+		if err := ctxio.NewWriteCloser(testutil.ContextWithDeadline(t), pipeWriter).Close(); err != nil {
+			t.Fatalf("Unexpected error closing writer: %v", err)
+		}
+
+		if _, err := pipeReader.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+			t.Fatalf("Expected error %v after closing writer, got %v", io.EOF, err)
+		}
+	})
+}
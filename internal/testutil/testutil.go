@@ -2,20 +2,45 @@
 package testutil
 
 import (
+	"bytes"
 	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
 	"time"
 )
 
 const (
 	// Arbitrary amount of time to let tests exit cleanly before main process terminates.
 	timeoutGracePeriod = 10 * time.Second
+
+	// GoldenDir is a directory relative to tested package, where golden files are stored.
+	GoldenDir = "testdata/golden"
+
+	// FakeHeader is a byte prepended to data "compressed" by FakeCompressor.
+	FakeHeader byte = 0xFA
+
+	// How long goroutines started by the test have to exit after it finishes, before they are considered leaked.
+	goroutineExitTimeout      = time.Second
+	goroutineExitPollInterval = 10 * time.Millisecond
 )
 
+// UpdateGolden controls, whether GoldenFile should overwrite golden files with actual data instead of
+// comparing them. Golden files can be updated by running tests with -update-golden flag.
+//
+//nolint:gochecknoglobals // Flags must be registered before tests are run, so they can't be local.
+var UpdateGolden = flag.Bool("update-golden", false, "overwrite golden files with actual test results")
+
 // Testing is an interface representing testing.T, so helpers itself can be tested as well.
 type Testing interface {
 	Helper()
 	Deadline() (time.Time, bool)
 	Cleanup(func())
+	Fatalf(format string, args ...interface{})
+	TempDir() string
 }
 
 // ContextWithDeadline returns context which will timeout before t.Deadline().
@@ -36,3 +61,190 @@ func ContextWithDeadline(t Testing) context.Context {
 
 	return ctx
 }
+
+// ContextWithTimeout returns context which will timeout after given duration or before t.Deadline(),
+// whichever comes first. It is useful when tests have no deadline set, e.g. when running without -timeout flag.
+//
+//nolint:varnamelen // Make exception for t, as it should be treated as *testing.T still.
+func ContextWithTimeout(t Testing, d time.Duration) context.Context {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(ContextWithDeadline(t), d)
+
+	t.Cleanup(cancel)
+
+	return ctx
+}
+
+// RequireNoGoroutineLeak fails the test, if number of running goroutines does not return to the number
+// from before the test shortly after the test finishes. It should be called at the beginning of the test, so
+// it is checked after all other cleanup functions. Goroutines are counted for the whole process, so tests
+// using it must not run in parallel.
+//
+//nolint:varnamelen // Make exception for t, as it should be treated as *testing.T still.
+func RequireNoGoroutineLeak(t Testing) {
+	t.Helper()
+
+	before := runtime.NumGoroutine()
+
+	t.Cleanup(func() {
+		deadline := time.Now().Add(goroutineExitTimeout)
+
+		for {
+			after := runtime.NumGoroutine()
+			if after <= before {
+				return
+			}
+
+			if time.Now().After(deadline) {
+				stacks := make([]byte, 1<<16)
+				stacks = stacks[:runtime.Stack(stacks, true)]
+
+				t.Fatalf("Expected at most %d goroutines to be running after the test, got %d:\n%s",
+					before, after, stacks)
+
+				return
+			}
+
+			time.Sleep(goroutineExitPollInterval)
+		}
+	})
+}
+
+// NewFakeSignal returns channel, which can be used in place of channel registered using signal.Notify to
+// simulate receiving OS signal. It is buffered like channels passed to signal.Notify should be, so sending
+// a signal does not block.
+//
+//nolint:varnamelen // Make exception for t, as it should be treated as *testing.T still.
+func NewFakeSignal(t Testing) chan os.Signal {
+	t.Helper()
+
+	return make(chan os.Signal, 1)
+}
+
+// MustWriteFile writes given content into file with given path and permissions, failing the test on error.
+//
+//nolint:varnamelen // Make exception for t, as it should be treated as *testing.T still.
+func MustWriteFile(t Testing, path string, content []byte, perm os.FileMode) {
+	t.Helper()
+
+	if err := os.WriteFile(path, content, perm); err != nil {
+		t.Fatalf("Failed writing file %q: %v", path, err)
+	}
+}
+
+// RequireFileContent fails the test if file with given path can't be read or if its content differs from
+// expected content.
+//
+//nolint:varnamelen // Make exception for t, as it should be treated as *testing.T still.
+func RequireFileContent(t Testing, path string, want []byte) {
+	t.Helper()
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed reading file %q: %v", path, err)
+
+		return
+	}
+
+	if !bytes.Equal(got, want) {
+		t.Fatalf("Expected file %q content %q, got %q", path, want, got)
+	}
+}
+
+// NewTempConfigFile writes given content into config.yaml file in temporary directory and returns path to it.
+//
+//nolint:varnamelen // Make exception for t, as it should be treated as *testing.T still.
+func NewTempConfigFile(t Testing, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+
+	MustWriteFile(t, path, []byte(content), 0o600)
+
+	return path
+}
+
+// GoldenFile compares given actual data with content of golden file with given name stored in GoldenDir. If update
+// is true, golden file is overwritten with actual data instead.
+//
+//nolint:varnamelen // Make exception for t, as it should be treated as *testing.T still.
+func GoldenFile(t Testing, name string, actual []byte, update bool) {
+	t.Helper()
+
+	path := filepath.Join(GoldenDir, name)
+
+	if update {
+		if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+			t.Fatalf("Failed creating golden files directory: %v", err)
+
+			return
+		}
+
+		MustWriteFile(t, path, actual, 0o600)
+
+		return
+	}
+
+	RequireFileContent(t, path, actual)
+}
+
+// FakeCompressor returns writer, which prepends FakeHeader to data written to given writer, so "compressed" data
+// can be distinguished from original data without relying on real compression format.
+func FakeCompressor(output io.WriteCloser) io.WriteCloser {
+	return &fakeCompressWriter{output: output}
+}
+
+type fakeCompressWriter struct {
+	output        io.WriteCloser
+	headerWritten bool
+}
+
+func (f *fakeCompressWriter) writeHeader() error {
+	if f.headerWritten {
+		return nil
+	}
+
+	if _, err := f.output.Write([]byte{FakeHeader}); err != nil {
+		return fmt.Errorf("writing header: %w", err)
+	}
+
+	f.headerWritten = true
+
+	return nil
+}
+
+// Write ...
+func (f *fakeCompressWriter) Write(b []byte) (int, error) {
+	if err := f.writeHeader(); err != nil {
+		return 0, err
+	}
+
+	//nolint:wrapcheck // Do not hide the error from the underlying writer.
+	return f.output.Write(b)
+}
+
+// Close writes header if no data has been written and closes underlying writer.
+func (f *fakeCompressWriter) Close() error {
+	if err := f.writeHeader(); err != nil {
+		return err
+	}
+
+	//nolint:wrapcheck // Do not hide the error from the underlying writer.
+	return f.output.Close()
+}
+
+// FakeDecompressor strips FakeHeader from given input, returning error if input does not start with it.
+func FakeDecompressor(input io.Reader) (io.ReadCloser, error) {
+	header := make([]byte, 1)
+
+	if _, err := io.ReadFull(input, header); err != nil {
+		return nil, fmt.Errorf("reading header: %w", err)
+	}
+
+	if header[0] != FakeHeader {
+		return nil, fmt.Errorf("unexpected header %#x, expected %#x", header[0], FakeHeader)
+	}
+
+	return io.NopCloser(input), nil
+}
@@ -1,6 +1,13 @@
 package testutil_test
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -44,10 +51,431 @@ func Test_ContextWithDeadline(t *testing.T) {
 	})
 }
 
+func Test_ContextWithTimeout(t *testing.T) {
+	t.Parallel()
+
+	testT := &testTesting{}
+
+	timeout := time.Minute
+	start := time.Now()
+
+	ctx := testutil.ContextWithTimeout(testT, timeout)
+
+	t.Run("calls_helper_method", func(t *testing.T) {
+		t.Parallel()
+
+		if !testT.helper {
+			t.Fatalf("Expected helper call")
+		}
+	})
+
+	t.Run("adds_cancel_function_cleanup", func(t *testing.T) {
+		t.Parallel()
+
+		if testT.cleanup == nil {
+			t.Fatalf("Expected cleanup function to be registered")
+		}
+	})
+
+	t.Run("returns_context_with_deadline_when_test_has_no_deadline_set", func(t *testing.T) {
+		t.Parallel()
+
+		deadline, ok := ctx.Deadline()
+		if !ok {
+			t.Fatalf("Received context has no deadline set")
+		}
+
+		if deadline.Before(start) || deadline.After(time.Now().Add(timeout)) {
+			t.Fatalf("Expected deadline within %v from now, got %v", timeout, deadline)
+		}
+	})
+}
+
+//nolint:paralleltest // Goroutines are counted for the whole process.
+func Test_RequireNoGoroutineLeak(t *testing.T) {
+	t.Run("calls_helper_method", func(t *testing.T) {
+		testT := &testTesting{}
+
+		testutil.RequireNoGoroutineLeak(testT)
+
+		if !testT.helper {
+			t.Fatalf("Expected helper call")
+		}
+	})
+
+	t.Run("passes_when_goroutines_exit_after_test", func(t *testing.T) {
+		testT := &testTesting{}
+
+		testutil.RequireNoGoroutineLeak(testT)
+
+		done := make(chan struct{})
+
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			close(done)
+		}()
+
+		testT.cleanup()
+
+		<-done
+
+		if testT.fatal != "" {
+			t.Fatalf("Unexpected failure: %s", testT.fatal)
+		}
+	})
+
+	t.Run("fails_when_goroutine_started_by_test_is_still_running", func(t *testing.T) {
+		testT := &testTesting{}
+
+		testutil.RequireNoGoroutineLeak(testT)
+
+		stop := make(chan struct{})
+		stopped := make(chan struct{})
+
+		go func() {
+			<-stop
+			close(stopped)
+		}()
+
+		testT.cleanup()
+
+		close(stop)
+		<-stopped
+
+		if !strings.Contains(testT.fatal, "goroutines to be running after the test") {
+			t.Fatalf("Expected goroutine leak to be reported, got %q", testT.fatal)
+		}
+	})
+}
+
+func Test_NewFakeSignal(t *testing.T) {
+	t.Parallel()
+
+	testT := &testTesting{}
+
+	sigs := testutil.NewFakeSignal(testT)
+
+	t.Run("calls_helper_method", func(t *testing.T) {
+		t.Parallel()
+
+		if !testT.helper {
+			t.Fatalf("Expected helper call")
+		}
+	})
+
+	t.Run("returns_channel_receiving_sent_signal_without_blocking_sender", func(t *testing.T) {
+		t.Parallel()
+
+		select {
+		case sigs <- os.Interrupt:
+		default:
+			t.Fatalf("Sending signal should not block")
+		}
+
+		if sig := <-sigs; sig != os.Interrupt {
+			t.Fatalf("Expected to receive signal %v, got %v", os.Interrupt, sig)
+		}
+	})
+}
+
+func Test_MustWriteFile(t *testing.T) {
+	t.Parallel()
+
+	t.Run("writes_given_content_into_file", func(t *testing.T) {
+		t.Parallel()
+
+		testT := &testTesting{}
+		path := filepath.Join(t.TempDir(), "file")
+		content := []byte("foo")
+
+		testutil.MustWriteFile(testT, path, content, 0o600)
+
+		if !testT.helper {
+			t.Fatalf("Expected helper call")
+		}
+
+		if testT.fatal != "" {
+			t.Fatalf("Unexpected test failure: %s", testT.fatal)
+		}
+
+		written, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("Unexpected error reading file: %v", err)
+		}
+
+		if string(written) != string(content) {
+			t.Fatalf("Expected file content %q, got %q", content, written)
+		}
+	})
+
+	t.Run("fails_test_when_writing_fails", func(t *testing.T) {
+		t.Parallel()
+
+		testT := &testTesting{}
+
+		testutil.MustWriteFile(testT, filepath.Join(t.TempDir(), "missing", "file"), nil, 0o600)
+
+		if testT.fatal == "" {
+			t.Fatalf("Expected test to fail")
+		}
+	})
+}
+
+func Test_RequireFileContent(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "file")
+	content := []byte("foo")
+
+	testutil.MustWriteFile(t, path, content, 0o600)
+
+	for name, testCase := range map[string]struct {
+		path       string
+		want       []byte
+		shouldFail bool
+	}{
+		"passes_when_content_matches": {
+			path: path,
+			want: content,
+		},
+		"fails_when_content_differs": {
+			path:       path,
+			want:       []byte("bar"),
+			shouldFail: true,
+		},
+		"fails_when_file_does_not_exist": {
+			path:       path + "-missing",
+			want:       content,
+			shouldFail: true,
+		},
+	} {
+		testCase := testCase
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			testT := &testTesting{}
+
+			testutil.RequireFileContent(testT, testCase.path, testCase.want)
+
+			if !testT.helper {
+				t.Fatalf("Expected helper call")
+			}
+
+			if failed := testT.fatal != ""; failed != testCase.shouldFail {
+				t.Fatalf("Expected test failure to be %v, got %q", testCase.shouldFail, testT.fatal)
+			}
+		})
+	}
+}
+
+func Test_NewTempConfigFile(t *testing.T) {
+	t.Parallel()
+
+	testT := &testTesting{tempDir: t.TempDir()}
+	content := "format: noop"
+
+	path := testutil.NewTempConfigFile(testT, content)
+
+	if !testT.helper {
+		t.Fatalf("Expected helper call")
+	}
+
+	if expectedPath := filepath.Join(testT.tempDir, "config.yaml"); path != expectedPath {
+		t.Fatalf("Expected config file path %q, got %q", expectedPath, path)
+	}
+
+	testutil.RequireFileContent(t, path, []byte(content))
+}
+
+func Test_GoldenFile(t *testing.T) {
+	t.Parallel()
+
+	t.Run("passes_when_actual_data_matches_golden_file", func(t *testing.T) {
+		t.Parallel()
+
+		testT := &testTesting{}
+
+		testutil.GoldenFile(testT, "example", []byte("foo"), false)
+
+		if !testT.helper {
+			t.Fatalf("Expected helper call")
+		}
+
+		if testT.fatal != "" {
+			t.Fatalf("Unexpected test failure: %s", testT.fatal)
+		}
+	})
+
+	t.Run("fails_when_actual_data_differs_from_golden_file", func(t *testing.T) {
+		t.Parallel()
+
+		testT := &testTesting{}
+
+		testutil.GoldenFile(testT, "example", []byte("bar"), false)
+
+		if testT.fatal == "" {
+			t.Fatalf("Expected test to fail")
+		}
+	})
+
+	t.Run("fails_when_golden_file_does_not_exist", func(t *testing.T) {
+		t.Parallel()
+
+		testT := &testTesting{}
+
+		testutil.GoldenFile(testT, "missing", []byte("foo"), false)
+
+		if testT.fatal == "" {
+			t.Fatalf("Expected test to fail")
+		}
+	})
+
+	t.Run("overwrites_golden_file_when_update_is_requested", func(t *testing.T) {
+		t.Parallel()
+
+		name := filepath.Join(t.Name(), "updated")
+		path := filepath.Join(testutil.GoldenDir, name)
+
+		t.Cleanup(func() {
+			if err := os.RemoveAll(filepath.Join(testutil.GoldenDir, "Test_GoldenFile")); err != nil {
+				t.Logf("Failed removing updated golden file: %v", err)
+			}
+		})
+
+		testT := &testTesting{}
+		content := []byte("bar")
+
+		testutil.GoldenFile(testT, name, content, true)
+
+		if testT.fatal != "" {
+			t.Fatalf("Unexpected test failure: %s", testT.fatal)
+		}
+
+		testutil.RequireFileContent(t, path, content)
+	})
+}
+
+func Test_FakeCompressor(t *testing.T) {
+	t.Parallel()
+
+	for name, input := range map[string]string{
+		"prepends_header_to_written_data":       "foo",
+		"writes_header_when_no_data_is_written": "",
+	} {
+		input := input
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			output := &testWriteCloser{}
+
+			writer := testutil.FakeCompressor(output)
+
+			if _, err := io.WriteString(writer, input); err != nil {
+				t.Fatalf("Unexpected error writing data: %v", err)
+			}
+
+			if err := writer.Close(); err != nil {
+				t.Fatalf("Unexpected error closing writer: %v", err)
+			}
+
+			if !output.closed {
+				t.Fatalf("Expected underlying writer to be closed")
+			}
+
+			if expected := string([]byte{testutil.FakeHeader}) + input; output.String() != expected {
+				t.Fatalf("Expected output %q, got %q", expected, output.String())
+			}
+		})
+	}
+
+	t.Run("returns_error_when_writing_header_fails", func(t *testing.T) {
+		t.Parallel()
+
+		writer := testutil.FakeCompressor(&testWriteCloser{err: errors.New("write failed")})
+
+		if _, err := writer.Write([]byte("foo")); err == nil {
+			t.Fatalf("Expected error writing data")
+		}
+
+		if err := writer.Close(); err == nil {
+			t.Fatalf("Expected error closing writer")
+		}
+	})
+}
+
+func Test_FakeDecompressor(t *testing.T) {
+	t.Parallel()
+
+	t.Run("strips_header_from_input", func(t *testing.T) {
+		t.Parallel()
+
+		reader, err := testutil.FakeDecompressor(strings.NewReader(string([]byte{testutil.FakeHeader}) + "foo"))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		data, err := io.ReadAll(reader)
+		if err != nil {
+			t.Fatalf("Unexpected error reading data: %v", err)
+		}
+
+		if string(data) != "foo" {
+			t.Fatalf("Expected data %q, got %q", "foo", data)
+		}
+	})
+
+	for name, input := range map[string]string{
+		"returns_error_when_input_is_empty":                   "",
+		"returns_error_when_input_does_not_start_with_header": "foo",
+	} {
+		input := input
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			if _, err := testutil.FakeDecompressor(strings.NewReader(input)); err == nil {
+				t.Fatalf("Expected error")
+			}
+		})
+	}
+}
+
+type testWriteCloser struct {
+	bytes.Buffer
+	closed bool
+	err    error
+}
+
+func (w *testWriteCloser) Write(b []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+
+	return w.Buffer.Write(b)
+}
+
+func (w *testWriteCloser) Close() error {
+	w.closed = true
+
+	return nil
+}
+
 type testTesting struct {
 	helper  bool
 	cleanup func()
 	time    time.Time
+	fatal   string
+	tempDir string
+}
+
+func (t *testTesting) TempDir() string {
+	return t.tempDir
+}
+
+func (t *testTesting) Fatalf(format string, args ...interface{}) {
+	t.fatal = fmt.Sprintf(format, args...)
 }
 
 func (t *testTesting) Helper() {
@@ -0,0 +1,347 @@
+package compressor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+
+	"github.com/invidian/golang-cli-testing-example/internal/ctxio"
+	"github.com/invidian/golang-cli-testing-example/pkg/compressor/frame"
+)
+
+// MaxParallelism is a maximum number of blocks processed concurrently. Each of them is held in memory
+// until it is written, so higher values would only risk exhausting memory.
+const MaxParallelism = 256
+
+// BlockClient is implemented by clients, which can process data in independent blocks, so multiple
+// blocks can be processed concurrently. Like Compress and Decompress, its methods close given input once
+// processing stops and returned readers can be closed to stop processing before all data is read.
+type BlockClient interface {
+	CompressBlocks(ctx context.Context, input io.ReadCloser, blockSize, parallelism int) (io.ReadCloser, chan error)
+	DecompressBlocks(ctx context.Context, input io.ReadCloser, parallelism int) (io.ReadCloser, chan error)
+}
+
+type blockResult struct {
+	frame frame.Frame
+	err   error
+}
+
+// blockPipeline describes how blocks are read, processed and written by processBlocks.
+type blockPipeline struct {
+	parallelism int
+
+	// start is optional and called before any block is written.
+	start func(io.Writer) error
+
+	// read should return io.EOF when there are no more blocks.
+	read    func() (frame.Frame, error)
+	process func(frame.Frame) (frame.Frame, error)
+	write   func(io.Writer, frame.Frame) error
+
+	// finish is optional and called after all blocks have been written.
+	finish func(io.Writer) error
+}
+
+// CompressBlocks splits input into blocks of given size, compresses up to parallelism blocks concurrently
+// and writes them sequentially using format defined in frame package. Checksum of the input is calculated
+// and input is copied to tee writer the same way as by Compress. Metadata cannot be embedded into blocks,
+// so configuring it makes processing fail.
+func (c *client) CompressBlocks(
+	ctx context.Context, input io.ReadCloser, blockSize, parallelism int,
+) (io.ReadCloser, chan error) {
+	c = c.current()
+	ctx = c.context(ctx)
+
+	if blockSize < 1 {
+		return failedBlocks(ctx, input, fmt.Errorf("block size must be positive, got %d", blockSize))
+	}
+
+	if blockSize > frame.MaxBlockSize {
+		return failedBlocks(ctx, input, fmt.Errorf("block size must not exceed %d, got %d", frame.MaxBlockSize, blockSize))
+	}
+
+	if c.metadata != nil {
+		return failedBlocks(ctx, input, fmt.Errorf("metadata is not supported when compressing blocks"))
+	}
+
+	reader := c.teeInput(input)
+
+	checksum := c.newChecksum()
+	if checksum != nil {
+		reader = io.TeeReader(reader, checksum)
+	}
+
+	return c.processBlocks(ctx, input, blockPipeline{
+		parallelism: parallelism,
+		start:       frame.WriteHeader,
+		read: func() (frame.Frame, error) {
+			// Buffer grows with data actually read, so small input does not allocate whole block.
+			block := &bytes.Buffer{}
+
+			// Partially filled block is the last one.
+			_, err := io.CopyN(block, reader, int64(blockSize))
+			if errors.Is(err, io.EOF) && block.Len() > 0 {
+				err = nil
+			}
+
+			return frame.Frame{Data: block.Bytes()}, err
+		},
+		process: c.compressBlock,
+		write:   frame.WriteFrame,
+		finish: func(w io.Writer) error {
+			if err := frame.WriteEnd(w); err != nil {
+				return err //nolint:wrapcheck // Error is wrapped by the caller.
+			}
+
+			return c.verifyBlocksChecksum(checksum)
+		},
+	})
+}
+
+// DecompressBlocks reverses CompressBlocks, decompressing up to parallelism blocks concurrently.
+// Configured output limit applies to the total size of all decompressed blocks and checksum is verified
+// once all of them are written.
+func (c *client) DecompressBlocks(
+	ctx context.Context, input io.ReadCloser, parallelism int,
+) (io.ReadCloser, chan error) {
+	c = c.current()
+	ctx = c.context(ctx)
+
+	if c.metadataReader != nil {
+		return failedBlocks(ctx, input, fmt.Errorf("metadata is not supported when decompressing blocks"))
+	}
+
+	checksum := c.newChecksum()
+
+	headerRead := false
+
+	var outputBytes int64
+
+	return c.processBlocks(ctx, input, blockPipeline{
+		parallelism: parallelism,
+		read: func() (frame.Frame, error) {
+			if !headerRead {
+				if err := frame.ReadHeader(input); err != nil {
+					return frame.Frame{}, fmt.Errorf("reading stream header: %w", err)
+				}
+
+				headerRead = true
+			}
+
+			block, err := frame.ReadFrame(input)
+			if err != nil {
+				return block, err
+			}
+
+			// Size of decompressed block is verified, so limit can be checked before decompressing it.
+			outputBytes += int64(block.UncompressedSize)
+			if c.maxOutputBytes > 0 && outputBytes > c.maxOutputBytes {
+				return frame.Frame{}, fmt.Errorf("decompressed data exceeds limit of %d bytes", c.maxOutputBytes)
+			}
+
+			return block, nil
+		},
+		process: c.decompressBlock,
+		write: func(w io.Writer, block frame.Frame) error {
+			if checksum != nil {
+				checksum.Write(block.Data)
+			}
+
+			_, err := w.Write(block.Data)
+
+			return err //nolint:wrapcheck // Error is wrapped by the caller.
+		},
+		finish: func(io.Writer) error {
+			return c.verifyBlocksChecksum(checksum)
+		},
+	})
+}
+
+func (c *client) verifyBlocksChecksum(checksum hash.Hash) error {
+	if err := c.verifyChecksum(checksum); err != nil {
+		return fmt.Errorf("verifying checksum: %w", err)
+	}
+
+	return nil
+}
+
+func (c *client) compressBlock(block frame.Frame) (frame.Frame, error) {
+	buf := &bytes.Buffer{}
+
+	compressor := c.compressor(ctxio.WriteNopCloser(buf))
+
+	if _, err := compressor.Write(block.Data); err != nil {
+		return frame.Frame{}, fmt.Errorf("compressing block: %w", err)
+	}
+
+	if err := compressor.Close(); err != nil {
+		return frame.Frame{}, fmt.Errorf("closing compressor: %w", err)
+	}
+
+	return frame.Frame{
+		Data: buf.Bytes(),
+		// Block size is limited to frame.MaxBlockSize, so it always fits.
+		UncompressedSize: uint32(len(block.Data)),
+		CRC32:            crc32.ChecksumIEEE(block.Data),
+		HasCRC32:         true,
+	}, nil
+}
+
+func (c *client) decompressBlock(block frame.Frame) (frame.Frame, error) {
+	decompressor, err := c.decompressor(bytes.NewReader(block.Data))
+	if err != nil {
+		return frame.Frame{}, fmt.Errorf("creating decompressor: %w", err)
+	}
+
+	// Reading one byte more than expected is enough for verification to fail, so decompression bomb hidden
+	// in a block does not exhaust memory.
+	data, err := io.ReadAll(io.LimitReader(decompressor, int64(block.UncompressedSize)+1))
+	if err != nil {
+		return frame.Frame{}, fmt.Errorf("decompressing block: %w", err)
+	}
+
+	if err := decompressor.Close(); err != nil {
+		return frame.Frame{}, fmt.Errorf("closing decompressor: %w", err)
+	}
+
+	if err := block.Verify(data); err != nil {
+		return frame.Frame{}, fmt.Errorf("verifying block: %w", err)
+	}
+
+	return frame.Frame{Data: data}, nil
+}
+
+// processBlocks reads blocks until io.EOF, processes up to configured number of them concurrently
+// and writes the results into returned reader in the original order. Given input is closed once processing
+// stops. Given context must not be nil.
+//
+//nolint:funlen,cyclop // Splitting producer and consumer apart would make the flow harder to follow.
+func (c *client) processBlocks(
+	ctx context.Context, input io.Closer, pipeline blockPipeline,
+) (io.ReadCloser, chan error) {
+	if pipeline.parallelism < 1 {
+		return failedBlocks(ctx, input, fmt.Errorf("parallelism must be positive, got %d", pipeline.parallelism))
+	}
+
+	if pipeline.parallelism > MaxParallelism {
+		return failedBlocks(ctx, input,
+			fmt.Errorf("parallelism must not exceed %d, got %d", MaxParallelism, pipeline.parallelism))
+	}
+
+	outputReader, outputWriter := ContextPipe(ctx)
+
+	// Stops reading new blocks when writing the results fails or returned reader gets closed.
+	ctx, cancel := context.WithCancel(ctx)
+
+	// Bounds number of blocks held in memory, as results must be written in order.
+	results := make(chan chan blockResult, pipeline.parallelism)
+	workers := make(chan struct{}, pipeline.parallelism)
+
+	go func() {
+		defer close(results)
+
+		for {
+			block, err := pipeline.read()
+			if errors.Is(err, io.EOF) {
+				return
+			}
+
+			result := make(chan blockResult, 1)
+
+			select {
+			case results <- result:
+			case <-ctx.Done():
+				return
+			}
+
+			if err != nil {
+				result <- blockResult{err: fmt.Errorf("reading block: %w", err)}
+
+				return
+			}
+
+			workers <- struct{}{}
+
+			go func() {
+				processed, err := pipeline.process(block)
+
+				<-workers
+
+				result <- blockResult{frame: processed, err: err}
+			}()
+		}
+	}()
+
+	errCh := make(chan error, 1)
+
+	go func() {
+		defer cancel()
+
+		errCh <- wrapCanceled(closingInput(input, func() error {
+			err := writeBlocks(outputWriter, pipeline, results)
+			if err != nil {
+				err = fmt.Errorf("processing blocks: %w", err)
+
+				// Propagate the error to the reader side as well, so reading from pipe does not block infinitely.
+				//
+				//nolint:errcheck // Closing pipe always returns nil.
+				outputWriter.CloseWithError(err)
+
+				return err
+			}
+
+			// Close writing to pipe, so reading from it does not block infinitely.
+			//
+			//nolint:errcheck // Closing pipe always returns nil.
+			outputWriter.Close()
+
+			return nil
+		})())
+	}()
+
+	return &pipeReadCloser{ContextPipeReader: outputReader, cancel: cancel}, errCh
+}
+
+func writeBlocks(w io.Writer, pipeline blockPipeline, results chan chan blockResult) error {
+	if pipeline.start != nil {
+		if err := pipeline.start(w); err != nil {
+			return err
+		}
+	}
+
+	for result := range results {
+		block := <-result
+		if block.err != nil {
+			return block.err
+		}
+
+		if err := pipeline.write(w, block.frame); err != nil {
+			return err
+		}
+	}
+
+	if pipeline.finish != nil {
+		return pipeline.finish(w)
+	}
+
+	return nil
+}
+
+func failedBlocks(ctx context.Context, input io.Closer, err error) (io.ReadCloser, chan error) {
+	outputReader, outputWriter := ContextPipe(ctx)
+
+	//nolint:errcheck // Input is only read, so closing errors can be ignored.
+	input.Close()
+
+	//nolint:errcheck // Closing pipe always returns nil.
+	outputWriter.CloseWithError(err)
+
+	errCh := make(chan error, 1)
+	errCh <- err
+
+	return outputReader, errCh
+}
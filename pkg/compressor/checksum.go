@@ -0,0 +1,71 @@
+package compressor
+
+import (
+	"crypto/md5" //nolint:gosec // MD5 is only offered for compatibility with existing pipelines.
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"strings"
+)
+
+// ChecksumAlgorithm ...
+type ChecksumAlgorithm string
+
+const (
+	// ChecksumNone ...
+	ChecksumNone ChecksumAlgorithm = ""
+	// ChecksumSHA256 ...
+	ChecksumSHA256 ChecksumAlgorithm = "sha256"
+	// ChecksumMD5 ...
+	ChecksumMD5 ChecksumAlgorithm = "md5"
+)
+
+// AvailableChecksumAlgorithms ...
+func AvailableChecksumAlgorithms() []string {
+	return []string{
+		string(ChecksumSHA256),
+		string(ChecksumMD5),
+	}
+}
+
+func (c ChecksumAlgorithm) newHash() (hash.Hash, error) {
+	switch c {
+	case ChecksumNone:
+		return nil, nil
+	case ChecksumSHA256:
+		return sha256.New(), nil
+	case ChecksumMD5:
+		//nolint:gosec // MD5 is only offered for compatibility with existing pipelines.
+		return md5.New(), nil
+	default:
+		return nil, fmt.Errorf("unknown checksum algorithm %q", c)
+	}
+}
+
+func (c *client) newChecksum() hash.Hash {
+	//nolint:errcheck // Algorithm is validated when creating the client.
+	checksum, _ := c.checksum.newHash()
+
+	return checksum
+}
+
+// verifyChecksum passes calculated checksum to the configured handler and compares it with the expected one.
+func (c *client) verifyChecksum(checksum hash.Hash) error {
+	if checksum == nil {
+		return nil
+	}
+
+	sum := hex.EncodeToString(checksum.Sum(nil))
+
+	if c.checksumHandler != nil {
+		c.checksumHandler(sum)
+	}
+
+	// Hex encoding is case-insensitive, e.g. checksums printed by some tools use upper case.
+	if c.expectedChecksum != "" && !strings.EqualFold(c.expectedChecksum, sum) {
+		return fmt.Errorf("checksum mismatch, expected %s, got %s", c.expectedChecksum, sum)
+	}
+
+	return nil
+}
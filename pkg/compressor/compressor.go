@@ -6,8 +6,10 @@ import (
 	"context"
 	"fmt"
 	"io"
-
-	"github.com/go-git/go-git/v5/utils/ioutil"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
 )
 
 // Format ...
@@ -23,12 +25,55 @@ const (
 	DefaultFormat = FormatGzip
 )
 
-// AvailableFormats ...
-func AvailableFormats() []string {
-	return []string{
-		string(FormatGzip),
-		string(FormatNoop),
+// AvailableFormats returns sorted list of formats registered in DefaultRegistry.
+func AvailableFormats() []Format {
+	return DefaultRegistry.Formats()
+}
+
+// IsValid returns true if format is one of available formats.
+func (f Format) IsValid() bool {
+	for _, format := range AvailableFormats() {
+		if f == format {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ParseFormat returns format matching given name, ignoring the case and surrounding whitespace.
+func ParseFormat(s string) (Format, error) {
+	format := Format(strings.ToLower(strings.TrimSpace(s)))
+
+	if !format.IsValid() {
+		return "", &UnknownFormatError{Format: s}
 	}
+
+	return format, nil
+}
+
+// MarshalText ...
+func (f Format) MarshalText() ([]byte, error) {
+	return []byte(f), nil
+}
+
+// UnmarshalText parses format using ParseFormat, so decoding configuration files validates the format.
+// Empty value is accepted and means default format.
+func (f *Format) UnmarshalText(b []byte) error {
+	if len(b) == 0 {
+		*f = ""
+
+		return nil
+	}
+
+	format, err := ParseFormat(string(b))
+	if err != nil {
+		return err
+	}
+
+	*f = format
+
+	return nil
 }
 
 // Config ...
@@ -36,26 +81,165 @@ type Config struct {
 	Format       Format
 	Compressor   func(io.WriteCloser) io.WriteCloser
 	Decompressor func(io.Reader) (io.ReadCloser, error)
+
+	// Level sets compression level of gzip format, e.g. gzip.NoCompression. Nil means default compression
+	// level. Setting it for other formats or together with custom compressor is an error.
+	Level *int
+
+	// MaxOutputBytes limits how much data can be produced by decompression to protect from
+	// decompression bombs. Zero means no limit.
+	MaxOutputBytes int64
+
+	// MaxRetries sets how many times compression is retried from the beginning of input when it fails, if input
+	// implements io.ReadSeeker. Data consumed from the input is then passed to TeeWriter again.
+	MaxRetries int
+
+	// Checksum selects algorithm used to calculate checksum of uncompressed data, both when
+	// compressing and decompressing.
+	Checksum ChecksumAlgorithm
+
+	// ChecksumHandler, when set, receives hex-encoded checksum of uncompressed data once compression
+	// or decompression finishes.
+	ChecksumHandler func(string)
+
+	// ExpectedChecksum is a hex-encoded checksum which decompressed data must match, otherwise
+	// decompression returns an error.
+	ExpectedChecksum string
+
+	// Metadata is embedded into compressed data. Gzip format stores it in the extra header field and noop
+	// format prepends it as a JSON line.
+	Metadata map[string]string
+
+	// MetadataReader, when set, receives metadata embedded in the data being decompressed. Noop format
+	// then expects the data to start with a JSON line with metadata.
+	MetadataReader func(map[string]string)
+
+	// OriginalName and ModTime are stored in the gzip header, to preserve information about the original file.
+	OriginalName string
+	ModTime      time.Time
+
+	// HeaderReader, when set, receives gzip header of the data being decompressed.
+	HeaderReader func(gzip.Header)
+
+	// TeeWriter, when set, receives input data as it is consumed during compression, e.g. to log raw input
+	// without wrapping the input reader externally.
+	TeeWriter io.Writer
+
+	// DefaultContext is used when nil context is passed to client methods, e.g. when client lifetime matches
+	// lifetime of a server request. If not set, context.Background() is used.
+	DefaultContext context.Context
+
+	// Logger, when set, receives debug messages when compression or decompression starts and finishes, including
+	// processed byte counts and duration.
+	Logger *slog.Logger
+
+	// Tracer, when set, is used to start span for each compression and decompression.
+	Tracer Tracer
+
+	// PipeBufferSize is a number of bytes of processed data, which are buffered until they are read, so
+	// processing does not have to wait for the reader on every write. Zero means DefaultPipeBufferSize.
+	PipeBufferSize int
+
+	// ChunkSize is a number of bytes processed between checks of the context. Smaller chunks make processing
+	// stop sooner once context is done, at the cost of more overhead. Zero means DefaultChunkSize.
+	ChunkSize int
 }
 
 // Client ...
+//
+// Readers returned by Compress and Decompress can be closed to stop processing before all data is read.
+// Returned error channels receive single value and are closed once processing stops.
+//
+// Compress and Decompress close given input once processing stops, so caller does not need to manage its lifetime.
 type Client interface {
-	Compress(context.Context, io.Reader) (io.Reader, chan error)
-	Decompress(context.Context, io.Reader) (io.Reader, chan error)
+	Compress(context.Context, io.ReadCloser) (io.ReadCloser, chan error)
+	Decompress(context.Context, io.ReadCloser) (io.ReadCloser, chan error)
+}
+
+// FormatReporter is implemented by clients, which can report format they are configured with.
+type FormatReporter interface {
+	// Format returns format client is configured with. It is empty when client uses custom compressor
+	// and decompressor without specifying the format.
+	Format() Format
+}
+
+// formatOf returns format reported by given client or empty format if client does not report it.
+func formatOf(client Client) Format {
+	if reporter, ok := client.(FormatReporter); ok {
+		return reporter.Format()
+	}
+
+	return ""
 }
 
 type client struct {
-	compressor   func(io.WriteCloser) io.WriteCloser
-	decompressor func(io.Reader) (io.ReadCloser, error)
+	// mu guards reloaded, which is a client with configuration replacing the original one after reloading.
+	// All other fields are set once when creating the client and never modified, so operations using them
+	// complete with the same configuration even if client is reloaded in the meantime.
+	mu       sync.RWMutex
+	reloaded *client
+
+	format         Format
+	compressor     func(io.WriteCloser) io.WriteCloser
+	decompressor   func(io.Reader) (io.ReadCloser, error)
+	maxOutputBytes int64
+	maxRetries     int
+
+	checksum         ChecksumAlgorithm
+	checksumHandler  func(string)
+	expectedChecksum string
+
+	metadata       map[string]string
+	metadataReader func(map[string]string)
+
+	originalName string
+	modTime      time.Time
+	headerReader func(gzip.Header)
+
+	teeWriter      io.Writer
+	defaultContext context.Context
+	logger         *slog.Logger
+	tracer         Tracer
+	pipeBufferSize int
+	chunkSize      int
 }
 
 func (c Config) validate() error {
 	if c.Decompressor == nil {
-		return fmt.Errorf("decompressor must be configured")
+		return &ConfigValidationError{Reason: "decompressor must be configured"}
 	}
 
 	if c.Compressor == nil {
-		return fmt.Errorf("compressor must be configured")
+		return &ConfigValidationError{Reason: "compressor must be configured"}
+	}
+
+	if c.Level != nil && (*c.Level < gzip.HuffmanOnly || *c.Level > gzip.BestCompression) {
+		return &ConfigValidationError{Reason: fmt.Sprintf("compression level must be between %d and %d, got %d",
+			gzip.HuffmanOnly, gzip.BestCompression, *c.Level)}
+	}
+
+	if c.MaxRetries < 0 {
+		return &ConfigValidationError{Reason: "max retries must not be negative"}
+	}
+
+	if c.MaxOutputBytes < 0 {
+		return &ConfigValidationError{Reason: "max output bytes must not be negative"}
+	}
+
+	if c.PipeBufferSize < 0 {
+		return &ConfigValidationError{Reason: "pipe buffer size must not be negative"}
+	}
+
+	if c.ChunkSize < 0 {
+		return &ConfigValidationError{Reason: "chunk size must not be negative"}
+	}
+
+	if _, err := c.Checksum.newHash(); err != nil {
+		return &ConfigValidationError{Reason: fmt.Sprintf("validating checksum: %v", err)}
+	}
+
+	if c.Checksum == ChecksumNone && (c.ChecksumHandler != nil || c.ExpectedChecksum != "") {
+		return &ConfigValidationError{Reason: "checksum algorithm must be configured to use checksums"}
 	}
 
 	return nil
@@ -64,24 +248,45 @@ func (c Config) validate() error {
 // NewClient ...
 func NewClient(configs ...Config) (Client, error) {
 	if len(configs) > 1 {
-		return nil, fmt.Errorf("only one config can be passed")
+		return nil, &ConfigValidationError{Reason: "only one config can be passed"}
 	}
 
-	config := gzipConfig()
+	config := GzipConfig()
 
 	if len(configs) == 1 {
 		config = configs[0]
 	}
 
-	if config.Decompressor == nil && config.Compressor == nil {
-		switch config.Format {
-		case FormatGzip, "":
-			config = gzipConfig()
-		case FormatNoop:
-			config = noopConfig()
-		default:
-			return nil, fmt.Errorf("unknown compression format %q", config.Format)
+	customCompressor := config.Decompressor != nil || config.Compressor != nil
+
+	if config.Level != nil && customCompressor {
+		return nil, &ConfigValidationError{Reason: "compression level can't be used with custom compressor"}
+	}
+
+	if !customCompressor {
+		if config.Format == "" {
+			config.Format = FormatGzip
+		}
+
+		factory, ok := DefaultRegistry.factory(config.Format)
+		if !ok {
+			return nil, &UnknownFormatError{Format: string(config.Format)}
 		}
+
+		formatConfig := factory()
+
+		if config.Level != nil && config.Format != FormatGzip {
+			return nil, &ConfigValidationError{
+				Reason: fmt.Sprintf("compression level is only supported by %q format, got %q", FormatGzip, config.Format),
+			}
+		}
+
+		if config.Level != nil {
+			formatConfig.Compressor = gzipLevelCompressor(*config.Level)
+		}
+
+		config.Compressor = formatConfig.Compressor
+		config.Decompressor = formatConfig.Decompressor
 	}
 
 	if err := config.validate(); err != nil {
@@ -89,91 +294,314 @@ func NewClient(configs ...Config) (Client, error) {
 	}
 
 	return &client{
-		compressor:   config.Compressor,
-		decompressor: config.Decompressor,
+		format:         config.Format,
+		compressor:     config.Compressor,
+		decompressor:   config.Decompressor,
+		maxOutputBytes: config.MaxOutputBytes,
+		maxRetries:     config.MaxRetries,
+
+		checksum:         config.Checksum,
+		checksumHandler:  config.ChecksumHandler,
+		expectedChecksum: config.ExpectedChecksum,
+
+		metadata:       config.Metadata,
+		metadataReader: config.MetadataReader,
+
+		originalName: config.OriginalName,
+		modTime:      config.ModTime,
+		headerReader: config.HeaderReader,
+
+		teeWriter:      config.TeeWriter,
+		defaultContext: config.DefaultContext,
+		logger:         config.Logger,
+		tracer:         config.Tracer,
+		pipeBufferSize: config.PipeBufferSize,
+		chunkSize:      config.ChunkSize,
 	}, nil
 }
 
+// Format ...
+func (c *client) Format() Format {
+	return c.current().format
+}
+
 // Compress ...
-func (c *client) Compress(ctx context.Context, input io.Reader) (io.Reader, chan error) {
-	compressedReader, compressedWriter := io.Pipe()
+func (c *client) Compress(ctx context.Context, input io.ReadCloser) (io.ReadCloser, chan error) {
+	c = c.current()
+	ctx = c.context(ctx)
 
-	ctxCompressedReader := ioutil.NewContextReader(ctx, compressedReader)
-	ctxCompressedWriter := ioutil.NewContextWriteCloser(ctx, compressedWriter)
+	if _, ok := input.(io.ReadSeeker); ok && c.maxRetries > 0 {
+		return retryProcessing(ctx, input, c.maxRetries+1, nil, c.compress)
+	}
 
-	errCh := make(chan error, 1)
+	return c.compress(ctx, input)
+}
+
+func (c *client) compress(ctx context.Context, input io.ReadCloser) (io.ReadCloser, chan error) {
+	output, compress := c.prepareCompress(ctx, input, 0)
+
+	return output, runJob(closingInput(input, compress))
+}
 
-	compressor := c.compressor(ctxCompressedWriter)
+// Decompress ...
+func (c *client) Decompress(ctx context.Context, input io.ReadCloser) (io.ReadCloser, chan error) {
+	c = c.current()
+
+	output, decompress := c.prepareDecompress(c.context(ctx), input)
+
+	return output, runJob(closingInput(input, decompress))
+}
+
+// runJob runs given job in the background and returns channel receiving its result.
+func runJob(job func() error) chan error {
+	errCh := make(chan error, 1)
 
 	go func() {
-		errCh <- func() error {
-			// Initialize compression by draining input.
-			if _, err := io.Copy(compressor, input); err != nil {
-				return fmt.Errorf("compressing data: %w", err)
-			}
+		errCh <- wrapCanceled(job())
 
-			// Ensure all data was flushed.
-			if err := compressor.Close(); err != nil {
-				return fmt.Errorf("closing compressor: %w", err)
-			}
+		close(errCh)
+	}()
+
+	return errCh
+}
 
-			// Close writing to pipe, so reading from it does not block infinitely.
+// closingInput returns job, which closes given input once given job finishes.
+func closingInput(input io.Closer, job func() error) func() error {
+	return func() error {
+		//nolint:errcheck // Input is only read, so closing errors can be ignored.
+		defer input.Close()
+
+		return job()
+	}
+}
+
+// afterJob returns channel receiving the result from given channel once given function is called with it.
+func afterJob(errCh chan error, fn func(error)) chan error {
+	return runJob(func() error {
+		err := <-errCh
+
+		fn(err)
+
+		return err
+	})
+}
+
+// pipeReadCloser is returned from processing, which writes the results into a pipe. Closing it stops
+// the processing.
+type pipeReadCloser struct {
+	*ContextPipeReader
+
+	cancel context.CancelFunc
+}
+
+// Close ...
+func (p *pipeReadCloser) Close() error {
+	p.cancel()
+
+	return p.ContextPipeReader.Close()
+}
+
+// context returns given context or configured default context if given context is nil.
+func (c *client) context(ctx context.Context) context.Context {
+	if ctx != nil {
+		return ctx
+	}
+
+	if c.defaultContext != nil {
+		return c.defaultContext
+	}
+
+	return context.Background()
+}
+
+// newPipe returns pipe bound to given context passing processed data to the reader, buffering configured
+// amount of data.
+func (c *client) newPipe(ctx context.Context) (*ContextPipeReader, *ContextPipeWriter) {
+	size := c.pipeBufferSize
+	if size == 0 {
+		size = DefaultPipeBufferSize
+	}
+
+	return newContextPipe(ctx, size)
+}
+
+// teeInput returns input, which copies consumed data to configured tee writer.
+func (c *client) teeInput(input io.Reader) io.Reader {
+	if c.teeWriter == nil {
+		return input
+	}
+
+	return io.TeeReader(input, c.teeWriter)
+}
+
+// prepareCompress returns reader with compressed data and a function, which performs the compression
+// and must be run concurrently with reading the data. If flush interval is positive, compressor is flushed
+// every time given number of bytes is consumed from the input. Given context must not be nil.
+func (c *client) prepareCompress(
+	ctx context.Context, input io.Reader, flushInterval int64,
+) (io.ReadCloser, func() error) {
+	// Separate context allows stopping the compression by closing the output. Pipe is bound to it, so reads and
+	// writes stop once it is done, but data written before closing the writer can still be read.
+	jobCtx, cancel := context.WithCancel(ctx)
+
+	compressedReader, compressedWriter := c.newPipe(jobCtx)
+
+	countedOutput := newCountingWriteCloser(compressedWriter)
+	compressor := c.compressor(countedOutput)
+
+	countedInput := &countingReader{reader: input}
+	input = c.teeInput(countedInput)
+
+	checksum := c.newChecksum()
+	if checksum != nil {
+		input = io.TeeReader(input, checksum)
+	}
+
+	return &pipeReadCloser{ContextPipeReader: compressedReader, cancel: cancel}, func() (err error) {
+		defer cancel()
+
+		finish := c.startOperation(ctx, "compress", SpanNameCompress)
+
+		defer func() { finish(countedInput.count, countedOutput.count, err) }()
+
+		if err := c.writeMetadata(compressor); err != nil {
+			err = fmt.Errorf("writing metadata: %w", err)
+
+			//nolint:errcheck // Closing pipe always returns nil.
+			compressedWriter.CloseWithError(err)
+
+			return err
+		}
+
+		// Initialize compression by draining input.
+		if err := c.copyFlushing(jobCtx, compressor, input, flushInterval); err != nil {
+			err = fmt.Errorf("compressing data: %w", err)
+
+			// Propagate the error to the reader side as well, so reading from pipe does not block infinitely.
 			//
 			//nolint:errcheck // Closing pipe always returns nil.
-			ctxCompressedWriter.Close()
+			compressedWriter.CloseWithError(err)
 
-			return nil
-		}()
-	}()
+			return err
+		}
 
-	return ctxCompressedReader, errCh
+		// Ensure all data was flushed.
+		if err := compressor.Close(); err != nil {
+			err = fmt.Errorf("closing compressor: %w", err)
+
+			//nolint:errcheck // Closing pipe always returns nil.
+			compressedWriter.CloseWithError(err)
+
+			return err
+		}
+
+		if err := c.verifyChecksum(checksum); err != nil {
+			err = fmt.Errorf("verifying checksum: %w", err)
+
+			//nolint:errcheck // Closing pipe always returns nil.
+			compressedWriter.CloseWithError(err)
+
+			return err
+		}
+
+		// Close writing to pipe, so reading from it does not block infinitely.
+		//
+		//nolint:errcheck // Closing pipe always returns nil.
+		compressedWriter.Close()
+
+		return nil
+	}
 }
 
-// Decompress ...
-func (c *client) Decompress(ctx context.Context, input io.Reader) (io.Reader, chan error) {
-	decompressedReader, decompressedWriter := io.Pipe()
+// prepareDecompress returns reader with decompressed data and a function, which performs the decompression
+// and must be run concurrently with reading the data. Given context must not be nil.
+func (c *client) prepareDecompress(ctx context.Context, input io.Reader) (io.ReadCloser, func() error) {
+	// Separate context allows stopping the decompression by closing the output. Pipe is bound to it, so reads and
+	// writes stop once it is done, but data written before closing the writer can still be read.
+	jobCtx, cancel := context.WithCancel(ctx)
 
-	ctxDecompressedReader := ioutil.NewContextReader(ctx, decompressedReader)
-	ctxDecompressedWriter := ioutil.NewContextWriteCloser(ctx, decompressedWriter)
+	decompressedReader, decompressedWriter := c.newPipe(jobCtx)
+	decompressedOutput := &pipeReadCloser{ContextPipeReader: decompressedReader, cancel: cancel}
 
-	errCh := make(chan error, 1)
+	countedInput := &countingReader{reader: input}
 
-	decompressor, err := c.decompressor(input)
+	decompressor, err := c.newDecompressor(countedInput)
 	if err != nil {
-		errCh <- fmt.Errorf("creating decompressor: %w", err)
-
 		//nolint:errcheck // Closing pipe always returns nil.
-		defer ctxDecompressedWriter.Close()
+		decompressedWriter.Close()
+
+		return decompressedOutput, func() error {
+			cancel()
 
-		return ctxDecompressedReader, errCh
+			return fmt.Errorf("creating decompressor: %w", err)
+		}
 	}
 
-	go func() {
-		errCh <- func() error {
-			// Initialize decompression by draining input.
-			if _, err := io.Copy(ctxDecompressedWriter, decompressor); err != nil {
-				return fmt.Errorf("decompressing data: %w", err)
+	return decompressedOutput, func() (err error) {
+		defer cancel()
+
+		countedOutput := &countingWriter{Writer: decompressedWriter}
+
+		finish := c.startOperation(ctx, "decompress", SpanNameDecompress)
+
+		defer func() { finish(countedInput.count, countedOutput.count, err) }()
+
+		var output io.Writer = countedOutput
+
+		if c.maxOutputBytes > 0 {
+			output = &limitedWriter{
+				writer: output,
+				limit:  c.maxOutputBytes,
 			}
+		}
+
+		checksum := c.newChecksum()
+		if checksum != nil {
+			output = io.MultiWriter(output, checksum)
+		}
+
+		// Initialize decompression by draining input.
+		if _, err := c.streamCopy(jobCtx, output, decompressor); err != nil {
+			err = fmt.Errorf("decompressing data: %w", err)
 
-			// Close writing to pipe, so reading from it does not block infinitely.
+			// Propagate the error to the reader side as well, so reading from pipe does not block infinitely.
 			//
 			//nolint:errcheck // Closing pipe always returns nil.
-			defer func() { _ = ctxDecompressedWriter.Close() }()
+			decompressedWriter.CloseWithError(err)
 
-			// Ensure all data was flushed.
-			if err := decompressor.Close(); err != nil {
-				return fmt.Errorf("closing decompressor: %w", err)
-			}
+			return err
+		}
 
-			return nil
-		}()
-	}()
+		if err := c.verifyChecksum(checksum); err != nil {
+			err = fmt.Errorf("verifying checksum: %w", err)
+
+			// Make sure reader does not consider data as valid.
+			//
+			//nolint:errcheck // Closing pipe always returns nil.
+			decompressedWriter.CloseWithError(err)
 
-	return ctxDecompressedReader, errCh
+			return err
+		}
+
+		// Close writing to pipe, so reading from it does not block infinitely.
+		//
+		//nolint:errcheck // Closing pipe always returns nil.
+		defer func() { _ = decompressedWriter.Close() }()
+
+		// Ensure all data was flushed.
+		if err := decompressor.Close(); err != nil {
+			return fmt.Errorf("closing decompressor: %w", err)
+		}
+
+		return nil
+	}
 }
 
-func gzipConfig() Config {
+// GzipConfig returns configuration using gzip format with default compression level. It can be used as a base
+// for custom configurations.
+func GzipConfig() Config {
 	return Config{
+		Format: FormatGzip,
 		Compressor: func(a io.WriteCloser) io.WriteCloser {
 			return gzip.NewWriter(a)
 		},
@@ -188,8 +616,21 @@ func gzipConfig() Config {
 	}
 }
 
-func noopConfig() Config {
+// gzipLevelCompressor returns gzip compressor using given compression level, which must be valid.
+func gzipLevelCompressor(level int) func(io.WriteCloser) io.WriteCloser {
+	return func(a io.WriteCloser) io.WriteCloser {
+		// Level is validated when creating the client, so error is not possible here.
+		w, _ := gzip.NewWriterLevel(a, level)
+
+		return w
+	}
+}
+
+// NoopConfig returns configuration, which passes data through without compressing it. It can be used as a base
+// for custom configurations.
+func NoopConfig() Config {
 	return Config{
+		Format: FormatNoop,
 		Compressor: func(a io.WriteCloser) io.WriteCloser {
 			return a
 		},
@@ -4,16 +4,26 @@ import (
 	"bytes"
 	"compress/gzip"
 	"context"
+	"crypto/md5" //nolint:gosec // Just for testing.
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"math/rand"
+	"reflect"
+	"runtime"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/invidian/golang-cli-testing-example/internal/testutil"
 	"github.com/invidian/golang-cli-testing-example/pkg/compressor"
+	"github.com/invidian/golang-cli-testing-example/pkg/compressor/frame"
 )
 
 func Test_Compressing_and_decompressing_data_using_same_compressor_multiple_times_restores_original_data(t *testing.T) {
@@ -39,7 +49,7 @@ func Test_Compressing_and_decompressing_data_using_same_compressor_multiple_time
 					return fmt.Errorf("generating random data for compression: %w", err)
 				}
 
-				compressedData, compressErrCh := client.Compress(ctx, bytes.NewBuffer(data))
+				compressedData, compressErrCh := client.Compress(ctx, io.NopCloser(bytes.NewBuffer(data)))
 
 				reader, decompressErrCh := client.Decompress(ctx, io.NopCloser(compressedData))
 
@@ -72,6 +82,82 @@ func Test_Compressing_and_decompressing_data_using_same_compressor_multiple_time
 	}
 }
 
+func FuzzCompressDecompress(f *testing.F) {
+	for _, seed := range [][]byte{{}, {0}, []byte(testData)} {
+		f.Add(seed)
+	}
+
+	client, err := compressor.NewClient()
+	if err != nil {
+		f.Fatalf("Unexpected error creating client: %v", err)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		ctx := testutil.ContextWithDeadline(t)
+
+		compressedData, compressErrCh := client.Compress(ctx, io.NopCloser(bytes.NewReader(data)))
+
+		reader, decompressErrCh := client.Decompress(ctx, compressedData)
+
+		decompressedData, err := io.ReadAll(reader)
+		if err != nil {
+			t.Fatalf("Unexpected error reading decompressed data: %v", err)
+		}
+
+		if err := <-compressErrCh; err != nil {
+			t.Fatalf("Unexpected compression error: %v", err)
+		}
+
+		if err := <-decompressErrCh; err != nil {
+			t.Fatalf("Unexpected decompression error: %v", err)
+		}
+
+		if !bytes.Equal(decompressedData, data) {
+			t.Fatalf("Expected decompressed data to be %q, got %q", data, decompressedData)
+		}
+	})
+}
+
+// maxCompressAllocs is a number of allocations, which compressing small input is known to not exceed. Goroutine and
+// pipe used for each call allocate as well, so it can't be zero, but it should not grow unnoticed.
+const maxCompressAllocs = 100
+
+func BenchmarkCompressAllocs(b *testing.B) {
+	client, err := compressor.NewClient()
+	if err != nil {
+		b.Fatalf("Unexpected error creating client: %v", err)
+	}
+
+	input := strings.NewReader(testData)
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(testData)))
+
+	var before, after runtime.MemStats
+
+	runtime.ReadMemStats(&before)
+
+	for i := 0; i < b.N; i++ {
+		input.Reset(testData)
+
+		output, errCh := client.Compress(context.Background(), io.NopCloser(input))
+
+		if _, err := io.Copy(io.Discard, output); err != nil {
+			b.Fatalf("Unexpected error reading compressed data: %v", err)
+		}
+
+		if err := <-errCh; err != nil {
+			b.Fatalf("Unexpected compression error: %v", err)
+		}
+	}
+
+	runtime.ReadMemStats(&after)
+
+	if allocs := (after.Mallocs - before.Mallocs) / uint64(b.N); allocs > maxCompressAllocs {
+		b.Fatalf("Expected at most %d allocations per compression, got %d", maxCompressAllocs, allocs)
+	}
+}
+
 func Test_Compressor_use_gzip_format_for_compression(t *testing.T) {
 	t.Parallel()
 
@@ -96,7 +182,9 @@ func Test_Compressor_use_gzip_format_for_compression(t *testing.T) {
 				t.Fatalf("Unexpected error creating client: %v", err)
 			}
 
-			compressedData, errCh := client.Compress(testutil.ContextWithDeadline(t), bytes.NewBufferString(testData))
+			input := io.NopCloser(bytes.NewBufferString(testData))
+
+			compressedData, errCh := client.Compress(testutil.ContextWithDeadline(t), input)
 
 			reader, err := gzip.NewReader(compressedData)
 			if err != nil {
@@ -132,7 +220,7 @@ func Test_Compressor_supports_noop_compression_format_which_does_not_modify_data
 	}
 
 	ctx := testutil.ContextWithDeadline(t)
-	compressedData, errCh := client.Compress(ctx, bytes.NewBufferString(testData))
+	compressedData, errCh := client.Compress(ctx, io.NopCloser(bytes.NewBufferString(testData)))
 
 	decompressedDataReader, decompressionErrCh := client.Decompress(ctx, compressedData)
 
@@ -154,253 +242,3056 @@ func Test_Compressor_supports_noop_compression_format_which_does_not_modify_data
 	}
 }
 
-//nolint:funlen // Just many test cases.
-func Test_Creating_compressor_returns_error_when(t *testing.T) {
+func Test_Exported_format_configs_can_be_customized(t *testing.T) {
 	t.Parallel()
 
-	t.Run("unknown_compression_format_is_requested", func(t *testing.T) {
-		t.Parallel()
+	for name, config := range map[string]compressor.Config{
+		"gzip": compressor.GzipConfig(),
+		"noop": compressor.NoopConfig(),
+	} {
+		config := config
 
-		badFormat := "badFormat"
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
 
-		config := compressor.Config{
-			Format: compressor.Format(badFormat),
+			config.MaxOutputBytes = int64(len(testData)) - 1
+
+			client, err := compressor.NewClient(config)
+			if err != nil {
+				t.Fatalf("Unexpected error creating client: %v", err)
+			}
+
+			if format := clientFormat(t, client); format != config.Format {
+				t.Fatalf("Expected format %q, got %q", config.Format, format)
+			}
+
+			ctx := testutil.ContextWithDeadline(t)
+
+			compressed, compressErrCh := client.Compress(ctx, io.NopCloser(strings.NewReader(testData)))
+
+			decompressed, decompressErrCh := client.Decompress(ctx, compressed)
+
+			if _, err := io.ReadAll(decompressed); err == nil {
+				t.Fatalf("Expected decompressing to fail due to output limit")
+			}
+
+			// Decompression stops reading compressed data on error, so compression must be stopped explicitly.
+			compressed.Close()
+			<-compressErrCh
+
+			if err := <-decompressErrCh; err == nil {
+				t.Fatalf("Expected decompression error due to output limit")
+			}
+		})
+	}
+}
+
+func Test_Compressor_logs_processed_bytes_using_configured_logger(t *testing.T) {
+	t.Parallel()
+
+	logs := &bytes.Buffer{}
+	logger := slog.New(slog.NewJSONHandler(logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	client, err := compressor.NewClientWithOptions(compressor.WithLogger(logger))
+	if err != nil {
+		t.Fatalf("Unexpected error creating client: %v", err)
+	}
+
+	output, errCh := client.Compress(testutil.ContextWithDeadline(t), io.NopCloser(strings.NewReader(testData)))
+
+	compressed, err := io.ReadAll(output)
+	if err != nil {
+		t.Fatalf("Unexpected error reading compressed data: %v", err)
+	}
+
+	if err := <-errCh; err != nil {
+		t.Fatalf("Unexpected compression error: %v", err)
+	}
+
+	var lastLog struct {
+		Msg         string `json:"msg"`
+		Operation   string `json:"operation"`
+		InputBytes  int    `json:"input_bytes"`
+		OutputBytes int    `json:"output_bytes"`
+	}
+
+	lines := strings.Split(strings.TrimSpace(logs.String()), "\n")
+
+	if err := json.Unmarshal([]byte(lines[len(lines)-1]), &lastLog); err != nil {
+		t.Fatalf("Unexpected error decoding log line %q: %v", lines[len(lines)-1], err)
+	}
+
+	if lastLog.Msg != "processing finished" || lastLog.Operation != "compress" {
+		t.Fatalf("Expected compression finished message, got %+v", lastLog)
+	}
+
+	if lastLog.InputBytes != len(testData) || lastLog.OutputBytes != len(compressed) {
+		t.Fatalf("Expected %d input bytes and %d output bytes to be logged, got %+v",
+			len(testData), len(compressed), lastLog)
+	}
+}
+
+type testSpan struct {
+	name       string
+	attributes map[string]interface{}
+	ended      bool
+	err        error
+}
+
+func (s *testSpan) SetAttributes(attributes ...compressor.Attribute) {
+	for _, attribute := range attributes {
+		s.attributes[attribute.Key] = attribute.Value
+	}
+}
+
+func (s *testSpan) End(err error) {
+	s.ended = true
+	s.err = err
+}
+
+type testTracer struct {
+	mu    sync.Mutex
+	spans []*testSpan
+}
+
+func (t *testTracer) Start(ctx context.Context, spanName string) (context.Context, compressor.Span) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	span := &testSpan{name: spanName, attributes: map[string]interface{}{}}
+	t.spans = append(t.spans, span)
+
+	return ctx, span
+}
+
+func Test_Compressor_starts_spans_using_configured_tracer(t *testing.T) {
+	t.Parallel()
+
+	tracer := &testTracer{}
+
+	client, err := compressor.NewClientWithOptions(compressor.WithTracer(tracer))
+	if err != nil {
+		t.Fatalf("Unexpected error creating client: %v", err)
+	}
+
+	ctx := testutil.ContextWithDeadline(t)
+
+	compressed, compressErrCh := client.Compress(ctx, io.NopCloser(strings.NewReader(testData)))
+	decompressed, decompressErrCh := client.Decompress(ctx, compressed)
+
+	if _, err := io.ReadAll(decompressed); err != nil {
+		t.Fatalf("Unexpected error reading decompressed data: %v", err)
+	}
+
+	if err := <-compressErrCh; err != nil {
+		t.Fatalf("Unexpected compression error: %v", err)
+	}
+
+	if err := <-decompressErrCh; err != nil {
+		t.Fatalf("Unexpected decompression error: %v", err)
+	}
+
+	tracer.mu.Lock()
+	defer tracer.mu.Unlock()
+
+	spans := map[string]*testSpan{}
+
+	for _, span := range tracer.spans {
+		spans[span.name] = span
+	}
+
+	for name, inputBytesKey := range map[string]string{
+		compressor.SpanNameCompress:   compressor.AttributeInputBytes,
+		compressor.SpanNameDecompress: compressor.AttributeOutputBytes,
+	} {
+		span, ok := spans[name]
+		if !ok {
+			t.Fatalf("Expected span %q to be started, got %v", name, tracer.spans)
 		}
 
-		client, err := compressor.NewClient(config)
-		if err == nil {
-			t.Fatalf("Expected client creating error")
+		if !span.ended || span.err != nil {
+			t.Fatalf("Expected span %q to be ended without error, got ended=%v, err=%v", name, span.ended, span.err)
 		}
 
-		if !strings.Contains(err.Error(), badFormat) {
-			t.Fatalf("Expected error message to contain %q, got %v", badFormat, err)
+		if format := span.attributes[compressor.AttributeFormat]; format != string(compressor.FormatGzip) {
+			t.Fatalf("Expected span %q to have format %q, got %v", name, compressor.FormatGzip, format)
 		}
 
-		if client != nil {
-			t.Fatalf("When creating client returns error, no client should be returned")
+		if uncompressedBytes := span.attributes[inputBytesKey]; uncompressedBytes != int64(len(testData)) {
+			t.Fatalf("Expected span %q to have %d uncompressed bytes, got %v", name, len(testData), uncompressedBytes)
 		}
-	})
+	}
+}
 
-	t.Run("multiple_configs_are_passed", func(t *testing.T) {
+type testMetricsRecorder struct {
+	mu         sync.Mutex
+	bytesIn    map[compressor.Format]int64
+	bytesOut   map[compressor.Format]int64
+	operations []string
+}
+
+func (r *testMetricsRecorder) AddBytesIn(format compressor.Format, bytes int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.bytesIn[format] += bytes
+}
+
+func (r *testMetricsRecorder) AddBytesOut(format compressor.Format, bytes int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.bytesOut[format] += bytes
+}
+
+func (r *testMetricsRecorder) ObserveDuration(format compressor.Format, operation string, duration time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.operations = append(r.operations, operation)
+}
+
+func Test_Instrumented_client_records_processed_bytes_and_duration(t *testing.T) {
+	t.Parallel()
+
+	client, err := compressor.NewClient()
+	if err != nil {
+		t.Fatalf("Unexpected error creating client: %v", err)
+	}
+
+	recorder := &testMetricsRecorder{
+		bytesIn:  map[compressor.Format]int64{},
+		bytesOut: map[compressor.Format]int64{},
+	}
+
+	instrumentedClient := compressor.NewInstrumentedClient(client, recorder)
+
+	input := io.NopCloser(strings.NewReader(testData))
+
+	output, errCh := instrumentedClient.Compress(testutil.ContextWithDeadline(t), input)
+
+	compressed, err := io.ReadAll(output)
+	if err != nil {
+		t.Fatalf("Unexpected error reading compressed data: %v", err)
+	}
+
+	if err := <-errCh; err != nil {
+		t.Fatalf("Unexpected compression error: %v", err)
+	}
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+
+	if bytesIn := recorder.bytesIn[compressor.FormatGzip]; bytesIn != int64(len(testData)) {
+		t.Fatalf("Expected %d input bytes to be recorded, got %d", len(testData), bytesIn)
+	}
+
+	if bytesOut := recorder.bytesOut[compressor.FormatGzip]; bytesOut != int64(len(compressed)) {
+		t.Fatalf("Expected %d output bytes to be recorded, got %d", len(compressed), bytesOut)
+	}
+
+	expectedOperations := []string{compressor.OperationCompress}
+
+	if !reflect.DeepEqual(recorder.operations, expectedOperations) {
+		t.Fatalf("Expected operations %v to be observed, got %v", expectedOperations, recorder.operations)
+	}
+}
+
+type recordingClient struct {
+	compressor.Client
+
+	name  string
+	calls *[]string
+}
+
+func (r *recordingClient) Compress(ctx context.Context, input io.ReadCloser) (io.ReadCloser, chan error) {
+	*r.calls = append(*r.calls, r.name)
+
+	return r.Client.Compress(ctx, input)
+}
+
+func Test_Chaining_middlewares(t *testing.T) {
+	t.Parallel()
+
+	client, err := compressor.NewClient()
+	if err != nil {
+		t.Fatalf("Unexpected error creating client: %v", err)
+	}
+
+	calls := []string{}
+
+	recording := func(name string) compressor.Middleware {
+		return func(client compressor.Client) compressor.Client {
+			return &recordingClient{Client: client, name: name, calls: &calls}
+		}
+	}
+
+	logs := &bytes.Buffer{}
+
+	chained := compressor.Chain(client,
+		recording("first"),
+		compressor.LoggingMiddleware(slog.New(slog.NewTextHandler(logs, nil))),
+		recording("second"),
+	)
+
+	output, errCh := chained.Compress(testutil.ContextWithDeadline(t), io.NopCloser(strings.NewReader(testData)))
+
+	if _, err := io.ReadAll(output); err != nil {
+		t.Fatalf("Unexpected error reading compressed data: %v", err)
+	}
+
+	if err := <-errCh; err != nil {
+		t.Fatalf("Unexpected compression error: %v", err)
+	}
+
+	t.Run("calls_middlewares_in_given_order", func(t *testing.T) {
 		t.Parallel()
 
-		c, err := compressor.NewClient(compressor.Config{}, compressor.Config{})
-		if err == nil {
-			t.Fatalf("Expected client creating error")
+		expectedCalls := []string{"first", "second"}
+
+		if !reflect.DeepEqual(calls, expectedCalls) {
+			t.Fatalf("Expected calls %v, got %v", expectedCalls, calls)
 		}
+	})
 
-		if c != nil {
-			t.Fatalf("When creating client returns error, no client should be returned")
+	t.Run("logs_finished_processing_using_logging_middleware", func(t *testing.T) {
+		t.Parallel()
+
+		if !strings.Contains(logs.String(), "processing finished") {
+			t.Fatalf("Expected finished processing to be logged, got %q", logs.String())
 		}
 	})
+}
 
-	t.Run("compressor_is_configured_without_decompressor", func(t *testing.T) {
+func Test_Rate_limit_middleware(t *testing.T) {
+	t.Parallel()
+
+	const bytesPerSecond = 1000
+
+	client, err := compressor.NewClient()
+	if err != nil {
+		t.Fatalf("Unexpected error creating client: %v", err)
+	}
+
+	client = compressor.Chain(client, compressor.RateLimitMiddleware(bytesPerSecond))
+
+	t.Run("limits_rate_of_consuming_input", func(t *testing.T) {
 		t.Parallel()
 
-		config := compressor.Config{
-			Compressor: nopCompressor,
+		// First second worth of data is available immediately, so this should take around half a second.
+		input := strings.Repeat("a", bytesPerSecond*3/2)
+
+		start := time.Now()
+
+		output, errCh := client.Compress(testutil.ContextWithDeadline(t), io.NopCloser(strings.NewReader(input)))
+
+		if _, err := io.ReadAll(output); err != nil {
+			t.Fatalf("Unexpected error reading compressed data: %v", err)
 		}
 
-		c, err := compressor.NewClient(config)
-		if err == nil {
-			t.Fatalf("Expected client creating error")
+		if err := <-errCh; err != nil {
+			t.Fatalf("Unexpected compression error: %v", err)
 		}
 
-		if c != nil {
-			t.Fatalf("When creating client returns error, no client should be returned")
+		if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+			t.Fatalf("Expected compression to be rate limited, took %v", elapsed)
 		}
 	})
 
-	t.Run("decompressor_is_configured_without_compressor", func(t *testing.T) {
+	t.Run("stops_waiting_when_context_is_canceled", func(t *testing.T) {
 		t.Parallel()
 
-		config := compressor.Config{
-			Decompressor: nopDecompressor,
+		ctx, cancel := context.WithTimeout(testutil.ContextWithDeadline(t), 100*time.Millisecond)
+		defer cancel()
+
+		output, errCh := client.Compress(ctx, io.NopCloser(strings.NewReader(strings.Repeat("a", bytesPerSecond*10))))
+
+		if _, err := io.ReadAll(output); err == nil {
+			t.Fatalf("Expected reading compressed data to fail")
 		}
 
-		c, err := compressor.NewClient(config)
-		if err == nil {
-			t.Fatalf("Expected client creating error")
+		if err := <-errCh; !errors.Is(err, compressor.ErrCanceled) {
+			t.Fatalf("Expected error %v, got %v", compressor.ErrCanceled, err)
 		}
+	})
+}
+
+func Test_Compressor_output_writes_processed_data_directly_into_given_writer(t *testing.T) {
+	t.Parallel()
+
+	data := strings.Repeat(testData, 1024)
+
+	// Small buffer ensures data is passed to the writer in many parts.
+	client, err := compressor.NewClient(compressor.Config{Format: compressor.FormatNoop, PipeBufferSize: 16})
+	if err != nil {
+		t.Fatalf("Unexpected error creating client: %v", err)
+	}
+
+	output, errCh := client.Compress(testutil.ContextWithDeadline(t), io.NopCloser(strings.NewReader(data)))
+
+	writerTo, ok := output.(io.WriterTo)
+	if !ok {
+		t.Fatalf("Expected compressed data reader to implement io.WriterTo, got %T", output)
+	}
+
+	buf := &bytes.Buffer{}
+
+	written, err := writerTo.WriteTo(buf)
+	if err != nil {
+		t.Fatalf("Unexpected error writing compressed data: %v", err)
+	}
+
+	if err := <-errCh; err != nil {
+		t.Fatalf("Unexpected compression error: %v", err)
+	}
+
+	if written != int64(len(data)) || buf.String() != data {
+		t.Fatalf("Expected %d bytes of data to be written, got %d bytes, data matching: %t",
+			len(data), written, buf.String() == data)
+	}
+}
+
+func Test_Compressor_output_stops_writing_data_into_given_writer_when_context_is_cancelled(t *testing.T) {
+	t.Parallel()
+
+	client, err := compressor.NewClient()
+	if err != nil {
+		t.Fatalf("Unexpected error creating client: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(testutil.ContextWithDeadline(t))
+
+	// Input never provides any data, so writing output can only be stopped by cancelling the context.
+	input, inputWriter := io.Pipe()
+	t.Cleanup(func() { inputWriter.Close() })
+
+	output, _ := client.Compress(ctx, input)
+
+	writerTo, ok := output.(io.WriterTo)
+	if !ok {
+		t.Fatalf("Expected compressed data reader to implement io.WriterTo, got %T", output)
+	}
+
+	cancel()
+
+	if _, err := writerTo.WriteTo(io.Discard); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected error %v, got %v", context.Canceled, err)
+	}
+}
+
+var errTransient = errors.New("transient error")
+
+// flakyReadSeeker fails reading once given number of bytes is read, until it fails given number of times.
+type flakyReadSeeker struct {
+	*strings.Reader
+
+	failAfter int64
+	failures  int
+}
+
+func (f *flakyReadSeeker) Read(p []byte) (int, error) {
+	position := f.Size() - int64(f.Len())
+
+	if f.failures > 0 && position >= f.failAfter {
+		f.failures--
+
+		return 0, errTransient
+	}
+
+	if remaining := f.failAfter - position; f.failures > 0 && int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+
+	return f.Reader.Read(p)
+}
+
+func (f *flakyReadSeeker) Close() error {
+	return nil
+}
+
+func Test_Compressor_retries_compressing_seekable_input_when_configured(t *testing.T) {
+	t.Parallel()
+
+	client, err := compressor.NewClientWithOptions(compressor.WithMaxRetries(2))
+	if err != nil {
+		t.Fatalf("Unexpected error creating client: %v", err)
+	}
+
+	ctx := testutil.ContextWithDeadline(t)
+
+	input := &flakyReadSeeker{Reader: strings.NewReader(testData), failAfter: 2, failures: 2}
+
+	compressed, compressErrCh := client.Compress(ctx, input)
+	decompressed, decompressErrCh := client.Decompress(ctx, compressed)
+
+	output, err := io.ReadAll(decompressed)
+	if err != nil {
+		t.Fatalf("Unexpected error reading decompressed data: %v", err)
+	}
+
+	if err := <-compressErrCh; err != nil {
+		t.Fatalf("Unexpected compression error: %v", err)
+	}
+
+	if err := <-decompressErrCh; err != nil {
+		t.Fatalf("Unexpected decompression error: %v", err)
+	}
+
+	if string(output) != testData {
+		t.Fatalf("Expected output %q, got %q", testData, string(output))
+	}
+}
+
+func Test_Retry_middleware(t *testing.T) {
+	t.Parallel()
+
+	client, err := compressor.NewClient(compressor.Config{Format: compressor.FormatNoop})
+	if err != nil {
+		t.Fatalf("Unexpected error creating client: %v", err)
+	}
+
+	isTransient := func(err error) bool { return errors.Is(err, errTransient) }
+
+	t.Run("retries_processing_from_the_beginning_of_input_without_repeating_output", func(t *testing.T) {
+		t.Parallel()
+
+		retryingClient := compressor.Chain(client, compressor.RetryMiddleware(3, isTransient))
+
+		input := &flakyReadSeeker{Reader: strings.NewReader(testData), failAfter: 2, failures: 2}
+
+		output, errCh := retryingClient.Compress(testutil.ContextWithDeadline(t), input)
+
+		compressed, err := io.ReadAll(output)
+		if err != nil {
+			t.Fatalf("Unexpected error reading output: %v", err)
+		}
+
+		if err := <-errCh; err != nil {
+			t.Fatalf("Unexpected compression error: %v", err)
+		}
+
+		if string(compressed) != testData {
+			t.Fatalf("Expected output %q, got %q", testData, string(compressed))
+		}
+	})
+
+	t.Run("retries_processing_when_context_is_nil", func(t *testing.T) {
+		t.Parallel()
+
+		retryingClient := compressor.RetryMiddleware(3, nil)(client)
+
+		input := &flakyReadSeeker{Reader: strings.NewReader(testData), failAfter: 2, failures: 1}
+
+		//nolint:staticcheck // Passing nil context is intended.
+		output, errCh := retryingClient.Compress(nil, input)
+
+		compressed, err := io.ReadAll(output)
+		if err != nil {
+			t.Fatalf("Unexpected error reading output: %v", err)
+		}
+
+		if err := <-errCh; err != nil {
+			t.Fatalf("Unexpected compression error: %v", err)
+		}
+
+		if string(compressed) != testData {
+			t.Fatalf("Expected output %q, got %q", testData, string(compressed))
+		}
+	})
+
+	t.Run("returns_error_when_attempts_are_exhausted", func(t *testing.T) {
+		t.Parallel()
+
+		retryingClient := compressor.Chain(client, compressor.RetryMiddleware(2, isTransient))
+
+		input := &flakyReadSeeker{Reader: strings.NewReader(testData), failAfter: 2, failures: 2}
+
+		output, errCh := retryingClient.Compress(testutil.ContextWithDeadline(t), input)
+
+		if _, err := io.ReadAll(output); !errors.Is(err, errTransient) {
+			t.Fatalf("Expected reading output to fail with %v, got %v", errTransient, err)
+		}
+
+		if err := <-errCh; !errors.Is(err, errTransient) {
+			t.Fatalf("Expected error %v, got %v", errTransient, err)
+		}
+	})
+
+	t.Run("does_not_retry_errors_which_are_not_retryable", func(t *testing.T) {
+		t.Parallel()
+
+		retryingClient := compressor.Chain(client, compressor.RetryMiddleware(3, func(error) bool { return false }))
+
+		input := &flakyReadSeeker{Reader: strings.NewReader(testData), failAfter: 2, failures: 1}
+
+		output, errCh := retryingClient.Compress(testutil.ContextWithDeadline(t), input)
+
+		if _, err := io.ReadAll(output); err == nil {
+			t.Fatalf("Expected reading output to fail")
+		}
+
+		if err := <-errCh; !errors.Is(err, errTransient) {
+			t.Fatalf("Expected error %v, got %v", errTransient, err)
+		}
+	})
+
+	t.Run("returns_error_when_input_is_not_seekable", func(t *testing.T) {
+		t.Parallel()
+
+		retryingClient := compressor.Chain(client, compressor.RetryMiddleware(3, nil))
+
+		input := io.NopCloser(bytes.NewBufferString(testData))
+
+		output, errCh := retryingClient.Compress(testutil.ContextWithDeadline(t), input)
+
+		if _, err := io.ReadAll(output); err == nil {
+			t.Fatalf("Expected reading output to fail")
+		}
+
+		if err := <-errCh; err == nil {
+			t.Fatalf("Expected compression error")
+		}
+	})
+}
+
+func Test_Registry(t *testing.T) {
+	t.Parallel()
+
+	const customFormat = "custom"
+
+	newRegistry := func() *compressor.Registry {
+		registry := compressor.NewRegistry()
+
+		registry.Register(customFormat, func() compressor.Config {
+			config := compressor.NoopConfig()
+			config.Format = customFormat
+
+			return config
+		})
+
+		return registry
+	}
+
+	t.Run("creates_client_for_registered_format", func(t *testing.T) {
+		t.Parallel()
+
+		client, err := newRegistry().NewClientForFormat(customFormat)
+		if err != nil {
+			t.Fatalf("Unexpected error creating client: %v", err)
+		}
+
+		if format := clientFormat(t, client); format != customFormat {
+			t.Fatalf("Expected format %q, got %q", customFormat, format)
+		}
+
+		output, errCh := client.Compress(testutil.ContextWithDeadline(t), io.NopCloser(strings.NewReader(testData)))
+
+		compressed, err := io.ReadAll(output)
+		if err != nil {
+			t.Fatalf("Unexpected error reading compressed data: %v", err)
+		}
+
+		if err := <-errCh; err != nil {
+			t.Fatalf("Unexpected compression error: %v", err)
+		}
+
+		if string(compressed) != testData {
+			t.Fatalf("Expected custom format to pass data through, got %q", string(compressed))
+		}
+	})
+
+	t.Run("returns_error_for_unknown_format", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := newRegistry().NewClientForFormat(string(compressor.FormatGzip))
+
+		var formatErr *compressor.UnknownFormatError
+
+		if !errors.As(err, &formatErr) {
+			t.Fatalf("Expected error to be %T, got %v", formatErr, err)
+		}
+	})
+
+	t.Run("lists_registered_formats", func(t *testing.T) {
+		t.Parallel()
+
+		expectedFormats := []compressor.Format{customFormat}
+
+		if formats := newRegistry().Formats(); !reflect.DeepEqual(formats, expectedFormats) {
+			t.Fatalf("Expected formats %v, got %v", expectedFormats, formats)
+		}
+	})
+
+	t.Run("panics_when_format_is_registered_twice", func(t *testing.T) {
+		t.Parallel()
+
+		defer func() {
+			if recover() == nil {
+				t.Fatalf("Expected registering format twice to panic")
+			}
+		}()
+
+		newRegistry().Register(customFormat, compressor.NoopConfig)
+	})
+
+	t.Run("has_built_in_formats_registered_by_default", func(t *testing.T) {
+		t.Parallel()
+
+		for _, format := range []compressor.Format{compressor.FormatGzip, compressor.FormatNoop} {
+			if _, err := compressor.DefaultRegistry.NewClientForFormat(string(format)); err != nil {
+				t.Fatalf("Unexpected error creating client for format %q: %v", format, err)
+			}
+		}
+	})
+}
+
+func Test_Client_reports_configured_format(t *testing.T) {
+	t.Parallel()
+
+	for config, expectedFormat := range map[compressor.Format]compressor.Format{
+		"":                    compressor.FormatGzip,
+		compressor.FormatGzip: compressor.FormatGzip,
+		compressor.FormatNoop: compressor.FormatNoop,
+	} {
+		client, err := compressor.NewClient(compressor.Config{Format: config})
+		if err != nil {
+			t.Fatalf("Unexpected error creating client: %v", err)
+		}
+
+		if format := clientFormat(t, client); format != expectedFormat {
+			t.Fatalf("Expected client configured with %q to report format %q, got %q", config, expectedFormat, format)
+		}
+	}
+}
+
+//nolint:funlen // Just many test cases.
+func Test_Creating_compressor_returns_error_when(t *testing.T) {
+	t.Parallel()
+
+	t.Run("unknown_compression_format_is_requested", func(t *testing.T) {
+		t.Parallel()
+
+		badFormat := "badFormat"
+
+		config := compressor.Config{
+			Format: compressor.Format(badFormat),
+		}
+
+		client, err := compressor.NewClient(config)
+		if err == nil {
+			t.Fatalf("Expected client creating error")
+		}
+
+		var formatErr *compressor.UnknownFormatError
+
+		if !errors.As(err, &formatErr) {
+			t.Fatalf("Expected error to be %T, got %v", formatErr, err)
+		}
+
+		if formatErr.Format != badFormat {
+			t.Fatalf("Expected error to report format %q, got %q", badFormat, formatErr.Format)
+		}
+
+		if client != nil {
+			t.Fatalf("When creating client returns error, no client should be returned")
+		}
+	})
+
+	t.Run("multiple_configs_are_passed", func(t *testing.T) {
+		t.Parallel()
+
+		c, err := compressor.NewClient(compressor.Config{}, compressor.Config{})
+		if err == nil {
+			t.Fatalf("Expected client creating error")
+		}
+
+		var validationErr *compressor.ConfigValidationError
+
+		if !errors.As(err, &validationErr) {
+			t.Fatalf("Expected error to be %T, got %v", validationErr, err)
+		}
+
+		if c != nil {
+			t.Fatalf("When creating client returns error, no client should be returned")
+		}
+	})
+
+	t.Run("compressor_is_configured_without_decompressor", func(t *testing.T) {
+		t.Parallel()
+
+		config := compressor.Config{
+			Compressor: nopCompressor,
+		}
+
+		c, err := compressor.NewClient(config)
+		if err == nil {
+			t.Fatalf("Expected client creating error")
+		}
+
+		if c != nil {
+			t.Fatalf("When creating client returns error, no client should be returned")
+		}
+	})
+
+	t.Run("pool_is_created_without_workers", func(t *testing.T) {
+		t.Parallel()
+
+		if _, err := compressor.NewPool(0); err == nil {
+			t.Fatalf("Expected pool creating error")
+		}
+	})
+
+	t.Run("pool_is_created_with_invalid_configuration", func(t *testing.T) {
+		t.Parallel()
+
+		if _, err := compressor.NewPool(1, compressor.Config{Format: "badFormat"}); err == nil {
+			t.Fatalf("Expected pool creating error")
+		}
+	})
+
+	t.Run("max_output_bytes_is_negative", func(t *testing.T) {
+		t.Parallel()
+
+		c, err := compressor.NewClient(compressor.Config{MaxOutputBytes: -1})
+		if err == nil {
+			t.Fatalf("Expected client creating error")
+		}
+
+		var validationErr *compressor.ConfigValidationError
+
+		if !errors.As(err, &validationErr) {
+			t.Fatalf("Expected error to be %T, got %v", validationErr, err)
+		}
+
+		if c != nil {
+			t.Fatalf("When creating client returns error, no client should be returned")
+		}
+	})
+
+	t.Run("max_retries_is_negative", func(t *testing.T) {
+		t.Parallel()
+
+		c, err := compressor.NewClient(compressor.Config{MaxRetries: -1})
+		if err == nil {
+			t.Fatalf("Expected client creating error")
+		}
+
+		if c != nil {
+			t.Fatalf("When creating client returns error, no client should be returned")
+		}
+	})
+
+	t.Run("pipe_buffer_size_is_negative", func(t *testing.T) {
+		t.Parallel()
+
+		c, err := compressor.NewClient(compressor.Config{PipeBufferSize: -1})
+		if err == nil {
+			t.Fatalf("Expected client creating error")
+		}
+
+		if c != nil {
+			t.Fatalf("When creating client returns error, no client should be returned")
+		}
+	})
+
+	t.Run("chunk_size_is_negative", func(t *testing.T) {
+		t.Parallel()
+
+		c, err := compressor.NewClient(compressor.Config{ChunkSize: -1})
+		if err == nil {
+			t.Fatalf("Expected client creating error")
+		}
+
+		if c != nil {
+			t.Fatalf("When creating client returns error, no client should be returned")
+		}
+	})
+
+	t.Run("unknown_checksum_algorithm_is_requested", func(t *testing.T) {
+		t.Parallel()
+
+		c, err := compressor.NewClient(compressor.Config{Checksum: "crc"})
+		if err == nil {
+			t.Fatalf("Expected client creating error")
+		}
+
+		if c != nil {
+			t.Fatalf("When creating client returns error, no client should be returned")
+		}
+	})
+
+	t.Run("expected_checksum_is_configured_without_checksum_algorithm", func(t *testing.T) {
+		t.Parallel()
+
+		c, err := compressor.NewClient(compressor.Config{ExpectedChecksum: "foo"})
+		if err == nil {
+			t.Fatalf("Expected client creating error")
+		}
+
+		if c != nil {
+			t.Fatalf("When creating client returns error, no client should be returned")
+		}
+	})
+
+	t.Run("compression_level_is_invalid", func(t *testing.T) {
+		t.Parallel()
+
+		c, err := compressor.NewClientWithOptions(compressor.WithLevel(gzip.BestCompression + 1))
+		if err == nil {
+			t.Fatalf("Expected client creating error")
+		}
+
+		if c != nil {
+			t.Fatalf("When creating client returns error, no client should be returned")
+		}
+	})
+
+	t.Run("compression_level_is_set_for_format_other_than_gzip", func(t *testing.T) {
+		t.Parallel()
+
+		c, err := compressor.NewClientWithOptions(
+			compressor.WithFormat(compressor.FormatNoop), compressor.WithLevel(gzip.BestSpeed),
+		)
+		if err == nil {
+			t.Fatalf("Expected client creating error")
+		}
+
+		if c != nil {
+			t.Fatalf("When creating client returns error, no client should be returned")
+		}
+	})
+
+	t.Run("compression_level_is_set_with_custom_compressor", func(t *testing.T) {
+		t.Parallel()
+
+		c, err := compressor.NewClientWithOptions(
+			compressor.WithCompressor(nopCompressor),
+			compressor.WithDecompressor(nopDecompressor),
+			compressor.WithLevel(gzip.BestSpeed),
+		)
+		if err == nil {
+			t.Fatalf("Expected client creating error")
+		}
+
+		if c != nil {
+			t.Fatalf("When creating client returns error, no client should be returned")
+		}
+	})
+
+	t.Run("decompressor_is_configured_without_compressor", func(t *testing.T) {
+		t.Parallel()
+
+		config := compressor.Config{
+			Decompressor: nopDecompressor,
+		}
+
+		c, err := compressor.NewClient(config)
+		if err == nil {
+			t.Fatalf("Expected client creating error")
+		}
+
+		if c != nil {
+			t.Fatalf("When creating client returns error, no client should be returned")
+		}
+	})
+}
+
+func Test_Creating_compressor_with_options_applies_given_options(t *testing.T) {
+	t.Parallel()
+
+	for name, opts := range map[string][]compressor.Option{
+		"by_default":       nil,
+		"with_format":      {compressor.WithFormat(compressor.FormatNoop)},
+		"with_level":       {compressor.WithLevel(gzip.BestSpeed)},
+		"with_config":      {compressor.WithConfig(compressor.Config{Format: compressor.FormatNoop})},
+		"with_compressors": {compressor.WithCompressor(nopCompressor), compressor.WithDecompressor(nopDecompressor)},
+	} {
+		opts := opts
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			client, err := compressor.NewClientWithOptions(opts...)
+			if err != nil {
+				t.Fatalf("Unexpected error creating client: %v", err)
+			}
+
+			ctx := testutil.ContextWithDeadline(t)
+
+			data := "foo"
+
+			compressed, compressErrCh := client.Compress(ctx, io.NopCloser(strings.NewReader(data)))
+			decompressed, decompressErrCh := client.Decompress(ctx, compressed)
+
+			decompressedData, err := io.ReadAll(decompressed)
+			if err != nil {
+				t.Fatalf("Reading decompressed data: %v", err)
+			}
+
+			if err := <-compressErrCh; err != nil {
+				t.Fatalf("Unexpected compression error: %v", err)
+			}
+
+			if err := <-decompressErrCh; err != nil {
+				t.Fatalf("Unexpected decompression error: %v", err)
+			}
+
+			if string(decompressedData) != data {
+				t.Fatalf("Expected decompressed data %q, got %q", data, decompressedData)
+			}
+		})
+	}
+}
+
+func Test_Compressor_uses_configured_compressor_and_decompressor(t *testing.T) {
+	t.Parallel()
+
+	client, err := compressor.NewClient(compressor.Config{
+		Compressor:   testutil.FakeCompressor,
+		Decompressor: testutil.FakeDecompressor,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error creating client: %v", err)
+	}
+
+	ctx := testutil.ContextWithDeadline(t)
+
+	compressedData, compressErrCh := client.Compress(ctx, io.NopCloser(strings.NewReader(testData)))
+
+	compressed, err := io.ReadAll(compressedData)
+	if err != nil {
+		t.Fatalf("Unexpected error reading compressed data: %v", err)
+	}
+
+	if err := <-compressErrCh; err != nil {
+		t.Fatalf("Unexpected compression error: %v", err)
+	}
+
+	if expected := string([]byte{testutil.FakeHeader}) + testData; string(compressed) != expected {
+		t.Fatalf("Expected compressed data %q, got %q", expected, compressed)
+	}
+
+	decompressedData, decompressErrCh := client.Decompress(ctx, io.NopCloser(bytes.NewReader(compressed)))
+
+	decompressed, err := io.ReadAll(decompressedData)
+	if err != nil {
+		t.Fatalf("Unexpected error reading decompressed data: %v", err)
+	}
+
+	if err := <-decompressErrCh; err != nil {
+		t.Fatalf("Unexpected decompression error: %v", err)
+	}
+
+	if string(decompressed) != testData {
+		t.Fatalf("Expected decompressed data %q, got %q", testData, decompressed)
+	}
+}
+
+func Test_Compressor_compresses_data_using_configured_level(t *testing.T) {
+	t.Parallel()
+
+	data := strings.Repeat("foo bar baz ", 1024)
+
+	sizes := map[int]int{}
+
+	for _, level := range []int{gzip.NoCompression, gzip.HuffmanOnly, gzip.BestCompression} {
+		client, err := compressor.NewClientWithOptions(compressor.WithLevel(level))
+		if err != nil {
+			t.Fatalf("Unexpected error creating client: %v", err)
+		}
+
+		output, errCh := client.Compress(testutil.ContextWithDeadline(t), io.NopCloser(strings.NewReader(data)))
+
+		compressed, err := io.ReadAll(output)
+		if err != nil {
+			t.Fatalf("Reading compressed data: %v", err)
+		}
+
+		if err := <-errCh; err != nil {
+			t.Fatalf("Unexpected compression error: %v", err)
+		}
+
+		sizes[level] = len(compressed)
+	}
+
+	if sizes[gzip.BestCompression] >= sizes[gzip.HuffmanOnly] {
+		t.Fatalf("Expected best compression to produce less data than Huffman only, got %v", sizes)
+	}
+
+	if sizes[gzip.NoCompression] <= len(data) {
+		t.Fatalf("Expected no compression to produce more data than input of %d bytes, got %v", len(data), sizes)
+	}
+}
+
+func Test_Compressor_buffers_processed_data_until_it_is_read(t *testing.T) {
+	t.Parallel()
+
+	client, err := compressor.NewClientWithOptions(compressor.WithFormat(compressor.FormatNoop))
+	if err != nil {
+		t.Fatalf("Unexpected error creating client: %v", err)
+	}
+
+	output, errCh := client.Compress(testutil.ContextWithDeadline(t), io.NopCloser(strings.NewReader(testData)))
+
+	// Processing is able to finish without waiting for the reader, as data fits into the buffer.
+	select {
+	case err := <-errCh:
+		if err != nil {
+			t.Fatalf("Unexpected compression error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for compression to finish before reading the output")
+	}
+
+	data, err := io.ReadAll(output)
+	if err != nil {
+		t.Fatalf("Unexpected error reading compressed data: %v", err)
+	}
+
+	if string(data) != testData {
+		t.Fatalf("Expected output %q, got %q", testData, string(data))
+	}
+}
+
+func Test_Compressor_with_pipe_buffer_smaller_than_processed_data_produces_valid_data(t *testing.T) {
+	t.Parallel()
+
+	client, err := compressor.NewClientWithOptions(compressor.WithPipeBufferSize(1))
+	if err != nil {
+		t.Fatalf("Unexpected error creating client: %v", err)
+	}
+
+	ctx := testutil.ContextWithDeadline(t)
+	input := strings.Repeat(testData, 100)
+
+	compressed, compressErrCh := client.Compress(ctx, io.NopCloser(strings.NewReader(input)))
+	decompressed, decompressErrCh := client.Decompress(ctx, compressed)
+
+	data, err := io.ReadAll(decompressed)
+	if err != nil {
+		t.Fatalf("Unexpected error reading decompressed data: %v", err)
+	}
+
+	if err := <-compressErrCh; err != nil {
+		t.Fatalf("Unexpected compression error: %v", err)
+	}
+
+	if err := <-decompressErrCh; err != nil {
+		t.Fatalf("Unexpected decompression error: %v", err)
+	}
+
+	if string(data) != input {
+		t.Fatalf("Expected output of %d bytes, got %d bytes", len(input), len(data))
+	}
+}
+
+func Test_ContextPipe(t *testing.T) {
+	t.Parallel()
+
+	t.Run("passes_written_data_to_reader", func(t *testing.T) {
+		t.Parallel()
+
+		reader, writer := compressor.ContextPipe(testutil.ContextWithDeadline(t))
+
+		go func() {
+			//nolint:errcheck // Reader side verifies the data.
+			writer.Write([]byte(testData))
+
+			//nolint:errcheck // Closing pipe always returns nil.
+			writer.Close()
+		}()
+
+		data, err := io.ReadAll(reader)
+		if err != nil {
+			t.Fatalf("Unexpected error reading data: %v", err)
+		}
+
+		if string(data) != testData {
+			t.Fatalf("Expected data %q, got %q", testData, string(data))
+		}
+	})
+
+	t.Run("returns_context_error_from_blocked_read_once_context_is_done", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithCancel(testutil.ContextWithDeadline(t))
+
+		reader, _ := compressor.ContextPipe(ctx)
+
+		time.AfterFunc(10*time.Millisecond, cancel)
+
+		if _, err := reader.Read(make([]byte, 1)); !errors.Is(err, context.Canceled) {
+			t.Fatalf("Expected error %v, got %v", context.Canceled, err)
+		}
+	})
+
+	t.Run("returns_context_error_from_blocked_write_once_context_is_done", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithCancel(testutil.ContextWithDeadline(t))
+
+		_, writer := compressor.ContextPipe(ctx)
+
+		time.AfterFunc(10*time.Millisecond, cancel)
+
+		// Write blocks only once the buffer is full.
+		if _, err := writer.Write(make([]byte, compressor.DefaultPipeBufferSize+1)); !errors.Is(err, context.Canceled) {
+			t.Fatalf("Expected error %v, got %v", context.Canceled, err)
+		}
+	})
+
+	t.Run("returns_error_given_when_closing_writer_to_reader", func(t *testing.T) {
+		t.Parallel()
+
+		reader, writer := compressor.ContextPipe(testutil.ContextWithDeadline(t))
+
+		//nolint:errcheck // Closing pipe always returns nil.
+		writer.CloseWithError(errTransient)
+
+		if _, err := reader.Read(make([]byte, 1)); !errors.Is(err, errTransient) {
+			t.Fatalf("Expected error %v, got %v", errTransient, err)
+		}
+	})
+}
+
+func Test_Compressor_with_small_chunk_size_produces_valid_data(t *testing.T) {
+	t.Parallel()
+
+	client, err := compressor.NewClientWithOptions(compressor.WithChunkSize(1))
+	if err != nil {
+		t.Fatalf("Unexpected error creating client: %v", err)
+	}
+
+	ctx := testutil.ContextWithDeadline(t)
+
+	compressed, compressErrCh := client.Compress(ctx, io.NopCloser(strings.NewReader(testData)))
+	decompressed, decompressErrCh := client.Decompress(ctx, compressed)
+
+	data, err := io.ReadAll(decompressed)
+	if err != nil {
+		t.Fatalf("Unexpected error reading decompressed data: %v", err)
+	}
+
+	if err := <-compressErrCh; err != nil {
+		t.Fatalf("Unexpected compression error: %v", err)
+	}
+
+	if err := <-decompressErrCh; err != nil {
+		t.Fatalf("Unexpected decompression error: %v", err)
+	}
+
+	if string(data) != testData {
+		t.Fatalf("Expected output %q, got %q", testData, string(data))
+	}
+}
+
+// testInfiniteReader produces data forever, simulating large input.
+type testInfiniteReader struct{}
+
+func (testInfiniteReader) Read(b []byte) (int, error) {
+	for i := range b {
+		b[i] = byte(i)
+	}
+
+	return len(b), nil
+}
+
+// testFailingWriter fails every write with errTransient.
+type testFailingWriter struct{}
+
+func (*testFailingWriter) Write([]byte) (int, error) {
+	return 0, errTransient
+}
+
+// cancellingReader cancels given context once data is read from it.
+type cancellingReader struct {
+	io.Reader
+
+	cancel context.CancelFunc
+}
+
+func (c *cancellingReader) Read(b []byte) (int, error) {
+	c.cancel()
+
+	return c.Reader.Read(b)
+}
+
+func Test_StreamCopy(t *testing.T) {
+	t.Parallel()
+
+	t.Run("copies_all_data_from_reader_to_writer", func(t *testing.T) {
+		t.Parallel()
+
+		input := strings.Repeat(testData, 10000)
+		output := &bytes.Buffer{}
+
+		written, err := compressor.StreamCopy(testutil.ContextWithDeadline(t), output, strings.NewReader(input))
+		if err != nil {
+			t.Fatalf("Unexpected error copying data: %v", err)
+		}
+
+		if written != int64(len(input)) {
+			t.Fatalf("Expected %d bytes to be written, got %d", len(input), written)
+		}
+
+		if output.String() != input {
+			t.Fatalf("Expected output of %d bytes, got %d bytes", len(input), output.Len())
+		}
+	})
+
+	t.Run("stops_copying_once_context_is_done", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithCancel(testutil.ContextWithDeadline(t))
+
+		input := &cancellingReader{Reader: testInfiniteReader{}, cancel: cancel}
+
+		written, err := compressor.StreamCopy(ctx, io.Discard, input)
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("Expected error %v, got %v", context.Canceled, err)
+		}
+
+		if written == 0 {
+			t.Fatalf("Expected chunk read before cancellation to be written")
+		}
+	})
+
+	t.Run("returns_error_from_writer", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := compressor.StreamCopy(testutil.ContextWithDeadline(t), &testFailingWriter{},
+			strings.NewReader(testData))
+		if !errors.Is(err, errTransient) {
+			t.Fatalf("Expected error %v, got %v", errTransient, err)
+		}
+	})
+}
+
+//nolint:paralleltest // Goroutines are counted for the whole process.
+func Test_Compressor_stops_all_goroutines_when_context_is_cancelled_during_compression(t *testing.T) {
+	testutil.RequireNoGoroutineLeak(t)
+
+	client, err := compressor.NewClient()
+	if err != nil {
+		t.Fatalf("Unexpected error creating client: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(testutil.ContextWithDeadline(t))
+	defer cancel()
+
+	output, errCh := client.Compress(ctx, io.NopCloser(testInfiniteReader{}))
+
+	// Ensure compression is in progress before cancelling it.
+	if _, err := io.CopyN(io.Discard, output, 1024); err != nil {
+		t.Fatalf("Unexpected error reading compressed data: %v", err)
+	}
+
+	cancel()
+
+	if err := <-errCh; !errors.Is(err, compressor.ErrCanceled) {
+		t.Fatalf("Expected error %v, got %v", compressor.ErrCanceled, err)
+	}
+
+	if err := output.Close(); err != nil {
+		t.Fatalf("Unexpected error closing compressed data reader: %v", err)
+	}
+}
+
+//nolint:staticcheck // Passing nil context is intended.
+func Test_Compressor_uses_configured_default_context_when_nil_context_is_given(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(testutil.ContextWithDeadline(t))
+	cancel()
+
+	client, err := compressor.NewClientWithOptions(compressor.WithContext(ctx))
+	if err != nil {
+		t.Fatalf("Unexpected error creating client: %v", err)
+	}
+
+	output, errCh := client.Compress(nil, io.NopCloser(strings.NewReader("foo")))
+
+	if _, err := io.ReadAll(output); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected reading output to fail with %v, got %v", context.Canceled, err)
+	}
+
+	if err := <-errCh; !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected compression to fail with %v, got %v", context.Canceled, err)
+	}
+}
+
+func Test_Compressor_wraps_context_errors_with_canceled_error(t *testing.T) {
+	t.Parallel()
+
+	client, err := compressor.NewClient()
+	if err != nil {
+		t.Fatalf("Unexpected error creating client: %v", err)
+	}
+
+	for name, cancelErr := range map[string]error{
+		"canceled":          context.Canceled,
+		"deadline_exceeded": context.DeadlineExceeded,
+	} {
+		cancelErr := cancelErr
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithCancel(testutil.ContextWithDeadline(t))
+			if errors.Is(cancelErr, context.DeadlineExceeded) {
+				ctx, cancel = context.WithDeadline(ctx, time.Now())
+			}
+
+			cancel()
+
+			_, errCh := client.Compress(ctx, io.NopCloser(strings.NewReader("foo")))
+
+			err := <-errCh
+			if !errors.Is(err, compressor.ErrCanceled) {
+				t.Fatalf("Expected error %v, got %v", compressor.ErrCanceled, err)
+			}
+
+			if !errors.Is(err, cancelErr) {
+				t.Fatalf("Expected error to still wrap %v, got %v", cancelErr, err)
+			}
+		})
+	}
+}
+
+//nolint:staticcheck // Passing nil context is intended.
+func Test_Compressor_uses_background_context_when_nil_context_is_given_and_no_default_is_configured(t *testing.T) {
+	t.Parallel()
+
+	client, err := compressor.NewClient()
+	if err != nil {
+		t.Fatalf("Unexpected error creating client: %v", err)
+	}
+
+	compressed, compressErrCh := client.Compress(nil, io.NopCloser(strings.NewReader("foo")))
+	decompressed, decompressErrCh := client.Decompress(nil, compressed)
+
+	if _, err := io.ReadAll(decompressed); err != nil {
+		t.Fatalf("Unexpected error reading decompressed data: %v", err)
+	}
+
+	if err := <-compressErrCh; err != nil {
+		t.Fatalf("Unexpected compression error: %v", err)
+	}
+
+	if err := <-decompressErrCh; err != nil {
+		t.Fatalf("Unexpected decompression error: %v", err)
+	}
+}
+
+func Test_Closing_output_reader_stops_processing_and_closes_error_channel(t *testing.T) {
+	t.Parallel()
+
+	client, err := compressor.NewClient()
+	if err != nil {
+		t.Fatalf("Unexpected error creating client: %v", err)
+	}
+
+	ctx := testutil.ContextWithDeadline(t)
+
+	for name, process := range map[string]func() (io.ReadCloser, chan error){
+		"when_compressing": func() (io.ReadCloser, chan error) {
+			return client.Compress(ctx, io.NopCloser(rand.New(rand.NewSource(1)))) //nolint:gosec // Just for testing.
+		},
+		"when_decompressing": func() (io.ReadCloser, chan error) {
+			compressed, _ := client.Compress(ctx, io.NopCloser(rand.New(rand.NewSource(1)))) //nolint:gosec // Just for testing.
+
+			// Stop compression as well once test finishes.
+			t.Cleanup(func() {
+				//nolint:errcheck // Closing pipe always returns nil.
+				compressed.Close()
+			})
+
+			return client.Decompress(ctx, compressed)
+		},
+	} {
+		output, errCh := process()
+
+		if _, err := io.ReadFull(output, make([]byte, 1024)); err != nil {
+			t.Fatalf("Reading output %s: %v", name, err)
+		}
+
+		if err := output.Close(); err != nil {
+			t.Fatalf("Unexpected error closing output %s: %v", name, err)
+		}
+
+		if err := <-errCh; err == nil {
+			t.Fatalf("Expected processing to be stopped with error %s", name)
+		}
+
+		if _, ok := <-errCh; ok {
+			t.Fatalf("Expected error channel to be closed %s", name)
+		}
+	}
+}
+
+func Test_Compressing_with_flush_interval_produces_partial_output_before_input_is_exhausted(t *testing.T) {
+	t.Parallel()
+
+	client, err := compressor.NewClient()
+	if err != nil {
+		t.Fatalf("Unexpected error creating client: %v", err)
+	}
+
+	flushableClient, ok := client.(compressor.FlushableClient)
+	if !ok {
+		t.Fatalf("Expected client to implement FlushableClient")
+	}
+
+	inputReader, inputWriter := io.Pipe()
+
+	output, errCh := flushableClient.CompressFlush(testutil.ContextWithDeadline(t), inputReader, 3)
+
+	go func() {
+		// Input is not closed until partial data is read.
+		//
+		//nolint:errcheck // Failed write will be detected by the reader.
+		inputWriter.Write([]byte("foo"))
+	}()
+
+	reader, err := gzip.NewReader(output)
+	if err != nil {
+		t.Fatalf("Failed creating gzip reader: %v", err)
+	}
+
+	partialData := make([]byte, 3)
+
+	if _, err := io.ReadFull(reader, partialData); err != nil {
+		t.Fatalf("Reading partial data: %v", err)
+	}
+
+	if string(partialData) != "foo" {
+		t.Fatalf("Expected partial data %q, got %q", "foo", partialData)
+	}
+
+	if err := inputWriter.Close(); err != nil {
+		t.Fatalf("Closing input: %v", err)
+	}
+
+	if _, err := io.ReadAll(reader); err != nil {
+		t.Fatalf("Reading remaining data: %v", err)
+	}
+
+	if err := <-errCh; err != nil {
+		t.Fatalf("Unexpected compression error: %v", err)
+	}
+}
+
+func Test_Compressor_copies_consumed_input_to_configured_tee_writer(t *testing.T) {
+	t.Parallel()
+
+	data := "foo bar baz"
+
+	for name, compress := range map[string]func(compressor.Client, io.Reader) (io.Reader, chan error){
+		"when_compressing": func(c compressor.Client, input io.Reader) (io.Reader, chan error) {
+			return c.Compress(testutil.ContextWithDeadline(t), io.NopCloser(input))
+		},
+		"when_compressing_blocks": func(c compressor.Client, input io.Reader) (io.Reader, chan error) {
+			return asBlockClient(t, c).CompressBlocks(testutil.ContextWithDeadline(t), io.NopCloser(input), 4, 2)
+		},
+	} {
+		tee := &bytes.Buffer{}
+
+		client, err := compressor.NewClientWithOptions(compressor.WithTeeWriter(tee))
+		if err != nil {
+			t.Fatalf("Unexpected error creating client: %v", err)
+		}
+
+		output, errCh := compress(client, strings.NewReader(data))
+
+		if _, err := io.ReadAll(output); err != nil {
+			t.Fatalf("Reading compressed data %s: %v", name, err)
+		}
+
+		if err := <-errCh; err != nil {
+			t.Fatalf("Unexpected compression error %s: %v", name, err)
+		}
+
+		if tee.String() != data {
+			t.Fatalf("Expected tee writer to receive %q %s, got %q", data, name, tee.String())
+		}
+	}
+}
+
+func Test_Format_is_valid_only_when_it_is_one_of_available_formats(t *testing.T) {
+	t.Parallel()
+
+	for _, format := range compressor.AvailableFormats() {
+		if !format.IsValid() {
+			t.Fatalf("Expected format %q to be valid", format)
+		}
+	}
+
+	for _, format := range []compressor.Format{"", "GZIP", "badFormat"} {
+		if format.IsValid() {
+			t.Fatalf("Expected format %q to be invalid", format)
+		}
+	}
+}
+
+func Test_Parsing_format(t *testing.T) {
+	t.Parallel()
+
+	t.Run("returns_canonical_format_for_known_names", func(t *testing.T) {
+		t.Parallel()
+
+		for name, expectedFormat := range map[string]compressor.Format{
+			"gzip":    compressor.FormatGzip,
+			" GZip\n": compressor.FormatGzip,
+			"NOOP":    compressor.FormatNoop,
+		} {
+			format, err := compressor.ParseFormat(name)
+			if err != nil {
+				t.Fatalf("Unexpected error parsing format %q: %v", name, err)
+			}
+
+			if format != expectedFormat {
+				t.Fatalf("Expected format %q for name %q, got %q", expectedFormat, name, format)
+			}
+		}
+	})
+
+	t.Run("returns_error_for_unknown_names", func(t *testing.T) {
+		t.Parallel()
+
+		for _, name := range []string{"", "badFormat"} {
+			if _, err := compressor.ParseFormat(name); err == nil {
+				t.Fatalf("Expected error parsing format %q", name)
+			}
+		}
+	})
+}
+
+func Test_Format_can_be_encoded_and_decoded_as_text(t *testing.T) {
+	t.Parallel()
+
+	type config struct {
+		Format compressor.Format `json:"format"`
+	}
+
+	encoded, err := json.Marshal(config{Format: compressor.FormatNoop})
+	if err != nil {
+		t.Fatalf("Unexpected error encoding format: %v", err)
+	}
+
+	expectedEncoded := `{"format":"noop"}`
+
+	if string(encoded) != expectedEncoded {
+		t.Fatalf("Expected encoded format %s, got %s", expectedEncoded, encoded)
+	}
+
+	decoded := config{}
+
+	if err := json.Unmarshal([]byte(`{"format":"GZIP"}`), &decoded); err != nil {
+		t.Fatalf("Unexpected error decoding format: %v", err)
+	}
+
+	if decoded.Format != compressor.FormatGzip {
+		t.Fatalf("Expected decoded format %q, got %q", compressor.FormatGzip, decoded.Format)
+	}
+
+	if err := json.Unmarshal([]byte(`{"format":"badFormat"}`), &decoded); err == nil {
+		t.Fatalf("Expected error decoding unknown format")
+	}
+}
+
+func Test_Compressor_supports_all_available_formats(t *testing.T) {
+	t.Parallel()
+
+	for _, format := range compressor.AvailableFormats() {
+		config := compressor.Config{
+			Format: format,
+		}
+
+		if _, err := compressor.NewClient(config); err != nil {
+			t.Fatalf("Unexpected error creating client: %v", err)
+		}
+	}
+}
+
+func Test_Compressor_use_gzip_format_for_decompressor_by_default(t *testing.T) {
+	t.Parallel()
+
+	client, err := compressor.NewClient()
+	if err != nil {
+		t.Fatalf("Unexpected error creating client: %v", err)
+	}
+
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+
+	if _, err := writer.Write([]byte(testData)); err != nil {
+		t.Fatalf("Failed writing data to compress: %v", err)
+	}
+
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Failed closing writer: %v", err)
+	}
+
+	reader, errCh := client.Decompress(testutil.ContextWithDeadline(t), io.NopCloser(&buf))
+
+	decompressedData, err := io.ReadAll(reader)
+	if err != nil {
+		t.Errorf("Failed decompressing data: %v", err)
+	}
+
+	if err := <-errCh; err != nil {
+		t.Fatalf("Unexpected compression error: %v", err)
+	}
+
+	if string(decompressedData) != testData {
+		t.Fatalf("Expected decompressed data to be %q, got %q", testData, string(decompressedData))
+	}
+}
+
+func Test_Decompressing_data_within_configured_max_output_bytes_restores_original_data(t *testing.T) {
+	t.Parallel()
+
+	config := compressor.Config{
+		Format:         compressor.FormatNoop,
+		MaxOutputBytes: int64(len(testData)),
+	}
+
+	client, err := compressor.NewClient(config)
+	if err != nil {
+		t.Fatalf("Unexpected error creating client: %v", err)
+	}
+
+	reader, errCh := client.Decompress(testutil.ContextWithDeadline(t), io.NopCloser(bytes.NewBufferString(testData)))
+
+	decompressedData, err := io.ReadAll(reader)
+	if err != nil {
+		t.Errorf("Failed decompressing data: %v", err)
+	}
+
+	if err := <-errCh; err != nil {
+		t.Fatalf("Unexpected decompression error: %v", err)
+	}
+
+	if string(decompressedData) != testData {
+		t.Fatalf("Expected decompressed data to be %q, got %q", testData, string(decompressedData))
+	}
+}
+
+func Test_Compressor_reports_checksum_of_uncompressed_data_using_configured_algorithm(t *testing.T) {
+	t.Parallel()
+
+	sha256Sum := sha256.Sum256([]byte(testData))
+	md5Sum := md5.Sum([]byte(testData)) //nolint:gosec // Just for testing.
+
+	for algorithm, expectedChecksum := range map[compressor.ChecksumAlgorithm]string{
+		compressor.ChecksumSHA256: hex.EncodeToString(sha256Sum[:]),
+		compressor.ChecksumMD5:    hex.EncodeToString(md5Sum[:]),
+	} {
+		algorithm := algorithm
+		expectedChecksum := expectedChecksum
+
+		t.Run(string(algorithm), func(t *testing.T) {
+			t.Parallel()
+
+			checksums := make(chan string, 2)
+
+			client, err := compressor.NewClient(compressor.Config{
+				Checksum: algorithm,
+				ChecksumHandler: func(checksum string) {
+					checksums <- checksum
+				},
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error creating client: %v", err)
+			}
+
+			ctx := testutil.ContextWithDeadline(t)
+
+			compressedData, compressErrCh := client.Compress(ctx, io.NopCloser(bytes.NewBufferString(testData)))
+
+			reader, decompressErrCh := client.Decompress(ctx, compressedData)
+
+			if _, err := io.ReadAll(reader); err != nil {
+				t.Fatalf("Failed decompressing data: %v", err)
+			}
+
+			if err := <-compressErrCh; err != nil {
+				t.Fatalf("Unexpected compression error: %v", err)
+			}
+
+			if err := <-decompressErrCh; err != nil {
+				t.Fatalf("Unexpected decompression error: %v", err)
+			}
+
+			for _, action := range []string{"compression", "decompression"} {
+				if checksum := <-checksums; checksum != expectedChecksum {
+					t.Fatalf("Expected %s checksum %q, got %q", action, expectedChecksum, checksum)
+				}
+			}
+		})
+	}
+}
+
+func Test_Decompressing_data_with_expected_checksum_restores_original_data(t *testing.T) {
+	t.Parallel()
+
+	sum := sha256.Sum256([]byte(testData))
+
+	for name, expectedChecksum := range map[string]string{
+		"in_lower_case": hex.EncodeToString(sum[:]),
+		"in_upper_case": strings.ToUpper(hex.EncodeToString(sum[:])),
+	} {
+		expectedChecksum := expectedChecksum
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			client, err := compressor.NewClient(compressor.Config{
+				Format:           compressor.FormatNoop,
+				Checksum:         compressor.ChecksumSHA256,
+				ExpectedChecksum: expectedChecksum,
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error creating client: %v", err)
+			}
+
+			reader, errCh := client.Decompress(testutil.ContextWithDeadline(t), io.NopCloser(bytes.NewBufferString(testData)))
+
+			decompressedData, err := io.ReadAll(reader)
+			if err != nil {
+				t.Errorf("Failed decompressing data: %v", err)
+			}
+
+			if err := <-errCh; err != nil {
+				t.Fatalf("Unexpected decompression error: %v", err)
+			}
+
+			if string(decompressedData) != testData {
+				t.Fatalf("Expected decompressed data to be %q, got %q", testData, string(decompressedData))
+			}
+		})
+	}
+}
+
+func Test_Compressor_passes_configured_metadata_through_compressed_data(t *testing.T) {
+	t.Parallel()
+
+	for _, format := range compressor.AvailableFormats() {
+		format := format
+
+		t.Run(string(format), func(t *testing.T) {
+			t.Parallel()
+
+			expectedMetadata := map[string]string{"content-type": "text/plain"}
+			metadataCh := make(chan map[string]string, 1)
+
+			client, err := compressor.NewClient(compressor.Config{
+				Format:   format,
+				Metadata: expectedMetadata,
+				MetadataReader: func(metadata map[string]string) {
+					metadataCh <- metadata
+				},
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error creating client: %v", err)
+			}
+
+			ctx := testutil.ContextWithDeadline(t)
+
+			compressedData, compressErrCh := client.Compress(ctx, io.NopCloser(bytes.NewBufferString(testData)))
+
+			reader, decompressErrCh := client.Decompress(ctx, compressedData)
+
+			decompressedData, err := io.ReadAll(reader)
+			if err != nil {
+				t.Fatalf("Failed decompressing data: %v", err)
+			}
+
+			if err := <-compressErrCh; err != nil {
+				t.Fatalf("Unexpected compression error: %v", err)
+			}
+
+			if err := <-decompressErrCh; err != nil {
+				t.Fatalf("Unexpected decompression error: %v", err)
+			}
+
+			if string(decompressedData) != testData {
+				t.Fatalf("Expected decompressed data to be %q, got %q", testData, string(decompressedData))
+			}
+
+			if metadata := <-metadataCh; !reflect.DeepEqual(metadata, expectedMetadata) {
+				t.Fatalf("Expected metadata %v, got %v", expectedMetadata, metadata)
+			}
+		})
+	}
+}
+
+func Test_Compressor_preserves_original_name_and_modification_time_in_gzip_header(t *testing.T) {
+	t.Parallel()
+
+	expectedName := "foo.txt"
+	expectedModTime := time.Unix(1600000000, 0)
+	headerCh := make(chan gzip.Header, 1)
+
+	client, err := compressor.NewClient(compressor.Config{
+		OriginalName: expectedName,
+		ModTime:      expectedModTime,
+		HeaderReader: func(header gzip.Header) {
+			headerCh <- header
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error creating client: %v", err)
+	}
+
+	ctx := testutil.ContextWithDeadline(t)
+
+	compressedData, compressErrCh := client.Compress(ctx, io.NopCloser(bytes.NewBufferString(testData)))
+
+	reader, decompressErrCh := client.Decompress(ctx, compressedData)
+
+	if _, err := io.ReadAll(reader); err != nil {
+		t.Fatalf("Failed decompressing data: %v", err)
+	}
+
+	if err := <-compressErrCh; err != nil {
+		t.Fatalf("Unexpected compression error: %v", err)
+	}
+
+	if err := <-decompressErrCh; err != nil {
+		t.Fatalf("Unexpected decompression error: %v", err)
+	}
+
+	header := <-headerCh
+
+	if header.Name != expectedName {
+		t.Fatalf("Expected name %q, got %q", expectedName, header.Name)
+	}
+
+	if !header.ModTime.Equal(expectedModTime) {
+		t.Fatalf("Expected modification time %v, got %v", expectedModTime, header.ModTime)
+	}
+}
+
+func Test_Compressor_reports_no_metadata_when_decompressing_gzip_data_without_metadata(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+
+	writer := gzip.NewWriter(&buf)
+
+	if _, err := writer.Write([]byte(testData)); err != nil {
+		t.Fatalf("Failed writing data to compress: %v", err)
+	}
+
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Failed closing writer: %v", err)
+	}
+
+	metadataCh := make(chan map[string]string, 1)
+
+	client, err := compressor.NewClient(compressor.Config{
+		MetadataReader: func(metadata map[string]string) {
+			metadataCh <- metadata
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error creating client: %v", err)
+	}
+
+	reader, errCh := client.Decompress(testutil.ContextWithDeadline(t), io.NopCloser(&buf))
+
+	if _, err := io.ReadAll(reader); err != nil {
+		t.Fatalf("Failed decompressing data: %v", err)
+	}
+
+	if err := <-errCh; err != nil {
+		t.Fatalf("Unexpected decompression error: %v", err)
+	}
+
+	if metadata := <-metadataCh; metadata != nil {
+		t.Fatalf("Expected no metadata, got %v", metadata)
+	}
+}
+
+func Test_Piping_data_through_multiple_stages_compresses_output_of_each_stage_with_the_next_one(t *testing.T) {
+	t.Parallel()
+
+	client, err := compressor.NewClient()
+	if err != nil {
+		t.Fatalf("Unexpected error creating client: %v", err)
+	}
+
+	input := io.NopCloser(bytes.NewBufferString(testData))
+
+	output, errChs := compressor.Pipe(testutil.ContextWithDeadline(t), input, client, client)
+
+	if len(errChs) != 2 {
+		t.Fatalf("Expected error channel for each stage, got %d", len(errChs))
+	}
+
+	data := output
+
+	for i := range errChs {
+		reader, err := gzip.NewReader(data)
+		if err != nil {
+			t.Fatalf("Failed creating gzip reader for stage %d: %v", i, err)
+		}
+
+		data = reader
+	}
+
+	decompressedData, err := io.ReadAll(data)
+	if err != nil {
+		t.Fatalf("Failed decompressing data: %v", err)
+	}
+
+	for i, errCh := range errChs {
+		if err := <-errCh; err != nil {
+			t.Fatalf("Unexpected compression error in stage %d: %v", i, err)
+		}
+	}
+
+	if string(decompressedData) != testData {
+		t.Fatalf("Expected decompressed data to be %q, got %q", testData, string(decompressedData))
+	}
+}
+
+func Test_Piping_data_without_stages_returns_given_input(t *testing.T) {
+	t.Parallel()
+
+	input := io.NopCloser(bytes.NewBufferString(testData))
+
+	output, errChs := compressor.Pipe(testutil.ContextWithDeadline(t), input)
+
+	if output != input {
+		t.Fatalf("Expected input to be returned as is")
+	}
+
+	if len(errChs) != 0 {
+		t.Fatalf("Expected no error channels, got %d", len(errChs))
+	}
+}
+
+func Test_Compressing_and_decompressing_data_using_pool_restores_original_data(t *testing.T) {
+	t.Parallel()
+
+	pool, err := compressor.NewPool(2)
+	if err != nil {
+		t.Fatalf("Unexpected error creating pool: %v", err)
+	}
+
+	t.Cleanup(pool.Close)
+
+	ctx := testutil.ContextWithDeadline(t)
+
+	// Run more requests than workers to make sure workers get reused.
+	for i := 0; i < 5; i++ {
+		compressedData, compressErrCh := pool.Compress(ctx, io.NopCloser(bytes.NewBufferString(testData)))
+
+		reader, decompressErrCh := pool.Decompress(ctx, compressedData)
+
+		decompressedData, err := io.ReadAll(reader)
+		if err != nil {
+			t.Fatalf("Failed decompressing data: %v", err)
+		}
+
+		if err := <-compressErrCh; err != nil {
+			t.Fatalf("Unexpected compression error: %v", err)
+		}
+
+		if err := <-decompressErrCh; err != nil {
+			t.Fatalf("Unexpected decompression error: %v", err)
+		}
+
+		if string(decompressedData) != testData {
+			t.Fatalf("Expected decompressed data to be %q, got %q", testData, string(decompressedData))
+		}
+	}
+}
+
+func Test_Pool_returns_error_when_no_worker_becomes_idle_before_context_is_cancelled(t *testing.T) {
+	t.Parallel()
+
+	pool, err := compressor.NewPool(1)
+	if err != nil {
+		t.Fatalf("Unexpected error creating pool: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(testutil.ContextWithDeadline(t))
+
+	t.Cleanup(func() {
+		cancel()
+		pool.Close()
+	})
+
+	// Occupy the only worker by not reading the compressed data.
+	_, busyErrCh := pool.Compress(ctx, io.NopCloser(rand.New(rand.NewSource(time.Now().UnixNano()))))
+
+	timeoutCtx, cancelTimeout := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancelTimeout()
+
+	_, errCh := pool.Compress(timeoutCtx, io.NopCloser(bytes.NewBufferString(testData)))
+
+	if err := <-errCh; !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected error %v, got %v", context.DeadlineExceeded, err)
+	}
+
+	cancel()
+
+	if err := <-busyErrCh; !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected error %v, got %v", context.Canceled, err)
+	}
+}
+
+func Test_Pool_closes_given_input_when_no_worker_becomes_idle_before_context_is_cancelled(t *testing.T) {
+	t.Parallel()
+
+	pool, err := compressor.NewPool(1)
+	if err != nil {
+		t.Fatalf("Unexpected error creating pool: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(testutil.ContextWithDeadline(t))
+
+	t.Cleanup(func() {
+		cancel()
+		pool.Close()
+	})
+
+	// Occupy the only worker by not reading the compressed data.
+	_, busyErrCh := pool.Compress(ctx, io.NopCloser(rand.New(rand.NewSource(time.Now().UnixNano()))))
+
+	timeoutCtx, cancelTimeout := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancelTimeout()
+
+	input := &closeTrackingReader{ReadSeeker: strings.NewReader(testData)}
+
+	if _, errCh := pool.Decompress(timeoutCtx, input); <-errCh == nil {
+		t.Fatalf("Expected error when no worker becomes idle")
+	}
+
+	if !input.closed.Load() {
+		t.Fatalf("Expected input to be closed when decompression is not started")
+	}
+
+	cancel()
+
+	<-busyErrCh
+}
+
+func Test_Reloading_client_configuration(t *testing.T) {
+	t.Parallel()
+
+	newReloader := func(t *testing.T) (compressor.Client, compressor.Reloader) {
+		t.Helper()
+
+		client, err := compressor.NewClient()
+		if err != nil {
+			t.Fatalf("Unexpected error creating client: %v", err)
+		}
+
+		reloader, ok := client.(compressor.Reloader)
+		if !ok {
+			t.Fatalf("Expected client to implement %T", reloader)
+		}
+
+		return client, reloader
+	}
+
+	t.Run("applies_new_configuration_to_operations_started_afterwards", func(t *testing.T) {
+		t.Parallel()
+
+		client, reloader := newReloader(t)
+
+		if err := reloader.Reload(compressor.Config{Format: compressor.FormatNoop}); err != nil {
+			t.Fatalf("Unexpected error reloading configuration: %v", err)
+		}
+
+		if format := clientFormat(t, client); format != compressor.FormatNoop {
+			t.Fatalf("Expected format %q after reloading, got %q", compressor.FormatNoop, format)
+		}
+
+		output, errCh := client.Compress(testutil.ContextWithDeadline(t), io.NopCloser(strings.NewReader(testData)))
+
+		data, err := io.ReadAll(output)
+		if err != nil {
+			t.Fatalf("Unexpected error reading output: %v", err)
+		}
+
+		if err := <-errCh; err != nil {
+			t.Fatalf("Unexpected compression error: %v", err)
+		}
+
+		if string(data) != testData {
+			t.Fatalf("Expected output %q, got %q", testData, string(data))
+		}
+	})
+
+	t.Run("completes_running_operations_using_previous_configuration", func(t *testing.T) {
+		t.Parallel()
+
+		client, reloader := newReloader(t)
+
+		input, inputWriter := io.Pipe()
+
+		output, errCh := client.Compress(testutil.ContextWithDeadline(t), input)
+
+		if err := reloader.Reload(compressor.Config{Format: compressor.FormatNoop}); err != nil {
+			t.Fatalf("Unexpected error reloading configuration: %v", err)
+		}
+
+		go func() {
+			_, err := inputWriter.Write([]byte(testData))
+
+			//nolint:errcheck // Closing pipe always returns nil.
+			inputWriter.CloseWithError(err)
+		}()
+
+		data, err := io.ReadAll(output)
+		if err != nil {
+			t.Fatalf("Unexpected error reading output: %v", err)
+		}
+
+		if err := <-errCh; err != nil {
+			t.Fatalf("Unexpected compression error: %v", err)
+		}
+
+		if !bytes.Equal(data, testGzip(t)) {
+			t.Fatalf("Expected output to be compressed using gzip, got %q", data)
+		}
+	})
+
+	t.Run("keeps_previous_configuration_when_new_one_is_invalid", func(t *testing.T) {
+		t.Parallel()
+
+		client, reloader := newReloader(t)
+
+		if err := reloader.Reload(compressor.Config{Format: "foo"}); err == nil {
+			t.Fatalf("Expected error reloading invalid configuration")
+		}
+
+		if format := clientFormat(t, client); format != compressor.FormatGzip {
+			t.Fatalf("Expected format %q to be kept, got %q", compressor.FormatGzip, format)
+		}
+	})
+
+	t.Run("applies_new_configuration_to_pool", func(t *testing.T) {
+		t.Parallel()
+
+		pool, err := compressor.NewPool(1)
+		if err != nil {
+			t.Fatalf("Unexpected error creating pool: %v", err)
+		}
+
+		t.Cleanup(pool.Close)
+
+		if err := pool.Reload(compressor.Config{Format: compressor.FormatNoop}); err != nil {
+			t.Fatalf("Unexpected error reloading configuration: %v", err)
+		}
+
+		output, errCh := pool.Compress(testutil.ContextWithDeadline(t), io.NopCloser(strings.NewReader(testData)))
+
+		data, err := io.ReadAll(output)
+		if err != nil {
+			t.Fatalf("Unexpected error reading output: %v", err)
+		}
+
+		if err := <-errCh; err != nil {
+			t.Fatalf("Unexpected compression error: %v", err)
+		}
+
+		if string(data) != testData {
+			t.Fatalf("Expected output %q, got %q", testData, string(data))
+		}
+	})
+}
+
+func Test_Compressing_and_decompressing_data_in_blocks_restores_original_data(t *testing.T) {
+	t.Parallel()
+
+	for _, format := range compressor.AvailableFormats() {
+		format := format
+
+		t.Run(string(format), func(t *testing.T) {
+			t.Parallel()
+
+			client, err := compressor.NewClient(compressor.Config{Format: format})
+			if err != nil {
+				t.Fatalf("Unexpected error creating client: %v", err)
+			}
+
+			blockClient := asBlockClient(t, client)
+
+			// Use size which is not a multiple of block size to cover partial last block.
+			data := make([]byte, 10000)
+			if _, err := rand.Read(data); err != nil {
+				t.Fatalf("Failed generating random data: %v", err)
+			}
+
+			ctx := testutil.ContextWithDeadline(t)
+
+			compressedData, compressErrCh := blockClient.CompressBlocks(ctx, io.NopCloser(bytes.NewBuffer(data)), 1024, 3)
+
+			reader, decompressErrCh := blockClient.DecompressBlocks(ctx, compressedData, 3)
+
+			decompressedData, err := io.ReadAll(reader)
+			if err != nil {
+				t.Fatalf("Failed decompressing data: %v", err)
+			}
+
+			if err := <-compressErrCh; err != nil {
+				t.Fatalf("Unexpected compression error: %v", err)
+			}
+
+			if err := <-decompressErrCh; err != nil {
+				t.Fatalf("Unexpected decompression error: %v", err)
+			}
+
+			if !bytes.Equal(decompressedData, data) {
+				t.Fatalf("Expected decompressed data to be equal to original data")
+			}
+		})
+	}
+}
+
+func Test_Compressing_data_in_blocks_of_maximum_size_restores_original_data(t *testing.T) {
+	t.Parallel()
+
+	client, err := compressor.NewClient()
+	if err != nil {
+		t.Fatalf("Unexpected error creating client: %v", err)
+	}
+
+	blockClient := asBlockClient(t, client)
+
+	ctx := testutil.ContextWithDeadline(t)
+
+	compressedData, compressErrCh := blockClient.CompressBlocks(
+		ctx, io.NopCloser(bytes.NewBufferString(testData)), frame.MaxBlockSize, 1,
+	)
+
+	reader, decompressErrCh := blockClient.DecompressBlocks(ctx, compressedData, 1)
+
+	decompressedData, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("Failed decompressing data: %v", err)
+	}
+
+	if err := <-compressErrCh; err != nil {
+		t.Fatalf("Unexpected compression error: %v", err)
+	}
+
+	if err := <-decompressErrCh; err != nil {
+		t.Fatalf("Unexpected decompression error: %v", err)
+	}
+
+	if string(decompressedData) != testData {
+		t.Fatalf("Expected decompressed data %q, got %q", testData, decompressedData)
+	}
+}
+
+//nolint:funlen,cyclop // Just many test cases.
+func Test_Compressor_when_given_context_is_cancelled(t *testing.T) {
+	t.Parallel()
+
+	t.Run("stops_compression", func(t *testing.T) {
+		t.Parallel()
+
+		client, err := compressor.NewClient()
+		if err != nil {
+			t.Fatalf("Unexpected error creating client: %v", err)
+		}
+
+		timeout := time.NewTimer(time.Second)
+
+		ctx, cancel := context.WithTimeout(testutil.ContextWithDeadline(t), 200*time.Millisecond)
+		defer cancel()
+
+		_, errCh := client.Compress(ctx, io.NopCloser(rand.New(rand.NewSource(time.Now().UnixNano()))))
+
+		select {
+		case err := <-errCh:
+			if err != nil && !errors.Is(err, context.DeadlineExceeded) {
+				t.Fatalf("Unexpected compression error: %v", err)
+			}
+		case <-timeout.C:
+			t.Fatal("Compression did not stop within expected timeout")
+		}
+	})
+
+	t.Run("stops_decompression", func(t *testing.T) {
+		t.Parallel()
+
+		client, err := compressor.NewClient()
+		if err != nil {
+			t.Fatalf("Unexpected error creating client: %v", err)
+		}
+
+		ctx, cancel := context.WithCancel(testutil.ContextWithDeadline(t))
+		defer cancel()
+
+		compressedData, compressErrCh := client.Compress(ctx, io.NopCloser(rand.New(rand.NewSource(time.Now().UnixNano()))))
+
+		ctx, cancelTimeout := context.WithTimeout(ctx, 200*time.Millisecond)
+		defer cancelTimeout()
+
+		reader, decompressErrCh := client.Decompress(ctx, io.NopCloser(compressedData))
+
+		errCh := make(chan error, 1)
+
+		go func() {
+			errCh <- func() error {
+				if _, err := io.ReadAll(reader); err != nil {
+					return fmt.Errorf("reading decompressed data: %w", err)
+				}
+
+				if err := <-compressErrCh; err != nil {
+					return fmt.Errorf("compressing: %w", err)
+				}
+
+				return nil
+			}()
+		}()
+
+		timeout := time.NewTimer(time.Second)
+
+		select {
+		case err := <-decompressErrCh:
+			if err != nil && !errors.Is(err, context.DeadlineExceeded) {
+				t.Fatalf("Unexpected compression error: %v", err)
+			}
+		case <-timeout.C:
+			t.Fatal("Compression did not stop within expected timeout")
+		}
+
+		cancel()
+
+		if err := <-errCh; err != nil && !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("Unexpected client error: %v", err)
+		}
+	})
+}
+
+//nolint:funlen // Just many test cases.
+func Test_Compression_returns_error_when(t *testing.T) {
+	t.Parallel()
+
+	t.Run("flush_interval_is_not_positive", func(t *testing.T) {
+		t.Parallel()
+
+		c, err := compressor.NewClient()
+		if err != nil {
+			t.Fatalf("Unexpected error creating client: %v", err)
+		}
+
+		//nolint:forcetypeassert // Client is expected to support flushing.
+		output, errCh := c.(compressor.FlushableClient).CompressFlush(
+			testutil.ContextWithDeadline(t), io.NopCloser(strings.NewReader("foo")), 0)
+
+		if _, err := io.ReadAll(output); err == nil {
+			t.Fatalf("Expected error reading output")
+		}
+
+		if err := <-errCh; err == nil {
+			t.Fatalf("Expected compression error")
+		}
+	})
+
+	t.Run("closing_compressor_fails", func(t *testing.T) {
+		t.Parallel()
+
+		expectedErr := fmt.Errorf("test error")
+
+		config := compressor.Config{
+			Compressor: func(wrc io.WriteCloser) io.WriteCloser {
+				return &testReadWriteCloser{
+					writeF: func(b []byte) (int, error) {
+						//nolint:wrapcheck // We don't care about error wrapping in test code.
+						return wrc.Write(b)
+					},
+					closeF: func() error {
+						if err := wrc.Close(); err != nil {
+							t.Logf("Failed closing test writer: %v", err)
+						}
+
+						return expectedErr
+					},
+				}
+			},
+			Decompressor: nopDecompressor,
+		}
+
+		c, err := compressor.NewClient(config)
+		if err != nil {
+			t.Fatalf("Unexpected error creating client: %v", err)
+		}
+
+		output, errCh := c.Compress(testutil.ContextWithDeadline(t), io.NopCloser(bytes.NewBufferString(testData)))
+
+		if _, err := io.Copy(io.Discard, output); err != nil {
+			t.Fatalf("Failed discarding compression output: %v", err)
+		}
+
+		if err := <-errCh; !errors.Is(err, expectedErr) {
+			t.Fatalf("Expected error %v, got %v", expectedErr, err)
+		}
+	})
+
+	t.Run("bad_input_is_given", func(t *testing.T) {
+		t.Parallel()
+
+		config := compressor.Config{
+			Compressor: func(wrc io.WriteCloser) io.WriteCloser {
+				return &testReadWriteCloser{
+					writeF: func(b []byte) (int, error) {
+						//nolint:wrapcheck // We don't care about error wrapping in test code.
+						return wrc.Write(b)
+					},
+					closeF: func() error {
+						//nolint:wrapcheck // We don't care about error wrapping in test code.
+						return wrc.Close()
+					},
+				}
+			},
+			Decompressor: nopDecompressor,
+		}
+
+		client, err := compressor.NewClient(config)
+		if err != nil {
+			t.Fatalf("Unexpected error creating client: %v", err)
+		}
+
+		badReader := &testReadWriteCloser{
+			readF: func(p []byte) (n int, err error) {
+				return 0, fmt.Errorf("reading error")
+			},
+			closeF: func() error { return nil },
+		}
+
+		_, errCh := client.Compress(testutil.ContextWithDeadline(t), badReader)
+
+		if err := <-errCh; err == nil {
+			t.Fatalf("Expected error")
+		}
+	})
+
+	t.Run("metadata_is_not_supported_by_configured_compressor", func(t *testing.T) {
+		t.Parallel()
+
+		config := compressor.Config{
+			Compressor:   nopCompressor,
+			Decompressor: nopDecompressor,
+			Metadata:     map[string]string{"foo": "bar"},
+		}
+
+		client, err := compressor.NewClient(config)
+		if err != nil {
+			t.Fatalf("Unexpected error creating client: %v", err)
+		}
+
+		output, errCh := client.Compress(testutil.ContextWithDeadline(t), io.NopCloser(bytes.NewBufferString(testData)))
+
+		if _, err := io.ReadAll(output); err == nil {
+			t.Fatalf("Expected error reading compressed data")
+		}
+
+		if err := <-errCh; err == nil {
+			t.Fatalf("Expected error")
+		}
+	})
+}
+
+func Test_Decompressing_blocks_returns_error_when_total_decompressed_size_exceeds_configured_limit(t *testing.T) {
+	t.Parallel()
+
+	data := strings.Repeat(testData, 2)
+
+	client, err := compressor.NewClient(compressor.Config{MaxOutputBytes: int64(len(data)) - 1})
+	if err != nil {
+		t.Fatalf("Unexpected error creating client: %v", err)
+	}
+
+	blockClient := asBlockClient(t, client)
+
+	ctx := testutil.ContextWithDeadline(t)
+
+	// Each block fits into the limit, only their total size exceeds it.
+	compressedReader, compressErrCh := blockClient.CompressBlocks(
+		ctx, io.NopCloser(bytes.NewBufferString(data)), len(testData), 1,
+	)
+
+	compressedData, err := io.ReadAll(compressedReader)
+	if err != nil {
+		t.Fatalf("Unexpected error reading compressed data: %v", err)
+	}
+
+	if err := <-compressErrCh; err != nil {
+		t.Fatalf("Unexpected compression error: %v", err)
+	}
+
+	reader, decompressErrCh := blockClient.DecompressBlocks(ctx, io.NopCloser(bytes.NewReader(compressedData)), 1)
+
+	if _, err := io.ReadAll(reader); err == nil {
+		t.Fatalf("Expected error reading decompressed data")
+	}
+
+	if err := <-decompressErrCh; err == nil {
+		t.Fatalf("Expected decompression error")
+	}
+}
+
+func Test_Block_processing_reports_checksum_of_uncompressed_data(t *testing.T) {
+	t.Parallel()
+
+	sum := sha256.Sum256([]byte(testData))
+	expectedChecksum := hex.EncodeToString(sum[:])
+
+	checksums := make(chan string, 2)
+
+	client, err := compressor.NewClient(compressor.Config{
+		Checksum: compressor.ChecksumSHA256,
+		ChecksumHandler: func(checksum string) {
+			checksums <- checksum
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error creating client: %v", err)
+	}
+
+	blockClient := asBlockClient(t, client)
+
+	ctx := testutil.ContextWithDeadline(t)
+
+	compressedData, compressErrCh := blockClient.CompressBlocks(ctx, io.NopCloser(bytes.NewBufferString(testData)), 2, 2)
+
+	reader, decompressErrCh := blockClient.DecompressBlocks(ctx, compressedData, 2)
+
+	if _, err := io.ReadAll(reader); err != nil {
+		t.Fatalf("Failed decompressing data: %v", err)
+	}
+
+	if err := <-compressErrCh; err != nil {
+		t.Fatalf("Unexpected compression error: %v", err)
+	}
+
+	if err := <-decompressErrCh; err != nil {
+		t.Fatalf("Unexpected decompression error: %v", err)
+	}
+
+	for _, action := range []string{"compression", "decompression"} {
+		if checksum := <-checksums; checksum != expectedChecksum {
+			t.Fatalf("Expected %s checksum %q, got %q", action, expectedChecksum, checksum)
+		}
+	}
+}
+
+func Test_Decompressing_blocks_returns_error_when_decompressed_data_does_not_match_expected_checksum(t *testing.T) {
+	t.Parallel()
+
+	compressingClient, err := compressor.NewClient()
+	if err != nil {
+		t.Fatalf("Unexpected error creating client: %v", err)
+	}
+
+	ctx := testutil.ContextWithDeadline(t)
+
+	compressedReader, compressErrCh := asBlockClient(t, compressingClient).CompressBlocks(
+		ctx, io.NopCloser(bytes.NewBufferString(testData)), 2, 1,
+	)
+
+	compressedData, err := io.ReadAll(compressedReader)
+	if err != nil {
+		t.Fatalf("Unexpected error reading compressed data: %v", err)
+	}
+
+	if err := <-compressErrCh; err != nil {
+		t.Fatalf("Unexpected compression error: %v", err)
+	}
+
+	sum := sha256.Sum256([]byte("bar"))
+
+	client, err := compressor.NewClient(compressor.Config{
+		Checksum:         compressor.ChecksumSHA256,
+		ExpectedChecksum: hex.EncodeToString(sum[:]),
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error creating client: %v", err)
+	}
+
+	reader, errCh := asBlockClient(t, client).DecompressBlocks(ctx, io.NopCloser(bytes.NewReader(compressedData)), 1)
+
+	if _, err := io.ReadAll(reader); err == nil {
+		t.Fatalf("Expected error reading decompressed data")
+	}
+
+	if err := <-errCh; err == nil || !strings.Contains(err.Error(), "checksum") {
+		t.Fatalf("Expected checksum error, got %v", err)
+	}
+}
+
+func Test_Block_processing_returns_error_when_metadata_is_configured(t *testing.T) {
+	t.Parallel()
+
+	for name, testCase := range map[string]struct {
+		config  compressor.Config
+		process func(context.Context, compressor.BlockClient) (io.Reader, chan error)
+	}{
+		"when_compressing": {
+			config: compressor.Config{Metadata: map[string]string{"foo": "bar"}},
+			process: func(ctx context.Context, client compressor.BlockClient) (io.Reader, chan error) {
+				return client.CompressBlocks(ctx, io.NopCloser(bytes.NewBufferString(testData)), 1, 1)
+			},
+		},
+		"when_decompressing": {
+			config: compressor.Config{MetadataReader: func(map[string]string) {}},
+			process: func(ctx context.Context, client compressor.BlockClient) (io.Reader, chan error) {
+				return client.DecompressBlocks(ctx, io.NopCloser(bytes.NewBufferString(testData)), 1)
+			},
+		},
+	} {
+		testCase := testCase
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			client, err := compressor.NewClient(testCase.config)
+			if err != nil {
+				t.Fatalf("Unexpected error creating client: %v", err)
+			}
+
+			output, errCh := testCase.process(testutil.ContextWithDeadline(t), asBlockClient(t, client))
+
+			if _, err := io.ReadAll(output); err == nil {
+				t.Fatalf("Expected error reading output")
+			}
+
+			if err := <-errCh; err == nil || !strings.Contains(err.Error(), "metadata") {
+				t.Fatalf("Expected metadata error, got %v", err)
+			}
+		})
+	}
+}
+
+func Test_Block_compression_returns_error_when(t *testing.T) {
+	t.Parallel()
+
+	client, err := compressor.NewClient()
+	if err != nil {
+		t.Fatalf("Unexpected error creating client: %v", err)
+	}
+
+	blockClient := asBlockClient(t, client)
+
+	for name, testCase := range map[string]func(context.Context) (io.Reader, chan error){
+		"block_size_is_not_positive": func(ctx context.Context) (io.Reader, chan error) {
+			return blockClient.CompressBlocks(ctx, io.NopCloser(bytes.NewBufferString(testData)), 0, 1)
+		},
+		"block_size_is_not_positive_and_context_is_nil": func(context.Context) (io.Reader, chan error) {
+			//nolint:staticcheck // Passing nil context is intended.
+			return blockClient.CompressBlocks(nil, io.NopCloser(bytes.NewBufferString(testData)), 0, 1)
+		},
+		"block_size_exceeds_maximum_block_size": func(ctx context.Context) (io.Reader, chan error) {
+			return blockClient.CompressBlocks(ctx, io.NopCloser(bytes.NewBufferString(testData)), frame.MaxBlockSize+1, 1)
+		},
+		"parallelism_is_not_positive": func(ctx context.Context) (io.Reader, chan error) {
+			return blockClient.CompressBlocks(ctx, io.NopCloser(bytes.NewBufferString(testData)), 1, 0)
+		},
+		"parallelism_exceeds_maximum_parallelism": func(ctx context.Context) (io.Reader, chan error) {
+			return blockClient.CompressBlocks(ctx, io.NopCloser(bytes.NewBufferString(testData)), 1, compressor.MaxParallelism+1)
+		},
+		"decompression_parallelism_is_not_positive": func(ctx context.Context) (io.Reader, chan error) {
+			return blockClient.DecompressBlocks(ctx, io.NopCloser(bytes.NewBufferString(testData)), 0)
+		},
+		"decompressed_data_is_empty": func(ctx context.Context) (io.Reader, chan error) {
+			return blockClient.DecompressBlocks(ctx, io.NopCloser(&bytes.Buffer{}), 1)
+		},
+		"decompressed_data_has_no_terminal_frame": func(ctx context.Context) (io.Reader, chan error) {
+			return blockClient.DecompressBlocks(ctx, testBlocks(t, frame.WriteHeader), 1)
+		},
+		"decompressed_block_is_not_compressed": func(ctx context.Context) (io.Reader, chan error) {
+			return blockClient.DecompressBlocks(ctx, testBlocks(t, frame.WriteHeader, func(w io.Writer) error {
+				return frame.WriteFrame(w, frame.Frame{Data: []byte(testData), UncompressedSize: 3})
+			}, frame.WriteEnd), 1)
+		},
+		"decompressed_block_checksum_does_not_match": func(ctx context.Context) (io.Reader, chan error) {
+			return blockClient.DecompressBlocks(ctx, testBlocks(t, frame.WriteHeader, func(w io.Writer) error {
+				return frame.WriteFrame(w, frame.Frame{Data: testGzip(t), UncompressedSize: 3, HasCRC32: true})
+			}, frame.WriteEnd), 1)
+		},
+	} {
+		testCase := testCase
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			output, errCh := testCase(testutil.ContextWithDeadline(t))
+
+			if _, err := io.ReadAll(output); err == nil {
+				t.Fatalf("Expected error reading output")
+			}
+
+			if err := <-errCh; err == nil {
+				t.Fatalf("Expected error")
+			}
+		})
+	}
+}
+
+//nolint:funlen // Just many test cases.
+func Test_Compression_closes_given_input_when_using(t *testing.T) {
+	t.Parallel()
+
+	newClient := func(t *testing.T) compressor.Client {
+		t.Helper()
+
+		client, err := compressor.NewClient()
+		if err != nil {
+			t.Fatalf("Unexpected error creating client: %v", err)
+		}
+
+		return client
+	}
+
+	type compressFunc func(context.Context, io.ReadCloser) (io.ReadCloser, chan error)
+
+	for name, createCompress := range map[string]func(t *testing.T) compressFunc{
+		"client": func(t *testing.T) compressFunc {
+			t.Helper()
+
+			return newClient(t).Compress
+		},
+		"client_with_retries": func(t *testing.T) compressFunc {
+			t.Helper()
+
+			client, err := compressor.NewClientWithOptions(compressor.WithMaxRetries(1))
+			if err != nil {
+				t.Fatalf("Unexpected error creating client: %v", err)
+			}
+
+			return client.Compress
+		},
+		"pool": func(t *testing.T) compressFunc {
+			t.Helper()
+
+			pool, err := compressor.NewPool(1)
+			if err != nil {
+				t.Fatalf("Unexpected error creating pool: %v", err)
+			}
+
+			t.Cleanup(pool.Close)
+
+			return pool.Compress
+		},
+		"retry_middleware": func(t *testing.T) compressFunc {
+			t.Helper()
+
+			return compressor.Chain(newClient(t), compressor.RetryMiddleware(2, nil)).Compress
+		},
+		"rate_limit_middleware": func(t *testing.T) compressFunc {
+			t.Helper()
+
+			return compressor.Chain(newClient(t), compressor.RateLimitMiddleware(1<<20)).Compress
+		},
+		"instrumented_client": func(t *testing.T) compressFunc {
+			t.Helper()
+
+			return compressor.NewInstrumentedClient(newClient(t), &testMetricsRecorder{
+				bytesIn:  map[compressor.Format]int64{},
+				bytesOut: map[compressor.Format]int64{},
+			}).Compress
+		},
+		"block_client": func(t *testing.T) compressFunc {
+			t.Helper()
+
+			blockClient := asBlockClient(t, newClient(t))
+
+			return func(ctx context.Context, input io.ReadCloser) (io.ReadCloser, chan error) {
+				return blockClient.CompressBlocks(ctx, input, 2, 2)
+			}
+		},
+		"rate_limited_block_client": func(t *testing.T) compressFunc {
+			t.Helper()
+
+			blockClient := asBlockClient(t, compressor.Chain(newClient(t), compressor.RateLimitMiddleware(1<<20)))
+
+			return func(ctx context.Context, input io.ReadCloser) (io.ReadCloser, chan error) {
+				return blockClient.CompressBlocks(ctx, input, 2, 2)
+			}
+		},
+		"flushable_client": func(t *testing.T) compressFunc {
+			t.Helper()
+
+			flushableClient, ok := newClient(t).(compressor.FlushableClient)
+			if !ok {
+				t.Fatalf("Expected client to implement FlushableClient")
+			}
+
+			return func(ctx context.Context, input io.ReadCloser) (io.ReadCloser, chan error) {
+				return flushableClient.CompressFlush(ctx, input, 2)
+			}
+		},
+	} {
+		createCompress := createCompress
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
 
-		if c != nil {
-			t.Fatalf("When creating client returns error, no client should be returned")
-		}
-	})
-}
+			input := &closeTrackingReader{ReadSeeker: strings.NewReader(testData)}
 
-func Test_Compressor_supports_all_available_formats(t *testing.T) {
-	t.Parallel()
+			output, errCh := createCompress(t)(testutil.ContextWithDeadline(t), input)
 
-	for _, format := range compressor.AvailableFormats() {
-		config := compressor.Config{
-			Format: compressor.Format(format),
-		}
+			if _, err := io.Copy(io.Discard, output); err != nil {
+				t.Fatalf("Unexpected error reading compressed data: %v", err)
+			}
 
-		if _, err := compressor.NewClient(config); err != nil {
-			t.Fatalf("Unexpected error creating client: %v", err)
-		}
+			if err := <-errCh; err != nil {
+				t.Fatalf("Unexpected compression error: %v", err)
+			}
+
+			if !input.closed.Load() {
+				t.Fatalf("Expected input to be closed once compression finishes")
+			}
+		})
 	}
 }
 
-func Test_Compressor_use_gzip_format_for_decompressor_by_default(t *testing.T) {
+func Test_Decompression_closes_given_input_when(t *testing.T) {
 	t.Parallel()
 
-	client, err := compressor.NewClient()
-	if err != nil {
-		t.Fatalf("Unexpected error creating client: %v", err)
-	}
+	for name, data := range map[string][]byte{
+		"processing_succeeds":         testGzip(t),
+		"creating_decompressor_fails": []byte(testData),
+	} {
+		data := data
+		valid := name == "processing_succeeds"
 
-	var buf bytes.Buffer
-	writer := gzip.NewWriter(&buf)
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
 
-	if _, err := writer.Write([]byte(testData)); err != nil {
-		t.Fatalf("Failed writing data to compress: %v", err)
-	}
+			client, err := compressor.NewClient()
+			if err != nil {
+				t.Fatalf("Unexpected error creating client: %v", err)
+			}
 
-	if err := writer.Close(); err != nil {
-		t.Fatalf("Failed closing writer: %v", err)
-	}
+			input := &closeTrackingReader{ReadSeeker: bytes.NewReader(data)}
 
-	reader, errCh := client.Decompress(testutil.ContextWithDeadline(t), io.NopCloser(&buf))
+			output, errCh := client.Decompress(testutil.ContextWithDeadline(t), input)
 
-	decompressedData, err := io.ReadAll(reader)
-	if err != nil {
-		t.Errorf("Failed decompressing data: %v", err)
-	}
+			if _, err := io.Copy(io.Discard, output); err != nil && valid {
+				t.Fatalf("Unexpected error reading decompressed data: %v", err)
+			}
 
-	if err := <-errCh; err != nil {
-		t.Fatalf("Unexpected compression error: %v", err)
-	}
+			<-errCh
 
-	if string(decompressedData) != testData {
-		t.Fatalf("Expected decompressed data to be %q, got %q", testData, string(decompressedData))
+			if !input.closed.Load() {
+				t.Fatalf("Expected input to be closed once decompression finishes")
+			}
+		})
 	}
 }
 
-//nolint:funlen,cyclop // Just many test cases.
-func Test_Compressor_when_given_context_is_cancelled(t *testing.T) {
+//nolint:funlen // Just many test cases.
+func Test_Decompression_closes_given_input_when_using(t *testing.T) {
 	t.Parallel()
 
-	t.Run("stops_compression", func(t *testing.T) {
-		t.Parallel()
+	newClient := func(t *testing.T) compressor.Client {
+		t.Helper()
 
 		client, err := compressor.NewClient()
 		if err != nil {
 			t.Fatalf("Unexpected error creating client: %v", err)
 		}
 
-		timeout := time.NewTimer(time.Second)
+		return client
+	}
 
-		ctx, cancel := context.WithTimeout(testutil.ContextWithDeadline(t), 200*time.Millisecond)
-		defer cancel()
+	type decompressFunc func(context.Context, io.ReadCloser) (io.ReadCloser, chan error)
 
-		_, errCh := client.Compress(ctx, rand.New(rand.NewSource(time.Now().UnixNano())))
+	for name, createDecompress := range map[string]func(t *testing.T) decompressFunc{
+		"pool": func(t *testing.T) decompressFunc {
+			t.Helper()
 
-		select {
-		case err := <-errCh:
-			if err != nil && !errors.Is(err, context.DeadlineExceeded) {
-				t.Fatalf("Unexpected compression error: %v", err)
+			pool, err := compressor.NewPool(1)
+			if err != nil {
+				t.Fatalf("Unexpected error creating pool: %v", err)
 			}
-		case <-timeout.C:
-			t.Fatal("Compression did not stop within expected timeout")
-		}
-	})
 
-	t.Run("stops_decompression", func(t *testing.T) {
-		t.Parallel()
+			t.Cleanup(pool.Close)
 
-		client, err := compressor.NewClient()
-		if err != nil {
-			t.Fatalf("Unexpected error creating client: %v", err)
-		}
+			return pool.Decompress
+		},
+		"retry_middleware": func(t *testing.T) decompressFunc {
+			t.Helper()
 
-		ctx, cancel := context.WithCancel(testutil.ContextWithDeadline(t))
-		defer cancel()
+			return compressor.Chain(newClient(t), compressor.RetryMiddleware(2, nil)).Decompress
+		},
+		"rate_limit_middleware": func(t *testing.T) decompressFunc {
+			t.Helper()
 
-		compressedData, compressErrCh := client.Compress(ctx, rand.New(rand.NewSource(time.Now().UnixNano())))
+			return compressor.Chain(newClient(t), compressor.RateLimitMiddleware(1<<20)).Decompress
+		},
+		"logging_middleware": func(t *testing.T) decompressFunc {
+			t.Helper()
 
-		ctx, cancelTimeout := context.WithTimeout(ctx, 200*time.Millisecond)
-		defer cancelTimeout()
+			logger := slog.New(slog.NewTextHandler(io.Discard, nil))
 
-		reader, decompressErrCh := client.Decompress(ctx, io.NopCloser(compressedData))
+			return compressor.Chain(newClient(t), compressor.LoggingMiddleware(logger)).Decompress
+		},
+		"instrumented_client": func(t *testing.T) decompressFunc {
+			t.Helper()
 
-		errCh := make(chan error, 1)
+			return compressor.NewInstrumentedClient(newClient(t), &testMetricsRecorder{
+				bytesIn:  map[compressor.Format]int64{},
+				bytesOut: map[compressor.Format]int64{},
+			}).Decompress
+		},
+	} {
+		createDecompress := createDecompress
 
-		go func() {
-			errCh <- func() error {
-				if _, err := io.ReadAll(reader); err != nil {
-					return fmt.Errorf("reading decompressed data: %w", err)
-				}
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
 
-				if err := <-compressErrCh; err != nil {
-					return fmt.Errorf("compressing: %w", err)
-				}
+			input := &closeTrackingReader{ReadSeeker: bytes.NewReader(testGzip(t))}
 
-				return nil
-			}()
-		}()
+			output, errCh := createDecompress(t)(testutil.ContextWithDeadline(t), input)
 
-		timeout := time.NewTimer(time.Second)
+			data, err := io.ReadAll(output)
+			if err != nil {
+				t.Fatalf("Unexpected error reading decompressed data: %v", err)
+			}
 
-		select {
-		case err := <-decompressErrCh:
-			if err != nil && !errors.Is(err, context.DeadlineExceeded) {
-				t.Fatalf("Unexpected compression error: %v", err)
+			if err := <-errCh; err != nil {
+				t.Fatalf("Unexpected decompression error: %v", err)
 			}
-		case <-timeout.C:
-			t.Fatal("Compression did not stop within expected timeout")
-		}
 
-		cancel()
+			if string(data) != testData {
+				t.Fatalf("Expected output %q, got %q", testData, string(data))
+			}
 
-		if err := <-errCh; err != nil && !errors.Is(err, context.DeadlineExceeded) {
-			t.Fatalf("Unexpected client error: %v", err)
-		}
-	})
+			if !input.closed.Load() {
+				t.Fatalf("Expected input to be closed once decompression finishes")
+			}
+		})
+	}
 }
 
 //nolint:funlen // Just many test cases.
-func Test_Compression_returns_error_when(t *testing.T) {
+func Test_Decompression_returns_error_when(t *testing.T) {
 	t.Parallel()
-
-	t.Run("closing_compressor_fails", func(t *testing.T) {
+	t.Run("creating_decompressor_fails", func(t *testing.T) {
 		t.Parallel()
 
-		expectedErr := fmt.Errorf("test error")
-
-		config := compressor.Config{
-			Compressor: func(wrc io.WriteCloser) io.WriteCloser {
-				return &testReadWriteCloser{
-					writeF: func(b []byte) (int, error) {
-						//nolint:wrapcheck // We don't care about error wrapping in test code.
-						return wrc.Write(b)
-					},
-					closeF: func() error {
-						if err := wrc.Close(); err != nil {
-							t.Logf("Failed closing test writer: %v", err)
-						}
-
-						return expectedErr
-					},
-				}
-			},
-			Decompressor: nopDecompressor,
-		}
-
-		c, err := compressor.NewClient(config)
+		c, err := compressor.NewClient()
 		if err != nil {
 			t.Fatalf("Unexpected error creating client: %v", err)
 		}
 
-		output, errCh := c.Compress(testutil.ContextWithDeadline(t), bytes.NewBufferString(testData))
-
-		if _, err := io.Copy(io.Discard, output); err != nil {
-			t.Fatalf("Failed discarding compression output: %v", err)
-		}
+		_, errCh := c.Decompress(testutil.ContextWithDeadline(t), io.NopCloser(bytes.NewBufferString(testData)))
 
-		if err := <-errCh; !errors.Is(err, expectedErr) {
-			t.Fatalf("Expected error %v, got %v", expectedErr, err)
+		err = <-errCh
+		if err == nil {
+			t.Fatalf("Expected compression error")
 		}
 	})
 
@@ -408,18 +3299,7 @@ func Test_Compression_returns_error_when(t *testing.T) {
 		t.Parallel()
 
 		config := compressor.Config{
-			Compressor: func(wrc io.WriteCloser) io.WriteCloser {
-				return &testReadWriteCloser{
-					writeF: func(b []byte) (int, error) {
-						//nolint:wrapcheck // We don't care about error wrapping in test code.
-						return wrc.Write(b)
-					},
-					closeF: func() error {
-						//nolint:wrapcheck // We don't care about error wrapping in test code.
-						return wrc.Close()
-					},
-				}
-			},
+			Compressor:   nopCompressor,
 			Decompressor: nopDecompressor,
 		}
 
@@ -432,55 +3312,89 @@ func Test_Compression_returns_error_when(t *testing.T) {
 			readF: func(p []byte) (n int, err error) {
 				return 0, fmt.Errorf("reading error")
 			},
+			closeF: func() error { return nil },
 		}
 
-		_, errCh := client.Compress(testutil.ContextWithDeadline(t), badReader)
+		_, errCh := client.Decompress(testutil.ContextWithDeadline(t), badReader)
 
 		if err := <-errCh; err == nil {
 			t.Fatalf("Expected error")
 		}
 	})
-}
 
-//nolint:funlen // Just many test cases.
-func Test_Decompression_returns_error_when(t *testing.T) {
-	t.Parallel()
-	t.Run("creating_decompressor_fails", func(t *testing.T) {
+	t.Run("decompressed_data_exceeds_configured_max_output_bytes", func(t *testing.T) {
 		t.Parallel()
 
-		c, err := compressor.NewClient()
+		var buf bytes.Buffer
+
+		writer := gzip.NewWriter(&buf)
+
+		if _, err := writer.Write(make([]byte, 1<<20)); err != nil {
+			t.Fatalf("Failed writing data to compress: %v", err)
+		}
+
+		if err := writer.Close(); err != nil {
+			t.Fatalf("Failed closing writer: %v", err)
+		}
+
+		maxOutputBytes := 1 << 10
+
+		client, err := compressor.NewClient(compressor.Config{MaxOutputBytes: int64(maxOutputBytes)})
 		if err != nil {
 			t.Fatalf("Unexpected error creating client: %v", err)
 		}
 
-		_, errCh := c.Decompress(testutil.ContextWithDeadline(t), io.NopCloser(bytes.NewBufferString(testData)))
+		reader, errCh := client.Decompress(testutil.ContextWithDeadline(t), io.NopCloser(&buf))
 
-		err = <-errCh
+		decompressedData, err := io.ReadAll(reader)
 		if err == nil {
-			t.Fatalf("Expected compression error")
+			t.Errorf("Expected error reading decompressed data")
 		}
-	})
 
-	t.Run("bad_input_is_given", func(t *testing.T) {
-		t.Parallel()
+		if len(decompressedData) > maxOutputBytes {
+			t.Errorf("Expected at most %d bytes of decompressed data, got %d", maxOutputBytes, len(decompressedData))
+		}
 
-		config := compressor.Config{
-			Compressor:   nopCompressor,
-			Decompressor: nopDecompressor,
+		if err := <-errCh; err == nil || !strings.Contains(err.Error(), "limit") {
+			t.Fatalf("Expected error mentioning limit, got %v", err)
 		}
+	})
 
-		client, err := compressor.NewClient(config)
+	t.Run("checksum_of_decompressed_data_does_not_match_expected_checksum", func(t *testing.T) {
+		t.Parallel()
+
+		client, err := compressor.NewClient(compressor.Config{
+			Format:           compressor.FormatNoop,
+			Checksum:         compressor.ChecksumSHA256,
+			ExpectedChecksum: "foo",
+		})
 		if err != nil {
 			t.Fatalf("Unexpected error creating client: %v", err)
 		}
 
-		badReader := &testReadWriteCloser{
-			readF: func(p []byte) (n int, err error) {
-				return 0, fmt.Errorf("reading error")
-			},
+		reader, errCh := client.Decompress(testutil.ContextWithDeadline(t), io.NopCloser(bytes.NewBufferString(testData)))
+
+		if _, err := io.ReadAll(reader); err == nil {
+			t.Errorf("Expected error reading decompressed data")
 		}
 
-		_, errCh := client.Decompress(testutil.ContextWithDeadline(t), badReader)
+		if err := <-errCh; err == nil || !strings.Contains(err.Error(), "checksum") {
+			t.Fatalf("Expected error mentioning checksum, got %v", err)
+		}
+	})
+
+	t.Run("noop_data_has_no_metadata_envelope", func(t *testing.T) {
+		t.Parallel()
+
+		client, err := compressor.NewClient(compressor.Config{
+			Format:         compressor.FormatNoop,
+			MetadataReader: func(map[string]string) {},
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error creating client: %v", err)
+		}
+
+		_, errCh := client.Decompress(testutil.ContextWithDeadline(t), io.NopCloser(bytes.NewBufferString(testData)))
 
 		if err := <-errCh; err == nil {
 			t.Fatalf("Expected error")
@@ -512,7 +3426,7 @@ func Test_Decompression_returns_error_when(t *testing.T) {
 			t.Fatalf("Unexpected error creating client: %v", err)
 		}
 
-		output, errCh := c.Decompress(testutil.ContextWithDeadline(t), bytes.NewBufferString(testData))
+		output, errCh := c.Decompress(testutil.ContextWithDeadline(t), io.NopCloser(bytes.NewBufferString(testData)))
 
 		if _, err := io.Copy(io.Discard, output); err != nil {
 			t.Fatalf("Failed discarding compression output: %v", err)
@@ -526,6 +3440,60 @@ func Test_Decompression_returns_error_when(t *testing.T) {
 
 const testData = "foo"
 
+func asBlockClient(t *testing.T, client compressor.Client) compressor.BlockClient {
+	t.Helper()
+
+	blockClient, ok := client.(compressor.BlockClient)
+	if !ok {
+		t.Fatalf("Expected client %T to implement BlockClient", client)
+	}
+
+	return blockClient
+}
+
+func clientFormat(t *testing.T, client compressor.Client) compressor.Format {
+	t.Helper()
+
+	reporter, ok := client.(compressor.FormatReporter)
+	if !ok {
+		t.Fatalf("Expected client %T to implement FormatReporter", client)
+	}
+
+	return reporter.Format()
+}
+
+func testBlocks(t *testing.T, writers ...func(io.Writer) error) io.ReadCloser {
+	t.Helper()
+
+	buf := &bytes.Buffer{}
+
+	for _, write := range writers {
+		if err := write(buf); err != nil {
+			t.Fatalf("Failed writing test blocks: %v", err)
+		}
+	}
+
+	return io.NopCloser(buf)
+}
+
+func testGzip(t *testing.T) []byte {
+	t.Helper()
+
+	buf := &bytes.Buffer{}
+
+	writer := gzip.NewWriter(buf)
+
+	if _, err := writer.Write([]byte(testData)); err != nil {
+		t.Fatalf("Failed writing data to compress: %v", err)
+	}
+
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Failed closing writer: %v", err)
+	}
+
+	return buf.Bytes()
+}
+
 func nopCompressor(a io.WriteCloser) io.WriteCloser {
 	return a
 }
@@ -534,6 +3502,19 @@ func nopDecompressor(a io.Reader) (io.ReadCloser, error) {
 	return io.NopCloser(a), nil
 }
 
+// closeTrackingReader records whether it has been closed. It can be seeked, so it can be used with retries.
+type closeTrackingReader struct {
+	io.ReadSeeker
+
+	closed atomic.Bool
+}
+
+func (c *closeTrackingReader) Close() error {
+	c.closed.Store(true)
+
+	return nil
+}
+
 type testReadWriteCloser struct {
 	writeF func([]byte) (int, error)
 	closeF func() error
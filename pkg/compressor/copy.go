@@ -0,0 +1,64 @@
+package compressor
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// DefaultChunkSize is a number of bytes copied between checks of the context, when chunk size is not configured.
+const DefaultChunkSize = 32 * 1024
+
+// StreamCopy copies data from src to dst until io.EOF is reached, like io.Copy does, but checks given context
+// between chunks of DefaultChunkSize bytes, so copying stops soon after context is done, returning the context
+// error.
+func StreamCopy(ctx context.Context, dst io.Writer, src io.Reader) (int64, error) {
+	return streamCopy(ctx, dst, src, DefaultChunkSize)
+}
+
+// streamCopy works like StreamCopy, but checks the context between chunks of given size, which must be positive.
+func streamCopy(ctx context.Context, dst io.Writer, src io.Reader, chunkSize int) (int64, error) {
+	buf := make([]byte, chunkSize)
+	written := int64(0)
+
+	for {
+		if err := ctx.Err(); err != nil {
+			//nolint:wrapcheck // Context errors must be returned unwrapped.
+			return written, err
+		}
+
+		n, readErr := src.Read(buf)
+		if n > 0 {
+			m, err := dst.Write(buf[:n])
+			written += int64(m)
+
+			if err != nil {
+				//nolint:wrapcheck // Do not hide the error from the underlying writer.
+				return written, err
+			}
+
+			if m != n {
+				return written, io.ErrShortWrite
+			}
+		}
+
+		if errors.Is(readErr, io.EOF) {
+			return written, nil
+		}
+
+		if readErr != nil {
+			//nolint:wrapcheck // Do not hide the error from the underlying reader.
+			return written, readErr
+		}
+	}
+}
+
+// streamCopy copies data using configured chunk size.
+func (c *client) streamCopy(ctx context.Context, dst io.Writer, src io.Reader) (int64, error) {
+	chunkSize := c.chunkSize
+	if chunkSize == 0 {
+		chunkSize = DefaultChunkSize
+	}
+
+	return streamCopy(ctx, dst, src, chunkSize)
+}
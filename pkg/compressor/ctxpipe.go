@@ -0,0 +1,271 @@
+package compressor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sync"
+)
+
+// DefaultPipeBufferSize is a number of bytes buffered between processing and reading its output, when
+// buffer size is not configured.
+const DefaultPipeBufferSize = 32 * 1024
+
+// ContextPipe creates pipe bound to given context, which buffers up to DefaultPipeBufferSize bytes. Once context
+// is done, blocked and subsequent reads and writes return context error, so neither side of the pipe has to
+// watch the context separately. Closing any side of the pipe unbinds it from the context.
+func ContextPipe(ctx context.Context) (*ContextPipeReader, *ContextPipeWriter) {
+	return newContextPipe(ctx, DefaultPipeBufferSize)
+}
+
+// contextPipe works like io.Pipe, but writes return as soon as data fits into the buffer, so writer does not
+// have to wait for the reader on every write, which reduces goroutine switching.
+type contextPipe struct {
+	mu      sync.Mutex
+	changed *sync.Cond
+	buf     *bytes.Buffer
+	size    int
+
+	//nolint:containedctx // Pipe is bound to a single operation using this context.
+	ctx  context.Context
+	stop func() bool
+
+	// readErr is returned by reads once the buffer is drained and writeErr is returned by writes. They are set
+	// when writer or reader is closed respectively.
+	readErr  error
+	writeErr error
+}
+
+// ContextPipeReader is a reading half of the pipe created by ContextPipe.
+type ContextPipeReader struct {
+	pipe *contextPipe
+}
+
+// ContextPipeWriter is a writing half of the pipe created by ContextPipe.
+type ContextPipeWriter struct {
+	pipe *contextPipe
+}
+
+// newContextPipe creates pipe bound to given context buffering up to given number of bytes, which must be
+// positive.
+func newContextPipe(ctx context.Context, size int) (*ContextPipeReader, *ContextPipeWriter) {
+	pipe := &contextPipe{buf: &bytes.Buffer{}, size: size, ctx: ctx}
+	pipe.changed = sync.NewCond(&pipe.mu)
+
+	// Wake up blocked reads and writes once context is done.
+	pipe.stop = context.AfterFunc(ctx, func() {
+		pipe.mu.Lock()
+		defer pipe.mu.Unlock()
+
+		pipe.changed.Broadcast()
+	})
+
+	return &ContextPipeReader{pipe: pipe}, &ContextPipeWriter{pipe: pipe}
+}
+
+// ctxErr returns context error if context is done before any side of the pipe is closed.
+func (p *contextPipe) ctxErr() error {
+	if p.readErr != nil || p.writeErr != nil {
+		return nil
+	}
+
+	return p.ctx.Err()
+}
+
+// err returns context error if given error was caused by closing the pipe when context was done.
+func (p *contextPipe) err(err error) error {
+	if errors.Is(err, io.ErrClosedPipe) && p.ctx.Err() != nil {
+		return p.ctx.Err()
+	}
+
+	return err
+}
+
+func (p *contextPipe) read(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for {
+		// Reader closed with an error should not receive more data.
+		if p.writeErr != nil {
+			return 0, p.err(io.ErrClosedPipe)
+		}
+
+		if err := p.ctxErr(); err != nil {
+			return 0, err
+		}
+
+		if p.buf.Len() > 0 {
+			n, _ := p.buf.Read(b)
+
+			p.changed.Broadcast()
+
+			return n, nil
+		}
+
+		if p.readErr != nil {
+			return 0, p.readErr
+		}
+
+		p.changed.Wait()
+	}
+}
+
+func (p *contextPipe) write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	written := 0
+
+	for {
+		if p.writeErr != nil {
+			return written, p.err(p.writeErr)
+		}
+
+		if p.readErr != nil {
+			return written, io.ErrClosedPipe
+		}
+
+		if err := p.ctxErr(); err != nil {
+			return written, err
+		}
+
+		if space := p.size - p.buf.Len(); space > 0 {
+			n, _ := p.buf.Write(b[:min(space, len(b))])
+			written += n
+			b = b[n:]
+
+			p.changed.Broadcast()
+		}
+
+		if len(b) == 0 {
+			return written, nil
+		}
+
+		p.changed.Wait()
+	}
+}
+
+// writeTo writes data to given writer as it is written into the pipe, until the pipe is closed or its context
+// is done. Buffered data is taken from the pipe as a whole, so it is not copied and the pipe can be filled again
+// while the data is written.
+func (p *contextPipe) writeTo(dst io.Writer) (int64, error) {
+	var written int64
+
+	spare := &bytes.Buffer{}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for {
+		switch err := p.ctxErr(); {
+		// Reader closed with an error should not receive more data.
+		case p.writeErr != nil:
+			return written, p.err(io.ErrClosedPipe)
+		case err != nil:
+			return written, err
+		case p.buf.Len() > 0:
+			data := p.buf
+			p.buf = spare
+
+			p.changed.Broadcast()
+			p.mu.Unlock()
+
+			n, err := data.WriteTo(dst)
+
+			p.mu.Lock()
+
+			written += n
+
+			if err != nil {
+				//nolint:wrapcheck // Do not hide the error from the underlying writer.
+				return written, err
+			}
+
+			spare = data
+		case errors.Is(p.readErr, io.EOF):
+			return written, nil
+		case p.readErr != nil:
+			return written, p.readErr
+		default:
+			p.changed.Wait()
+		}
+	}
+}
+
+// closeRead makes writes return given error, or io.ErrClosedPipe if error is nil.
+func (p *contextPipe) closeRead(err error) {
+	if err == nil {
+		err = io.ErrClosedPipe
+	}
+
+	p.stop()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.writeErr == nil {
+		p.writeErr = err
+	}
+
+	p.changed.Broadcast()
+}
+
+// closeWrite makes reads return given error, or io.EOF if error is nil, once buffered data is read.
+func (p *contextPipe) closeWrite(err error) {
+	if err == nil {
+		err = io.EOF
+	}
+
+	p.stop()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.readErr == nil {
+		p.readErr = err
+	}
+
+	p.changed.Broadcast()
+}
+
+// Read ...
+func (r *ContextPipeReader) Read(b []byte) (int, error) {
+	return r.pipe.read(b)
+}
+
+// WriteTo writes data directly into given writer as it is written into the pipe, so io.Copy from the reader
+// avoids intermediate buffers.
+func (r *ContextPipeReader) WriteTo(dst io.Writer) (int64, error) {
+	return r.pipe.writeTo(dst)
+}
+
+// Close closes the reader, so subsequent writes return io.ErrClosedPipe.
+func (r *ContextPipeReader) Close() error {
+	return r.CloseWithError(nil)
+}
+
+// CloseWithError closes the reader, so subsequent writes return given error.
+func (r *ContextPipeReader) CloseWithError(err error) error {
+	r.pipe.closeRead(err)
+
+	return nil
+}
+
+// Write ...
+func (w *ContextPipeWriter) Write(b []byte) (int, error) {
+	return w.pipe.write(b)
+}
+
+// Close closes the writer, so reads return io.EOF once buffered data is read.
+func (w *ContextPipeWriter) Close() error {
+	return w.CloseWithError(nil)
+}
+
+// CloseWithError closes the writer, so reads return given error once buffered data is read.
+func (w *ContextPipeWriter) CloseWithError(err error) error {
+	w.pipe.closeWrite(err)
+
+	return nil
+}
@@ -0,0 +1,60 @@
+package compressor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrCanceled is returned when processing is stopped because its context was canceled or its deadline exceeded.
+// Returned errors still wrap original context error.
+var ErrCanceled = errors.New("operation canceled")
+
+// UnknownFormatError is returned when requested compression format is not available.
+type UnknownFormatError struct {
+	Format string
+}
+
+func (e *UnknownFormatError) Error() string {
+	return fmt.Sprintf("unknown compression format %q, expected one of %v", e.Format, AvailableFormats())
+}
+
+// ConfigValidationError is returned when client configuration is not valid.
+type ConfigValidationError struct {
+	Reason string
+}
+
+func (e *ConfigValidationError) Error() string {
+	return e.Reason
+}
+
+// canceledError marks error caused by context cancellation as ErrCanceled, keeping original error chain.
+type canceledError struct {
+	err error
+}
+
+func (e *canceledError) Error() string {
+	return e.err.Error()
+}
+
+func (e *canceledError) Unwrap() error {
+	return e.err
+}
+
+// Is ...
+func (e *canceledError) Is(target error) bool {
+	return target == ErrCanceled //nolint:errorlint,goerr113 // Sentinel is compared directly on purpose.
+}
+
+// wrapCanceled wraps given error with ErrCanceled if it was caused by context cancellation.
+func wrapCanceled(err error) error {
+	if err == nil || errors.Is(err, ErrCanceled) {
+		return err
+	}
+
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return &canceledError{err: err}
+	}
+
+	return err
+}
@@ -0,0 +1,74 @@
+package compressor
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// FlushableClient is implemented by clients, which can flush compressed data while input is still being
+// consumed, so receivers can start processing partial compressed output before the input is exhausted.
+// Like Compress, CompressFlush closes given input once processing stops.
+type FlushableClient interface {
+	CompressFlush(ctx context.Context, input io.ReadCloser, flushInterval int64) (io.ReadCloser, chan error)
+}
+
+// CompressFlush works like Compress, but flushes compressor every time flushInterval bytes is consumed
+// from the input.
+func (c *client) CompressFlush(
+	ctx context.Context, input io.ReadCloser, flushInterval int64,
+) (io.ReadCloser, chan error) {
+	c = c.current()
+	ctx = c.context(ctx)
+
+	if flushInterval < 1 {
+		err := fmt.Errorf("flush interval must be positive, got %d", flushInterval)
+
+		reader, writer := ContextPipe(ctx)
+
+		//nolint:errcheck // Closing pipe always returns nil.
+		writer.CloseWithError(err)
+
+		return reader, runJob(closingInput(input, func() error { return err }))
+	}
+
+	output, compress := c.prepareCompress(ctx, input, flushInterval)
+
+	return output, runJob(closingInput(input, compress))
+}
+
+// flusher is implemented by compressors supporting flushing pending data, like gzip.Writer.
+type flusher interface {
+	Flush() error
+}
+
+// copyFlushing copies data from src to dst, flushing dst every time given number of bytes is copied, if
+// dst supports flushing. If interval is not positive, data is copied without flushing. Copying stops once
+// given context is done.
+func (c *client) copyFlushing(ctx context.Context, dst io.Writer, src io.Reader, interval int64) error {
+	dstFlusher, ok := dst.(flusher)
+
+	if interval < 1 || !ok {
+		_, err := c.streamCopy(ctx, dst, src)
+
+		return err
+	}
+
+	for {
+		n, err := c.streamCopy(ctx, dst, io.LimitReader(src, interval))
+		if err != nil {
+			return err
+		}
+
+		if n > 0 {
+			if err := dstFlusher.Flush(); err != nil {
+				return fmt.Errorf("flushing: %w", err)
+			}
+		}
+
+		// Less data than requested means the input has ended.
+		if n < interval {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,210 @@
+// Package frame implements binary framing format used for block-compressed data.
+//
+// Stream starts with a header consisting of 4-byte magic number and 2-byte version. Header is followed by
+// blocks, each prefixed with its compressed size, uncompressed size and flags, optionally followed by CRC32
+// checksum of the uncompressed data. Stream ends with a terminal block with zero compressed size. Sizes of
+// compressed and uncompressed data of a single block are limited by MaxDataSize and MaxBlockSize.
+//
+// All integers are encoded in big-endian byte order.
+package frame
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// Version ...
+const Version uint16 = 1
+
+const (
+	// MaxBlockSize is a maximum size of uncompressed data of a single block. It bounds memory needed to process
+	// single block, as each block is held in memory as a whole.
+	MaxBlockSize = 64 << 20
+
+	// MaxDataSize is a maximum size of compressed data of a single frame. Compressed data may be bigger than
+	// uncompressed data for incompressible input, so twice the maximum block size is allowed.
+	MaxDataSize = 2 * MaxBlockSize
+)
+
+// Magic ...
+var Magic = [4]byte{'C', 'B', 'L', 'K'} //nolint:gochecknoglobals // Arrays can't be constants.
+
+const (
+	// Compressed size, uncompressed size and flags.
+	blockHeaderSize = 4 + 4 + 1
+	crc32Size       = 4
+
+	flagCRC32 byte = 1 << 0
+)
+
+// Frame represents single block of data.
+type Frame struct {
+	// Data is compressed block data. Empty data marks the end of the stream.
+	Data []byte
+
+	// UncompressedSize is size of the block data after decompression.
+	UncompressedSize uint32
+
+	// CRC32 is IEEE checksum of the uncompressed data, only written when HasCRC32 is true.
+	CRC32    uint32
+	HasCRC32 bool
+}
+
+// Verify checks if given uncompressed data matches the size and checksum stored in the frame.
+func (f Frame) Verify(data []byte) error {
+	if uint32(len(data)) != f.UncompressedSize {
+		return fmt.Errorf("expected %d bytes of uncompressed data, got %d", f.UncompressedSize, len(data))
+	}
+
+	if f.HasCRC32 && crc32.ChecksumIEEE(data) != f.CRC32 {
+		return fmt.Errorf("CRC32 checksum mismatch")
+	}
+
+	return nil
+}
+
+// WriteHeader writes stream header into given writer.
+func WriteHeader(w io.Writer) error {
+	header := make([]byte, len(Magic)+2)
+	copy(header, Magic[:])
+	binary.BigEndian.PutUint16(header[len(Magic):], Version)
+
+	if _, err := w.Write(header); err != nil {
+		return fmt.Errorf("writing header: %w", err)
+	}
+
+	return nil
+}
+
+// ReadHeader reads stream header from given reader and verifies if it's supported.
+func ReadHeader(r io.Reader) error {
+	header := make([]byte, len(Magic)+2)
+
+	if err := readFull(r, header); err != nil {
+		return fmt.Errorf("reading header: %w", err)
+	}
+
+	if [4]byte{header[0], header[1], header[2], header[3]} != Magic {
+		return fmt.Errorf("unexpected magic number %x", header[:len(Magic)])
+	}
+
+	if version := binary.BigEndian.Uint16(header[len(Magic):]); version != Version {
+		return fmt.Errorf("unsupported version %d", version)
+	}
+
+	return nil
+}
+
+// WriteFrame writes given frame into given writer. Frames exceeding MaxDataSize or MaxBlockSize are rejected,
+// as they could not be read back.
+func WriteFrame(w io.Writer, frame Frame) error {
+	if err := validateSizes(uint64(len(frame.Data)), frame.UncompressedSize); err != nil {
+		return fmt.Errorf("validating frame: %w", err)
+	}
+
+	size := blockHeaderSize + len(frame.Data)
+
+	if frame.HasCRC32 {
+		size += crc32Size
+	}
+
+	buf := make([]byte, size)
+	// Sizes are validated above, so they always fit.
+	binary.BigEndian.PutUint32(buf, uint32(len(frame.Data)))
+	binary.BigEndian.PutUint32(buf[4:], frame.UncompressedSize)
+
+	dataOffset := blockHeaderSize
+
+	if frame.HasCRC32 {
+		buf[8] |= flagCRC32
+		binary.BigEndian.PutUint32(buf[dataOffset:], frame.CRC32)
+		dataOffset += crc32Size
+	}
+
+	copy(buf[dataOffset:], frame.Data)
+
+	if _, err := w.Write(buf); err != nil {
+		return fmt.Errorf("writing frame: %w", err)
+	}
+
+	return nil
+}
+
+// WriteEnd writes terminal frame into given writer.
+func WriteEnd(w io.Writer) error {
+	return WriteFrame(w, Frame{})
+}
+
+// ReadFrame reads next frame from given reader. When terminal frame is read, io.EOF is returned. Frames
+// exceeding MaxDataSize or MaxBlockSize are rejected before allocating memory for them, as sizes come from
+// untrusted input.
+func ReadFrame(r io.Reader) (Frame, error) {
+	header := make([]byte, blockHeaderSize)
+
+	if err := readFull(r, header); err != nil {
+		return Frame{}, fmt.Errorf("reading frame header: %w", err)
+	}
+
+	frame := Frame{
+		UncompressedSize: binary.BigEndian.Uint32(header[4:]),
+		HasCRC32:         header[8]&flagCRC32 != 0,
+	}
+
+	compressedSize := binary.BigEndian.Uint32(header)
+
+	if err := validateSizes(uint64(compressedSize), frame.UncompressedSize); err != nil {
+		return Frame{}, fmt.Errorf("validating frame header: %w", err)
+	}
+
+	if frame.HasCRC32 {
+		checksum := make([]byte, crc32Size)
+
+		if err := readFull(r, checksum); err != nil {
+			return Frame{}, fmt.Errorf("reading frame checksum: %w", err)
+		}
+
+		frame.CRC32 = binary.BigEndian.Uint32(checksum)
+	}
+
+	if compressedSize == 0 {
+		return Frame{}, io.EOF
+	}
+
+	frame.Data = make([]byte, compressedSize)
+
+	if err := readFull(r, frame.Data); err != nil {
+		return Frame{}, fmt.Errorf("reading frame data: %w", err)
+	}
+
+	return frame, nil
+}
+
+// validateSizes ensures, that given sizes of frame data do not exceed supported maximums.
+func validateSizes(compressedSize uint64, uncompressedSize uint32) error {
+	if compressedSize > MaxDataSize {
+		return fmt.Errorf("compressed size %d exceeds maximum of %d bytes", compressedSize, MaxDataSize)
+	}
+
+	if uncompressedSize > MaxBlockSize {
+		return fmt.Errorf("uncompressed size %d exceeds maximum of %d bytes", uncompressedSize, MaxBlockSize)
+	}
+
+	return nil
+}
+
+// readFull works like io.ReadFull, but returns io.ErrUnexpectedEOF instead of io.EOF, as stream must
+// always end with the terminal frame.
+func readFull(r io.Reader, buf []byte) error {
+	if _, err := io.ReadFull(r, buf); err != nil {
+		if errors.Is(err, io.EOF) {
+			return io.ErrUnexpectedEOF
+		}
+
+		return err //nolint:wrapcheck // Error is wrapped by the caller.
+	}
+
+	return nil
+}
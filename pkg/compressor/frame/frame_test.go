@@ -0,0 +1,161 @@
+package frame_test
+
+import (
+	"bytes"
+	"errors"
+	"hash/crc32"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/invidian/golang-cli-testing-example/pkg/compressor/frame"
+)
+
+func Test_Reading_written_frames_restores_original_frames(t *testing.T) {
+	t.Parallel()
+
+	expectedFrames := []frame.Frame{
+		{
+			Data:             []byte("foo"),
+			UncompressedSize: 10,
+		},
+		{
+			Data:             []byte("bar"),
+			UncompressedSize: 3,
+			CRC32:            crc32.ChecksumIEEE([]byte("bar")),
+			HasCRC32:         true,
+		},
+	}
+
+	buf := &bytes.Buffer{}
+
+	if err := frame.WriteHeader(buf); err != nil {
+		t.Fatalf("Unexpected error writing header: %v", err)
+	}
+
+	for _, f := range expectedFrames {
+		if err := frame.WriteFrame(buf, f); err != nil {
+			t.Fatalf("Unexpected error writing frame: %v", err)
+		}
+	}
+
+	if err := frame.WriteEnd(buf); err != nil {
+		t.Fatalf("Unexpected error writing terminal frame: %v", err)
+	}
+
+	if err := frame.ReadHeader(buf); err != nil {
+		t.Fatalf("Unexpected error reading header: %v", err)
+	}
+
+	for i, expectedFrame := range expectedFrames {
+		f, err := frame.ReadFrame(buf)
+		if err != nil {
+			t.Fatalf("Unexpected error reading frame %d: %v", i, err)
+		}
+
+		if !reflect.DeepEqual(f, expectedFrame) {
+			t.Fatalf("Expected frame %d to be %+v, got %+v", i, expectedFrame, f)
+		}
+	}
+
+	if _, err := frame.ReadFrame(buf); !errors.Is(err, io.EOF) {
+		t.Fatalf("Expected %v after terminal frame, got %v", io.EOF, err)
+	}
+}
+
+func Test_Verifying_frame_returns_error_when(t *testing.T) {
+	t.Parallel()
+
+	data := []byte("foo")
+
+	for name, f := range map[string]frame.Frame{
+		"uncompressed_size_does_not_match": {UncompressedSize: 4},
+		"checksum_does_not_match":          {UncompressedSize: 3, HasCRC32: true, CRC32: 1},
+	} {
+		f := f
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			if err := f.Verify(data); err == nil {
+				t.Fatalf("Expected verification error")
+			}
+		})
+	}
+}
+
+func Test_Verifying_frame_succeeds_when_data_matches_size_and_checksum(t *testing.T) {
+	t.Parallel()
+
+	data := []byte("foo")
+
+	f := frame.Frame{UncompressedSize: 3, HasCRC32: true, CRC32: crc32.ChecksumIEEE(data)}
+
+	if err := f.Verify(data); err != nil {
+		t.Fatalf("Unexpected verification error: %v", err)
+	}
+}
+
+func Test_Reading_header_returns_error_when(t *testing.T) {
+	t.Parallel()
+
+	for name, header := range map[string][]byte{
+		"input_is_empty":             {},
+		"magic_number_is_unexpected": {'F', 'O', 'O', 'O', 0, 1},
+		"version_is_not_supported":   append(frame.Magic[:], 0, 2),
+	} {
+		header := header
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			err := frame.ReadHeader(bytes.NewBuffer(header))
+			if err == nil {
+				t.Fatalf("Expected error reading header")
+			}
+
+			if errors.Is(err, io.EOF) {
+				t.Fatalf("Error must not be %v to not be mistaken with end of stream", io.EOF)
+			}
+		})
+	}
+}
+
+func Test_Writing_frame_returns_error_when_uncompressed_size_exceeds_maximum(t *testing.T) {
+	t.Parallel()
+
+	f := frame.Frame{Data: []byte("foo"), UncompressedSize: frame.MaxBlockSize + 1}
+
+	if err := frame.WriteFrame(&bytes.Buffer{}, f); err == nil {
+		t.Fatalf("Expected error writing frame")
+	}
+}
+
+func Test_Reading_frame_returns_error_when(t *testing.T) {
+	t.Parallel()
+
+	for name, data := range map[string][]byte{
+		"input_ends_without_terminal_frame": {},
+		"frame_header_is_truncated":         {0, 0, 0, 1},
+		"checksum_is_truncated":             {0, 0, 0, 1, 0, 0, 0, 1, 1, 0},
+		"frame_data_is_truncated":           {0, 0, 0, 2, 0, 0, 0, 1, 0, 1},
+		"compressed_size_exceeds_maximum":   {0x08, 0, 0, 1, 0, 0, 0, 1, 0, 1},
+		"uncompressed_size_exceeds_maximum": {0, 0, 0, 1, 0x04, 0, 0, 1, 0, 1},
+		"compressed_size_is_maximum_uint32": {0xff, 0xff, 0xff, 0xff, 0, 0, 0, 1, 0, 1},
+	} {
+		data := data
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := frame.ReadFrame(bytes.NewBuffer(data))
+			if err == nil {
+				t.Fatalf("Expected error reading frame")
+			}
+
+			if errors.Is(err, io.EOF) {
+				t.Fatalf("Error must not be %v to not be mistaken with end of stream", io.EOF)
+			}
+		})
+	}
+}
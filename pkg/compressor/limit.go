@@ -0,0 +1,36 @@
+package compressor
+
+import (
+	"fmt"
+	"io"
+)
+
+// limitedWriter returns an error once more data than the configured limit is written into it.
+type limitedWriter struct {
+	writer  io.Writer
+	limit   int64
+	written int64
+}
+
+func (l *limitedWriter) Write(p []byte) (int, error) {
+	exceeded := false
+
+	if remaining := l.limit - l.written; int64(len(p)) > remaining {
+		p = p[:remaining]
+		exceeded = true
+	}
+
+	n, err := l.writer.Write(p)
+	l.written += int64(n)
+
+	if err != nil {
+		//nolint:wrapcheck // Do not hide the error from the underlying writer.
+		return n, err
+	}
+
+	if exceeded {
+		return n, fmt.Errorf("decompressed data exceeds limit of %d bytes", l.limit)
+	}
+
+	return n, nil
+}
@@ -0,0 +1,119 @@
+package compressor
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"time"
+)
+
+// countingReader counts bytes read from the underlying reader.
+type countingReader struct {
+	reader io.Reader
+	count  int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.reader.Read(p)
+	c.count += int64(n)
+
+	//nolint:wrapcheck // Do not hide the error from the underlying reader.
+	return n, err
+}
+
+// countingWriter counts bytes written into the underlying writer.
+type countingWriter struct {
+	io.Writer
+	count int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.Writer.Write(p)
+	c.count += int64(n)
+
+	//nolint:wrapcheck // Do not hide the error from the underlying writer.
+	return n, err
+}
+
+// countingWriteCloser is countingWriter, which can be closed.
+type countingWriteCloser struct {
+	countingWriter
+
+	closer io.Closer
+}
+
+func newCountingWriteCloser(w io.WriteCloser) *countingWriteCloser {
+	return &countingWriteCloser{
+		countingWriter: countingWriter{Writer: w},
+		closer:         w,
+	}
+}
+
+// Close ...
+func (c *countingWriteCloser) Close() error {
+	//nolint:wrapcheck // Do not hide the error from the underlying writer.
+	return c.closer.Close()
+}
+
+// startOperation logs start of given operation and starts a span for it, if logger or tracer are configured.
+// Returned function must be called once operation finishes.
+func (c *client) startOperation(
+	ctx context.Context, operation, spanName string,
+) func(inputBytes, outputBytes int64, err error) {
+	var span Span
+
+	if c.tracer != nil {
+		ctx, span = c.tracer.Start(ctx, spanName)
+	}
+
+	c.logStarted(ctx, operation)
+
+	start := time.Now()
+
+	return func(inputBytes, outputBytes int64, err error) {
+		c.logFinished(ctx, operation, start, inputBytes, outputBytes, err)
+
+		if span == nil {
+			return
+		}
+
+		span.SetAttributes(
+			Attribute{Key: AttributeFormat, Value: string(c.format)},
+			Attribute{Key: AttributeInputBytes, Value: inputBytes},
+			Attribute{Key: AttributeOutputBytes, Value: outputBytes},
+		)
+		span.End(err)
+	}
+}
+
+// logStarted logs start of given operation if logger is configured.
+func (c *client) logStarted(ctx context.Context, operation string) {
+	if c.logger == nil {
+		return
+	}
+
+	c.logger.DebugContext(ctx, "processing started", slog.String("operation", operation), slog.Any("format", c.format))
+}
+
+// logFinished logs result of given operation if logger is configured.
+func (c *client) logFinished(
+	ctx context.Context, operation string, start time.Time, inputBytes, outputBytes int64, err error,
+) {
+	if c.logger == nil {
+		return
+	}
+
+	attrs := []slog.Attr{
+		slog.String("operation", operation),
+		slog.Any("format", c.format),
+		slog.Int64("input_bytes", inputBytes),
+		slog.Int64("output_bytes", outputBytes),
+		slog.Duration("duration", time.Since(start)),
+	}
+
+	if err != nil {
+		attrs = append(attrs, slog.Any("error", err))
+	}
+
+	c.logger.LogAttrs(ctx, slog.LevelDebug, "processing finished", attrs...)
+}
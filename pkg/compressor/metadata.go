@@ -0,0 +1,145 @@
+package compressor
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Gzip extra field subfield ID used for storing metadata, as described in RFC 1952, section 2.3.1.1.
+var gzipMetadataSubfieldID = [2]byte{'M', 'D'}
+
+const gzipSubfieldHeaderLength = 4
+
+// writeMetadata embeds configured metadata into the compressed stream. It must be called before any data is
+// written into the compressor.
+func (c *client) writeMetadata(compressor io.WriteCloser) error {
+	gzipWriter, isGzip := compressor.(*gzip.Writer)
+	if isGzip {
+		gzipWriter.Name = c.originalName
+		gzipWriter.ModTime = c.modTime
+	}
+
+	if c.metadata == nil {
+		return nil
+	}
+
+	if isGzip {
+		extra, err := encodeGzipMetadata(c.metadata)
+		if err != nil {
+			return fmt.Errorf("encoding metadata: %w", err)
+		}
+
+		gzipWriter.Extra = extra
+
+		return nil
+	}
+
+	if c.format == FormatNoop {
+		if err := json.NewEncoder(compressor).Encode(c.metadata); err != nil {
+			return fmt.Errorf("writing metadata envelope: %w", err)
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("metadata is not supported by configured compressor")
+}
+
+// newDecompressor creates decompressor for given input and passes metadata and gzip header found in the input
+// to the configured readers.
+func (c *client) newDecompressor(input io.Reader) (io.ReadCloser, error) {
+	var metadata map[string]string
+
+	if c.metadataReader != nil && c.format == FormatNoop {
+		bufferedInput := bufio.NewReader(input)
+
+		envelope, err := bufferedInput.ReadBytes('\n')
+		if err != nil {
+			return nil, fmt.Errorf("reading metadata envelope: %w", err)
+		}
+
+		if err := json.Unmarshal(envelope, &metadata); err != nil {
+			return nil, fmt.Errorf("decoding metadata envelope: %w", err)
+		}
+
+		input = bufferedInput
+	}
+
+	decompressor, err := c.decompressor(input)
+	if err != nil {
+		return nil, err
+	}
+
+	gzipReader, isGzip := decompressor.(*gzip.Reader)
+
+	if isGzip && c.headerReader != nil {
+		c.headerReader(gzipReader.Header)
+	}
+
+	if c.metadataReader == nil {
+		return decompressor, nil
+	}
+
+	switch {
+	case isGzip:
+		if metadata, err = decodeGzipMetadata(gzipReader.Extra); err != nil {
+			return nil, fmt.Errorf("decoding metadata: %w", err)
+		}
+	case c.format != FormatNoop:
+		return nil, fmt.Errorf("metadata is not supported by configured decompressor")
+	}
+
+	c.metadataReader(metadata)
+
+	return decompressor, nil
+}
+
+func encodeGzipMetadata(metadata map[string]string) ([]byte, error) {
+	payload, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, fmt.Errorf("encoding metadata to JSON: %w", err)
+	}
+
+	if len(payload) > math.MaxUint16-gzipSubfieldHeaderLength {
+		return nil, fmt.Errorf("metadata is too big, got %d bytes", len(payload))
+	}
+
+	extra := make([]byte, gzipSubfieldHeaderLength, gzipSubfieldHeaderLength+len(payload))
+	copy(extra, gzipMetadataSubfieldID[:])
+	binary.LittleEndian.PutUint16(extra[2:], uint16(len(payload)))
+
+	return append(extra, payload...), nil
+}
+
+// decodeGzipMetadata returns nil if given extra field does not carry any metadata.
+func decodeGzipMetadata(extra []byte) (map[string]string, error) {
+	for len(extra) >= gzipSubfieldHeaderLength {
+		length := int(binary.LittleEndian.Uint16(extra[2:]))
+		subfield := extra[gzipSubfieldHeaderLength:]
+
+		if len(subfield) < length {
+			return nil, fmt.Errorf("malformed gzip extra field")
+		}
+
+		if [2]byte{extra[0], extra[1]} != gzipMetadataSubfieldID {
+			extra = subfield[length:]
+
+			continue
+		}
+
+		metadata := map[string]string{}
+
+		if err := json.Unmarshal(subfield[:length], &metadata); err != nil {
+			return nil, fmt.Errorf("decoding metadata from JSON: %w", err)
+		}
+
+		return metadata, nil
+	}
+
+	return nil, nil
+}
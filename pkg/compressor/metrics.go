@@ -0,0 +1,118 @@
+package compressor
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+const (
+	// OperationCompress is operation reported to MetricsRecorder for compression.
+	OperationCompress = "compress"
+	// OperationDecompress is operation reported to MetricsRecorder for decompression.
+	OperationDecompress = "decompress"
+)
+
+// MetricsRecorder receives measurements from InstrumentedClient. It allows exporting metrics using libraries like
+// Prometheus without making this package depend on them, e.g. as compressor_bytes_in_total{format},
+// compressor_bytes_out_total{format} and compressor_duration_seconds{format,operation}. Methods are called
+// concurrently.
+type MetricsRecorder interface {
+	// AddBytesIn is called every time data is consumed from the input.
+	AddBytesIn(format Format, bytes int64)
+	// AddBytesOut is called every time data is read from the output.
+	AddBytesOut(format Format, bytes int64)
+	// ObserveDuration is called once processing finishes.
+	ObserveDuration(format Format, operation string, duration time.Duration)
+}
+
+// InstrumentedClient wraps a Client and reports throughput and latency of Compress and Decompress calls to
+// MetricsRecorder. Other methods are passed to wrapped client as is.
+type InstrumentedClient struct {
+	Client
+
+	recorder MetricsRecorder
+}
+
+// NewInstrumentedClient creates InstrumentedClient wrapping given client.
+func NewInstrumentedClient(client Client, recorder MetricsRecorder) *InstrumentedClient {
+	return &InstrumentedClient{
+		Client:   client,
+		recorder: recorder,
+	}
+}
+
+// Compress ...
+func (i *InstrumentedClient) Compress(ctx context.Context, input io.ReadCloser) (io.ReadCloser, chan error) {
+	return i.instrument(OperationCompress, input, func(input io.ReadCloser) (io.ReadCloser, chan error) {
+		return i.Client.Compress(ctx, input)
+	})
+}
+
+// Decompress ...
+func (i *InstrumentedClient) Decompress(ctx context.Context, input io.ReadCloser) (io.ReadCloser, chan error) {
+	return i.instrument(OperationDecompress, input, func(input io.ReadCloser) (io.ReadCloser, chan error) {
+		return i.Client.Decompress(ctx, input)
+	})
+}
+
+// Format ...
+func (i *InstrumentedClient) Format() Format {
+	return formatOf(i.Client)
+}
+
+func (i *InstrumentedClient) instrument(
+	operation string, input io.ReadCloser, process func(io.ReadCloser) (io.ReadCloser, chan error),
+) (io.ReadCloser, chan error) {
+	format := formatOf(i.Client)
+	start := time.Now()
+
+	output, errCh := process(&recordingReadCloser{
+		recordingReader: recordingReader{
+			reader: input,
+			record: func(n int64) { i.recorder.AddBytesIn(format, n) },
+		},
+		closer: input,
+	})
+
+	instrumentedErrCh := afterJob(errCh, func(error) {
+		i.recorder.ObserveDuration(format, operation, time.Since(start))
+	})
+
+	return &recordingReadCloser{
+		recordingReader: recordingReader{
+			reader: output,
+			record: func(n int64) { i.recorder.AddBytesOut(format, n) },
+		},
+		closer: output,
+	}, instrumentedErrCh
+}
+
+// recordingReader reports number of bytes read from the underlying reader.
+type recordingReader struct {
+	reader io.Reader
+	record func(int64)
+}
+
+func (r *recordingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		r.record(int64(n))
+	}
+
+	//nolint:wrapcheck // Do not hide the error from the underlying reader.
+	return n, err
+}
+
+// recordingReadCloser is recordingReader, which can be closed.
+type recordingReadCloser struct {
+	recordingReader
+
+	closer io.Closer
+}
+
+// Close ...
+func (r *recordingReadCloser) Close() error {
+	//nolint:wrapcheck // Do not hide the error from the underlying reader.
+	return r.closer.Close()
+}
@@ -0,0 +1,79 @@
+package compressor
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"time"
+)
+
+// Middleware wraps a Client to add behavior like logging, metrics or rate limiting without modifying the
+// wrapped client.
+type Middleware func(Client) Client
+
+// Chain wraps base client with given middlewares. First middleware is the outermost one, so it sees calls
+// first.
+func Chain(base Client, mws ...Middleware) Client {
+	client := base
+
+	for i := len(mws) - 1; i >= 0; i-- {
+		client = mws[i](client)
+	}
+
+	return client
+}
+
+// LoggingMiddleware logs every compression and decompression once it finishes, including its duration and error.
+func LoggingMiddleware(logger *slog.Logger) Middleware {
+	return func(client Client) Client {
+		return &loggingClient{
+			Client: client,
+			logger: logger,
+		}
+	}
+}
+
+type loggingClient struct {
+	Client
+
+	logger *slog.Logger
+}
+
+// Compress ...
+func (l *loggingClient) Compress(ctx context.Context, input io.ReadCloser) (io.ReadCloser, chan error) {
+	output, errCh := l.Client.Compress(ctx, input)
+
+	return output, l.logResult(ctx, OperationCompress, errCh)
+}
+
+// Decompress ...
+func (l *loggingClient) Decompress(ctx context.Context, input io.ReadCloser) (io.ReadCloser, chan error) {
+	output, errCh := l.Client.Decompress(ctx, input)
+
+	return output, l.logResult(ctx, OperationDecompress, errCh)
+}
+
+// Format ...
+func (l *loggingClient) Format() Format {
+	return formatOf(l.Client)
+}
+
+func (l *loggingClient) logResult(ctx context.Context, operation string, errCh chan error) chan error {
+	start := time.Now()
+
+	return afterJob(errCh, func(err error) {
+		attrs := []slog.Attr{
+			slog.String("operation", operation),
+			slog.Any("format", formatOf(l.Client)),
+			slog.Duration("duration", time.Since(start)),
+		}
+
+		if err != nil {
+			l.logger.LogAttrs(ctx, slog.LevelError, "processing failed", append(attrs, slog.Any("error", err))...)
+
+			return
+		}
+
+		l.logger.LogAttrs(ctx, slog.LevelInfo, "processing finished", attrs...)
+	})
+}
@@ -0,0 +1,106 @@
+package compressor
+
+import (
+	"context"
+	"io"
+	"log/slog"
+)
+
+// Option configures client created using NewClientWithOptions.
+type Option func(*Config)
+
+// WithFormat selects one of built-in compression formats.
+func WithFormat(f Format) Option {
+	return func(c *Config) {
+		c.Format = f
+	}
+}
+
+// WithCompressor sets custom compressor. It must be used together with WithDecompressor.
+func WithCompressor(fn func(io.WriteCloser) io.WriteCloser) Option {
+	return func(c *Config) {
+		c.Compressor = fn
+	}
+}
+
+// WithDecompressor sets custom decompressor. It must be used together with WithCompressor.
+func WithDecompressor(fn func(io.Reader) (io.ReadCloser, error)) Option {
+	return func(c *Config) {
+		c.Decompressor = fn
+	}
+}
+
+// WithLevel sets compression level of gzip format, e.g. gzip.BestSpeed.
+func WithLevel(level int) Option {
+	return func(c *Config) {
+		c.Level = &level
+	}
+}
+
+// WithMaxRetries sets how many times compression of seekable input is retried when it fails.
+func WithMaxRetries(retries int) Option {
+	return func(c *Config) {
+		c.MaxRetries = retries
+	}
+}
+
+// WithTeeWriter sets writer receiving input data as it is consumed during compression.
+func WithTeeWriter(w io.Writer) Option {
+	return func(c *Config) {
+		c.TeeWriter = w
+	}
+}
+
+// WithContext sets default context used when nil context is passed to client methods.
+func WithContext(ctx context.Context) Option {
+	return func(c *Config) {
+		c.DefaultContext = ctx
+	}
+}
+
+// WithLogger sets logger receiving debug messages about processing.
+func WithLogger(logger *slog.Logger) Option {
+	return func(c *Config) {
+		c.Logger = logger
+	}
+}
+
+// WithTracer sets tracer starting spans for processing.
+func WithTracer(tracer Tracer) Option {
+	return func(c *Config) {
+		c.Tracer = tracer
+	}
+}
+
+// WithPipeBufferSize sets number of bytes of processed data buffered until they are read.
+func WithPipeBufferSize(size int) Option {
+	return func(c *Config) {
+		c.PipeBufferSize = size
+	}
+}
+
+// WithChunkSize sets number of bytes processed between checks of the context.
+func WithChunkSize(size int) Option {
+	return func(c *Config) {
+		c.ChunkSize = size
+	}
+}
+
+// WithConfig replaces configuration built so far with given one, so options can be used to override only
+// selected fields of existing configuration.
+func WithConfig(config Config) Option {
+	return func(c *Config) {
+		*c = config
+	}
+}
+
+// NewClientWithOptions creates client configured using given options. Without options, client uses gzip format.
+func NewClientWithOptions(opts ...Option) (Client, error) {
+	config := Config{}
+
+	for _, opt := range opts {
+		opt(&config)
+	}
+
+	return NewClient(config)
+}
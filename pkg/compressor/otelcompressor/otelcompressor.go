@@ -0,0 +1,80 @@
+// Package otelcompressor provides OpenTelemetry tracing for compressor clients. It is a separate package, so
+// users not interested in tracing do not need to import OpenTelemetry.
+package otelcompressor
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/invidian/golang-cli-testing-example/pkg/compressor"
+)
+
+// InstrumentationName is name of the tracer obtained from given tracer provider.
+const InstrumentationName = "github.com/invidian/golang-cli-testing-example/pkg/compressor"
+
+// Tracer implements compressor.Tracer using OpenTelemetry. Spans are only started when processing context
+// carries a valid span, so processing is not traced on its own.
+type Tracer struct {
+	tracer trace.Tracer
+}
+
+// NewTracer creates tracer using given tracer provider, e.g. otel.GetTracerProvider().
+func NewTracer(provider trace.TracerProvider) *Tracer {
+	return &Tracer{
+		tracer: provider.Tracer(InstrumentationName),
+	}
+}
+
+// Start ...
+func (t *Tracer) Start(ctx context.Context, spanName string) (context.Context, compressor.Span) {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return ctx, noopSpan{}
+	}
+
+	ctx, span := t.tracer.Start(ctx, spanName)
+
+	return ctx, &otelSpan{span: span}
+}
+
+type otelSpan struct {
+	span trace.Span
+}
+
+// SetAttributes ...
+func (s *otelSpan) SetAttributes(attributes ...compressor.Attribute) {
+	keyValues := make([]attribute.KeyValue, 0, len(attributes))
+
+	for _, a := range attributes {
+		switch value := a.Value.(type) {
+		case string:
+			keyValues = append(keyValues, attribute.String(a.Key, value))
+		case int64:
+			keyValues = append(keyValues, attribute.Int64(a.Key, value))
+		default:
+			keyValues = append(keyValues, attribute.String(a.Key, fmt.Sprint(value)))
+		}
+	}
+
+	s.span.SetAttributes(keyValues...)
+}
+
+// End ...
+func (s *otelSpan) End(err error) {
+	if err != nil {
+		s.span.RecordError(err)
+		s.span.SetStatus(codes.Error, err.Error())
+	}
+
+	s.span.End()
+}
+
+// noopSpan is returned when processing context does not carry a span.
+type noopSpan struct{}
+
+func (noopSpan) SetAttributes(...compressor.Attribute) {}
+
+func (noopSpan) End(error) {}
@@ -0,0 +1,88 @@
+package otelcompressor_test
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/invidian/golang-cli-testing-example/internal/testutil"
+	"github.com/invidian/golang-cli-testing-example/pkg/compressor"
+	"github.com/invidian/golang-cli-testing-example/pkg/compressor/otelcompressor"
+)
+
+const testData = "foo"
+
+func compress(ctx context.Context, t *testing.T, tracer compressor.Tracer) {
+	t.Helper()
+
+	client, err := compressor.NewClientWithOptions(compressor.WithTracer(tracer))
+	if err != nil {
+		t.Fatalf("Unexpected error creating client: %v", err)
+	}
+
+	output, errCh := client.Compress(ctx, io.NopCloser(strings.NewReader(testData)))
+
+	if _, err := io.ReadAll(output); err != nil {
+		t.Fatalf("Unexpected error reading compressed data: %v", err)
+	}
+
+	if err := <-errCh; err != nil {
+		t.Fatalf("Unexpected compression error: %v", err)
+	}
+}
+
+func Test_Tracer_starts_child_span_with_compression_attributes(t *testing.T) {
+	t.Parallel()
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	ctx, parent := provider.Tracer("test").Start(testutil.ContextWithDeadline(t), "parent")
+
+	compress(ctx, t, otelcompressor.NewTracer(provider))
+
+	parent.End()
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("Expected 2 spans to be recorded, got %d", len(spans))
+	}
+
+	span := spans[0]
+
+	if span.Name() != compressor.SpanNameCompress {
+		t.Fatalf("Expected span %q, got %q", compressor.SpanNameCompress, span.Name())
+	}
+
+	if span.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Fatalf("Expected span to be child of parent span")
+	}
+
+	attributes := attribute.NewSet(span.Attributes()...)
+
+	if value, _ := attributes.Value(compressor.AttributeInputBytes); value.AsInt64() != int64(len(testData)) {
+		t.Fatalf("Expected %d input bytes, got %v", len(testData), value.Emit())
+	}
+
+	if value, _ := attributes.Value(compressor.AttributeFormat); value.AsString() != string(compressor.FormatGzip) {
+		t.Fatalf("Expected format %q, got %q", compressor.FormatGzip, value.Emit())
+	}
+}
+
+func Test_Tracer_does_not_start_span_when_context_carries_no_span(t *testing.T) {
+	t.Parallel()
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	compress(testutil.ContextWithDeadline(t), t, otelcompressor.NewTracer(provider))
+
+	if spans := recorder.Ended(); len(spans) != 0 {
+		t.Fatalf("Expected no spans to be recorded, got %d", len(spans))
+	}
+}
@@ -0,0 +1,24 @@
+package compressor
+
+import (
+	"context"
+	"io"
+)
+
+// Pipe chains compression stages, so output of each stage is used as an input for the next one, e.g. to
+// compress data and then encrypt it. Returned error channels are ordered the same way as given stages and
+// all of them should be drained after reading the output. Given input is closed by the first stage.
+func Pipe(ctx context.Context, input io.ReadCloser, stages ...Client) (io.Reader, []chan error) {
+	errChs := make([]chan error, 0, len(stages))
+	output := input
+
+	for _, stage := range stages {
+		var errCh chan error
+
+		output, errCh = stage.Compress(ctx, output)
+
+		errChs = append(errChs, errCh)
+	}
+
+	return output, errChs
+}
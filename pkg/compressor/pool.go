@@ -0,0 +1,107 @@
+package compressor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Pool runs compression and decompression using fixed number of pre-started worker goroutines, which avoids
+// spawning new goroutine for every request in high-throughput scenarios.
+//
+// When all workers are busy, Compress and Decompress block until either a worker becomes idle or given
+// context is cancelled, so reading data returned from the pool should not depend on another pool request.
+type Pool struct {
+	client *client
+	jobs   chan func()
+	wg     sync.WaitGroup
+}
+
+// NewPool creates a pool with given number of workers, using given configuration the same way as NewClient.
+func NewPool(workers int, configs ...Config) (*Pool, error) {
+	if workers < 1 {
+		return nil, fmt.Errorf("at least one worker is required, got %d", workers)
+	}
+
+	c, err := NewClient(configs...)
+	if err != nil {
+		return nil, fmt.Errorf("creating client: %w", err)
+	}
+
+	pool := &Pool{
+		//nolint:forcetypeassert // NewClient always returns *client.
+		client: c.(*client),
+		jobs:   make(chan func()),
+	}
+
+	pool.wg.Add(workers)
+
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer pool.wg.Done()
+
+			for job := range pool.jobs {
+				job()
+			}
+		}()
+	}
+
+	return pool, nil
+}
+
+// Compress ...
+func (p *Pool) Compress(ctx context.Context, input io.ReadCloser) (io.ReadCloser, chan error) {
+	client := p.client.current()
+	ctx = client.context(ctx)
+
+	output, compress := client.prepareCompress(ctx, input, 0)
+
+	return output, p.schedule(ctx, input, closingInput(input, compress))
+}
+
+// Decompress ...
+func (p *Pool) Decompress(ctx context.Context, input io.ReadCloser) (io.ReadCloser, chan error) {
+	client := p.client.current()
+	ctx = client.context(ctx)
+
+	output, decompress := client.prepareDecompress(ctx, input)
+
+	return output, p.schedule(ctx, input, closingInput(input, decompress))
+}
+
+// Reload ...
+func (p *Pool) Reload(config Config) error {
+	return p.client.Reload(config)
+}
+
+// Close stops all workers once they finish currently running jobs. Pool must not be used after closing.
+func (p *Pool) Close() {
+	close(p.jobs)
+
+	p.wg.Wait()
+}
+
+// schedule runs given job using idle worker. If context is done before any worker becomes idle, job is not run
+// and given input is closed instead.
+func (p *Pool) schedule(ctx context.Context, input io.Closer, job func() error) chan error {
+	errCh := make(chan error, 1)
+
+	select {
+	case p.jobs <- func() {
+		errCh <- wrapCanceled(job())
+
+		close(errCh)
+	}:
+	case <-ctx.Done():
+		//nolint:errcheck // Input is only read, so closing errors can be ignored.
+		input.Close()
+
+		// Returned reader is bound to the same context, so reading from it won't block.
+		errCh <- wrapCanceled(fmt.Errorf("waiting for idle worker: %w", ctx.Err()))
+
+		close(errCh)
+	}
+
+	return errCh
+}
@@ -0,0 +1,62 @@
+// Package promcompressor provides Prometheus metrics for compressor clients. It is a separate package, so users
+// not interested in metrics do not need to import Prometheus client.
+package promcompressor
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/invidian/golang-cli-testing-example/pkg/compressor"
+)
+
+// Recorder implements compressor.MetricsRecorder using Prometheus counters and histogram.
+type Recorder struct {
+	bytesIn  *prometheus.CounterVec
+	bytesOut *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+}
+
+// NewRecorder creates recorder and registers its metrics using given registerer,
+// e.g. prometheus.DefaultRegisterer.
+func NewRecorder(registerer prometheus.Registerer) (*Recorder, error) {
+	recorder := &Recorder{
+		bytesIn: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "compressor_bytes_in_total",
+			Help: "Total number of bytes consumed from the input.",
+		}, []string{"format"}),
+		bytesOut: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "compressor_bytes_out_total",
+			Help: "Total number of bytes produced.",
+		}, []string{"format"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "compressor_duration_seconds",
+			Help:    "Duration of compression and decompression.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"format", "operation"}),
+	}
+
+	for _, collector := range []prometheus.Collector{recorder.bytesIn, recorder.bytesOut, recorder.duration} {
+		if err := registerer.Register(collector); err != nil {
+			return nil, fmt.Errorf("registering collector: %w", err)
+		}
+	}
+
+	return recorder, nil
+}
+
+// AddBytesIn ...
+func (r *Recorder) AddBytesIn(format compressor.Format, bytes int64) {
+	r.bytesIn.WithLabelValues(string(format)).Add(float64(bytes))
+}
+
+// AddBytesOut ...
+func (r *Recorder) AddBytesOut(format compressor.Format, bytes int64) {
+	r.bytesOut.WithLabelValues(string(format)).Add(float64(bytes))
+}
+
+// ObserveDuration ...
+func (r *Recorder) ObserveDuration(format compressor.Format, operation string, duration time.Duration) {
+	r.duration.WithLabelValues(string(format), operation).Observe(duration.Seconds())
+}
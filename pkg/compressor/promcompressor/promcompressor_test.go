@@ -0,0 +1,75 @@
+package promcompressor_test
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/invidian/golang-cli-testing-example/internal/testutil"
+	"github.com/invidian/golang-cli-testing-example/pkg/compressor"
+	"github.com/invidian/golang-cli-testing-example/pkg/compressor/promcompressor"
+)
+
+const testData = "foo"
+
+func Test_Recorder_exports_metrics_of_instrumented_client(t *testing.T) {
+	t.Parallel()
+
+	registry := prometheus.NewRegistry()
+
+	recorder, err := promcompressor.NewRecorder(registry)
+	if err != nil {
+		t.Fatalf("Unexpected error creating recorder: %v", err)
+	}
+
+	client, err := compressor.NewClient()
+	if err != nil {
+		t.Fatalf("Unexpected error creating client: %v", err)
+	}
+
+	instrumentedClient := compressor.NewInstrumentedClient(client, recorder)
+
+	input := io.NopCloser(strings.NewReader(testData))
+
+	output, errCh := instrumentedClient.Compress(testutil.ContextWithDeadline(t), input)
+
+	if _, err := io.ReadAll(output); err != nil {
+		t.Fatalf("Unexpected error reading compressed data: %v", err)
+	}
+
+	if err := <-errCh; err != nil {
+		t.Fatalf("Unexpected compression error: %v", err)
+	}
+
+	expectedBytesIn := `
+# HELP compressor_bytes_in_total Total number of bytes consumed from the input.
+# TYPE compressor_bytes_in_total counter
+compressor_bytes_in_total{format="gzip"} 3
+`
+
+	if err := promtestutil.GatherAndCompare(registry, strings.NewReader(expectedBytesIn),
+		"compressor_bytes_in_total"); err != nil {
+		t.Fatalf("Unexpected metrics: %v", err)
+	}
+
+	if count := promtestutil.CollectAndCount(registry, "compressor_duration_seconds"); count != 1 {
+		t.Fatalf("Expected 1 duration series, got %d", count)
+	}
+}
+
+func Test_Creating_recorder_returns_error_when_metrics_are_already_registered(t *testing.T) {
+	t.Parallel()
+
+	registry := prometheus.NewRegistry()
+
+	if _, err := promcompressor.NewRecorder(registry); err != nil {
+		t.Fatalf("Unexpected error creating recorder: %v", err)
+	}
+
+	if _, err := promcompressor.NewRecorder(registry); err == nil {
+		t.Fatalf("Expected error registering metrics twice")
+	}
+}
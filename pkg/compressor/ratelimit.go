@@ -0,0 +1,150 @@
+package compressor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+
+	"golang.org/x/time/rate"
+)
+
+// RateLimitMiddleware limits how fast input data is consumed by client methods, so processing does
+// not saturate I/O bandwidth. Limit is shared by all operations of the wrapped client. If bytes per second is not
+// positive, client is returned unchanged.
+func RateLimitMiddleware(bytesPerSecond int64) Middleware {
+	return func(client Client) Client {
+		if bytesPerSecond < 1 {
+			return client
+		}
+
+		burst := bytesPerSecond
+		if burst > math.MaxInt32 {
+			burst = math.MaxInt32
+		}
+
+		limited := &rateLimitedClient{
+			Client:  client,
+			limiter: rate.NewLimiter(rate.Limit(bytesPerSecond), int(burst)),
+		}
+
+		// Block processing is only offered when wrapped client supports it.
+		if blockClient, ok := client.(BlockClient); ok {
+			return &rateLimitedBlockClient{
+				rateLimitedClient: limited,
+				blockClient:       blockClient,
+			}
+		}
+
+		return limited
+	}
+}
+
+type rateLimitedClient struct {
+	Client
+
+	limiter *rate.Limiter
+}
+
+// Compress ...
+func (r *rateLimitedClient) Compress(ctx context.Context, input io.ReadCloser) (io.ReadCloser, chan error) {
+	return r.Client.Compress(ctx, &rateLimitedReadCloser{
+		rateLimitedReader: r.limit(ctx, input),
+		closer:            input,
+	})
+}
+
+// Decompress ...
+func (r *rateLimitedClient) Decompress(ctx context.Context, input io.ReadCloser) (io.ReadCloser, chan error) {
+	return r.Client.Decompress(ctx, &rateLimitedReadCloser{
+		rateLimitedReader: r.limit(ctx, input),
+		closer:            input,
+	})
+}
+
+// Format ...
+func (r *rateLimitedClient) Format() Format {
+	return formatOf(r.Client)
+}
+
+func (r *rateLimitedClient) limit(ctx context.Context, input io.Reader) *rateLimitedReader {
+	// Middleware has no default context configured, so it falls back to background context.
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	return &rateLimitedReader{
+		ctx:     ctx,
+		reader:  input,
+		limiter: r.limiter,
+	}
+}
+
+// rateLimitedBlockClient is rateLimitedClient wrapping client, which implements BlockClient.
+type rateLimitedBlockClient struct {
+	*rateLimitedClient
+
+	blockClient BlockClient
+}
+
+// CompressBlocks ...
+func (r *rateLimitedBlockClient) CompressBlocks(
+	ctx context.Context, input io.ReadCloser, blockSize, parallelism int,
+) (io.ReadCloser, chan error) {
+	return r.blockClient.CompressBlocks(ctx, &rateLimitedReadCloser{
+		rateLimitedReader: r.limit(ctx, input),
+		closer:            input,
+	}, blockSize, parallelism)
+}
+
+// DecompressBlocks ...
+func (r *rateLimitedBlockClient) DecompressBlocks(
+	ctx context.Context, input io.ReadCloser, parallelism int,
+) (io.ReadCloser, chan error) {
+	return r.blockClient.DecompressBlocks(ctx, &rateLimitedReadCloser{
+		rateLimitedReader: r.limit(ctx, input),
+		closer:            input,
+	}, parallelism)
+}
+
+// rateLimitedReader waits after each read until read bytes fit into the rate limit.
+type rateLimitedReader struct {
+	//nolint:containedctx // Reader is used by a single operation bound to this context.
+	ctx     context.Context
+	reader  io.Reader
+	limiter *rate.Limiter
+}
+
+func (r *rateLimitedReader) Read(p []byte) (int, error) {
+	if burst := r.limiter.Burst(); len(p) > burst {
+		p = p[:burst]
+	}
+
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		if waitErr := r.limiter.WaitN(r.ctx, n); waitErr != nil {
+			// Limiter fails early when waiting would exceed context deadline, without returning context error.
+			if r.ctx.Err() == nil {
+				waitErr = fmt.Errorf("%w: %v", context.DeadlineExceeded, waitErr) //nolint:errorlint // See above.
+			}
+
+			return n, fmt.Errorf("waiting for rate limit: %w", waitErr)
+		}
+	}
+
+	//nolint:wrapcheck // Do not hide the error from the underlying reader.
+	return n, err
+}
+
+// rateLimitedReadCloser is rateLimitedReader, which can be closed.
+type rateLimitedReadCloser struct {
+	*rateLimitedReader
+
+	closer io.Closer
+}
+
+// Close ...
+func (r *rateLimitedReadCloser) Close() error {
+	//nolint:wrapcheck // Do not hide the error from the underlying reader.
+	return r.closer.Close()
+}
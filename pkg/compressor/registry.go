@@ -0,0 +1,87 @@
+package compressor
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// DefaultRegistry holds built-in formats and formats registered by other packages. It is used by NewClient to
+// resolve configured format.
+//
+//nolint:gochecknoglobals // Allows registering formats from other packages, similar to image or database/sql.
+var DefaultRegistry = newDefaultRegistry()
+
+// Registry maps format names to functions creating configuration for given format.
+type Registry struct {
+	mu        sync.RWMutex
+	factories map[Format]func() Config
+}
+
+// NewRegistry creates empty registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		factories: map[Format]func() Config{},
+	}
+}
+
+func newDefaultRegistry() *Registry {
+	registry := NewRegistry()
+
+	registry.Register(string(FormatGzip), GzipConfig)
+	registry.Register(string(FormatNoop), NoopConfig)
+
+	return registry
+}
+
+// Register adds new format to the registry. It panics if factory is nil or if given format is already
+// registered.
+func (r *Registry) Register(name string, factory func() Config) {
+	if factory == nil {
+		panic(fmt.Sprintf("registering format %q: nil factory", name))
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.factories[Format(name)]; ok {
+		panic(fmt.Sprintf("registering format %q: format already registered", name))
+	}
+
+	r.factories[Format(name)] = factory
+}
+
+// Formats returns sorted list of registered formats.
+func (r *Registry) Formats() []Format {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	formats := make([]Format, 0, len(r.factories))
+
+	for format := range r.factories {
+		formats = append(formats, format)
+	}
+
+	sort.Slice(formats, func(i, j int) bool { return formats[i] < formats[j] })
+
+	return formats
+}
+
+// NewClientForFormat creates client using configuration of given registered format.
+func (r *Registry) NewClientForFormat(name string) (Client, error) {
+	factory, ok := r.factory(Format(name))
+	if !ok {
+		return nil, &UnknownFormatError{Format: name}
+	}
+
+	return NewClient(factory())
+}
+
+func (r *Registry) factory(format Format) (func() Config, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	factory, ok := r.factories[format]
+
+	return factory, ok
+}
@@ -0,0 +1,41 @@
+package compressor
+
+import (
+	"fmt"
+)
+
+// Reloader is implemented by clients, which can replace their configuration while running, e.g. to change
+// format of compressed data without restarting the program.
+type Reloader interface {
+	// Reload validates given configuration the same way as NewClient and uses it for all operations started
+	// afterwards. Operations started before reloading complete using the previous configuration.
+	Reload(Config) error
+}
+
+// Reload ...
+func (c *client) Reload(config Config) error {
+	reloaded, err := NewClient(config)
+	if err != nil {
+		return fmt.Errorf("creating client with new configuration: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	//nolint:forcetypeassert // NewClient always returns *client.
+	c.reloaded = reloaded.(*client)
+
+	return nil
+}
+
+// current returns client with the latest configuration, which should be used for operation started now.
+func (c *client) current() *client {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.reloaded == nil {
+		return c
+	}
+
+	return c.reloaded
+}
@@ -0,0 +1,148 @@
+package compressor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// RetryMiddleware retries Compress and Decompress when processing fails with an error, for which shouldRetry
+// returns true, e.g. transient network error when reading input from HTTP source. If shouldRetry is nil, all
+// errors are retried. Max attempts includes the first attempt. Input must implement io.ReadSeeker, so it can be
+// read again from the beginning, otherwise processing fails.
+//
+// Output already read by the caller is not repeated, as it is skipped when retrying. This requires wrapped client
+// to produce the same output for the same input, which is the case for built-in formats.
+func RetryMiddleware(maxAttempts int, shouldRetry func(error) bool) Middleware {
+	return func(client Client) Client {
+		return &retryClient{
+			Client:      client,
+			maxAttempts: maxAttempts,
+			shouldRetry: shouldRetry,
+		}
+	}
+}
+
+type retryClient struct {
+	Client
+
+	maxAttempts int
+	shouldRetry func(error) bool
+}
+
+// Compress ...
+func (r *retryClient) Compress(ctx context.Context, input io.ReadCloser) (io.ReadCloser, chan error) {
+	return retryProcessing(ctx, input, r.maxAttempts, r.shouldRetry, r.Client.Compress)
+}
+
+// Decompress ...
+func (r *retryClient) Decompress(ctx context.Context, input io.ReadCloser) (io.ReadCloser, chan error) {
+	return retryProcessing(ctx, input, r.maxAttempts, r.shouldRetry, r.Client.Decompress)
+}
+
+// Format ...
+func (r *retryClient) Format() Format {
+	return formatOf(r.Client)
+}
+
+// processFunc is a signature of Client methods processing data.
+type processFunc func(context.Context, io.ReadCloser) (io.ReadCloser, chan error)
+
+// retryProcessing runs given processing, retrying it from the beginning of input if it fails with retryable error.
+// Input is read again by every attempt, so it is only closed once all attempts finish.
+func retryProcessing(
+	ctx context.Context, input io.ReadCloser, maxAttempts int, shouldRetry func(error) bool, process processFunc,
+) (io.ReadCloser, chan error) {
+	// Middleware has no default context configured, so it falls back to background context.
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	outputReader, outputWriter := ContextPipe(ctx)
+
+	seeker, ok := input.(io.ReadSeeker)
+	if !ok {
+		err := fmt.Errorf("retrying requires input implementing io.ReadSeeker, got %T", input)
+
+		//nolint:errcheck // Closing pipe always returns nil.
+		outputWriter.CloseWithError(err)
+
+		return outputReader, runJob(closingInput(input, func() error { return err }))
+	}
+
+	retry := func(ctx context.Context, err error, attempt int) bool {
+		return attempt < maxAttempts &&
+			ctx.Err() == nil &&
+			!errors.Is(err, io.ErrClosedPipe) &&
+			(shouldRetry == nil || shouldRetry(err))
+	}
+
+	return outputReader, runJob(closingInput(input, func() error {
+		var delivered int64
+
+		for attempt := 1; ; attempt++ {
+			written, err := processAttempt(ctx, seeker, outputWriter, delivered, attempt, process)
+			delivered += written
+
+			if err == nil {
+				// Close writing to pipe, so reading from it does not block infinitely.
+				//
+				//nolint:errcheck // Closing pipe always returns nil.
+				outputWriter.Close()
+
+				return nil
+			}
+
+			if !retry(ctx, err, attempt) {
+				//nolint:errcheck // Closing pipe always returns nil.
+				outputWriter.CloseWithError(err)
+
+				return err
+			}
+		}
+	}))
+}
+
+// processAttempt processes input from the beginning, skipping given number of bytes of output, which have
+// already been delivered to the caller. It returns number of newly written bytes.
+func processAttempt(
+	ctx context.Context, input io.ReadSeeker, output io.Writer, delivered int64, attempt int, process processFunc,
+) (int64, error) {
+	if attempt > 1 {
+		if _, err := input.Seek(0, io.SeekStart); err != nil {
+			return 0, fmt.Errorf("seeking to the beginning of input: %w", err)
+		}
+	}
+
+	processed, errCh := process(ctx, io.NopCloser(input))
+
+	written := int64(0)
+
+	_, copyErr := io.CopyN(io.Discard, processed, delivered)
+	if copyErr == nil {
+		written, copyErr = StreamCopy(ctx, output, processed)
+	}
+
+	// Stop processing if copying failed, so processing result can be received.
+	//
+	//nolint:errcheck // Closing is only used to stop processing.
+	processed.Close()
+
+	err := <-errCh
+
+	// Caller stopped reading the output, so processing error is only a consequence of that.
+	if errors.Is(copyErr, io.ErrClosedPipe) {
+		return written, copyErr
+	}
+
+	if err != nil {
+		return written, err
+	}
+
+	if copyErr != nil {
+		return written, fmt.Errorf("copying output: %w", copyErr)
+	}
+
+	return written, nil
+}
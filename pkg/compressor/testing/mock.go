@@ -0,0 +1,112 @@
+// Package compressortesting provides test doubles for compressor clients, so packages consuming compressor.Client
+// do not need to implement their own.
+package compressortesting
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/invidian/golang-cli-testing-example/pkg/compressor"
+)
+
+// MockClient implements compressor.Client and compressor.BlockClient by transforming input with given functions.
+// Both regular and block operations use the same functions and parameters specific to block operations are ignored.
+type MockClient struct {
+	compress   func(io.Reader) io.Reader
+	decompress func(io.Reader) io.Reader
+}
+
+// NewMockClient creates mock client, which compresses and decompresses data using given functions. Nil
+// function passes input through unmodified.
+func NewMockClient(compress, decompress func(io.Reader) io.Reader) compressor.Client {
+	return &MockClient{
+		compress:   compress,
+		decompress: decompress,
+	}
+}
+
+// Compress ...
+//
+// As mock client does not process data in the background, input is closed once reading output fails, e.g. at the
+// end of data, or once output is closed.
+func (m *MockClient) Compress(ctx context.Context, input io.ReadCloser) (io.ReadCloser, chan error) {
+	output, errCh := process(ctx, input, m.compress)
+
+	return &inputClosingReader{ReadCloser: output, input: input}, errCh
+}
+
+// Decompress works like Compress.
+func (m *MockClient) Decompress(ctx context.Context, input io.ReadCloser) (io.ReadCloser, chan error) {
+	output, errCh := process(ctx, input, m.decompress)
+
+	return &inputClosingReader{ReadCloser: output, input: input}, errCh
+}
+
+// CompressBlocks works like Compress.
+func (m *MockClient) CompressBlocks(ctx context.Context, input io.ReadCloser, _, _ int) (io.ReadCloser, chan error) {
+	return m.Compress(ctx, input)
+}
+
+// DecompressBlocks works like Compress.
+func (m *MockClient) DecompressBlocks(ctx context.Context, input io.ReadCloser, _ int) (io.ReadCloser, chan error) {
+	return m.Decompress(ctx, input)
+}
+
+// Format returns empty format, as mock client does not use any real format.
+func (m *MockClient) Format() compressor.Format {
+	return ""
+}
+
+// process returns output of given function or reports canceled error if given context is already done.
+func process(ctx context.Context, input io.Reader, transform func(io.Reader) io.Reader) (io.ReadCloser, chan error) {
+	errCh := make(chan error, 1)
+	defer close(errCh)
+
+	if ctx != nil && ctx.Err() != nil {
+		errCh <- fmt.Errorf("%w: %w", compressor.ErrCanceled, ctx.Err())
+
+		return io.NopCloser(&bytes.Buffer{}), errCh
+	}
+
+	if transform == nil {
+		return io.NopCloser(input), errCh
+	}
+
+	return io.NopCloser(transform(input)), errCh
+}
+
+// inputClosingReader closes input once reading from the underlying reader fails or once it is closed.
+type inputClosingReader struct {
+	io.ReadCloser
+
+	input io.Closer
+	once  sync.Once
+}
+
+func (r *inputClosingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if err != nil {
+		r.closeInput()
+	}
+
+	//nolint:wrapcheck // Do not hide the error from the underlying reader.
+	return n, err
+}
+
+// Close ...
+func (r *inputClosingReader) Close() error {
+	r.closeInput()
+
+	//nolint:wrapcheck // Do not hide the error from the underlying reader.
+	return r.ReadCloser.Close()
+}
+
+func (r *inputClosingReader) closeInput() {
+	r.once.Do(func() {
+		//nolint:errcheck // Input is only read, so closing errors can be ignored.
+		r.input.Close()
+	})
+}
@@ -0,0 +1,123 @@
+package compressortesting_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/invidian/golang-cli-testing-example/internal/testutil"
+	"github.com/invidian/golang-cli-testing-example/pkg/compressor"
+	compressortesting "github.com/invidian/golang-cli-testing-example/pkg/compressor/testing"
+)
+
+func Test_Mock_client_transforms_data_using_given_functions(t *testing.T) {
+	t.Parallel()
+
+	upper := func(input io.Reader) io.Reader {
+		data, _ := io.ReadAll(input) //nolint:errcheck // Input is always strings.Reader.
+
+		return bytes.NewReader(bytes.ToUpper(data))
+	}
+
+	client := compressortesting.NewMockClient(upper, nil)
+
+	blockClient, ok := client.(compressor.BlockClient)
+	if !ok {
+		t.Fatalf("Expected mock client to implement BlockClient")
+	}
+
+	ctx := testutil.ContextWithDeadline(t)
+
+	for name, process := range map[string]func(io.Reader) (io.Reader, chan error){
+		"when_compressing": func(input io.Reader) (io.Reader, chan error) {
+			return client.Compress(ctx, io.NopCloser(input))
+		},
+		"when_compressing_blocks": func(input io.Reader) (io.Reader, chan error) {
+			return blockClient.CompressBlocks(ctx, io.NopCloser(input), 1, 1)
+		},
+	} {
+		process := process
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			output, errCh := process(strings.NewReader(testData))
+
+			requireOutput(t, output, errCh, strings.ToUpper(testData))
+		})
+	}
+
+	for name, process := range map[string]func(io.Reader) (io.Reader, chan error){
+		"passes_data_through_when_decompressing_without_function": func(input io.Reader) (io.Reader, chan error) {
+			return client.Decompress(ctx, io.NopCloser(input))
+		},
+		"passes_data_through_when_decompressing_blocks_without_function": func(input io.Reader) (io.Reader, chan error) {
+			return blockClient.DecompressBlocks(ctx, io.NopCloser(input), 1)
+		},
+	} {
+		process := process
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			output, errCh := process(strings.NewReader(testData))
+
+			requireOutput(t, output, errCh, testData)
+		})
+	}
+}
+
+func Test_Mock_client_returns_canceled_error_when_given_context_is_cancelled(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(testutil.ContextWithDeadline(t))
+	cancel()
+
+	client := compressortesting.NewMockClient(nil, nil)
+
+	output, errCh := client.Compress(ctx, io.NopCloser(strings.NewReader(testData)))
+
+	if data, err := io.ReadAll(output); err != nil || len(data) != 0 {
+		t.Fatalf("Expected no output, got %q, error: %v", data, err)
+	}
+
+	err := <-errCh
+	if !errors.Is(err, compressor.ErrCanceled) || !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected canceled error, got %v", err)
+	}
+}
+
+func Test_Mock_client_reports_empty_format(t *testing.T) {
+	t.Parallel()
+
+	reporter, ok := compressortesting.NewMockClient(nil, nil).(compressor.FormatReporter)
+	if !ok {
+		t.Fatalf("Expected mock client to implement FormatReporter")
+	}
+
+	if format := reporter.Format(); format != "" {
+		t.Fatalf("Expected empty format, got %q", format)
+	}
+}
+
+func requireOutput(t *testing.T, output io.Reader, errCh chan error, expected string) {
+	t.Helper()
+
+	data, err := io.ReadAll(output)
+	if err != nil {
+		t.Fatalf("Unexpected error reading output: %v", err)
+	}
+
+	if err := <-errCh; err != nil {
+		t.Fatalf("Unexpected processing error: %v", err)
+	}
+
+	if string(data) != expected {
+		t.Fatalf("Expected output %q, got %q", expected, data)
+	}
+}
+
+const testData = "foo"
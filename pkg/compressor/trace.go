@@ -0,0 +1,40 @@
+package compressor
+
+import (
+	"context"
+)
+
+const (
+	// SpanNameCompress is name of the span started by Tracer for compression.
+	SpanNameCompress = "compressor.Compress"
+	// SpanNameDecompress is name of the span started by Tracer for decompression.
+	SpanNameDecompress = "compressor.Decompress"
+
+	// AttributeFormat is span attribute holding configured format.
+	AttributeFormat = "compression.format"
+	// AttributeInputBytes is span attribute holding number of bytes consumed from the input.
+	AttributeInputBytes = "compression.input_bytes"
+	// AttributeOutputBytes is span attribute holding number of bytes produced.
+	AttributeOutputBytes = "compression.output_bytes"
+)
+
+// Tracer starts spans for compression and decompression. It allows integrating tracing libraries like
+// OpenTelemetry without making this package depend on them. E.g. OpenTelemetry adapter may start child span
+// only when given context carries a recording span.
+type Tracer interface {
+	Start(ctx context.Context, spanName string) (context.Context, Span)
+}
+
+// Span represents single traced compression or decompression.
+type Span interface {
+	// SetAttributes records given attributes on the span. Attribute values are either strings or int64.
+	SetAttributes(attributes ...Attribute)
+	// End finishes the span. Error is nil when processing succeeded.
+	End(err error)
+}
+
+// Attribute is a single span attribute.
+type Attribute struct {
+	Key   string
+	Value interface{}
+}